@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/services"
+)
+
+// commandServices are the services available to subcommands
+type commandServices struct {
+	backfill services.BackfillService
+	users    services.UserService
+	audit    services.AuditService
+}
+
+// runCommand runs a command-line subcommand instead of starting the server
+func runCommand(name string, args []string, deps commandServices) error {
+	switch name {
+	case "backfill":
+		return runBackfill(args, deps.backfill)
+	case "set-role":
+		return runSetRole(args, deps.users, deps.audit)
+	case "verify-audit":
+		return runVerifyAudit(deps.audit)
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+// runBackfill loads historical rates for a date range, or resumes an earlier job:
+//
+//	backfill -provider cbn -start 2021-01-01 -end 2023-12-31
+//	backfill -resume 12
+func runBackfill(args []string, service services.BackfillService) error {
+	flags := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	provider := flags.String("provider", "", "rate provider to load from (default: the configured default provider)")
+	startStr := flags.String("start", "", "first date to load, YYYY-MM-DD")
+	endStr := flags.String("end", "", "last date to load, YYYY-MM-DD (default: yesterday)")
+	resume := flags.Uint("resume", 0, "ID of an earlier backfill job to continue")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	id := *resume
+	if id == 0 {
+		start, err := time.Parse("2006-01-02", *startStr)
+		if err != nil {
+			return fmt.Errorf("invalid -start date %q, expected YYYY-MM-DD", *startStr)
+		}
+		end := time.Now().UTC().AddDate(0, 0, -1)
+		if *endStr != "" {
+			if end, err = time.Parse("2006-01-02", *endStr); err != nil {
+				return fmt.Errorf("invalid -end date %q, expected YYYY-MM-DD", *endStr)
+			}
+		}
+
+		job, err := service.CreateBackfill(*provider, start, end)
+		if err != nil {
+			return err
+		}
+		id = job.ID
+		fmt.Printf("Created backfill job %d (%s, %s to %s, %d days)\n",
+			job.ID, job.Provider, job.StartDate.Format("2006-01-02"), job.EndDate.Format("2006-01-02"), job.TotalDays)
+	}
+
+	job, err := service.RunBackfill(id)
+	if err != nil {
+		return fmt.Errorf("backfill job %d stopped: %v (resume with -resume %d)", id, err, id)
+	}
+
+	fmt.Printf("Backfill job %d %s: %d fetched, %d skipped, %d failed\n",
+		job.ID, job.Status, job.FetchedDays, job.SkippedDays, job.FailedDays)
+	return nil
+}
+
+// runSetRole assigns a role from the command line, which is how the first admin is
+// created since roles can otherwise only be changed by an admin:
+//
+//	set-role -username jdoe -role admin
+func runSetRole(args []string, service services.UserService, audit services.AuditService) error {
+	flags := flag.NewFlagSet("set-role", flag.ContinueOnError)
+	username := flags.String("username", "", "user to update")
+	roleName := flags.String("role", "", "viewer, analyst, auditor, rate-publisher or admin")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	role, err := models.ParseRole(*roleName)
+	if err != nil {
+		return err
+	}
+
+	user, err := service.ChangeRole("", *username, role)
+	if err != nil {
+		return err
+	}
+
+	audit.RecordLogged(models.AuditEntry{
+		Type:    models.AuditRoleChanged,
+		Actor:   models.AuditCommandActor,
+		MdaID:   user.MdaID,
+		Target:  user.Username,
+		Details: map[string]interface{}{"role": user.Role},
+	})
+
+	fmt.Printf("User %s now has role %s\n", user.Username, user.Role)
+	return nil
+}
+
+// runVerifyAudit checks the hash chain of the audit log and fails if it is broken:
+//
+//	verify-audit
+func runVerifyAudit(audit services.AuditService) error {
+	result, err := audit.Verify()
+	if err != nil {
+		return err
+	}
+
+	if !result.Valid {
+		return fmt.Errorf("audit chain is broken at event %d: %s (%d events before it verified)",
+			result.FirstInvalidID, result.Problem, result.Checked)
+	}
+
+	fmt.Printf("Audit chain verified: %d events\n", result.Checked)
+	return nil
+}
@@ -0,0 +1,102 @@
+// internal/cache/cache.go
+
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Cache is a read-through store of encoded values under string keys. Every entry can
+// be dropped at once with Invalidate, which is how readers are kept from seeing data
+// older than the last write. A value loaded while an invalidation happens is returned
+// but not kept, so that it cannot outlive the write.
+type Cache interface {
+	GetOrLoad(key string, load func() ([]byte, error)) ([]byte, error)
+	Invalidate() error
+	Stats() Stats
+}
+
+// Stats counts cache activity since the process started
+type Stats struct {
+	Backend       string    `json:"backend"`
+	Hits          uint64    `json:"hits"`
+	Misses        uint64    `json:"misses"`
+	Errors        uint64    `json:"errors"`
+	Invalidations uint64    `json:"invalidations"`
+	HitRatio      float64   `json:"hit_ratio"` // Hits over lookups; zero before the first lookup
+	Since         time.Time `json:"since"`
+}
+
+// counters tracks the statistics shared by every backend
+type counters struct {
+	backend       string
+	since         time.Time
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	errors        atomic.Uint64
+	invalidations atomic.Uint64
+}
+
+// newCounters starts counting for the named backend
+func newCounters(backend string) *counters {
+	return &counters{backend: backend, since: time.Now().UTC()}
+}
+
+// hit counts a lookup answered from the cache
+func (c *counters) hit() {
+	c.hits.Add(1)
+}
+
+// miss counts a lookup that had to load the value
+func (c *counters) miss() {
+	c.misses.Add(1)
+}
+
+// failure counts an error talking to the backend
+func (c *counters) failure() {
+	c.errors.Add(1)
+}
+
+// stats returns a snapshot of the counters
+func (c *counters) stats() Stats {
+	stats := Stats{
+		Backend:       c.backend,
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Errors:        c.errors.Load(),
+		Invalidations: c.invalidations.Load(),
+		Since:         c.since,
+	}
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(lookups)
+	}
+	return stats
+}
+
+// noopCache never stores anything, for deployments with caching turned off
+type noopCache struct {
+	counters *counters
+}
+
+// NewNoop creates a Cache that misses on every lookup
+func NewNoop() Cache {
+	return &noopCache{counters: newCounters("none")}
+}
+
+// GetOrLoad always loads the value
+func (c *noopCache) GetOrLoad(key string, load func() ([]byte, error)) ([]byte, error) {
+	c.counters.miss()
+	return load()
+}
+
+// Invalidate has nothing to drop
+func (c *noopCache) Invalidate() error {
+	c.counters.invalidations.Add(1)
+	return nil
+}
+
+// Stats returns the lookups counted so far
+func (c *noopCache) Stats() Stats {
+	return c.counters.stats()
+}
@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestRedis returns a client of an in-process Redis server that is closed with the test
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, redis.UniversalClient) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return server, client
+}
+
+// testBackends creates an empty cache of each backend
+var testBackends = map[string]func(t *testing.T) Cache{
+	"memory": func(t *testing.T) Cache { return NewMemory(time.Minute, 0) },
+	"redis": func(t *testing.T) Cache {
+		_, client := newTestRedis(t)
+		return NewRedis(client, "test", time.Minute)
+	},
+}
+
+// loader counts the loads of a value
+type loader struct {
+	value string
+	loads int
+}
+
+func (l *loader) load() ([]byte, error) {
+	l.loads++
+	return []byte(l.value), nil
+}
+
+func TestGetOrLoad(t *testing.T) {
+	for name, newCache := range testBackends {
+		t.Run(name, func(t *testing.T) {
+			c := newCache(t)
+			rates := &loader{value: "v1"}
+
+			for i := 0; i < 3; i++ {
+				value, err := c.GetOrLoad("latest:NGN", rates.load)
+				if err != nil || string(value) != "v1" {
+					t.Fatalf("lookup %d = %q, %v; want v1", i+1, value, err)
+				}
+			}
+			if rates.loads != 1 {
+				t.Errorf("loaded %d times, want once", rates.loads)
+			}
+
+			// A failed load is returned and not stored
+			loadErr := errors.New("database down")
+			if _, err := c.GetOrLoad("latest:USD", func() ([]byte, error) { return nil, loadErr }); !errors.Is(err, loadErr) {
+				t.Errorf("err = %v, want the load error", err)
+			}
+			usd := &loader{value: "u1"}
+			if value, _ := c.GetOrLoad("latest:USD", usd.load); string(value) != "u1" || usd.loads != 1 {
+				t.Errorf("after a failed load got %q with %d loads, want u1 loaded once", value, usd.loads)
+			}
+
+			if err := c.Invalidate(); err != nil {
+				t.Fatalf("Invalidate: %v", err)
+			}
+			rates.value = "v2"
+			if value, _ := c.GetOrLoad("latest:NGN", rates.load); string(value) != "v2" || rates.loads != 2 {
+				t.Errorf("after invalidation got %q with %d loads, want v2 reloaded", value, rates.loads)
+			}
+
+			stats := c.Stats()
+			if stats.Backend != name || stats.Hits != 2 || stats.Misses != 4 || stats.Invalidations != 1 {
+				t.Errorf("stats = %+v", stats)
+			}
+		})
+	}
+}
+
+func TestValueLoadedAcrossInvalidationIsNotKept(t *testing.T) {
+	for name, newCache := range testBackends {
+		t.Run(name, func(t *testing.T) {
+			c := newCache(t)
+
+			// New rates are stored and the cache invalidated while a stale value loads
+			value, err := c.GetOrLoad("latest:NGN", func() ([]byte, error) {
+				if err := c.Invalidate(); err != nil {
+					t.Fatal(err)
+				}
+				return []byte("stale"), nil
+			})
+			if err != nil || string(value) != "stale" {
+				t.Fatalf("got %q, %v; want the loaded value returned", value, err)
+			}
+
+			fresh := &loader{value: "fresh"}
+			if value, _ := c.GetOrLoad("latest:NGN", fresh.load); string(value) != "fresh" || fresh.loads != 1 {
+				t.Errorf("got %q with %d loads, want the stale value dropped", value, fresh.loads)
+			}
+		})
+	}
+}
+
+func TestRedisInvalidationReachesEveryReplica(t *testing.T) {
+	server, client := newTestRedis(t)
+	first := NewRedis(client, "test", time.Minute)
+	other := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer other.Close()
+	second := NewRedis(other, "test", time.Minute)
+
+	rates := &loader{value: "v1"}
+	for _, replica := range []Cache{first, second} {
+		if value, err := replica.GetOrLoad("latest:NGN", rates.load); err != nil || string(value) != "v1" {
+			t.Fatalf("got %q, %v; want v1", value, err)
+		}
+	}
+	if rates.loads != 1 {
+		t.Errorf("loaded %d times, want the second replica to read the first one's entry", rates.loads)
+	}
+
+	if err := first.Invalidate(); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+	if generation, _ := server.Get("test:generation"); generation != "1" {
+		t.Errorf("generation = %q, want 1", generation)
+	}
+
+	rates.value = "v2"
+	if value, _ := second.GetOrLoad("latest:NGN", rates.load); string(value) != "v2" || rates.loads != 2 {
+		t.Errorf("second replica got %q with %d loads, want v2 reloaded", value, rates.loads)
+	}
+	if value, _ := first.GetOrLoad("latest:NGN", rates.load); string(value) != "v2" || rates.loads != 2 {
+		t.Errorf("first replica got %q with %d loads, want the second one's entry", value, rates.loads)
+	}
+}
+
+func TestRedisExpiresEntries(t *testing.T) {
+	server, client := newTestRedis(t)
+	c := NewRedis(client, "test", time.Minute)
+
+	rates := &loader{value: "v1"}
+	c.GetOrLoad("latest:NGN", rates.load)
+	server.FastForward(time.Minute + time.Second)
+	c.GetOrLoad("latest:NGN", rates.load)
+	if rates.loads != 2 {
+		t.Errorf("loaded %d times, want the expired entry reloaded", rates.loads)
+	}
+}
+
+func TestRedisUnavailableLoadsDirectly(t *testing.T) {
+	server, client := newTestRedis(t)
+	c := NewRedis(client, "test", time.Minute)
+	server.Close()
+
+	rates := &loader{value: "v1"}
+	for i := 0; i < 2; i++ {
+		if value, err := c.GetOrLoad("latest:NGN", rates.load); err != nil || string(value) != "v1" {
+			t.Fatalf("got %q, %v; want the loaded value", value, err)
+		}
+	}
+	if rates.loads != 2 {
+		t.Errorf("loaded %d times, want every lookup loaded", rates.loads)
+	}
+	if err := c.Invalidate(); err == nil {
+		t.Error("Invalidate succeeded without a server")
+	}
+	if stats := c.Stats(); stats.Errors != 3 || stats.Misses != 2 {
+		t.Errorf("stats = %+v, want 3 errors and 2 misses", stats)
+	}
+}
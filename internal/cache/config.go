@@ -0,0 +1,43 @@
+// internal/cache/config.go
+
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+)
+
+// NewFromConfig builds the rate cache for the configured driver: memory, redis or none
+func NewFromConfig() (Cache, error) {
+	ttl := viper.GetDuration("rate_cache.ttl")
+	if ttl <= 0 {
+		ttl = 10 * time.Minute
+	}
+
+	switch driver := viper.GetString("rate_cache.driver"); driver {
+	case "", "memory":
+		return NewMemory(ttl, viper.GetInt("rate_cache.max_entries")), nil
+	case "redis":
+		addr := viper.GetString("rate_cache.redis.addr")
+		if addr == "" {
+			return nil, fmt.Errorf("rate_cache.redis.addr is required for the redis driver")
+		}
+		prefix := viper.GetString("rate_cache.redis.prefix")
+		if prefix == "" {
+			prefix = "exchange-rates:cache"
+		}
+		client := redis.NewClient(&redis.Options{
+			Addr:     addr,
+			Password: viper.GetString("rate_cache.redis.password"),
+			DB:       viper.GetInt("rate_cache.redis.db"),
+		})
+		return NewRedis(client, prefix, ttl), nil
+	case "none":
+		return NewNoop(), nil
+	default:
+		return nil, fmt.Errorf("unknown rate_cache driver %q", driver)
+	}
+}
@@ -0,0 +1,89 @@
+// internal/cache/memory.go
+
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// memoryEntry is a value held by the in-memory cache
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// memoryCache keeps entries in a map local to the process
+type memoryCache struct {
+	mu         sync.RWMutex
+	entries    map[string]memoryEntry
+	generation uint64 // Incremented by Invalidate
+	ttl        time.Duration
+	maxEntries int
+	counters   *counters
+}
+
+// NewMemory creates a Cache held in the process's memory. Entries expire after ttl
+// (zero keeps them until invalidated); once maxEntries are held (zero for no limit)
+// everything is dropped rather than tracking recency, since the cache is rebuilt
+// cheaply and cleared on every ingestion anyway.
+func NewMemory(ttl time.Duration, maxEntries int) Cache {
+	return &memoryCache{
+		entries:    make(map[string]memoryEntry),
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		counters:   newCounters("memory"),
+	}
+}
+
+// GetOrLoad returns the unexpired value stored under the key, loading and storing it
+// on a miss
+func (c *memoryCache) GetOrLoad(key string, load func() ([]byte, error)) ([]byte, error) {
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	generation := c.generation
+	c.mu.RUnlock()
+
+	if ok && (entry.expiresAt.IsZero() || time.Now().Before(entry.expiresAt)) {
+		c.counters.hit()
+		return entry.value, nil
+	}
+	c.counters.miss()
+
+	value, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	entry = memoryEntry{value: value}
+	if c.ttl > 0 {
+		entry.expiresAt = time.Now().Add(c.ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != generation {
+		return value, nil
+	}
+	if c.maxEntries > 0 && len(c.entries) >= c.maxEntries {
+		c.entries = make(map[string]memoryEntry)
+	}
+	c.entries[key] = entry
+	return value, nil
+}
+
+// Invalidate drops every entry
+func (c *memoryCache) Invalidate() error {
+	c.mu.Lock()
+	c.entries = make(map[string]memoryEntry)
+	c.generation++
+	c.mu.Unlock()
+
+	c.counters.invalidations.Add(1)
+	return nil
+}
+
+// Stats returns the lookups counted so far
+func (c *memoryCache) Stats() Stats {
+	return c.counters.stats()
+}
@@ -0,0 +1,118 @@
+// internal/cache/redis.go
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisTimeout bounds every round trip, so that a slow Redis degrades to cache misses
+// rather than slow requests
+const redisTimeout = 500 * time.Millisecond
+
+// redisCache keeps entries in Redis, or any server speaking its protocol, so that
+// several replicas share them. Keys are namespaced by a generation counter: Invalidate
+// increments it, which makes every replica stop reading the older entries at once; they
+// are then left to expire.
+type redisCache struct {
+	client   redis.UniversalClient
+	prefix   string
+	ttl      time.Duration
+	counters *counters
+}
+
+// NewRedis creates a Cache stored through the client under keys starting with prefix.
+// Entries expire after ttl, which should be set since invalidated entries are only
+// removed by expiry. The client may point at an in-process fake such as miniredis.
+func NewRedis(client redis.UniversalClient, prefix string, ttl time.Duration) Cache {
+	return &redisCache{client: client, prefix: prefix, ttl: ttl, counters: newCounters("redis")}
+}
+
+// GetOrLoad returns the value stored under the key in the current generation, loading
+// and storing it on a miss. The value is stored in the generation read before loading,
+// so a value loaded across an invalidation is never seen again. When Redis cannot be
+// reached the value is loaded directly.
+func (c *redisCache) GetOrLoad(key string, load func() ([]byte, error)) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	generation, err := c.generation(ctx)
+	if err != nil {
+		c.counters.failure()
+		c.counters.miss()
+		log.Printf("Rate cache unavailable: %v", err)
+		return load()
+	}
+
+	entryKey := c.entryKey(generation, key)
+	value, err := c.client.Get(ctx, entryKey).Bytes()
+	if err == nil {
+		c.counters.hit()
+		return value, nil
+	}
+	if !errors.Is(err, redis.Nil) {
+		c.counters.failure()
+		log.Printf("Rate cache unavailable: failed to read cache entry: %v", err)
+	}
+	c.counters.miss()
+
+	value, err = load()
+	if err != nil {
+		return nil, err
+	}
+
+	// The load may have outlived the request timeout, so the write gets its own
+	ctx, cancel = context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := c.client.Set(ctx, entryKey, value, c.ttl).Err(); err != nil {
+		c.counters.failure()
+		log.Printf("Rate cache unavailable: failed to write cache entry: %v", err)
+	}
+	return value, nil
+}
+
+// Invalidate starts a new generation, hiding every existing entry from all replicas
+func (c *redisCache) Invalidate() error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	if err := c.client.Incr(ctx, c.generationKey()).Err(); err != nil {
+		c.counters.failure()
+		return fmt.Errorf("failed to invalidate cache: %v", err)
+	}
+	c.counters.invalidations.Add(1)
+	return nil
+}
+
+// Stats returns the lookups counted by this replica so far
+func (c *redisCache) Stats() Stats {
+	return c.counters.stats()
+}
+
+// generation reads the current generation; a missing counter is generation zero
+func (c *redisCache) generation(ctx context.Context) (int64, error) {
+	generation, err := c.client.Get(ctx, c.generationKey()).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read cache generation: %v", err)
+	}
+	return generation, nil
+}
+
+// generationKey is the key of the generation counter
+func (c *redisCache) generationKey() string {
+	return c.prefix + ":generation"
+}
+
+// entryKey is the key of an entry in a generation
+func (c *redisCache) entryKey(generation int64, key string) string {
+	return fmt.Sprintf("%s:%d:%s", c.prefix, generation, key)
+}
@@ -0,0 +1,212 @@
+// internal/controllers/api_key_controller.go
+
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/services"
+	"github.com/abduls21985/exchange-rate-service/internal/utils"
+	"github.com/abduls21985/exchange-rate-service/pkg/middleware"
+	"github.com/gorilla/mux"
+)
+
+// APIKeyController handles HTTP requests for managing the caller's API keys
+type APIKeyController struct {
+	Service services.APIKeyService
+	Audit   services.AuditService
+}
+
+// NewAPIKeyController creates a new APIKeyController
+func NewAPIKeyController(service services.APIKeyService, audit services.AuditService) *APIKeyController {
+	return &APIKeyController{Service: service, Audit: audit}
+}
+
+// apiKeyRequest is the payload for creating or updating an API key
+type apiKeyRequest struct {
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	AllowedIPs []string   `json:"allowed_ips"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+// toSettings maps the request onto API key settings
+func (req apiKeyRequest) toSettings() models.APIKeySettings {
+	return models.APIKeySettings{
+		Name:       req.Name,
+		Scopes:     req.Scopes,
+		AllowedIPs: req.AllowedIPs,
+		ExpiresAt:  req.ExpiresAt,
+	}
+}
+
+// CreateAPIKey handles POST /api/api-keys. The key is only ever shown in this response.
+func (c *APIKeyController) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		utils.JSONResponse(w, map[string]string{"error": "Authentication required"}, http.StatusUnauthorized)
+		return
+	}
+
+	var req apiKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JSONResponse(w, map[string]string{"error": "Invalid request payload"}, http.StatusBadRequest)
+		return
+	}
+
+	key, plain, err := c.Service.CreateAPIKey(principal.Username, req.toSettings())
+	if errors.Is(err, services.ErrInvalidAPIKeySettings) {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating API key for %s: %v", principal.Username, err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	c.recordKey(r, models.AuditAPIKeyCreated, key)
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   key,
+		"key":    plain,
+		"status": "API key created successfully; store the key now, it will not be shown again",
+	}, http.StatusCreated)
+}
+
+// ListAPIKeys handles GET /api/api-keys
+func (c *APIKeyController) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		utils.JSONResponse(w, map[string]string{"error": "Authentication required"}, http.StatusUnauthorized)
+		return
+	}
+
+	keys, err := c.Service.ListAPIKeys(principal.Username)
+	if err != nil {
+		log.Printf("Error listing API keys of %s: %v", principal.Username, err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   keys,
+		"status": "API keys retrieved successfully",
+	}, http.StatusOK)
+}
+
+// GetAPIKey handles GET /api/api-keys/{id}
+func (c *APIKeyController) GetAPIKey(w http.ResponseWriter, r *http.Request) {
+	principal, id, ok := c.keyRequest(w, r)
+	if !ok {
+		return
+	}
+
+	key, err := c.Service.GetAPIKey(principal.Username, id)
+	if errors.Is(err, services.ErrAPIKeyNotFound) {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error retrieving API key %d: %v", id, err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   key,
+		"status": "API key retrieved successfully",
+	}, http.StatusOK)
+}
+
+// UpdateAPIKey handles PUT /api/api-keys/{id}
+func (c *APIKeyController) UpdateAPIKey(w http.ResponseWriter, r *http.Request) {
+	principal, id, ok := c.keyRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req apiKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JSONResponse(w, map[string]string{"error": "Invalid request payload"}, http.StatusBadRequest)
+		return
+	}
+
+	key, err := c.Service.UpdateAPIKey(principal.Username, id, req.toSettings())
+	switch {
+	case errors.Is(err, services.ErrAPIKeyNotFound):
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusNotFound)
+		return
+	case errors.Is(err, services.ErrInvalidAPIKeySettings):
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Printf("Error updating API key %d: %v", id, err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	c.recordKey(r, models.AuditAPIKeyUpdated, key)
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   key,
+		"status": "API key updated successfully",
+	}, http.StatusOK)
+}
+
+// DeleteAPIKey handles DELETE /api/api-keys/{id}
+func (c *APIKeyController) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	principal, id, ok := c.keyRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err := c.Service.DeleteAPIKey(principal.Username, id)
+	if errors.Is(err, services.ErrAPIKeyNotFound) {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting API key %d: %v", id, err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	c.Audit.RecordLogged(auditEntry(r, models.AuditAPIKeyDeleted, strconv.FormatUint(uint64(id), 10), nil))
+
+	utils.JSONResponse(w, map[string]string{"status": "API key deleted successfully"}, http.StatusOK)
+}
+
+// keyRequest reads the principal and the key ID from the path, writing the error
+// response itself when either is missing
+func (c *APIKeyController) keyRequest(w http.ResponseWriter, r *http.Request) (*middleware.Principal, uint, bool) {
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		utils.JSONResponse(w, map[string]string{"error": "Authentication required"}, http.StatusUnauthorized)
+		return nil, 0, false
+	}
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		utils.JSONResponse(w, map[string]string{"error": "Invalid API key ID"}, http.StatusBadRequest)
+		return nil, 0, false
+	}
+	return principal, uint(id), true
+}
+
+// recordKey audits the creation or change of an API key
+func (c *APIKeyController) recordKey(r *http.Request, eventType string, key *models.APIKey) {
+	c.Audit.RecordLogged(auditEntry(r, eventType, strconv.FormatUint(uint64(key.ID), 10), map[string]interface{}{
+		"prefix":      key.Prefix,
+		"name":        key.Name,
+		"scopes":      key.Scopes,
+		"allowed_ips": key.AllowedIPs,
+		"expires_at":  key.ExpiresAt,
+	}))
+}
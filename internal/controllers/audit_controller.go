@@ -0,0 +1,202 @@
+// internal/controllers/audit_controller.go
+
+package controllers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/services"
+	"github.com/abduls21985/exchange-rate-service/internal/utils"
+	"github.com/abduls21985/exchange-rate-service/pkg/middleware"
+)
+
+// AuditController handles HTTP requests for querying and exporting the audit log
+type AuditController struct {
+	Service services.AuditService
+}
+
+// NewAuditController creates a new AuditController
+func NewAuditController(service services.AuditService) *AuditController {
+	return &AuditController{Service: service}
+}
+
+// ListEvents handles GET /api/audit-events?type=&actor=&target=&from=&to=&mda=&limit=&offset=
+func (c *AuditController) ListEvents(w http.ResponseWriter, r *http.Request) {
+	filter, ok := auditFilter(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	limit, offset, err := parsePagination(query.Get("limit"), query.Get("offset"))
+	if err != nil {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	}
+	filter.Limit = limit
+	filter.Offset = offset
+
+	events, total, err := c.Service.ListEvents(filter)
+	if err != nil {
+		log.Printf("Error listing audit events: %v", err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   events,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+		"status": "Audit events fetched successfully",
+	}, http.StatusOK)
+}
+
+// ExportEvents handles GET /api/audit-events/export, streaming the matching events as
+// CSV in chain order so that the export can be checked offline
+func (c *AuditController) ExportEvents(w http.ResponseWriter, r *http.Request) {
+	filter, ok := auditFilter(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-events-%s.csv"`, time.Now().UTC().Format("20060102T150405Z")))
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"id", "occurred_at", "type", "actor", "actor_id", "mda_id", "target", "ip_address", "details", "prev_hash", "hash"})
+
+	err := c.Service.ExportEvents(filter, func(event *models.AuditEvent) error {
+		actorID := ""
+		if event.ActorID != nil {
+			actorID = strconv.FormatUint(uint64(*event.ActorID), 10)
+		}
+		return writer.Write([]string{
+			strconv.FormatUint(uint64(event.ID), 10),
+			event.OccurredAt.UTC().Format(time.RFC3339Nano),
+			event.Type,
+			event.Actor,
+			actorID,
+			event.MdaID,
+			event.Target,
+			event.IPAddress,
+			string(event.Details),
+			event.PrevHash,
+			event.Hash,
+		})
+	})
+	writer.Flush()
+
+	// The status has already been sent, so a failure can only truncate the export
+	if err == nil {
+		err = writer.Error()
+	}
+	if err != nil {
+		log.Printf("Error exporting audit events: %v", err)
+	}
+}
+
+// VerifyChain handles GET /api/audit-events/verify
+func (c *AuditController) VerifyChain(w http.ResponseWriter, r *http.Request) {
+	result, err := c.Service.Verify()
+	if err != nil {
+		log.Printf("Error verifying audit chain: %v", err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   result,
+		"status": "Audit chain verified",
+	}, http.StatusOK)
+}
+
+// auditFilter reads the filter shared by the list and export endpoints. Auditors of an
+// MDA only ever see their MDA's events; platform auditors may pick one with ?mda=.
+func auditFilter(w http.ResponseWriter, r *http.Request) (models.AuditFilter, bool) {
+	query := r.URL.Query()
+	filter := models.AuditFilter{
+		Type:   query.Get("type"),
+		Actor:  query.Get("actor"),
+		Target: query.Get("target"),
+	}
+
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		utils.JSONResponse(w, map[string]string{"error": "Authentication required"}, http.StatusUnauthorized)
+		return filter, false
+	}
+	if principal.MdaID != "" {
+		filter.MdaID = &principal.MdaID
+	} else if query.Has("mda") {
+		mdaID := query.Get("mda")
+		filter.MdaID = &mdaID
+	}
+
+	var err error
+	if filter.From, err = parseAuditTime(query.Get("from")); err != nil {
+		utils.JSONResponse(w, map[string]string{"error": "Invalid from, expected YYYY-MM-DD or RFC 3339"}, http.StatusBadRequest)
+		return filter, false
+	}
+	if filter.To, err = parseAuditTime(query.Get("to")); err != nil {
+		utils.JSONResponse(w, map[string]string{"error": "Invalid to, expected YYYY-MM-DD or RFC 3339"}, http.StatusBadRequest)
+		return filter, false
+	}
+
+	return filter, true
+}
+
+// parseAuditTime accepts a date or an RFC 3339 timestamp; an empty value means no bound
+func parseAuditTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		if t, err = time.Parse(time.RFC3339, value); err != nil {
+			return nil, err
+		}
+	}
+	return &t, nil
+}
+
+// auditEntry builds an audit entry for an action taken by the request's principal
+func auditEntry(r *http.Request, eventType, target string, details map[string]interface{}) models.AuditEntry {
+	entry := models.AuditEntry{
+		Type:      eventType,
+		Target:    target,
+		IPAddress: middleware.ClientIP(r),
+		Details:   details,
+	}
+	if principal, ok := middleware.PrincipalFromContext(r.Context()); ok {
+		entry.Actor = principal.Username
+		entry.ActorID = principal.UserID
+		entry.MdaID = principal.MdaID
+		if principal.Kind == middleware.PrincipalAPIKey {
+			if entry.Details == nil {
+				entry.Details = map[string]interface{}{}
+			}
+			entry.Details["api_key_id"] = principal.APIKeyID
+		}
+	}
+	return entry
+}
+
+// auditUserEntry builds an audit entry for an action on a user. The event belongs to
+// the user's MDA, and requests without a principal, such as logins, are attributed to
+// the user themselves.
+func auditUserEntry(r *http.Request, eventType string, user *models.User, details map[string]interface{}) models.AuditEntry {
+	entry := auditEntry(r, eventType, user.Username, details)
+	entry.MdaID = user.MdaID
+	if entry.Actor == "" {
+		entry.Actor = user.Username
+		entry.ActorID = user.ID
+	}
+	return entry
+}
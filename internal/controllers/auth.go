@@ -2,46 +2,280 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 
+	"github.com/abduls21985/exchange-rate-service/internal/models"
 	"github.com/abduls21985/exchange-rate-service/internal/services"
+	"github.com/abduls21985/exchange-rate-service/pkg/middleware"
+	"github.com/gorilla/mux"
 )
 
 type AuthController struct {
 	AuthService services.AuthService
+	MFA         services.MFAService
+	Audit       services.AuditService
 }
 
 // NewAuthController creates a new instance of AuthController
-func NewAuthController(authService services.AuthService) *AuthController {
-	return &AuthController{AuthService: authService}
+func NewAuthController(authService services.AuthService, mfaService services.MFAService, audit services.AuditService) *AuthController {
+	return &AuthController{AuthService: authService, MFA: mfaService, Audit: audit}
 }
 
 // AuthenticateUser handles POST /api/login
 func (c *AuthController) AuthenticateUser(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := c.AuthService.AuthenticateUser(req.Username, req.Password, middleware.ClientIP(r))
+	var throttled *services.LoginThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		// Refused attempts are not audited, so that a flood of them cannot fill the log
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		if throttled.Locked {
+			http.Error(w, "Too many failed login attempts; login is temporarily locked", http.StatusTooManyRequests)
+			return
+		}
+		http.Error(w, "Too many failed login attempts; try again later", http.StatusTooManyRequests)
+		return
+	case errors.Is(err, services.ErrUserInactive):
+		c.recordLoginFailure(r, req.Username, err)
+		http.Error(w, "Account is deactivated", http.StatusForbidden)
+		return
+	case errors.Is(err, services.ErrInvalidCredentials):
+		c.recordLoginFailure(r, req.Username, err)
+		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		return
+	case err != nil:
+		log.Printf("Error authenticating user: %v", err)
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		return
+	}
+
+	pair, challenge, err := c.AuthService.BeginLogin(user, r.UserAgent(), middleware.ClientIP(r))
+	if err != nil {
+		log.Printf("Error issuing tokens: %v", err)
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	// The login is only audited as succeeded once the second factor is passed
+	if challenge != nil {
+		jsonResponse(w, newMFAChallengeResponse(challenge), http.StatusOK)
+		return
+	}
+
+	c.Audit.RecordLogged(auditUserEntry(r, models.AuditLoginSucceeded, user, map[string]interface{}{"session_id": pair.SessionID}))
+	jsonResponse(w, newTokenResponse("Login successful", pair), http.StatusOK)
+}
+
+// CompleteMFALogin handles POST /api/login/mfa, exchanging the MFA token returned by
+// /api/login and a TOTP or recovery code for access and refresh tokens. For users who
+// enrolled during the login, the code confirms the enrollment and the response carries
+// their recovery codes.
+func (c *AuthController) CompleteMFALogin(w http.ResponseWriter, r *http.Request) {
+	var req MFALoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
 	}
 
+	login, err := c.AuthService.CompleteMFALogin(req.MFAToken, req.Code, r.UserAgent(), middleware.ClientIP(r))
+	switch {
+	case errors.Is(err, services.ErrInvalidMFACode):
+		c.Audit.RecordLogged(auditUserEntry(r, models.AuditMFAFailed, login.User, nil))
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	case errors.Is(err, services.ErrInvalidMFAChallenge):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	case errors.Is(err, services.ErrUserInactive):
+		http.Error(w, "Account is deactivated", http.StatusForbidden)
+		return
+	case errors.Is(err, services.ErrMFANotEnrolling):
+		http.Error(w, "Enroll an authenticator app at /api/login/mfa/enroll first", http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Printf("Error completing MFA login: %v", err)
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	user := login.User
+	if login.Verification.RecoveryCodeUsed {
+		c.Audit.RecordLogged(auditUserEntry(r, models.AuditRecoveryCodeUsed, user, nil))
+	}
+	if login.Verification.RecoveryCodes != nil {
+		c.Audit.RecordLogged(auditUserEntry(r, models.AuditMFAEnabled, user, nil))
+	}
+	c.Audit.RecordLogged(auditUserEntry(r, models.AuditLoginSucceeded, user, map[string]interface{}{"session_id": login.Tokens.SessionID, "mfa": true}))
+
+	response := newTokenResponse("Login successful", login.Tokens)
+	response.RecoveryCodes = login.Verification.RecoveryCodes
+	jsonResponse(w, response, http.StatusOK)
+}
+
+// EnrollMFALogin handles POST /api/login/mfa/enroll, starting enrollment for a user who
+// must use a second factor but has none yet. The enrollment is confirmed by completing
+// the login at /api/login/mfa with a code from the new authenticator.
+func (c *AuthController) EnrollMFALogin(w http.ResponseWriter, r *http.Request) {
+	var req MFAEnrollRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	user, err := c.AuthService.AuthenticateUser(req.Username, req.Password)
+	enrollment, err := c.MFA.EnrollWithChallenge(req.MFAToken)
+	switch {
+	case errors.Is(err, services.ErrInvalidMFAChallenge):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	case errors.Is(err, services.ErrUserInactive):
+		http.Error(w, "Account is deactivated", http.StatusForbidden)
+		return
+	case errors.Is(err, services.ErrMFAAlreadyEnabled):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Error starting MFA enrollment: %v", err)
+		http.Error(w, "Failed to start enrollment", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, enrollment, http.StatusOK)
+}
+
+// recordLoginFailure audits a failed login under the username that was tried
+func (c *AuthController) recordLoginFailure(r *http.Request, username string, err error) {
+	reason := "invalid credentials"
+	if errors.Is(err, services.ErrUserInactive) {
+		reason = "account deactivated"
+	}
+
+	entry := auditEntry(r, models.AuditLoginFailed, username, map[string]interface{}{"reason": reason})
+	entry.Actor = username
+	c.Audit.RecordLogged(entry)
+}
+
+// RefreshToken handles POST /api/token/refresh. The refresh token in the request is
+// replaced by the one in the response and cannot be used again.
+func (c *AuthController) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	pair, err := c.AuthService.RefreshTokens(req.RefreshToken, r.UserAgent(), middleware.ClientIP(r))
+	if errors.Is(err, services.ErrInvalidRefreshToken) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
 	if err != nil {
-		log.Printf("Error authenticating user: %v", err)
-		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		log.Printf("Error refreshing tokens: %v", err)
+		http.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, newTokenResponse("Token refreshed", pair), http.StatusOK)
+}
+
+// Logout handles POST /api/logout, ending the session of the presented token
+func (c *AuthController) Logout(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
 		return
 	}
 
-	token, err := c.AuthService.GenerateJWT(user.Username)
+	if err := c.AuthService.Logout(principal); err != nil {
+		log.Printf("Error logging out %s: %v", principal.Username, err)
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, map[string]string{"message": "Logged out"}, http.StatusOK)
+}
+
+// LogoutAll handles POST /api/logout/all, ending every session of the caller
+func (c *AuthController) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	count, err := c.AuthService.LogoutAll(principal.Username)
 	if err != nil {
-		log.Printf("Error generating JWT: %v", err)
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		log.Printf("Error logging out all sessions of %s: %v", principal.Username, err)
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+
+	// The presented token may be older than its session's latest one, so revoke it too
+	if err := c.AuthService.Logout(principal); err != nil {
+		log.Printf("Error logging out %s: %v", principal.Username, err)
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, map[string]interface{}{"message": "Logged out of all sessions", "sessions_revoked": count}, http.StatusOK)
+}
+
+// ListSessions handles GET /api/me/sessions
+func (c *AuthController) ListSessions(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := c.AuthService.ListSessions(principal.Username)
+	if err != nil {
+		log.Printf("Error listing sessions of %s: %v", principal.Username, err)
+		http.Error(w, "Failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, newSessionResponse(session, principal.SessionID))
+	}
+
+	jsonResponse(w, response, http.StatusOK)
+}
+
+// RevokeSession handles DELETE /api/me/sessions/{id}
+func (c *AuthController) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	err = c.AuthService.RevokeSession(principal.Username, uint(id))
+	if errors.Is(err, services.ErrSessionNotFound) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error revoking session %d of %s: %v", id, principal.Username, err)
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
 		return
 	}
 
-	jsonResponse(w, map[string]string{"message": "Login successful", "token": token}, http.StatusOK)
+	jsonResponse(w, map[string]string{"message": "Session revoked"}, http.StatusOK)
 }
@@ -0,0 +1,87 @@
+// internal/controllers/auth_dto.go
+
+package controllers
+
+import (
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+)
+
+// LoginRequest is the payload of POST /api/login
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// MFALoginRequest is the payload of POST /api/login/mfa
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"` // TOTP code, or a recovery code
+}
+
+// MFAEnrollRequest is the payload of POST /api/login/mfa/enroll
+type MFAEnrollRequest struct {
+	MFAToken string `json:"mfa_token"`
+}
+
+// RefreshTokenRequest is the payload of POST /api/token/refresh
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TokenResponse is returned by login and refresh. Token repeats the access token for
+// clients written before refresh tokens existed.
+type TokenResponse struct {
+	Message string `json:"message"`
+	Token   string `json:"token"`
+	models.TokenPair
+	RecoveryCodes []string `json:"recovery_codes,omitempty"` // Issued when MFA was enrolled during the login
+}
+
+// newTokenResponse wraps a token pair with a message
+func newTokenResponse(message string, pair *models.TokenPair) TokenResponse {
+	return TokenResponse{Message: message, Token: pair.AccessToken, TokenPair: *pair}
+}
+
+// MFAChallengeResponse is returned by a login that must be completed at /api/login/mfa
+type MFAChallengeResponse struct {
+	Message     string `json:"message"`
+	MFARequired bool   `json:"mfa_required"`
+	models.MFAChallengeResponse
+}
+
+// newMFAChallengeResponse wraps an MFA challenge with a message
+func newMFAChallengeResponse(challenge *models.MFAChallengeResponse) MFAChallengeResponse {
+	message := "Two-factor authentication required"
+	if challenge.EnrollmentRequired {
+		message = "Two-factor authentication must be set up to log in"
+	}
+	return MFAChallengeResponse{Message: message, MFARequired: true, MFAChallengeResponse: *challenge}
+}
+
+// SessionResponse is the public view of a login session
+type SessionResponse struct {
+	ID         uint      `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	MFA        bool      `json:"mfa"`     // The login passed a second factor
+	Current    bool      `json:"current"` // The session of the token making the request
+}
+
+// newSessionResponse maps a session onto its public view
+func newSessionResponse(session models.Session, currentID uint) SessionResponse {
+	return SessionResponse{
+		ID:         session.ID,
+		UserAgent:  session.UserAgent,
+		IPAddress:  session.IPAddress,
+		CreatedAt:  session.CreatedAt,
+		LastUsedAt: session.LastUsedAt,
+		ExpiresAt:  session.ExpiresAt,
+		MFA:        session.MFAVerified,
+		Current:    session.ID == currentID,
+	}
+}
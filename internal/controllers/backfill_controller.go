@@ -0,0 +1,161 @@
+// internal/controllers/backfill_controller.go
+
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/services"
+	"github.com/abduls21985/exchange-rate-service/internal/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// BackfillController handles HTTP requests for historical rate backfills
+type BackfillController struct {
+	Service services.BackfillService
+	Audit   services.AuditService
+}
+
+// NewBackfillController creates a new BackfillController
+func NewBackfillController(service services.BackfillService, audit services.AuditService) *BackfillController {
+	return &BackfillController{Service: service, Audit: audit}
+}
+
+// CreateBackfill handles POST /api/admin/backfills. The job runs in the background;
+// its progress is available from GetBackfill.
+func (c *BackfillController) CreateBackfill(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Provider  string `json:"provider"`
+		StartDate string `json:"start_date"` // YYYY-MM-DD
+		EndDate   string `json:"end_date"`   // YYYY-MM-DD
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.JSONResponse(w, map[string]string{"error": "Invalid request payload"}, http.StatusBadRequest)
+		return
+	}
+
+	start, err := time.Parse("2006-01-02", request.StartDate)
+	if err != nil {
+		utils.JSONResponse(w, map[string]string{"error": "Invalid start_date, expected YYYY-MM-DD"}, http.StatusBadRequest)
+		return
+	}
+	end, err := time.Parse("2006-01-02", request.EndDate)
+	if err != nil {
+		utils.JSONResponse(w, map[string]string{"error": "Invalid end_date, expected YYYY-MM-DD"}, http.StatusBadRequest)
+		return
+	}
+
+	job, err := c.Service.CreateBackfill(request.Provider, start, end)
+	if err != nil {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	id := job.ID
+	c.Audit.RecordLogged(auditEntry(r, models.AuditBackfillCreated, job.Provider, map[string]interface{}{
+		"backfill_id": job.ID,
+		"start_date":  request.StartDate,
+		"end_date":    request.EndDate,
+	}))
+
+	job, err = c.Service.StartBackfill(id)
+	if err != nil {
+		log.Printf("Error starting backfill %d: %v", id, err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   job,
+		"status": "Backfill started successfully",
+	}, http.StatusAccepted)
+}
+
+// ListBackfills handles GET /api/admin/backfills
+func (c *BackfillController) ListBackfills(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit, offset, err := parsePagination(query.Get("limit"), query.Get("offset"))
+	if err != nil {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	jobs, err := c.Service.ListBackfills(limit, offset)
+	if err != nil {
+		log.Printf("Error listing backfills: %v", err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   jobs,
+		"limit":  limit,
+		"offset": offset,
+		"status": "Backfills fetched successfully",
+	}, http.StatusOK)
+}
+
+// GetBackfill handles GET /api/admin/backfills/{id}
+func (c *BackfillController) GetBackfill(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		utils.JSONResponse(w, map[string]string{"error": "Invalid backfill ID"}, http.StatusBadRequest)
+		return
+	}
+
+	job, err := c.Service.GetBackfill(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.JSONResponse(w, map[string]string{"error": "Backfill not found"}, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching backfill %d: %v", id, err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":           job,
+		"processed_days": job.ProcessedDays(),
+		"status":         "Backfill fetched successfully",
+	}, http.StatusOK)
+}
+
+// ResumeBackfill handles POST /api/admin/backfills/{id}/resume, continuing a failed or
+// interrupted job from the last day it saved
+func (c *BackfillController) ResumeBackfill(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		utils.JSONResponse(w, map[string]string{"error": "Invalid backfill ID"}, http.StatusBadRequest)
+		return
+	}
+
+	job, err := c.Service.StartBackfill(uint(id))
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.JSONResponse(w, map[string]string{"error": "Backfill not found"}, http.StatusNotFound)
+		return
+	case errors.Is(err, services.ErrBackfillRunning):
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Error resuming backfill %d: %v", id, err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	c.Audit.RecordLogged(auditEntry(r, models.AuditBackfillResumed, job.Provider, map[string]interface{}{"backfill_id": job.ID}))
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   job,
+		"status": "Backfill resumed successfully",
+	}, http.StatusAccepted)
+}
@@ -2,31 +2,68 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/abduls21985/exchange-rate-service/internal/models"
 	"github.com/abduls21985/exchange-rate-service/internal/services"
 	"github.com/abduls21985/exchange-rate-service/internal/utils"
+	"github.com/abduls21985/exchange-rate-service/pkg/middleware"
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
 )
 
 // ExchangeRateController handles HTTP requests related to exchange rates
 type ExchangeRateController struct {
 	Service services.ExchangeRateService
+	MDAs    services.MDAService
+	Audit   services.AuditService
 }
 
 // NewExchangeRateController creates a new ExchangeRateController
-func NewExchangeRateController(service services.ExchangeRateService) *ExchangeRateController {
-	return &ExchangeRateController{Service: service}
+func NewExchangeRateController(service services.ExchangeRateService, mdaService services.MDAService, audit services.AuditService) *ExchangeRateController {
+	return &ExchangeRateController{Service: service, MDAs: mdaService, Audit: audit}
+}
+
+// scopedService returns the exchange rate service scoped to the caller's MDA. If the
+// MDA cannot be loaded it writes the error response and returns false.
+func (c *ExchangeRateController) scopedService(w http.ResponseWriter, r *http.Request) (services.ExchangeRateService, bool) {
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok || principal.MdaID == "" {
+		return c.Service.ForTenant(nil), true
+	}
+
+	mda, err := c.MDAs.GetMDA(principal.MdaID)
+	if errors.Is(err, services.ErrMDANotFound) {
+		utils.JSONResponse(w, map[string]string{"error": "Your MDA is not registered"}, http.StatusForbidden)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Error loading MDA %s: %v", principal.MdaID, err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return nil, false
+	}
+	return c.Service.ForTenant(mda), true
 }
 
 // GetExchangeRates handles GET /api/exchange-rates
 func (c *ExchangeRateController) GetExchangeRates(w http.ResponseWriter, r *http.Request) {
+	service, ok := c.scopedService(w, r)
+	if !ok {
+		return
+	}
+
 	query := r.URL.Query()
 	currencyCode := query.Get("currency")
 	timestampStr := query.Get("timestamp")
+	source := query.Get("source")
 
 	var timestamp int64
 	var err error
@@ -39,7 +76,11 @@ func (c *ExchangeRateController) GetExchangeRates(w http.ResponseWriter, r *http
 	}
 
 	// Fetch the exchange rates using the service layer
-	rates, err := c.Service.FetchExchangeRates(currencyCode, timestamp)
+	rates, err := service.FetchExchangeRates(currencyCode, timestamp, source)
+	if errors.Is(err, services.ErrCurrencyNotAllowed) {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		log.Printf("Error fetching exchange rates: %v", err)
 		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
@@ -53,7 +94,7 @@ func (c *ExchangeRateController) GetExchangeRates(w http.ResponseWriter, r *http
 	}
 
 	// Aggregate the rates into a map
-	ratesMap := make(map[string]float64)
+	ratesMap := make(map[string]decimal.Decimal)
 	for _, rate := range rates {
 		if rate.Currency.Code != "" {
 			ratesMap[rate.Currency.Code] = rate.Rate
@@ -65,6 +106,7 @@ func (c *ExchangeRateController) GetExchangeRates(w http.ResponseWriter, r *http
 		"data": map[string]interface{}{
 			"timestamp": rates[0].Timestamp.Unix(),  // Assuming all rates have the same timestamp
 			"base":      rates[0].BaseCurrency.Code, // Assuming all rates share the same base currency
+			"source":    rates[0].Source.Code,
 			"rates":     ratesMap,
 		},
 		"status": "Exchange rates fetched successfully",
@@ -74,8 +116,16 @@ func (c *ExchangeRateController) GetExchangeRates(w http.ResponseWriter, r *http
 	utils.JSONResponse(w, responseData, http.StatusOK)
 }
 
+// maxReasonLength is the longest reason accepted with manually posted rates
+const maxReasonLength = 500
+
 // PostExchangeRates handles POST /api/exchange-rates
 func (c *ExchangeRateController) PostExchangeRates(w http.ResponseWriter, r *http.Request) {
+	service, ok := c.scopedService(w, r)
+	if !ok {
+		return
+	}
+
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		utils.JSONResponse(w, map[string]string{"error": "Invalid request body"}, http.StatusBadRequest)
@@ -89,18 +139,109 @@ func (c *ExchangeRateController) PostExchangeRates(w http.ResponseWriter, r *htt
 		return
 	}
 
-	if err := c.Service.AddExchangeRates(data); err != nil {
+	// Rates posted directly are always manual, so they can never overwrite the
+	// publications of a provider such as "cbn"
+	if data.Source != "" && data.Source != models.ManualSource {
+		utils.JSONResponse(w, map[string]string{"error": fmt.Sprintf("Posted rates are recorded under the %q source; source %q cannot be used", models.ManualSource, data.Source)}, http.StatusBadRequest)
+		return
+	}
+	data.Source = models.ManualSource
+
+	// Every manual submission records who made it and why
+	data.Reason = strings.TrimSpace(data.Reason)
+	if data.Reason == "" {
+		utils.JSONResponse(w, map[string]string{"error": "A reason for the submission is required"}, http.StatusBadRequest)
+		return
+	}
+	if len(data.Reason) > maxReasonLength {
+		utils.JSONResponse(w, map[string]string{"error": fmt.Sprintf("Reason cannot be longer than %d characters", maxReasonLength)}, http.StatusBadRequest)
+		return
+	}
+	data.PostedByID = middleware.UserIDFromContext(r.Context())
+	data.PostedBy = middleware.UsernameFromContext(r.Context())
+
+	snapshot, err := service.AddExchangeRates(data)
+	if err != nil {
 		log.Printf("Error adding exchange rates: %v", err)
 		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
 		return
 	}
 
-	utils.JSONResponse(w, map[string]string{"status": "Exchange rates updated successfully"}, http.StatusCreated)
+	utils.JSONResponse(w, map[string]interface{}{
+		"status":      "Exchange rates updated successfully",
+		"snapshot_id": snapshot.ID,
+		"checksum":    snapshot.Checksum,
+	}, http.StatusCreated)
+}
+
+// ListSnapshots handles GET /api/snapshots
+func (c *ExchangeRateController) ListSnapshots(w http.ResponseWriter, r *http.Request) {
+	service, ok := c.scopedService(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+
+	limit, offset, err := parsePagination(query.Get("limit"), query.Get("offset"))
+	if err != nil {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	snapshots, err := service.ListSnapshots(query.Get("source"), limit, offset)
+	if err != nil {
+		log.Printf("Error listing snapshots: %v", err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   snapshots,
+		"limit":  limit,
+		"offset": offset,
+		"status": "Snapshots fetched successfully",
+	}, http.StatusOK)
+}
+
+// GetSnapshot handles GET /api/snapshots/{id}
+func (c *ExchangeRateController) GetSnapshot(w http.ResponseWriter, r *http.Request) {
+	service, ok := c.scopedService(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		utils.JSONResponse(w, map[string]string{"error": "Invalid snapshot ID"}, http.StatusBadRequest)
+		return
+	}
+
+	snapshot, err := service.GetSnapshot(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.JSONResponse(w, map[string]string{"error": "Snapshot not found"}, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching snapshot %d: %v", id, err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   snapshot,
+		"status": "Snapshot fetched successfully",
+	}, http.StatusOK)
 }
 
 // GetCurrencies handles GET /api/currencies
 func (c *ExchangeRateController) GetCurrencies(w http.ResponseWriter, r *http.Request) {
-	currencies, err := c.Service.GetAllCurrencies()
+	service, ok := c.scopedService(w, r)
+	if !ok {
+		return
+	}
+
+	currencies, err := service.GetAllCurrencies()
 	if err != nil {
 		log.Printf("Error fetching currencies: %v", err)
 		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
@@ -110,14 +251,45 @@ func (c *ExchangeRateController) GetCurrencies(w http.ResponseWriter, r *http.Re
 	utils.JSONResponse(w, currencies, http.StatusOK)
 }
 
+// GetRateSources handles GET /api/rate-sources
+func (c *ExchangeRateController) GetRateSources(w http.ResponseWriter, r *http.Request) {
+	service, ok := c.scopedService(w, r)
+	if !ok {
+		return
+	}
+
+	sources, err := service.GetRateSources()
+	if err != nil {
+		log.Printf("Error fetching rate sources: %v", err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.JSONResponse(w, sources, http.StatusOK)
+}
+
 // HealthCheck handles GET /api/health
 func (c *ExchangeRateController) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	utils.JSONResponse(w, map[string]string{"status": "OK", "message": "Server is running"}, http.StatusOK)
 }
 
+// GetCacheStats handles GET /api/admin/rate-cache, reporting how often conversions were
+// answered from the latest-rate cache on this replica
+func (c *ExchangeRateController) GetCacheStats(w http.ResponseWriter, r *http.Request) {
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   c.Service.CacheStats(),
+		"status": "Cache statistics fetched successfully",
+	}, http.StatusOK)
+}
+
 // CountExchangeRates handles GET /api/exchange-rates/count
 func (c *ExchangeRateController) CountExchangeRates(w http.ResponseWriter, r *http.Request) {
-	count, err := c.Service.CountExchangeRates()
+	service, ok := c.scopedService(w, r)
+	if !ok {
+		return
+	}
+
+	count, err := service.CountExchangeRates()
 	if err != nil {
 		log.Printf("Error counting exchange rates: %v", err)
 		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
@@ -127,72 +299,139 @@ func (c *ExchangeRateController) CountExchangeRates(w http.ResponseWriter, r *ht
 	utils.JSONResponse(w, map[string]int{"count": count}, http.StatusOK)
 }
 
-// GetHistoricalExchangeRates handles GET /api/exchange-rates/historical
+// GetHistoricalExchangeRates handles GET /api/exchange-rates/historical, returning every
+// rate published in the range, or one per day, week or month with ?interval=, keyed by
+// date and then currency code. ?currencies= (or ?currency=) limits the currencies, ?base=
+// rebases the rates and ?sampling=close|average picks how a period's rates are reduced.
+// start_date and end_date accept YYYY-MM-DD dates, both inclusive, or Unix timestamps;
+// the range defaults to the month up to now.
 func (c *ExchangeRateController) GetHistoricalExchangeRates(w http.ResponseWriter, r *http.Request) {
+	service, ok := c.scopedService(w, r)
+	if !ok {
+		return
+	}
+
 	query := r.URL.Query()
-	currencyCode := query.Get("currency")
-	startStr := query.Get("start_date")
-	endStr := query.Get("end_date")
+	seriesQuery := services.TimeSeriesQuery{
+		Base:   query.Get("base"),
+		Source: query.Get("source"),
+	}
+	for _, list := range []string{query.Get("currency"), query.Get("currencies")} {
+		for _, code := range strings.Split(list, ",") {
+			if code = strings.TrimSpace(code); code != "" {
+				seriesQuery.Currencies = append(seriesQuery.Currencies, code)
+			}
+		}
+	}
 
-	var startDate, endDate int64
 	var err error
-
-	if startStr != "" {
-		startDate, err = strconv.ParseInt(startStr, 10, 64)
-		if err != nil {
-			utils.JSONResponse(w, map[string]string{"error": "Invalid start date format"}, http.StatusBadRequest)
+	if seriesQuery.Side, err = models.ParseRateSide(query.Get("side")); err != nil {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if interval := query.Get("interval"); interval != "" {
+		if seriesQuery.Interval, err = models.ParseRateInterval(interval); err != nil {
+			utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
 			return
 		}
 	}
+	if seriesQuery.Sampling, err = models.ParseRateSampling(query.Get("sampling")); err != nil {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	}
 
-	if endStr != "" {
-		endDate, err = strconv.ParseInt(endStr, 10, 64)
-		if err != nil {
-			utils.JSONResponse(w, map[string]string{"error": "Invalid end date format"}, http.StatusBadRequest)
+	seriesQuery.End = time.Now().UTC()
+	if value := query.Get("end_date"); value != "" {
+		if seriesQuery.End, err = parseRangeBound(value, true); err != nil {
+			utils.JSONResponse(w, map[string]string{"error": "Invalid end date format, expected YYYY-MM-DD or a Unix timestamp"}, http.StatusBadRequest)
+			return
+		}
+	}
+	seriesQuery.Start = seriesQuery.End.AddDate(0, -1, 0)
+	if value := query.Get("start_date"); value != "" {
+		if seriesQuery.Start, err = parseRangeBound(value, false); err != nil {
+			utils.JSONResponse(w, map[string]string{"error": "Invalid start date format, expected YYYY-MM-DD or a Unix timestamp"}, http.StatusBadRequest)
 			return
 		}
 	}
 
-	rates, err := c.Service.GetHistoricalExchangeRates(currencyCode, startDate, endDate)
-	if err != nil {
+	series, err := service.GetTimeSeries(seriesQuery)
+	switch {
+	case errors.Is(err, services.ErrInvalidDateRange):
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	case errors.Is(err, services.ErrCurrencyNotAllowed):
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusForbidden)
+		return
+	case errors.Is(err, services.ErrRateNotFound):
+		utils.JSONResponse(w, map[string]string{"error": "No exchange rates found for the given criteria"}, http.StatusNotFound)
+		return
+	case err != nil:
+		log.Printf("Error fetching historical exchange rates: %v", err)
 		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
 		return
 	}
 
-	response := make(map[string]float64)
-	for _, rate := range rates {
-		currency, err := c.Service.GetAllCurrencies()
-		if err != nil {
-			utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
-			return
-		}
-		for _, cur := range currency {
-			if cur.ID == rate.CurrencyID {
-				response[cur.Code] = rate.Rate
-				break
-			}
-		}
+	data := map[string]interface{}{
+		"start_date": seriesQuery.Start.Unix(),
+		"end_date":   seriesQuery.End.Add(-time.Second).Unix(),
+		"base":       series.Base,
+		"source":     series.Source,
+		"side":       seriesQuery.Side,
+		"rates":      series.Rates,
+	}
+	if series.Interval != "" {
+		data["interval"] = series.Interval
+		data["sampling"] = series.Sampling
 	}
 
 	utils.JSONResponse(w, map[string]interface{}{
-		"data": map[string]interface{}{
-			"start_date": startDate,
-			"end_date":   endDate,
-			"base":       "USD",
-			"rates":      response,
-		},
+		"data":   data,
 		"status": "Historical exchange rates fetched successfully",
 	}, http.StatusOK)
 }
 
+// parseRangeBound parses a YYYY-MM-DD date or a Unix timestamp bounding a date range.
+// An end bound is returned as the instant just after it, so that end dates include their
+// whole day and end timestamps their whole second.
+func parseRangeBound(value string, end bool) (time.Time, error) {
+	bound, err := time.Parse("2006-01-02", value)
+	if err == nil {
+		if end {
+			bound = bound.AddDate(0, 0, 1)
+		}
+		return bound, nil
+	}
+
+	timestamp, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	bound = time.Unix(timestamp, 0).UTC()
+	if end {
+		bound = bound.Add(time.Second)
+	}
+	return bound, nil
+}
+
 // internal/controllers/exchange_rates_controller.go
 
 // ConvertCurrency handles POST /api/exchange-rates/convert
 func (c *ExchangeRateController) ConvertCurrency(w http.ResponseWriter, r *http.Request) {
+	service, ok := c.scopedService(w, r)
+	if !ok {
+		return
+	}
+
 	var request struct {
-		FromCurrency string  `json:"from_currency"`
-		ToCurrency   string  `json:"to_currency"`
-		Amount       float64 `json:"amount"`
+		FromCurrency string          `json:"from_currency"`
+		ToCurrency   string          `json:"to_currency"`
+		Amount       decimal.Decimal `json:"amount"`
+		Source       string          `json:"source"`
+		Side         string          `json:"side"`
+		Date         string          `json:"date"`      // Optional YYYY-MM-DD to convert on
+		Timestamp    int64           `json:"timestamp"` // Optional Unix timestamp to convert on
+		Fallback     string          `json:"fallback"`  // previous, nearest or strict
 	}
 
 	// Parse the request body
@@ -201,28 +440,82 @@ func (c *ExchangeRateController) ConvertCurrency(w http.ResponseWriter, r *http.
 		return
 	}
 
+	// The source may also be chosen with ?source= like the other rate endpoints
+	if request.Source == "" {
+		request.Source = r.URL.Query().Get("source")
+	}
+
 	// Validate request parameters
-	if request.FromCurrency == "" || request.ToCurrency == "" || request.Amount <= 0 {
+	if request.FromCurrency == "" || request.ToCurrency == "" || !request.Amount.IsPositive() {
 		utils.JSONResponse(w, map[string]string{"error": "Missing or invalid parameters"}, http.StatusBadRequest)
 		return
 	}
 
+	side, err := models.ParseRateSide(request.Side)
+	if err != nil {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	fallback, err := models.ParseFallbackPolicy(request.Fallback)
+	if err != nil {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	// Resolve the optional conversion date
+	var at *time.Time
+	switch {
+	case request.Date != "":
+		date, err := time.Parse("2006-01-02", request.Date)
+		if err != nil {
+			utils.JSONResponse(w, map[string]string{"error": "Invalid date format, expected YYYY-MM-DD"}, http.StatusBadRequest)
+			return
+		}
+		at = &date
+	case request.Timestamp != 0:
+		timestamp := time.Unix(request.Timestamp, 0).UTC()
+		at = &timestamp
+	}
+
 	// Perform currency conversion
-	convertedAmount, err := c.Service.ConvertCurrency(request.FromCurrency, request.ToCurrency, request.Amount)
+	conversion, err := service.ConvertCurrency(models.ConversionRequest{
+		FromCurrency: request.FromCurrency,
+		ToCurrency:   request.ToCurrency,
+		Amount:       request.Amount,
+		Source:       request.Source,
+		Side:         side,
+		At:           at,
+		Fallback:     fallback,
+	})
+	if errors.Is(err, services.ErrRateNotFound) {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, services.ErrCurrencyNotAllowed) {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		log.Printf("Error converting currency: %v", err)
 		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
 		return
 	}
 
+	if c.Audit.IsLargeConversion(conversion.OriginalAmount) {
+		c.Audit.RecordLogged(auditEntry(r, models.AuditLargeConversion, conversion.FromCurrency+"/"+conversion.ToCurrency, map[string]interface{}{
+			"amount":           conversion.OriginalAmount,
+			"converted_amount": conversion.ConvertedAmount,
+			"rate":             conversion.Rate,
+			"side":             conversion.Side,
+			"source":           conversion.Source,
+			"requested_at":     conversion.RequestedAt,
+		}))
+	}
+
 	// Respond with the converted amount
 	response := map[string]interface{}{
-		"data": map[string]interface{}{
-			"from_currency":    request.FromCurrency,
-			"to_currency":      request.ToCurrency,
-			"original_amount":  request.Amount,
-			"converted_amount": convertedAmount,
-		},
+		"data":   conversion,
 		"status": "Currency converted successfully",
 	}
 
@@ -233,14 +526,24 @@ func (c *ExchangeRateController) ConvertCurrency(w http.ResponseWriter, r *http.
 
 // ConvertRatesToBaseCurrency handles GET /api/exchange-rates/base-convert
 func (c *ExchangeRateController) ConvertRatesToBaseCurrency(w http.ResponseWriter, r *http.Request) {
-	baseCurrency := r.URL.Query().Get("base")
-	if baseCurrency == "" {
+	service, ok := c.scopedService(w, r)
+	if !ok {
+		return
+	}
+
+	// Without ?base= the caller's MDA default base currency is used
+	baseCurrency, err := service.ResolveBaseCurrency(r.URL.Query().Get("base"))
+	if errors.Is(err, services.ErrBaseCurrencyRequired) {
 		utils.JSONResponse(w, map[string]string{"error": "Base currency is required"}, http.StatusBadRequest)
 		return
 	}
+	if errors.Is(err, services.ErrCurrencyNotAllowed) {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusForbidden)
+		return
+	}
 
 	// Fetch the exchange rates
-	rates, err := c.Service.FetchExchangeRates("", 0)
+	rates, err := service.FetchExchangeRates("", 0, r.URL.Query().Get("source"))
 	if err != nil {
 		log.Printf("Error fetching exchange rates: %v", err)
 		utils.JSONResponse(w, map[string]string{"error": "Failed to fetch exchange rates"}, http.StatusInternalServerError)
@@ -248,7 +551,7 @@ func (c *ExchangeRateController) ConvertRatesToBaseCurrency(w http.ResponseWrite
 	}
 
 	// Convert rates to the specified base currency
-	convertedRates, err := c.Service.ConvertToBaseCurrency(rates, baseCurrency)
+	convertedRates, err := service.ConvertToBaseCurrency(rates, baseCurrency)
 	if err != nil {
 		log.Printf("Error converting to base currency: %v", err)
 		utils.JSONResponse(w, map[string]string{"error": "Failed to convert exchange rates to base currency"}, http.StatusInternalServerError)
@@ -271,7 +574,12 @@ func (c *ExchangeRateController) ConvertRatesToBaseCurrency(w http.ResponseWrite
 
 // GetExchangeRateCount handles GET /api/exchange-rates/count
 func (c *ExchangeRateController) GetExchangeRateCount(w http.ResponseWriter, r *http.Request) {
-	count, err := c.Service.CountExchangeRates()
+	service, ok := c.scopedService(w, r)
+	if !ok {
+		return
+	}
+
+	count, err := service.CountExchangeRates()
 	if err != nil {
 		log.Printf("Error counting exchange rates: %v", err)
 		utils.JSONResponse(w, map[string]string{"error": "Failed to count exchange rates"}, http.StatusInternalServerError)
@@ -291,6 +599,11 @@ func (c *ExchangeRateController) GetExchangeRateCount(w http.ResponseWriter, r *
 
 // ConvertRatesToBaseCurrency handles the conversion of multiple rates to a specified base currency
 func (c *ExchangeRateController) ConvertMultipleRatesToBaseCurrency(w http.ResponseWriter, r *http.Request) {
+	service, ok := c.scopedService(w, r)
+	if !ok {
+		return
+	}
+
 	var request struct {
 		BaseCurrency string                `json:"base_currency"`
 		Rates        []models.ExchangeRate `json:"rates"`
@@ -303,7 +616,15 @@ func (c *ExchangeRateController) ConvertMultipleRatesToBaseCurrency(w http.Respo
 	}
 
 	// Call the service to convert rates to the specified base currency
-	convertedRates, err := c.Service.ConvertRatesToBaseCurrency(request.BaseCurrency, request.Rates)
+	convertedRates, err := service.ConvertRatesToBaseCurrency(request.BaseCurrency, request.Rates)
+	if errors.Is(err, services.ErrBaseCurrencyRequired) {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, services.ErrCurrencyNotAllowed) {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		log.Printf("Error converting rates: %v", err)
 		utils.JSONResponse(w, map[string]string{"error": "Failed to convert rates"}, http.StatusInternalServerError)
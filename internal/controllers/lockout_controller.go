@@ -0,0 +1,104 @@
+// internal/controllers/lockout_controller.go
+
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/services"
+	"github.com/abduls21985/exchange-rate-service/internal/utils"
+	"github.com/abduls21985/exchange-rate-service/pkg/middleware"
+	"github.com/gorilla/mux"
+)
+
+// LockoutController handles HTTP requests for monitoring and lifting login lockouts
+type LockoutController struct {
+	Service services.LoginThrottleService
+	Users   services.UserService
+	Audit   services.AuditService
+}
+
+// NewLockoutController creates a new LockoutController
+func NewLockoutController(service services.LoginThrottleService, users services.UserService, audit services.AuditService) *LockoutController {
+	return &LockoutController{Service: service, Users: users, Audit: audit}
+}
+
+// ListLockouts handles GET /api/admin/lockouts, listing the usernames and IPs currently
+// locked out
+func (c *LockoutController) ListLockouts(w http.ResponseWriter, r *http.Request) {
+	lockouts, err := c.Service.ListLockouts()
+	if err != nil {
+		log.Printf("Error listing lockouts: %v", err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   lockouts,
+		"status": "Lockouts fetched successfully",
+	}, http.StatusOK)
+}
+
+// UnlockUser handles POST /api/admin/users/{username}/unlock, lifting the user's
+// lockout and forgetting their failed logins
+func (c *LockoutController) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		utils.JSONResponse(w, map[string]string{"error": "Authentication required"}, http.StatusUnauthorized)
+		return
+	}
+
+	// Admins of an MDA can only unlock that MDA's users
+	user, err := c.Users.GetUser(principal.MdaID, username)
+	if errors.Is(err, services.ErrUserNotFound) {
+		utils.JSONResponse(w, map[string]string{"error": "User not found"}, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error looking up %s: %v", username, err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	if err := c.Service.Unlock(models.ThrottleUsername, user.Username); err != nil {
+		log.Printf("Error unlocking %s: %v", username, err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	c.Audit.RecordLogged(auditUserEntry(r, models.AuditLoginUnlocked, user, map[string]interface{}{"kind": models.ThrottleUsername}))
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   map[string]string{"username": user.Username},
+		"status": "User unlocked successfully",
+	}, http.StatusOK)
+}
+
+// UnlockIP handles DELETE /api/admin/lockouts/ips/{ip}, lifting the lockout of a client
+// IP and forgetting its failed logins
+func (c *LockoutController) UnlockIP(w http.ResponseWriter, r *http.Request) {
+	ip := net.ParseIP(mux.Vars(r)["ip"])
+	if ip == nil {
+		utils.JSONResponse(w, map[string]string{"error": "Invalid IP address"}, http.StatusBadRequest)
+		return
+	}
+
+	if err := c.Service.Unlock(models.ThrottleIP, ip.String()); err != nil {
+		log.Printf("Error unlocking %s: %v", ip, err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	c.Audit.RecordLogged(auditEntry(r, models.AuditLoginUnlocked, ip.String(), map[string]interface{}{"kind": models.ThrottleIP}))
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   map[string]string{"ip": ip.String()},
+		"status": "IP unlocked successfully",
+	}, http.StatusOK)
+}
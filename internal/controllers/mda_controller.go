@@ -0,0 +1,169 @@
+// internal/controllers/mda_controller.go
+
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/services"
+	"github.com/abduls21985/exchange-rate-service/internal/utils"
+	"github.com/abduls21985/exchange-rate-service/pkg/middleware"
+	"github.com/gorilla/mux"
+)
+
+// MDAController handles HTTP requests for tenant management
+type MDAController struct {
+	Service services.MDAService
+	Audit   services.AuditService
+}
+
+// NewMDAController creates a new MDAController
+func NewMDAController(service services.MDAService, audit services.AuditService) *MDAController {
+	return &MDAController{Service: service, Audit: audit}
+}
+
+// mdaRequest is the payload for creating or updating an MDA
+type mdaRequest struct {
+	Code                string   `json:"code"`
+	Name                string   `json:"name"`
+	AllowedCurrencies   []string `json:"allowed_currencies"`
+	PreferredSource     string   `json:"preferred_source"`
+	DefaultBaseCurrency string   `json:"default_base_currency"`
+	MaxUsers            int      `json:"max_users"`
+	DailyRequestQuota   int      `json:"daily_request_quota"`
+}
+
+// toModel maps the request onto an MDA
+func (req mdaRequest) toModel() *models.MDA {
+	return &models.MDA{
+		Code:                req.Code,
+		Name:                req.Name,
+		AllowedCurrencies:   req.AllowedCurrencies,
+		PreferredSource:     req.PreferredSource,
+		DefaultBaseCurrency: req.DefaultBaseCurrency,
+		MaxUsers:            req.MaxUsers,
+		DailyRequestQuota:   req.DailyRequestQuota,
+	}
+}
+
+// CreateMDA handles POST /api/admin/mdas
+func (c *MDAController) CreateMDA(w http.ResponseWriter, r *http.Request) {
+	var req mdaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JSONResponse(w, map[string]string{"error": "Invalid request payload"}, http.StatusBadRequest)
+		return
+	}
+
+	mda, err := c.Service.CreateMDA(req.toModel())
+	if errors.Is(err, services.ErrMDAExists) {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating MDA: %v", err)
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	c.recordMDA(r, models.AuditMDACreated, mda)
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   mda,
+		"status": "MDA created successfully",
+	}, http.StatusCreated)
+}
+
+// ListMDAs handles GET /api/admin/mdas
+func (c *MDAController) ListMDAs(w http.ResponseWriter, r *http.Request) {
+	mdas, err := c.Service.ListMDAs()
+	if err != nil {
+		log.Printf("Error listing MDAs: %v", err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   mdas,
+		"status": "MDAs fetched successfully",
+	}, http.StatusOK)
+}
+
+// GetMDA handles GET /api/admin/mdas/{code}
+func (c *MDAController) GetMDA(w http.ResponseWriter, r *http.Request) {
+	c.writeMDA(w, mux.Vars(r)["code"])
+}
+
+// GetOwnMDA handles GET /api/mda, returning the settings of the caller's MDA
+func (c *MDAController) GetOwnMDA(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok || principal.MdaID == "" {
+		utils.JSONResponse(w, map[string]string{"error": "You do not belong to an MDA"}, http.StatusNotFound)
+		return
+	}
+	c.writeMDA(w, principal.MdaID)
+}
+
+// UpdateMDA handles PUT /api/admin/mdas/{code}
+func (c *MDAController) UpdateMDA(w http.ResponseWriter, r *http.Request) {
+	var req mdaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JSONResponse(w, map[string]string{"error": "Invalid request payload"}, http.StatusBadRequest)
+		return
+	}
+
+	mda, err := c.Service.UpdateMDA(mux.Vars(r)["code"], req.toModel())
+	if errors.Is(err, services.ErrMDANotFound) {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating MDA: %v", err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	c.recordMDA(r, models.AuditMDAUpdated, mda)
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   mda,
+		"status": "MDA updated successfully",
+	}, http.StatusOK)
+}
+
+// writeMDA responds with the MDA that has the code
+func (c *MDAController) writeMDA(w http.ResponseWriter, code string) {
+	mda, err := c.Service.GetMDA(code)
+	if errors.Is(err, services.ErrMDANotFound) {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching MDA %s: %v", code, err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   mda,
+		"status": "MDA fetched successfully",
+	}, http.StatusOK)
+}
+
+// recordMDA audits a change to an MDA's settings. The event belongs to the MDA itself,
+// so that its own auditors can see how it was configured.
+func (c *MDAController) recordMDA(r *http.Request, eventType string, mda *models.MDA) {
+	entry := auditEntry(r, eventType, mda.Code, map[string]interface{}{
+		"name":                  mda.Name,
+		"allowed_currencies":    mda.AllowedCurrencies,
+		"preferred_source":      mda.PreferredSource,
+		"default_base_currency": mda.DefaultBaseCurrency,
+		"max_users":             mda.MaxUsers,
+		"daily_request_quota":   mda.DailyRequestQuota,
+	})
+	entry.MdaID = mda.Code
+	c.Audit.RecordLogged(entry)
+}
@@ -0,0 +1,285 @@
+// internal/controllers/mfa_controller.go
+
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/services"
+	"github.com/abduls21985/exchange-rate-service/internal/utils"
+	"github.com/abduls21985/exchange-rate-service/pkg/middleware"
+	"github.com/gorilla/mux"
+)
+
+// MFAController handles HTTP requests for managing two-factor authentication
+type MFAController struct {
+	Service services.MFAService
+	Users   services.UserService
+	Audit   services.AuditService
+}
+
+// NewMFAController creates a new MFAController
+func NewMFAController(service services.MFAService, users services.UserService, audit services.AuditService) *MFAController {
+	return &MFAController{Service: service, Users: users, Audit: audit}
+}
+
+// mfaCodeRequest is the payload of requests confirmed with a TOTP or recovery code
+type mfaCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// mfaPolicyRequest is the payload of PUT /api/admin/mfa-policies/{role}
+type mfaPolicyRequest struct {
+	Required bool `json:"required"`
+}
+
+// GetStatus handles GET /api/me/mfa
+func (c *MFAController) GetStatus(w http.ResponseWriter, r *http.Request) {
+	user, ok := c.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	status, err := c.Service.Status(user)
+	if err != nil {
+		log.Printf("Error fetching MFA status of %s: %v", user.Username, err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   status,
+		"status": "MFA status fetched successfully",
+	}, http.StatusOK)
+}
+
+// BeginEnrollment handles POST /api/me/mfa/enroll, returning a new TOTP secret to be
+// added to an authenticator app and confirmed at /api/me/mfa/confirm
+func (c *MFAController) BeginEnrollment(w http.ResponseWriter, r *http.Request) {
+	user, ok := c.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	enrollment, err := c.Service.BeginEnrollment(user)
+	if errors.Is(err, services.ErrMFAAlreadyEnabled) {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error starting MFA enrollment of %s: %v", user.Username, err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   enrollment,
+		"status": "Enrollment started; confirm it with a code from your authenticator app",
+	}, http.StatusOK)
+}
+
+// ConfirmEnrollment handles POST /api/me/mfa/confirm. The recovery codes are only ever
+// shown in this response.
+func (c *MFAController) ConfirmEnrollment(w http.ResponseWriter, r *http.Request) {
+	user, ok := c.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JSONResponse(w, map[string]string{"error": "Invalid request payload"}, http.StatusBadRequest)
+		return
+	}
+
+	codes, err := c.Service.ConfirmEnrollment(user, req.Code)
+	if !c.checkCodeError(w, user, err) {
+		return
+	}
+
+	c.Audit.RecordLogged(auditUserEntry(r, models.AuditMFAEnabled, user, nil))
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   map[string]interface{}{"recovery_codes": codes},
+		"status": "Two-factor authentication enabled; store the recovery codes now, they will not be shown again",
+	}, http.StatusOK)
+}
+
+// RegenerateRecoveryCodes handles POST /api/me/mfa/recovery-codes, replacing the
+// caller's recovery codes
+func (c *MFAController) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, ok := c.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JSONResponse(w, map[string]string{"error": "Invalid request payload"}, http.StatusBadRequest)
+		return
+	}
+
+	codes, err := c.Service.RegenerateRecoveryCodes(user, req.Code)
+	if !c.checkCodeError(w, user, err) {
+		return
+	}
+
+	c.Audit.RecordLogged(auditUserEntry(r, models.AuditRecoveryCodesReissued, user, nil))
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   map[string]interface{}{"recovery_codes": codes},
+		"status": "Recovery codes replaced; store them now, they will not be shown again",
+	}, http.StatusOK)
+}
+
+// Disable handles DELETE /api/me/mfa
+func (c *MFAController) Disable(w http.ResponseWriter, r *http.Request) {
+	user, ok := c.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JSONResponse(w, map[string]string{"error": "Invalid request payload"}, http.StatusBadRequest)
+		return
+	}
+
+	err := c.Service.Disable(user, req.Code)
+	if errors.Is(err, services.ErrMFARequired) {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusForbidden)
+		return
+	}
+	if !c.checkCodeError(w, user, err) {
+		return
+	}
+
+	c.Audit.RecordLogged(auditUserEntry(r, models.AuditMFADisabled, user, nil))
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   map[string]string{"username": user.Username},
+		"status": "Two-factor authentication disabled successfully",
+	}, http.StatusOK)
+}
+
+// ResetUser handles DELETE /api/admin/users/{username}/mfa, removing the second factor
+// of a user who has lost their device
+func (c *MFAController) ResetUser(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		utils.JSONResponse(w, map[string]string{"error": "Authentication required"}, http.StatusUnauthorized)
+		return
+	}
+
+	// Admins of an MDA can only reset that MDA's users
+	user, err := c.Users.GetUser(principal.MdaID, username)
+	if errors.Is(err, services.ErrUserNotFound) {
+		utils.JSONResponse(w, map[string]string{"error": "User not found"}, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error looking up %s: %v", username, err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	if err := c.Service.Reset(user); err != nil {
+		log.Printf("Error resetting MFA of %s: %v", username, err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	c.Audit.RecordLogged(auditUserEntry(r, models.AuditMFADisabled, user, map[string]interface{}{"reset_by_admin": true}))
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   map[string]string{"username": user.Username},
+		"status": "Two-factor authentication reset successfully",
+	}, http.StatusOK)
+}
+
+// ListPolicies handles GET /api/admin/mfa-policies
+func (c *MFAController) ListPolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := c.Service.ListPolicies()
+	if err != nil {
+		log.Printf("Error listing MFA policies: %v", err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   policies,
+		"status": "MFA policies fetched successfully",
+	}, http.StatusOK)
+}
+
+// SetPolicy handles PUT /api/admin/mfa-policies/{role}. Sessions of the role's users
+// that did not pass a second factor end at their next refresh.
+func (c *MFAController) SetPolicy(w http.ResponseWriter, r *http.Request) {
+	role, err := models.ParseRole(mux.Vars(r)["role"])
+	if err != nil {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	var req mfaPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JSONResponse(w, map[string]string{"error": "Invalid request payload"}, http.StatusBadRequest)
+		return
+	}
+
+	policy, err := c.Service.SetPolicy(role, req.Required)
+	if err != nil {
+		log.Printf("Error setting MFA policy of %s: %v", role, err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	c.Audit.RecordLogged(auditEntry(r, models.AuditMFAPolicyChanged, string(role), map[string]interface{}{"required": policy.Required}))
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   policy,
+		"status": "MFA policy updated successfully",
+	}, http.StatusOK)
+}
+
+// currentUser loads the calling user, writing an error response if that fails
+func (c *MFAController) currentUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	username := middleware.UsernameFromContext(r.Context())
+	if username == "" {
+		utils.JSONResponse(w, map[string]string{"error": "Authentication required"}, http.StatusUnauthorized)
+		return nil, false
+	}
+
+	user, err := c.Users.GetUserByUsername(username)
+	if err != nil {
+		log.Printf("Error looking up %s: %v", username, err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return nil, false
+	}
+	return user, true
+}
+
+// checkCodeError writes the response for an error from an operation confirmed with a
+// code, and reports whether the operation succeeded
+func (c *MFAController) checkCodeError(w http.ResponseWriter, user *models.User, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, services.ErrInvalidMFACode):
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusForbidden)
+	case errors.Is(err, services.ErrMFAAlreadyEnabled):
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusConflict)
+	case errors.Is(err, services.ErrMFANotEnabled), errors.Is(err, services.ErrMFANotEnrolling):
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+	default:
+		log.Printf("Error updating MFA of %s: %v", user.Username, err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+// internal/controllers/pagination.go
+
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// parsePagination reads the limit and offset query parameters, applying defaults and bounds
+func parsePagination(limitStr, offsetStr string) (int, int, error) {
+	limit, offset := defaultPageLimit, 0
+
+	if limitStr != "" {
+		value, err := strconv.Atoi(limitStr)
+		if err != nil || value <= 0 {
+			return 0, 0, fmt.Errorf("invalid limit %q", limitStr)
+		}
+		limit = value
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	if offsetStr != "" {
+		value, err := strconv.Atoi(offsetStr)
+		if err != nil || value < 0 {
+			return 0, 0, fmt.Errorf("invalid offset %q", offsetStr)
+		}
+		offset = value
+	}
+
+	return limit, offset, nil
+}
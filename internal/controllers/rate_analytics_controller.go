@@ -0,0 +1,157 @@
+// internal/controllers/rate_analytics_controller.go
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/services"
+	"github.com/abduls21985/exchange-rate-service/internal/utils"
+)
+
+const (
+	defaultVolatilityWindow = 20
+	maxVolatilityWindow     = 250
+)
+
+// GetRateOHLC handles GET /api/exchange-rates/analytics/ohlc, returning the open, high,
+// low, close and average rate of a currency pair for each day, week or month (?interval=)
+func (c *ExchangeRateController) GetRateOHLC(w http.ResponseWriter, r *http.Request) {
+	interval, err := models.ParseRateInterval(r.URL.Query().Get("interval"))
+	if err != nil {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	series, ok := c.pairSeries(w, r)
+	if !ok {
+		return
+	}
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data": map[string]interface{}{
+			"base":       series.Base,
+			"quote":      series.Quote,
+			"source":     series.Source,
+			"side":       series.Side,
+			"interval":   interval,
+			"start_date": series.StartDate.Format("2006-01-02"),
+			"end_date":   series.EndDate.Format("2006-01-02"),
+			"candles":    series.Candles(interval),
+		},
+		"status": "Exchange rate OHLC fetched successfully",
+	}, http.StatusOK)
+}
+
+// GetRateSummary handles GET /api/exchange-rates/analytics/summary, returning the change,
+// simple and time-weighted averages, extremes and volatility of a currency pair
+func (c *ExchangeRateController) GetRateSummary(w http.ResponseWriter, r *http.Request) {
+	series, ok := c.pairSeries(w, r)
+	if !ok {
+		return
+	}
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   series.Summary(),
+		"status": "Exchange rate summary fetched successfully",
+	}, http.StatusOK)
+}
+
+// GetRateVolatility handles GET /api/exchange-rates/analytics/volatility, returning the
+// volatility of a currency pair's daily closing rates over a rolling window of ?window= days
+func (c *ExchangeRateController) GetRateVolatility(w http.ResponseWriter, r *http.Request) {
+	window := defaultVolatilityWindow
+	if value := r.URL.Query().Get("window"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 2 || parsed > maxVolatilityWindow {
+			utils.JSONResponse(w, map[string]string{"error": fmt.Sprintf("Invalid window, expected a number of days from 2 to %d", maxVolatilityWindow)}, http.StatusBadRequest)
+			return
+		}
+		window = parsed
+	}
+
+	series, ok := c.pairSeries(w, r)
+	if !ok {
+		return
+	}
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data": map[string]interface{}{
+			"base":       series.Base,
+			"quote":      series.Quote,
+			"source":     series.Source,
+			"side":       series.Side,
+			"window":     window,
+			"start_date": series.StartDate.Format("2006-01-02"),
+			"end_date":   series.EndDate.Format("2006-01-02"),
+			"volatility": series.RollingVolatility(window),
+		},
+		"status": "Exchange rate volatility fetched successfully",
+	}, http.StatusOK)
+}
+
+// pairSeries loads the series of the pair described by the query parameters base (the
+// caller's default base when omitted), quote, source, side, start_date and end_date
+// (YYYY-MM-DD, today when omitted; the range defaults to the month before end_date).
+// It writes the error response itself and returns false when the series cannot be loaded.
+func (c *ExchangeRateController) pairSeries(w http.ResponseWriter, r *http.Request) (*services.PairSeries, bool) {
+	service, ok := c.scopedService(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	query := r.URL.Query()
+	base, quote := query.Get("base"), query.Get("quote")
+	if quote == "" {
+		utils.JSONResponse(w, map[string]string{"error": "Quote currency is required"}, http.StatusBadRequest)
+		return nil, false
+	}
+	if quote == base {
+		utils.JSONResponse(w, map[string]string{"error": "Base and quote currencies must differ"}, http.StatusBadRequest)
+		return nil, false
+	}
+
+	side, err := models.ParseRateSide(query.Get("side"))
+	if err != nil {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return nil, false
+	}
+
+	now := time.Now().UTC()
+	endDate := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if value := query.Get("end_date"); value != "" {
+		if endDate, err = time.Parse("2006-01-02", value); err != nil {
+			utils.JSONResponse(w, map[string]string{"error": "Invalid end_date, expected YYYY-MM-DD"}, http.StatusBadRequest)
+			return nil, false
+		}
+	}
+	startDate := endDate.AddDate(0, -1, 0)
+	if value := query.Get("start_date"); value != "" {
+		if startDate, err = time.Parse("2006-01-02", value); err != nil {
+			utils.JSONResponse(w, map[string]string{"error": "Invalid start_date, expected YYYY-MM-DD"}, http.StatusBadRequest)
+			return nil, false
+		}
+	}
+
+	series, err := service.GetPairSeries(base, quote, query.Get("source"), side, startDate, endDate)
+	switch {
+	case err == nil:
+		return series, true
+	case errors.Is(err, services.ErrBaseCurrencyRequired), errors.Is(err, services.ErrInvalidDateRange):
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+	case errors.Is(err, services.ErrCurrencyNotAllowed):
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusForbidden)
+	case errors.Is(err, services.ErrRateNotFound):
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusNotFound)
+	default:
+		log.Printf("Error loading %s/%s rate series: %v", base, quote, err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+	}
+	return nil, false
+}
@@ -0,0 +1,240 @@
+// internal/controllers/rate_stream_controller.go
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/services"
+	"github.com/abduls21985/exchange-rate-service/internal/utils"
+	"github.com/abduls21985/exchange-rate-service/pkg/middleware"
+)
+
+// streamWriteTimeout bounds each write to a WebSocket client
+const streamWriteTimeout = 10 * time.Second
+
+// streamRetry is the reconnection delay, in milliseconds, suggested to event stream clients
+const streamRetry = 5000
+
+// rateStreamUpgrader upgrades stream requests to WebSockets. Its default origin check
+// only admits pages served from this host.
+var rateStreamUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// RateStreamController handles HTTP requests that stream rate updates
+type RateStreamController struct {
+	Service services.RateStreamService
+	MDAs    services.MDAService
+}
+
+// NewRateStreamController creates a new RateStreamController
+func NewRateStreamController(service services.RateStreamService, mdaService services.MDAService) *RateStreamController {
+	return &RateStreamController{Service: service, MDAs: mdaService}
+}
+
+// StreamRates handles GET /api/exchange-rates/stream, pushing the rates of each stored
+// snapshot as server-sent events, or as WebSocket messages when the request is a
+// WebSocket handshake. The stream can be narrowed with ?source=, ?currencies=USD,EUR
+// and ?base=. A client resumes after reconnecting by sending the last snapshot ID it
+// received as the Last-Event-ID header or ?last_snapshot_id=.
+func (c *RateStreamController) StreamRates(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	lastSnapshotID, err := parseLastSnapshotID(r)
+	if err != nil {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	tenant, ok := c.tenant(w, r)
+	if !ok {
+		return
+	}
+
+	filter := services.RateStreamFilter{
+		Tenant: tenant,
+		Source: query.Get("source"),
+		Base:   strings.ToUpper(strings.TrimSpace(query.Get("base"))),
+	}
+	for _, code := range strings.Split(query.Get("currencies"), ",") {
+		if code = strings.ToUpper(strings.TrimSpace(code)); code != "" {
+			filter.Currencies = append(filter.Currencies, code)
+		}
+	}
+
+	// Close the stream after the maximum duration so the client authenticates again
+	options := c.Service.Options()
+	ctx, cancel := context.WithTimeout(r.Context(), options.MaxDuration)
+	defer cancel()
+
+	subscription, err := c.Service.Subscribe(ctx, filter, lastSnapshotID)
+	if errors.Is(err, services.ErrCurrencyNotAllowed) {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		log.Printf("Error subscribing to the rate stream: %v", err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	if websocket.IsWebSocketUpgrade(r) {
+		c.streamWebSocket(w, r, cancel, subscription, options.Heartbeat)
+	} else {
+		c.streamEvents(w, subscription, options.Heartbeat)
+	}
+
+	// Updates is closed once the subscription has wound down
+	cancel()
+	for range subscription.Updates {
+	}
+	if err := subscription.Err(); err != nil {
+		log.Printf("Rate stream of %s ended: %v", middleware.UsernameFromContext(r.Context()), err)
+	}
+}
+
+// streamEvents writes the subscription's updates as server-sent events until it ends
+func (c *RateStreamController) streamEvents(w http.ResponseWriter, subscription *services.RateSubscription, heartbeat time.Duration) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		utils.JSONResponse(w, map[string]string{"error": "Streaming is not supported"}, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Stop reverse proxies from buffering events
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry)
+	flusher.Flush()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case update, ok := <-subscription.Updates:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(update)
+			if err != nil {
+				log.Printf("Error encoding rate update %d: %v", update.SnapshotID, err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: rates\ndata: %s\n\n", update.SnapshotID, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// streamWebSocket upgrades the connection and writes the subscription's updates as JSON
+// messages until it ends. cancel ends the subscription when the client goes away.
+func (c *RateStreamController) streamWebSocket(w http.ResponseWriter, r *http.Request, cancel context.CancelFunc, subscription *services.RateSubscription, heartbeat time.Duration) {
+	conn, err := rateStreamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already responded to the client
+		cancel()
+		return
+	}
+	defer conn.Close()
+
+	// Clients only send pongs and close frames; a missed pong means the client is gone
+	go func() {
+		defer cancel()
+		conn.SetReadLimit(512)
+		conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+		})
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case update, ok := <-subscription.Updates:
+			if !ok {
+				// Tell the client whether to resume straight away or the session simply ended
+				code, reason := websocket.CloseNormalClosure, "stream ended"
+				if errors.Is(subscription.Err(), services.ErrStreamOverflow) {
+					code, reason = websocket.CloseTryAgainLater, "fell behind; resume from the last snapshot_id"
+				}
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(streamWriteTimeout))
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if err := conn.WriteJSON(update); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// tenant loads the caller's MDA, nil for users outside any MDA. If the MDA cannot be
+// loaded it writes the error response and returns false.
+func (c *RateStreamController) tenant(w http.ResponseWriter, r *http.Request) (*models.MDA, bool) {
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok || principal.MdaID == "" {
+		return nil, true
+	}
+
+	mda, err := c.MDAs.GetMDA(principal.MdaID)
+	if errors.Is(err, services.ErrMDANotFound) {
+		utils.JSONResponse(w, map[string]string{"error": "Your MDA is not registered"}, http.StatusForbidden)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Error loading MDA %s: %v", principal.MdaID, err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return nil, false
+	}
+	return mda, true
+}
+
+// parseLastSnapshotID reads the snapshot a client resumes from, preferring the
+// Last-Event-ID header that event stream clients send when reconnecting
+func parseLastSnapshotID(r *http.Request) (uint, error) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_snapshot_id")
+	}
+	if value == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid last snapshot ID %q", value)
+	}
+	return uint(id), nil
+}
@@ -2,38 +2,32 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/abduls21985/exchange-rate-service/internal/models"
 	"github.com/abduls21985/exchange-rate-service/internal/services"
+	"github.com/abduls21985/exchange-rate-service/pkg/middleware"
+	"github.com/gorilla/mux"
 )
 
 type UserController struct {
 	Service services.UserService
+	Auth    services.AuthService
+	Audit   services.AuditService
 }
 
-// NewUserController creates a new instance of UserController
-func NewUserController(service services.UserService) *UserController {
-	return &UserController{Service: service}
+// NewUserController creates a new instance of UserController. The auth service is used to
+// end a user's sessions when they are deactivated or their password is reset.
+func NewUserController(service services.UserService, authService services.AuthService, audit services.AuditService) *UserController {
+	return &UserController{Service: service, Auth: authService, Audit: audit}
 }
 
 // RegisterUser handles POST /api/register
 func (c *UserController) RegisterUser(w http.ResponseWriter, r *http.Request) {
-	// Define a struct to receive the registration payload
-	var req struct {
-		FirstName   string `json:"first_name"`
-		LastName    string `json:"last_name"`
-		Email       string `json:"email"`
-		Username    string `json:"username"`
-		PhoneNumber string `json:"phone_number"`
-		Password    string `json:"password"`
-		MdaID       string `json:"mda_id"`
-		MDA         string `json:"mda"`
-		Role        string `json:"role"`
-	}
-
-	// Decode the incoming JSON request into the req struct
+	var req RegisterUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
@@ -47,45 +41,134 @@ func (c *UserController) RegisterUser(w http.ResponseWriter, r *http.Request) {
 		Username:    req.Username,
 		PhoneNumber: req.PhoneNumber,
 		Password:    req.Password, // Note: Password will be hashed in the service layer
-		MdaID:       req.MdaID,
-		MDA:         req.MDA,
-		Role:        req.Role,
 	}
 
 	// Call the service to register the user
 	newUser, err := c.Service.RegisterUser(&user)
-	if err != nil {
+	switch {
+	case errors.Is(err, services.ErrUserExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, services.ErrWeakPassword), errors.Is(err, services.ErrInvalidEmail):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
 		log.Printf("Error registering user: %v", err)
 		http.Error(w, "Failed to register user", http.StatusInternalServerError)
 		return
 	}
 
+	c.Audit.RecordLogged(auditUserEntry(r, models.AuditUserRegistered, newUser, nil))
+
 	// Respond with the newly created user
-	jsonResponse(w, newUser, http.StatusCreated)
+	jsonResponse(w, newUserResponse(newUser), http.StatusCreated)
 }
 
-// UpdateUser handles PUT /api/users/{id}
-func (c *UserController) UpdateUser(w http.ResponseWriter, r *http.Request) {
-	var user models.User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+// GetMe handles GET /api/me
+func (c *UserController) GetMe(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := c.Service.GetUserByUsername(principal.Username)
+	if err != nil {
+		log.Printf("Error fetching user %s: %v", principal.Username, err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	jsonResponse(w, newUserResponse(user), http.StatusOK)
+}
+
+// UpdateMe handles PUT /api/me
+func (c *UserController) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var req UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if err := c.Service.UpdateUser(&user); err != nil {
+	user, err := c.Service.UpdateProfile(principal.Username, models.UserProfile{
+		FirstName:       req.FirstName,
+		LastName:        req.LastName,
+		Email:           req.Email,
+		PhoneNumber:     req.PhoneNumber,
+		CurrentPassword: req.CurrentPassword,
+	})
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	case errors.Is(err, services.ErrUserExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, services.ErrInvalidEmail), errors.Is(err, services.ErrPasswordRequired):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, services.ErrInvalidPassword):
+		http.Error(w, "Current password is incorrect", http.StatusForbidden)
+		return
+	case err != nil:
 		log.Printf("Error updating user: %v", err)
 		http.Error(w, "Failed to update user", http.StatusInternalServerError)
 		return
 	}
 
-	jsonResponse(w, map[string]string{"message": "User updated successfully"}, http.StatusOK)
+	c.Audit.RecordLogged(auditUserEntry(r, models.AuditProfileUpdated, user, map[string]interface{}{"email": user.Email}))
+
+	jsonResponse(w, newUserResponse(user), http.StatusOK)
 }
 
-// InitiatePasswordReset handles POST /api/password-reset/initiate
-func (c *UserController) InitiatePasswordReset(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Email string `json:"email"`
+// ChangePassword handles PUT /api/me/password
+func (c *UserController) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
 	}
+
+	err := c.Service.ChangePassword(principal.Username, req.CurrentPassword, req.NewPassword)
+	switch {
+	case errors.Is(err, services.ErrInvalidPassword):
+		http.Error(w, "Current password is incorrect", http.StatusForbidden)
+		return
+	case errors.Is(err, services.ErrWeakPassword):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Printf("Error changing password: %v", err)
+		http.Error(w, "Failed to change password", http.StatusInternalServerError)
+		return
+	}
+
+	c.Audit.RecordLogged(auditEntry(r, models.AuditPasswordChanged, principal.Username, nil))
+
+	// Whoever knew the old password must not stay logged in elsewhere
+	if _, err := c.Auth.LogoutOtherSessions(principal.Username, principal.SessionID); err != nil {
+		log.Printf("Error revoking other sessions of %s after password change: %v", principal.Username, err)
+	}
+
+	jsonResponse(w, map[string]string{"message": "Password changed successfully"}, http.StatusOK)
+}
+
+// InitiatePasswordReset handles POST /api/password-reset/initiate. The response is the
+// same whether or not the email is registered, so it cannot be used to discover accounts.
+func (c *UserController) InitiatePasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req PasswordResetInitiateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
@@ -94,33 +177,275 @@ func (c *UserController) InitiatePasswordReset(w http.ResponseWriter, r *http.Re
 	user, err := c.Service.InitiatePasswordReset(req.Email)
 	if err != nil {
 		log.Printf("Error initiating password reset: %v", err)
-		http.Error(w, "Failed to initiate password reset", http.StatusInternalServerError)
-		return
+	} else {
+		c.Audit.RecordLogged(auditUserEntry(r, models.AuditPasswordResetRequested, user, nil))
 	}
 
-	jsonResponse(w, map[string]string{"message": "Password reset link sent", "email": user.Email}, http.StatusOK)
+	jsonResponse(w, map[string]string{"message": "If the email is registered, a password reset link has been sent"}, http.StatusOK)
 }
 
 // ResetPassword handles POST /api/password-reset/complete
 func (c *UserController) ResetPassword(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Token       string `json:"token"`
-		NewPassword string `json:"new_password"`
-	}
+	var req PasswordResetCompleteRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if err := c.Service.ResetPassword(req.Token, req.NewPassword); err != nil {
+	user, err := c.Service.ResetPassword(req.Token, req.NewPassword)
+	switch {
+	case errors.Is(err, services.ErrInvalidResetToken), errors.Is(err, services.ErrWeakPassword):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
 		log.Printf("Error resetting password: %v", err)
 		http.Error(w, "Failed to reset password", http.StatusInternalServerError)
 		return
 	}
 
+	c.Audit.RecordLogged(auditUserEntry(r, models.AuditPasswordReset, user, nil))
+
+	// Whoever knew the old password must not stay logged in
+	if _, err := c.Auth.LogoutAll(user.Username); err != nil {
+		log.Printf("Error revoking sessions of %s after password reset: %v", user.Username, err)
+	}
+
 	jsonResponse(w, map[string]string{"message": "Password reset successful"}, http.StatusOK)
 }
 
+// ListUsers handles GET /api/admin/users?q=&role=&active=&limit=&offset=
+func (c *UserController) ListUsers(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	limit, offset, err := parsePagination(query.Get("limit"), query.Get("offset"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter := models.UserFilter{
+		Search: query.Get("q"),
+		Limit:  limit,
+		Offset: offset,
+	}
+	if roleName := query.Get("role"); roleName != "" {
+		if filter.Role, err = models.ParseRole(roleName); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if activeStr := query.Get("active"); activeStr != "" {
+		active, err := strconv.ParseBool(activeStr)
+		if err != nil {
+			http.Error(w, "Invalid active filter, expected true or false", http.StatusBadRequest)
+			return
+		}
+		filter.Active = &active
+	}
+
+	// Admins of an MDA only see that MDA's users
+	users, total, err := c.Service.ListUsers(principal.MdaID, filter)
+	if err != nil {
+		log.Printf("Error listing users: %v", err)
+		http.Error(w, "Failed to list users", http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]UserResponse, len(users))
+	for i := range users {
+		response[i] = newUserResponse(&users[i])
+	}
+
+	jsonResponse(w, map[string]interface{}{
+		"data":   response,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	}, http.StatusOK)
+}
+
+// GetUser handles GET /api/admin/users/{username}
+func (c *UserController) GetUser(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := c.Service.GetUser(principal.MdaID, mux.Vars(r)["username"])
+	if errors.Is(err, services.ErrUserNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching user: %v", err)
+		http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, newUserResponse(user), http.StatusOK)
+}
+
+// DeactivateUser handles POST /api/admin/users/{username}/deactivate
+func (c *UserController) DeactivateUser(w http.ResponseWriter, r *http.Request) {
+	c.setActive(w, r, false)
+}
+
+// ReactivateUser handles POST /api/admin/users/{username}/reactivate
+func (c *UserController) ReactivateUser(w http.ResponseWriter, r *http.Request) {
+	c.setActive(w, r, true)
+}
+
+// setActive deactivates or reactivates the user named in the path
+func (c *UserController) setActive(w http.ResponseWriter, r *http.Request, active bool) {
+	username := mux.Vars(r)["username"]
+
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	if principal.Username == username {
+		http.Error(w, "You cannot change the status of your own account", http.StatusForbidden)
+		return
+	}
+
+	user, err := c.Service.SetActive(principal.MdaID, username, active)
+	if errors.Is(err, services.ErrUserNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error changing status of %s: %v", username, err)
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+
+	if !active {
+		if _, err := c.Auth.LogoutAll(username); err != nil {
+			log.Printf("Error revoking sessions of %s: %v", username, err)
+		}
+		c.Audit.RecordLogged(auditUserEntry(r, models.AuditUserDeactivated, user, nil))
+	} else {
+		c.Audit.RecordLogged(auditUserEntry(r, models.AuditUserReactivated, user, nil))
+	}
+
+	jsonResponse(w, newUserResponse(user), http.StatusOK)
+}
+
+// LogoutUser handles POST /api/admin/users/{username}/logout, ending every session of
+// the user
+func (c *UserController) LogoutUser(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	// Admins of an MDA can only log out that MDA's users
+	user, err := c.Service.GetUser(principal.MdaID, username)
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error looking up %s: %v", username, err)
+		http.Error(w, "Failed to log out user", http.StatusInternalServerError)
+		return
+	}
+
+	count, err := c.Auth.LogoutAll(username)
+	if err != nil {
+		log.Printf("Error revoking sessions of %s: %v", username, err)
+		http.Error(w, "Failed to log out user", http.StatusInternalServerError)
+		return
+	}
+
+	c.Audit.RecordLogged(auditUserEntry(r, models.AuditSessionsRevoked, user, map[string]interface{}{"sessions_revoked": count}))
+
+	jsonResponse(w, map[string]interface{}{"message": "User logged out of all sessions", "sessions_revoked": count}, http.StatusOK)
+}
+
+// ChangeRole handles PUT /api/admin/users/{username}/role
+func (c *UserController) ChangeRole(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+
+	var req ChangeRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	role, err := models.ParseRole(req.Role)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Admins cannot demote themselves, so there is always someone able to grant roles
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	if principal.Username == username {
+		http.Error(w, "You cannot change your own role", http.StatusForbidden)
+		return
+	}
+
+	// Admins of an MDA can only manage that MDA's users
+	user, err := c.Service.ChangeRole(principal.MdaID, username, role)
+	if errors.Is(err, services.ErrUserNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error changing role of %s: %v", username, err)
+		http.Error(w, "Failed to change role", http.StatusInternalServerError)
+		return
+	}
+
+	c.Audit.RecordLogged(auditUserEntry(r, models.AuditRoleChanged, user, map[string]interface{}{"role": user.Role}))
+
+	jsonResponse(w, newUserResponse(user), http.StatusOK)
+}
+
+// AssignMDA handles PUT /api/admin/users/{username}/mda
+func (c *UserController) AssignMDA(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+
+	var req AssignMDARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := c.Service.AssignMDA(username, req.MdaID)
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	case errors.Is(err, services.ErrMDANotFound), errors.Is(err, services.ErrMDAUserLimit):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Printf("Error assigning %s to MDA %s: %v", username, req.MdaID, err)
+		http.Error(w, "Failed to assign MDA", http.StatusInternalServerError)
+		return
+	}
+
+	c.Audit.RecordLogged(auditUserEntry(r, models.AuditMDAAssigned, user, map[string]interface{}{"mda_id": user.MdaID}))
+
+	jsonResponse(w, newUserResponse(user), http.StatusOK)
+}
+
 // Helper function to write JSON responses
 func jsonResponse(w http.ResponseWriter, data interface{}, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
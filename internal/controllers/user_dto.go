@@ -0,0 +1,97 @@
+// internal/controllers/user_dto.go
+
+package controllers
+
+import (
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+)
+
+// RegisterUserRequest is the payload of POST /api/register. Role, ownership, MDA and
+// activation are not accepted from the caller.
+type RegisterUserRequest struct {
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	Email       string `json:"email"`
+	Username    string `json:"username"`
+	PhoneNumber string `json:"phone_number"`
+	Password    string `json:"password"`
+}
+
+// UpdateProfileRequest is the payload of PUT /api/me; omitted fields are left unchanged.
+// Changing the email address also needs the current password.
+type UpdateProfileRequest struct {
+	FirstName       string `json:"first_name"`
+	LastName        string `json:"last_name"`
+	Email           string `json:"email"`
+	PhoneNumber     string `json:"phone_number"`
+	CurrentPassword string `json:"current_password"`
+}
+
+// ChangePasswordRequest is the payload of PUT /api/me/password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// PasswordResetInitiateRequest is the payload of POST /api/password-reset/initiate
+type PasswordResetInitiateRequest struct {
+	Email string `json:"email"`
+}
+
+// PasswordResetCompleteRequest is the payload of POST /api/password-reset/complete
+type PasswordResetCompleteRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// ChangeRoleRequest is the payload of PUT /api/admin/users/{username}/role
+type ChangeRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// AssignMDARequest is the payload of PUT /api/admin/users/{username}/mda
+type AssignMDARequest struct {
+	MdaID string `json:"mda_id"` // Empty removes the user from their MDA
+}
+
+// UserResponse is the public view of a user; credentials and reset tokens are never exposed
+type UserResponse struct {
+	ID            uint        `json:"id"`
+	FirstName     string      `json:"first_name"`
+	LastName      string      `json:"last_name"`
+	Email         string      `json:"email"`
+	Username      string      `json:"username"`
+	PhoneNumber   string      `json:"phone_number,omitempty"`
+	MdaID         string      `json:"mda_id,omitempty"`
+	MDA           string      `json:"mda,omitempty"`
+	Role          models.Role `json:"role"`
+	IsOwner       bool        `json:"is_owner"`
+	MFAEnabled    bool        `json:"mfa_enabled"`
+	Active        bool        `json:"active"`
+	DeactivatedAt *time.Time  `json:"deactivated_at,omitempty"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+}
+
+// newUserResponse maps a user onto its public view
+func newUserResponse(user *models.User) UserResponse {
+	return UserResponse{
+		ID:            user.ID,
+		FirstName:     user.FirstName,
+		LastName:      user.LastName,
+		Email:         user.Email,
+		Username:      user.Username,
+		PhoneNumber:   user.PhoneNumber,
+		MdaID:         user.MdaID,
+		MDA:           user.MDA,
+		Role:          user.Role,
+		IsOwner:       user.IsOwner,
+		MFAEnabled:    user.MFAEnabled,
+		Active:        user.Active,
+		DeactivatedAt: user.DeactivatedAt,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+	}
+}
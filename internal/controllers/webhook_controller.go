@@ -0,0 +1,294 @@
+// internal/controllers/webhook_controller.go
+
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/services"
+	"github.com/abduls21985/exchange-rate-service/internal/utils"
+	"github.com/abduls21985/exchange-rate-service/pkg/middleware"
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+)
+
+// WebhookController handles HTTP requests for managing the webhook subscriptions of the
+// caller's MDA
+type WebhookController struct {
+	Service services.WebhookService
+	Audit   services.AuditService
+}
+
+// NewWebhookController creates a new WebhookController
+func NewWebhookController(service services.WebhookService, audit services.AuditService) *WebhookController {
+	return &WebhookController{Service: service, Audit: audit}
+}
+
+// webhookRequest is the payload for creating or updating a webhook subscription
+type webhookRequest struct {
+	URL              string          `json:"url"`
+	Secret           string          `json:"secret"`
+	Events           []string        `json:"events"`
+	Currencies       []string        `json:"currencies"`
+	ThresholdPercent decimal.Decimal `json:"threshold_percent"`
+	Active           *bool           `json:"active"`
+}
+
+// toSettings maps the request onto subscription settings
+func (req webhookRequest) toSettings() models.WebhookSubscriptionSettings {
+	return models.WebhookSubscriptionSettings{
+		URL:              req.URL,
+		Secret:           req.Secret,
+		Events:           req.Events,
+		Currencies:       req.Currencies,
+		ThresholdPercent: req.ThresholdPercent,
+		Active:           req.Active,
+	}
+}
+
+// CreateWebhook handles POST /api/webhooks. The secret is only ever shown in this response.
+func (c *WebhookController) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		utils.JSONResponse(w, map[string]string{"error": "Authentication required"}, http.StatusUnauthorized)
+		return
+	}
+
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JSONResponse(w, map[string]string{"error": "Invalid request payload"}, http.StatusBadRequest)
+		return
+	}
+
+	subscription, secret, err := c.Service.CreateSubscription(principal.MdaID, principal.Username, req.toSettings())
+	if !c.checkSettingsError(w, err) {
+		return
+	}
+
+	c.recordWebhook(r, models.AuditWebhookCreated, subscription)
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   subscription,
+		"secret": secret,
+		"status": "Webhook created successfully; store the secret now, it will not be shown again",
+	}, http.StatusCreated)
+}
+
+// ListWebhooks handles GET /api/webhooks
+func (c *WebhookController) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		utils.JSONResponse(w, map[string]string{"error": "Authentication required"}, http.StatusUnauthorized)
+		return
+	}
+
+	subscriptions, err := c.Service.ListSubscriptions(principal.MdaID)
+	if err != nil {
+		log.Printf("Error listing webhooks: %v", err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   subscriptions,
+		"status": "Webhooks fetched successfully",
+	}, http.StatusOK)
+}
+
+// GetWebhook handles GET /api/webhooks/{id}
+func (c *WebhookController) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	principal, id, ok := c.webhookRequest(w, r)
+	if !ok {
+		return
+	}
+
+	subscription, err := c.Service.GetSubscription(principal.MdaID, id)
+	if !c.checkLookupError(w, id, err) {
+		return
+	}
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   subscription,
+		"status": "Webhook fetched successfully",
+	}, http.StatusOK)
+}
+
+// UpdateWebhook handles PUT /api/webhooks/{id}. The secret is only replaced when the
+// payload contains one.
+func (c *WebhookController) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	principal, id, ok := c.webhookRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.JSONResponse(w, map[string]string{"error": "Invalid request payload"}, http.StatusBadRequest)
+		return
+	}
+
+	subscription, err := c.Service.UpdateSubscription(principal.MdaID, id, req.toSettings())
+	if errors.Is(err, services.ErrWebhookNotFound) {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusNotFound)
+		return
+	}
+	if !c.checkSettingsError(w, err) {
+		return
+	}
+
+	c.recordWebhook(r, models.AuditWebhookUpdated, subscription)
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   subscription,
+		"status": "Webhook updated successfully",
+	}, http.StatusOK)
+}
+
+// DeleteWebhook handles DELETE /api/webhooks/{id}
+func (c *WebhookController) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	principal, id, ok := c.webhookRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err := c.Service.DeleteSubscription(principal.MdaID, id)
+	if !c.checkLookupError(w, id, err) {
+		return
+	}
+
+	c.Audit.RecordLogged(auditEntry(r, models.AuditWebhookDeleted, strconv.FormatUint(uint64(id), 10), nil))
+
+	utils.JSONResponse(w, map[string]string{"status": "Webhook deleted successfully"}, http.StatusOK)
+}
+
+// ListDeliveries handles GET /api/webhooks/{id}/deliveries, optionally filtered by
+// ?status=pending|succeeded|failed
+func (c *WebhookController) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	principal, id, ok := c.webhookRequest(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	limit, offset, err := parsePagination(query.Get("limit"), query.Get("offset"))
+	if err != nil {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	deliveries, err := c.Service.ListDeliveries(principal.MdaID, id, query.Get("status"), limit, offset)
+	if errors.Is(err, services.ErrInvalidWebhookSettings) {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if !c.checkLookupError(w, id, err) {
+		return
+	}
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   deliveries,
+		"limit":  limit,
+		"offset": offset,
+		"status": "Webhook deliveries fetched successfully",
+	}, http.StatusOK)
+}
+
+// ReplayDelivery handles POST /api/webhooks/{id}/deliveries/{deliveryID}/replay,
+// queueing the delivery's event to be sent again
+func (c *WebhookController) ReplayDelivery(w http.ResponseWriter, r *http.Request) {
+	principal, id, ok := c.webhookRequest(w, r)
+	if !ok {
+		return
+	}
+
+	deliveryID, err := strconv.ParseUint(mux.Vars(r)["deliveryID"], 10, 64)
+	if err != nil {
+		utils.JSONResponse(w, map[string]string{"error": "Invalid delivery ID"}, http.StatusBadRequest)
+		return
+	}
+
+	replay, err := c.Service.ReplayDelivery(principal.MdaID, id, uint(deliveryID))
+	if errors.Is(err, services.ErrDeliveryNotFound) {
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusNotFound)
+		return
+	}
+	if !c.checkLookupError(w, id, err) {
+		return
+	}
+
+	c.Audit.RecordLogged(auditEntry(r, models.AuditWebhookReplayed, strconv.FormatUint(uint64(id), 10), map[string]interface{}{
+		"delivery_id": deliveryID,
+		"replay_id":   replay.ID,
+		"event_id":    replay.EventID,
+	}))
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"data":   replay,
+		"status": "Webhook delivery queued for replay",
+	}, http.StatusAccepted)
+}
+
+// webhookRequest reads the principal and the subscription ID from the path, writing the
+// error response itself when either is missing
+func (c *WebhookController) webhookRequest(w http.ResponseWriter, r *http.Request) (*middleware.Principal, uint, bool) {
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		utils.JSONResponse(w, map[string]string{"error": "Authentication required"}, http.StatusUnauthorized)
+		return nil, 0, false
+	}
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		utils.JSONResponse(w, map[string]string{"error": "Invalid webhook ID"}, http.StatusBadRequest)
+		return nil, 0, false
+	}
+	return principal, uint(id), true
+}
+
+// checkLookupError writes the response for an error from an operation on a subscription,
+// and reports whether the operation succeeded
+func (c *WebhookController) checkLookupError(w http.ResponseWriter, id uint, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, services.ErrWebhookNotFound):
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusNotFound)
+	default:
+		log.Printf("Error handling webhook %d: %v", id, err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+	}
+	return false
+}
+
+// checkSettingsError writes the response for an error from saving a subscription's
+// settings, and reports whether they were saved
+func (c *WebhookController) checkSettingsError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, services.ErrInvalidWebhookSettings):
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
+	case errors.Is(err, services.ErrCurrencyNotAllowed):
+		utils.JSONResponse(w, map[string]string{"error": err.Error()}, http.StatusForbidden)
+	default:
+		log.Printf("Error saving webhook: %v", err)
+		utils.JSONResponse(w, map[string]string{"error": "Internal Server Error"}, http.StatusInternalServerError)
+	}
+	return false
+}
+
+// recordWebhook audits the creation or change of a subscription; the secret is never logged
+func (c *WebhookController) recordWebhook(r *http.Request, eventType string, subscription *models.WebhookSubscription) {
+	c.Audit.RecordLogged(auditEntry(r, eventType, strconv.FormatUint(uint64(subscription.ID), 10), map[string]interface{}{
+		"url":               subscription.URL,
+		"events":            subscription.Events,
+		"currencies":        subscription.Currencies,
+		"threshold_percent": subscription.ThresholdPercent,
+		"active":            subscription.Active,
+	}))
+}
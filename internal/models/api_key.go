@@ -0,0 +1,72 @@
+// internal/models/api_key.go
+
+package models
+
+import (
+	"net"
+	"time"
+)
+
+// APIKeyScopes are the scopes an API key can be granted. They are the names of the
+// permissions in routes/permissions.go that machine clients may need; a key can never
+// do more than the role of the user who created it.
+var APIKeyScopes = []string{"rates:read", "rates:analyze", "rates:publish"}
+
+// APIKey represents the api_keys table: a credential for unattended clients that acts
+// on behalf of the user who created it. Only the hash of the key is stored; Prefix is
+// the first part of the key, kept in clear so that keys can be told apart.
+type APIKey struct {
+	ID      uint     `gorm:"primaryKey" json:"id"`
+	Name    string   `gorm:"size:100;not null" json:"name"`
+	Prefix  string   `gorm:"size:16;not null;uniqueIndex" json:"prefix"`
+	KeyHash string   `gorm:"size:64;not null" json:"-"`
+	UserID  uint     `gorm:"not null;index" json:"-"`
+	Scopes  []string `gorm:"serializer:json" json:"scopes"`
+	// AllowedIPs restricts the addresses or CIDR ranges the key may be used from; empty allows all
+	AllowedIPs []string   `gorm:"serializer:json" json:"allowed_ips"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `gorm:"size:45" json:"last_used_ip,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// TableName keeps GORM from deriving an awkward name from the acronym
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// Expired reports whether the key has passed its expiry
+func (k *APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// AllowsIP reports whether the key may be used from the address
+func (k *APIKey) AllowsIP(ipAddress string) bool {
+	if len(k.AllowedIPs) == 0 {
+		return true
+	}
+
+	ip := net.ParseIP(ipAddress)
+	if ip == nil {
+		return false
+	}
+	for _, allowed := range k.AllowedIPs {
+		if _, network, err := net.ParseCIDR(allowed); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if allowedIP := net.ParseIP(allowed); allowedIP != nil && allowedIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeySettings are the caller-controlled fields of an API key
+type APIKeySettings struct {
+	Name       string
+	Scopes     []string
+	AllowedIPs []string
+	ExpiresAt  *time.Time
+}
@@ -0,0 +1,147 @@
+// internal/models/audit_event.go
+
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Audit event types
+const (
+	AuditRatesIngested          = "rates.ingested"   // A provider publication was stored
+	AuditRatesPosted            = "rates.posted"     // Rates were submitted through the API
+	AuditLargeConversion        = "conversion.large" // A conversion at or above the configured amount
+	AuditLoginSucceeded         = "auth.login_succeeded"
+	AuditLoginFailed            = "auth.login_failed"
+	AuditLoginLocked            = "auth.login_locked"   // Repeated failures locked out a username or IP
+	AuditLoginUnlocked          = "auth.login_unlocked" // An admin lifted a lockout
+	AuditMFAFailed              = "auth.mfa_failed"
+	AuditRecoveryCodeUsed       = "auth.recovery_code_used"
+	AuditPasswordResetRequested = "auth.password_reset_requested"
+	AuditPasswordReset          = "auth.password_reset" // A password was reset with a reset token
+	AuditUserRegistered         = "user.registered"
+	AuditProfileUpdated         = "user.profile_updated"
+	AuditPasswordChanged        = "user.password_changed"
+	AuditUserDeactivated        = "user.deactivated"
+	AuditUserReactivated        = "user.reactivated"
+	AuditRoleChanged            = "user.role_changed"
+	AuditMDAAssigned            = "user.mda_assigned"
+	AuditSessionsRevoked        = "user.sessions_revoked" // An admin logged a user out everywhere
+	AuditMFAEnabled             = "user.mfa_enabled"
+	AuditMFADisabled            = "user.mfa_disabled" // By the user, or by an admin for a lost device
+	AuditRecoveryCodesReissued  = "user.recovery_codes_reissued"
+	AuditMFAPolicyChanged       = "mfa.policy_changed"
+	AuditAPIKeyCreated          = "api_key.created"
+	AuditAPIKeyUpdated          = "api_key.updated"
+	AuditAPIKeyDeleted          = "api_key.deleted"
+	AuditMDACreated             = "mda.created"
+	AuditMDAUpdated             = "mda.updated"
+	AuditWebhookCreated         = "webhook.created"
+	AuditWebhookUpdated         = "webhook.updated"
+	AuditWebhookDeleted         = "webhook.deleted"
+	AuditWebhookReplayed        = "webhook.delivery_replayed"
+	AuditBackfillCreated        = "backfill.created"
+	AuditBackfillResumed        = "backfill.resumed"
+)
+
+const (
+	// AuditSystemActor is the actor of events caused by scheduled jobs rather than a user
+	AuditSystemActor = "system"
+	// AuditCommandActor is the actor of events caused by command-line subcommands
+	AuditCommandActor = "command-line"
+)
+
+// AuditDetails is the JSON object of event-specific fields. It is stored as the exact
+// text that was hashed, so re-encoding can never change an event's hash.
+type AuditDetails string
+
+// MarshalJSON embeds the details as a JSON object rather than a string
+func (d AuditDetails) MarshalJSON() ([]byte, error) {
+	if d == "" {
+		return []byte("null"), nil
+	}
+	return []byte(d), nil
+}
+
+// AuditEvent represents the audit_events table. Events are only ever appended: each
+// one stores the hash of its predecessor and a hash over its own fields and that link,
+// so altering or removing an event breaks the chain from that point on.
+type AuditEvent struct {
+	ID         uint         `gorm:"primaryKey" json:"id"`
+	OccurredAt time.Time    `gorm:"not null;index" json:"occurred_at"`
+	Type       string       `gorm:"size:64;not null;index" json:"type"`
+	Actor      string       `gorm:"size:100;index" json:"actor"` // Username, AuditSystemActor or the name tried at login
+	ActorID    *uint        `json:"actor_id,omitempty"`
+	MdaID      string       `gorm:"size:50;not null;default:'';index" json:"mda_id,omitempty"` // Tenant the event belongs to
+	Target     string       `gorm:"size:150" json:"target,omitempty"`                          // What the action was applied to
+	IPAddress  string       `gorm:"size:45" json:"ip_address,omitempty"`
+	Details    AuditDetails `gorm:"type:text" json:"details"`
+	PrevHash   string       `gorm:"size:64" json:"prev_hash"`
+	Hash       string       `gorm:"size:64;not null;uniqueIndex" json:"hash"`
+}
+
+// ComputeHash returns the SHA-256 hash over the event's fields and PrevHash. OccurredAt
+// must already be truncated to the database's microsecond precision.
+func (e *AuditEvent) ComputeHash() string {
+	actorID := ""
+	if e.ActorID != nil {
+		actorID = strconv.FormatUint(uint64(*e.ActorID), 10)
+	}
+
+	fields := []string{
+		e.PrevHash,
+		e.OccurredAt.UTC().Format(time.RFC3339Nano),
+		e.Type,
+		e.Actor,
+		actorID,
+		e.MdaID,
+		e.Target,
+		e.IPAddress,
+		string(e.Details),
+	}
+	// Lengths are included so that moving text between fields changes the hash
+	var b strings.Builder
+	for _, field := range fields {
+		b.WriteString(strconv.Itoa(len(field)))
+		b.WriteByte(':')
+		b.WriteString(field)
+	}
+
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditEntry is an event to be recorded; the audit service turns it into a chained AuditEvent
+type AuditEntry struct {
+	Type      string
+	Actor     string
+	ActorID   uint
+	MdaID     string
+	Target    string
+	IPAddress string
+	Details   map[string]interface{}
+}
+
+// AuditFilter selects audit events. A nil MdaID selects every tenant.
+type AuditFilter struct {
+	MdaID  *string
+	Type   string
+	Actor  string
+	Target string
+	From   *time.Time
+	To     *time.Time
+	Limit  int
+	Offset int
+}
+
+// AuditVerification is the result of checking the hash chain
+type AuditVerification struct {
+	Checked        int    `json:"checked"`
+	Valid          bool   `json:"valid"`
+	FirstInvalidID uint   `json:"first_invalid_id,omitempty"`
+	Problem        string `json:"problem,omitempty"`
+}
@@ -0,0 +1,43 @@
+// internal/models/backfill_job.go
+
+package models
+
+import "time"
+
+// BackfillStatus is the lifecycle state of a backfill job
+type BackfillStatus string
+
+const (
+	BackfillPending   BackfillStatus = "pending"
+	BackfillRunning   BackfillStatus = "running"
+	BackfillCompleted BackfillStatus = "completed"
+	BackfillFailed    BackfillStatus = "failed"
+	// BackfillPartial is a job that reached its end date with days it could not fetch.
+	// Running it again retries those days.
+	BackfillPartial BackfillStatus = "partially_failed"
+)
+
+// BackfillJob represents the backfill_jobs table: a request to load historical rates
+// from a provider for a range of days. NextDate is the resume cursor; every day before
+// it has been fetched, skipped or recorded in FailedDates to be retried.
+type BackfillJob struct {
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	Provider    string         `gorm:"size:50;not null" json:"provider"`
+	StartDate   time.Time      `gorm:"not null" json:"start_date"`
+	EndDate     time.Time      `gorm:"not null" json:"end_date"`
+	NextDate    time.Time      `gorm:"not null" json:"next_date"`
+	Status      BackfillStatus `gorm:"size:20;not null;index" json:"status"`
+	TotalDays   int            `json:"total_days"`
+	FetchedDays int            `json:"fetched_days"`
+	SkippedDays int            `json:"skipped_days"`                                  // Days that already had a snapshot
+	FailedDays  int            `json:"failed_days"`                                   // Days still failing, as listed in FailedDates
+	FailedDates []string       `gorm:"serializer:json" json:"failed_dates,omitempty"` // YYYY-MM-DD days retried on the next run
+	LastError   string         `gorm:"size:500" json:"last_error,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+// ProcessedDays returns the number of days the job has dealt with so far
+func (j BackfillJob) ProcessedDays() int {
+	return j.FetchedDays + j.SkippedDays + j.FailedDays
+}
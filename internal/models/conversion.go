@@ -0,0 +1,73 @@
+// internal/models/conversion.go
+
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// FallbackPolicy decides which rate is used when none was published on the requested date
+type FallbackPolicy string
+
+const (
+	// FallbackPrevious uses the most recent rate published on or before the date,
+	// i.e. the previous business day when the date is a weekend or holiday
+	FallbackPrevious FallbackPolicy = "previous"
+	// FallbackNearest uses whichever rate is closest to the date, before or after it
+	FallbackNearest FallbackPolicy = "nearest"
+	// FallbackStrict only accepts a rate published on the date itself
+	FallbackStrict FallbackPolicy = "strict"
+)
+
+// ParseFallbackPolicy validates a fallback policy name. An empty value yields an empty
+// policy so that the caller can apply its configured default.
+func ParseFallbackPolicy(value string) (FallbackPolicy, error) {
+	switch policy := FallbackPolicy(value); policy {
+	case "", FallbackPrevious, FallbackNearest, FallbackStrict:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid fallback policy %q: must be previous, nearest or strict", value)
+	}
+}
+
+// ConversionRequest describes an amount to convert and how the rates should be chosen
+type ConversionRequest struct {
+	FromCurrency string
+	ToCurrency   string
+	Amount       decimal.Decimal
+	Source       string         // Empty to use the preferred sources
+	Side         RateSide       // Quote leg used for both currencies
+	At           *time.Time     // Date to convert on; nil for the latest rates
+	Fallback     FallbackPolicy // Empty to use the configured default
+}
+
+// ConversionLeg is one step of a conversion, using two rates from the same publication
+type ConversionLeg struct {
+	FromCurrency string          `json:"from_currency"`
+	ToCurrency   string          `json:"to_currency"`
+	Rate         decimal.Decimal `json:"rate"` // Units of ToCurrency per unit of FromCurrency
+	Base         string          `json:"base"` // Base currency both rates are quoted against
+	Source       string          `json:"source"`
+	Timestamp    time.Time       `json:"timestamp"`
+}
+
+// Conversion describes the result of converting an amount between two currencies
+type Conversion struct {
+	FromCurrency      string          `json:"from_currency"`
+	ToCurrency        string          `json:"to_currency"`
+	OriginalAmount    decimal.Decimal `json:"original_amount"`
+	ConvertedAmount   decimal.Decimal `json:"converted_amount"` // Rounded to the target currency's minor units
+	Rate              decimal.Decimal `json:"rate"`             // Units of ToCurrency per unit of FromCurrency
+	Side              RateSide        `json:"side"`             // Quote leg used for both currencies
+	Source            string          `json:"source"`           // Provider whose rates were used for the first leg
+	RequestedAt       *time.Time      `json:"requested_at,omitempty"`
+	Fallback          FallbackPolicy  `json:"fallback,omitempty"`
+	FromRateTimestamp time.Time       `json:"from_rate_timestamp"` // Timestamp of the FromCurrency rate used
+	ToRateTimestamp   time.Time       `json:"to_rate_timestamp"`   // Timestamp of the ToCurrency rate used
+	Path              []string        `json:"path"`                // Currencies visited, e.g. EUR, USD, NGN
+	Legs              []ConversionLeg `json:"legs"`
+	Warnings          []string        `json:"warnings,omitempty"` // Stale or mismatched legs
+}
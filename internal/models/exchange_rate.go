@@ -2,15 +2,63 @@
 
 package models
 
-import "time"
+import (
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ManualSource is the source recorded for rates posted directly to the API
+const ManualSource = "manual"
+
+// RateSide selects which leg of a quote is used in a conversion
+type RateSide string
+
+const (
+	BuySide  RateSide = "buy"
+	SellSide RateSide = "sell"
+	MidSide  RateSide = "mid"
+)
+
+// ParseRateSide validates a side name, defaulting to the mid rate when empty
+func ParseRateSide(value string) (RateSide, error) {
+	switch side := RateSide(value); side {
+	case "":
+		return MidSide, nil
+	case BuySide, SellSide, MidSide:
+		return side, nil
+	default:
+		return "", fmt.Errorf("invalid rate side %q: must be buy, sell or mid", value)
+	}
+}
+
+// Quote holds the buying, selling and mid rates for a currency when a provider publishes them
+type Quote struct {
+	Buy  decimal.Decimal `json:"buy"`
+	Sell decimal.Decimal `json:"sell"`
+	Mid  decimal.Decimal `json:"mid"`
+}
 
 // ExchangeRateData represents the incoming JSON structure
 type ExchangeRateData struct {
-	Timestamp int64              `json:"timestamp"`
-	Base      string             `json:"base"`
-	Rates     map[string]float64 `json:"rates"`
+	Timestamp int64                      `json:"timestamp"`
+	Base      string                     `json:"base"`
+	Source    string                     `json:"source,omitempty"` // Provider the rates came from
+	Rates     map[string]decimal.Decimal `json:"rates"`
+	Quotes    map[string]Quote           `json:"quotes,omitempty"` // Optional buy/sell/mid per currency
+	Reason    string                     `json:"reason,omitempty"` // Why rates were submitted manually
+
+	// The user submitting the rates; set by the server, never read from the payload
+	PostedByID uint   `json:"-"`
+	PostedBy   string `json:"-"`
 }
 
+// RateScale is the number of decimal places rates are stored with. Quotes published as
+// base-currency units per unit, such as CBN's NGN per USD, are stored inverted; this many
+// places keep converting back to the base exact to the kobo for any realistic amount.
+const RateScale = 24
+
 // Currency represents the currencies table
 type Currency struct {
 	ID   uint   `gorm:"primaryKey;autoIncrement" json:"id"`
@@ -18,13 +66,46 @@ type Currency struct {
 	Name string `gorm:"size:100" json:"name,omitempty"`
 }
 
+// RateSource represents the rate_sources table, one row per provider or feed
+type RateSource struct {
+	ID   uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	Code string `gorm:"size:50;uniqueIndex;not null" json:"code"` // Matches the provider name, e.g. "cbn"
+	Name string `gorm:"size:100" json:"name,omitempty"`
+	// MdaID is the tenant that owns a custom source; global sources have none
+	MdaID string `gorm:"size:50;not null;default:'';index" json:"mda_id,omitempty"`
+}
+
 // ExchangeRate represents the exchange_rates table
 type ExchangeRate struct {
-	ID             uint      `gorm:"primaryKey;autoIncrement" json:"id"`
-	CurrencyID     uint      `gorm:"not null" json:"currency_id"`
-	Currency       Currency  `gorm:"foreignKey:CurrencyID"` // Foreign key relationship
-	Rate           float64   `gorm:"not null" json:"rate"`
-	Timestamp      time.Time `gorm:"not null" json:"timestamp"`
-	BaseCurrencyID uint      `gorm:"not null" json:"base_currency_id"`
-	BaseCurrency   Currency  `gorm:"foreignKey:BaseCurrencyID"` // Foreign key relationship
+	ID             uint            `gorm:"primaryKey;autoIncrement" json:"id"`
+	CurrencyID     uint            `gorm:"not null;uniqueIndex:idx_exchange_rates_currency_timestamp_source" json:"currency_id"`
+	Currency       Currency        `gorm:"foreignKey:CurrencyID"` // Foreign key relationship
+	Rate           decimal.Decimal `gorm:"type:numeric(40,24);not null" json:"rate"`
+	BuyRate        decimal.Decimal `gorm:"type:numeric(40,24)" json:"buy_rate"`
+	SellRate       decimal.Decimal `gorm:"type:numeric(40,24)" json:"sell_rate"`
+	MidRate        decimal.Decimal `gorm:"type:numeric(40,24)" json:"mid_rate"`
+	Timestamp      time.Time       `gorm:"not null;uniqueIndex:idx_exchange_rates_currency_timestamp_source" json:"timestamp"`
+	BaseCurrencyID uint            `gorm:"not null" json:"base_currency_id"`
+	BaseCurrency   Currency        `gorm:"foreignKey:BaseCurrencyID"` // Foreign key relationship
+	SourceID       uint            `gorm:"uniqueIndex:idx_exchange_rates_currency_timestamp_source" json:"source_id"`
+	Source         RateSource      `gorm:"foreignKey:SourceID" json:"source"` // Provider the rate came from
+	SnapshotID     uint            `gorm:"index" json:"snapshot_id"`          // Ingestion run the rate belongs to
+}
+
+// RateFor returns the rate for the requested side, falling back to Rate for rows
+// ingested before buy/sell/mid rates were stored
+func (r ExchangeRate) RateFor(side RateSide) decimal.Decimal {
+	var value decimal.Decimal
+	switch side {
+	case BuySide:
+		value = r.BuyRate
+	case SellSide:
+		value = r.SellRate
+	default:
+		value = r.MidRate
+	}
+	if value.IsZero() {
+		return r.Rate
+	}
+	return value
 }
@@ -0,0 +1,27 @@
+// internal/models/login_throttle.go
+
+package models
+
+import "time"
+
+// Login throttle kinds
+const (
+	ThrottleUsername = "username"
+	ThrottleIP       = "ip"
+)
+
+// LoginThrottle represents the login_throttles table: recent failed logins for one
+// username or one client IP. Usernames are tracked whether or not they exist, so that
+// throttling does not reveal which accounts are registered.
+type LoginThrottle struct {
+	Kind          string     `gorm:"primaryKey;size:10" json:"kind"`   // ThrottleUsername or ThrottleIP
+	Value         string     `gorm:"primaryKey;size:150" json:"value"` // Lower-cased username or IP address
+	Failures      int        `gorm:"not null;default:0" json:"failures"`
+	LastFailureAt time.Time  `gorm:"not null" json:"last_failure_at"`
+	LockedUntil   *time.Time `gorm:"index" json:"locked_until,omitempty"`
+}
+
+// Locked reports whether logins are locked out at the given time
+func (t *LoginThrottle) Locked(now time.Time) bool {
+	return t.LockedUntil != nil && now.Before(*t.LockedUntil)
+}
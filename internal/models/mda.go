@@ -0,0 +1,52 @@
+// internal/models/mda.go
+
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// MDA represents the mdas table: a ministry, department or agency using the service as
+// a tenant. Users belong to an MDA through User.MdaID, which holds the MDA's code.
+type MDA struct {
+	ID   uint   `gorm:"primaryKey" json:"id"`
+	Code string `gorm:"size:50;uniqueIndex;not null" json:"code"`
+	Name string `gorm:"size:150;not null" json:"name"`
+	// AllowedCurrencies restricts the currencies the MDA may query; empty allows all
+	AllowedCurrencies []string `gorm:"serializer:json" json:"allowed_currencies"`
+	// PreferredSource is tried before the globally preferred sources
+	PreferredSource string `gorm:"size:50" json:"preferred_source,omitempty"`
+	// DefaultBaseCurrency is used when a rebasing request names no base
+	DefaultBaseCurrency string `gorm:"size:3" json:"default_base_currency,omitempty"`
+	// MaxUsers limits how many users the MDA may have; 0 means no limit
+	MaxUsers int `json:"max_users"`
+	// DailyRequestQuota limits authenticated API requests per UTC day; 0 means no limit
+	DailyRequestQuota int       `json:"daily_request_quota"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// TableName keeps GORM from deriving an awkward name from the acronym
+func (MDA) TableName() string {
+	return "mdas"
+}
+
+// AllowsCurrency reports whether the MDA may use the currency
+func (m *MDA) AllowsCurrency(code string) bool {
+	if m == nil || len(m.AllowedCurrencies) == 0 {
+		return true
+	}
+	for _, allowed := range m.AllowedCurrencies {
+		if strings.EqualFold(allowed, code) {
+			return true
+		}
+	}
+	return false
+}
+
+// SourceCode returns the code of the MDA's own rate source for a source name, e.g.
+// "nuprc:manual". Rates published by an MDA's users are kept apart from global sources.
+func (m *MDA) SourceCode(source string) string {
+	return strings.ToLower(m.Code) + ":" + source
+}
@@ -0,0 +1,63 @@
+// internal/models/mfa.go
+
+package models
+
+import "time"
+
+// MFAPolicy represents the mfa_policies table: whether users with a role must use a
+// second factor. Roles without a row fall back to the configured defaults.
+type MFAPolicy struct {
+	Role      Role      `gorm:"primaryKey;size:50" json:"role"`
+	Required  bool      `gorm:"not null" json:"required"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName overrides the pluralisation of MFAPolicy
+func (MFAPolicy) TableName() string {
+	return "mfa_policies"
+}
+
+// MFARecoveryCode represents the mfa_recovery_codes table: a one-time code that stands
+// in for a TOTP code when the user's device is lost. Only its hash is stored.
+type MFARecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"size:64;not null;uniqueIndex"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// MFAChallenge represents the mfa_challenges table: the second step of a login whose
+// password has been checked. The challenge token is single-use and only its hash is stored.
+type MFAChallenge struct {
+	ID        uint   `gorm:"primaryKey"`
+	TokenHash string `gorm:"size:64;not null;uniqueIndex"`
+	UserID    uint   `gorm:"not null;index"`
+	Attempts  int    `gorm:"not null;default:0"` // Wrong codes entered so far
+	UserAgent string `gorm:"size:255"`
+	IPAddress string `gorm:"size:45"`
+	CreatedAt time.Time
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
+
+// MFAEnrollment is returned when a user starts enrolling an authenticator app
+type MFAEnrollment struct {
+	Secret string `json:"secret"`      // Base32 secret for manual entry
+	URI    string `json:"otpauth_uri"` // otpauth:// URI, usually shown as a QR code
+}
+
+// MFAStatus summarises a user's second factor
+type MFAStatus struct {
+	Enabled                bool       `json:"enabled"`
+	Required               bool       `json:"required"` // Required by the user's role or ownership
+	EnabledAt              *time.Time `json:"enabled_at,omitempty"`
+	Enrolling              bool       `json:"enrolling"` // An enrollment awaits confirmation
+	RecoveryCodesRemaining int64      `json:"recovery_codes_remaining"`
+}
+
+// MFAChallengeResponse is returned by a login that needs a second factor
+type MFAChallengeResponse struct {
+	MFAToken           string    `json:"mfa_token"`
+	ExpiresAt          time.Time `json:"expires_at"`
+	EnrollmentRequired bool      `json:"enrollment_required"` // The user must enroll before completing the login
+}
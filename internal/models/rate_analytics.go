@@ -0,0 +1,132 @@
+// internal/models/rate_analytics.go
+
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// RateInterval is the length of the periods a rate series is grouped into
+type RateInterval string
+
+const (
+	DailyInterval   RateInterval = "day"
+	WeeklyInterval  RateInterval = "week" // ISO weeks, starting on Monday
+	MonthlyInterval RateInterval = "month"
+)
+
+// ParseRateInterval validates an interval name, defaulting to daily periods when empty
+func ParseRateInterval(value string) (RateInterval, error) {
+	switch interval := RateInterval(value); interval {
+	case "":
+		return DailyInterval, nil
+	case DailyInterval, WeeklyInterval, MonthlyInterval:
+		return interval, nil
+	default:
+		return "", fmt.Errorf("invalid interval %q: must be day, week or month", value)
+	}
+}
+
+// PeriodStart returns the start, in UTC, of the period containing t
+func (i RateInterval) PeriodStart(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch i {
+	case WeeklyInterval:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case MonthlyInterval:
+		return day.AddDate(0, 0, 1-day.Day())
+	default:
+		return day
+	}
+}
+
+// PeriodEnd returns the start of the period following the one starting at start
+func (i RateInterval) PeriodEnd(start time.Time) time.Time {
+	switch i {
+	case WeeklyInterval:
+		return start.AddDate(0, 0, 7)
+	case MonthlyInterval:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// RateSampling is how the rates published during a period are reduced to one value
+type RateSampling string
+
+const (
+	CloseSampling   RateSampling = "close"   // The last rate of the period
+	AverageSampling RateSampling = "average" // The mean of the period's rates
+)
+
+// ParseRateSampling validates a sampling name, defaulting to end-of-period rates when empty
+func ParseRateSampling(value string) (RateSampling, error) {
+	switch sampling := RateSampling(value); sampling {
+	case "":
+		return CloseSampling, nil
+	case CloseSampling, AverageSampling:
+		return sampling, nil
+	default:
+		return "", fmt.Errorf("invalid sampling %q: must be close or average", value)
+	}
+}
+
+// RatePoint is the rate of a currency pair in one stored snapshot
+type RatePoint struct {
+	SnapshotID uint            `json:"snapshot_id"`
+	Timestamp  time.Time       `json:"timestamp"`
+	Rate       decimal.Decimal `json:"rate"` // Units of the quote currency per unit of the base
+}
+
+// Candle summarises the rates of a currency pair published during one period
+type Candle struct {
+	Period       string          `json:"period"`     // First day of the period, YYYY-MM-DD
+	PeriodEnd    string          `json:"period_end"` // Last day of the period
+	Open         decimal.Decimal `json:"open"`
+	High         decimal.Decimal `json:"high"`
+	Low          decimal.Decimal `json:"low"`
+	Close        decimal.Decimal `json:"close"`
+	Average      decimal.Decimal `json:"average"` // Simple mean of the rates published in the period
+	Observations int             `json:"observations"`
+}
+
+// RateExtreme is the highest or lowest rate of a series and when it was published
+type RateExtreme struct {
+	Rate      decimal.Decimal `json:"rate"`
+	Date      string          `json:"date"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// RateSummary describes how the rate of a currency pair behaved over a date range
+type RateSummary struct {
+	Base         string   `json:"base"`
+	Quote        string   `json:"quote"`
+	Source       string   `json:"source"`
+	Side         RateSide `json:"side"`
+	StartDate    string   `json:"start_date"`
+	EndDate      string   `json:"end_date"`
+	Observations int      `json:"observations"`
+
+	Open                decimal.Decimal `json:"open"`
+	Close               decimal.Decimal `json:"close"`
+	Change              decimal.Decimal `json:"change"`
+	ChangePercent       decimal.Decimal `json:"change_percent"`
+	Average             decimal.Decimal `json:"average"`               // Simple mean of every published rate
+	TimeWeightedAverage decimal.Decimal `json:"time_weighted_average"` // Each rate weighted by how long it stood
+	Min                 RateExtreme     `json:"min"`
+	Max                 RateExtreme     `json:"max"`
+	// Volatility is the standard deviation, in percent, of the day-to-day log returns of
+	// the daily closing rates; nil when fewer than three days have rates
+	Volatility *decimal.Decimal `json:"volatility"`
+}
+
+// VolatilityPoint is the volatility of a currency pair over the window ending on Date
+type VolatilityPoint struct {
+	Date       string          `json:"date"`
+	Close      decimal.Decimal `json:"close"`
+	Volatility decimal.Decimal `json:"volatility"` // Percent standard deviation of the window's daily log returns
+}
@@ -0,0 +1,54 @@
+// internal/models/rate_snapshot.go
+
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RateSnapshot represents the rate_snapshots table: one ingestion run of a provider.
+// All of a snapshot's rates are written in a single transaction, so readers only see
+// rates belonging to complete snapshots.
+type RateSnapshot struct {
+	ID                uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	SourceID          uint           `gorm:"not null;uniqueIndex:idx_rate_snapshots_source_timestamp" json:"source_id"`
+	Source            RateSource     `gorm:"foreignKey:SourceID" json:"source"`
+	BaseCurrencyID    uint           `gorm:"not null" json:"base_currency_id"`
+	BaseCurrency      Currency       `gorm:"foreignKey:BaseCurrencyID" json:"base_currency"`
+	ProviderTimestamp time.Time      `gorm:"not null;uniqueIndex:idx_rate_snapshots_source_timestamp" json:"provider_timestamp"` // When the provider published the rates
+	FetchedAt         time.Time      `gorm:"not null" json:"fetched_at"`                                                         // When the rates were ingested
+	Checksum          string         `gorm:"size:64" json:"checksum"`                                                            // SHA-256 of the canonical rate payload
+	RateCount         int            `json:"rate_count"`
+	PostedByID        *uint          `gorm:"index" json:"posted_by_id,omitempty"` // User who submitted a manual snapshot
+	PostedBy          string         `gorm:"size:100" json:"posted_by,omitempty"` // Their username, kept if the user is deleted
+	Reason            string         `gorm:"size:500" json:"reason,omitempty"`    // Why the rates were submitted
+	Rates             []ExchangeRate `gorm:"foreignKey:SnapshotID" json:"rates,omitempty"`
+}
+
+// Checksum returns a SHA-256 digest of the payload that is independent of map ordering,
+// so the same publication always produces the same checksum
+func (d ExchangeRateData) Checksum() string {
+	codes := make([]string, 0, len(d.Rates))
+	for code := range d.Rates {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s|%s|%d\n", d.Source, d.Base, d.Timestamp)
+	for _, code := range codes {
+		fmt.Fprintf(&b, "%s|%s", code, d.Rates[code].String())
+		if quote, ok := d.Quotes[code]; ok {
+			fmt.Fprintf(&b, "|%s|%s|%s", quote.Buy.String(), quote.Sell.String(), quote.Mid.String())
+		}
+		b.WriteString("\n")
+	}
+
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
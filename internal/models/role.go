@@ -0,0 +1,29 @@
+// internal/models/role.go
+
+package models
+
+import "fmt"
+
+// Role determines what a user is allowed to do
+type Role string
+
+const (
+	RoleViewer        Role = "viewer"         // Reads published rates and converts amounts
+	RoleAnalyst       Role = "analyst"        // Also queries history and aggregates
+	RoleAuditor       Role = "auditor"        // An analyst who can also read the audit log
+	RoleRatePublisher Role = "rate-publisher" // Also publishes rates and triggers ingestion
+	RoleAdmin         Role = "admin"          // Also manages users and backfills
+)
+
+// Roles lists every role, roughly from least to most privileged
+var Roles = []Role{RoleViewer, RoleAnalyst, RoleAuditor, RoleRatePublisher, RoleAdmin}
+
+// ParseRole validates a role name
+func ParseRole(value string) (Role, error) {
+	for _, role := range Roles {
+		if string(role) == value {
+			return role, nil
+		}
+	}
+	return "", fmt.Errorf("unknown role %q (expected viewer, analyst, auditor, rate-publisher or admin)", value)
+}
@@ -0,0 +1,44 @@
+// internal/models/session.go
+
+package models
+
+import "time"
+
+// Session represents the sessions table: one login on one device. The session holds
+// the hash of its current refresh token, which is replaced every time it is used.
+type Session struct {
+	ID                       uint       `gorm:"primaryKey" json:"id"`
+	UserID                   uint       `gorm:"not null;index" json:"-"`
+	RefreshTokenHash         string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	PreviousRefreshTokenHash string     `gorm:"size:64;index" json:"-"` // Presenting it again means the token was stolen
+	AccessTokenID            string     `gorm:"size:64" json:"-"`       // jti of the latest access token
+	AccessExpiresAt          time.Time  `json:"-"`
+	MFAVerified              bool       `gorm:"not null;default:false" json:"mfa_verified"` // The login passed a second factor
+	UserAgent                string     `gorm:"size:255" json:"user_agent"`
+	IPAddress                string     `gorm:"size:45" json:"ip_address"`
+	CreatedAt                time.Time  `json:"created_at"`
+	LastUsedAt               time.Time  `json:"last_used_at"`
+	ExpiresAt                time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt                *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Active reports whether the session can still be refreshed
+func (s Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// RevokedToken represents the revoked_tokens table: access tokens that must be rejected
+// before they expire. Rows can be deleted once ExpiresAt has passed.
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey;size:64"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
+
+// TokenPair is issued at login and on every refresh
+type TokenPair struct {
+	AccessToken      string    `json:"access_token"`
+	AccessExpiresAt  time.Time `json:"access_expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+	SessionID        uint      `json:"session_id"`
+}
@@ -13,12 +13,40 @@ type User struct {
 	Username         string `gorm:"size:100;unique;not null"`
 	PhoneNumber      string `gorm:"size:20"`
 	Password         string `gorm:"not null"` // Store hashed password
-	ResetToken       string `gorm:"size:255"` // Token for password reset
+	ResetToken       string `gorm:"size:255"` // SHA-256 hash of the pending password reset token
 	ResetTokenExpiry time.Time
 	MdaID            string `gorm:"size:50"`
 	MDA              string `gorm:"size:150"`
-	Role             string `gorm:"size:50"`
+	Role             Role   `gorm:"size:50;not null;default:viewer"`
 	IsOwner          bool   `gorm:"default:false"`
+	Active           bool   `gorm:"not null;default:true"` // Deactivated users cannot log in
+	DeactivatedAt    *time.Time
+	MFAEnabled       bool   `gorm:"not null;default:false"`
+	MFASecret        string `gorm:"size:64"` // TOTP secret of the confirmed authenticator
+	MFAPendingSecret string `gorm:"size:64"` // TOTP secret awaiting confirmation during enrollment
+	MFAEnabledAt     *time.Time
+	MFALastStep      int64 // Last accepted TOTP time step, so that a code cannot be replayed
 	CreatedAt        time.Time
 	UpdatedAt        time.Time
 }
+
+// UserFilter selects users for admin listings
+type UserFilter struct {
+	MdaID  string // Restricts to one MDA when set
+	Search string // Matches username, email, first or last name
+	Role   Role
+	Active *bool
+	Limit  int
+	Offset int
+}
+
+// UserProfile holds the fields users may edit on their own account; empty fields are left unchanged
+type UserProfile struct {
+	FirstName   string
+	LastName    string
+	Email       string
+	PhoneNumber string
+	// CurrentPassword must be given to change the email address, since whoever controls
+	// the address can reset the password
+	CurrentPassword string
+}
@@ -0,0 +1,106 @@
+// internal/models/webhook.go
+
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Webhook event types a subscription can receive
+const (
+	WebhookSnapshotStored  = "snapshot.stored"  // A provider publication or posted rates were stored
+	WebhookRateMoved       = "rate.moved"       // Currencies moved more than the threshold since the previous snapshot
+	WebhookIngestionFailed = "ingestion.failed" // Rates of a source could not be fetched or stored
+)
+
+// WebhookEventTypes lists every event type a subscription can receive
+var WebhookEventTypes = []string{WebhookSnapshotStored, WebhookRateMoved, WebhookIngestionFailed}
+
+// Statuses of a webhook delivery
+const (
+	DeliveryPending   = "pending"   // Waiting for its first or next attempt
+	DeliverySucceeded = "succeeded" // The endpoint answered with a 2xx status
+	DeliveryFailed    = "failed"    // Every attempt failed
+)
+
+// WebhookSubscription represents the webhook_subscriptions table: an endpoint that is
+// sent the events it subscribes to. Secret signs each delivery and is kept in clear
+// because it is needed to compute the signatures.
+type WebhookSubscription struct {
+	ID     uint     `gorm:"primaryKey" json:"id"`
+	MdaID  string   `gorm:"size:50;not null;default:'';index" json:"mda_id,omitempty"` // Owning tenant; it only hears of its own and global sources
+	URL    string   `gorm:"size:500;not null" json:"url"`
+	Secret string   `gorm:"size:100;not null" json:"-"`
+	Events []string `gorm:"serializer:json" json:"events"`
+	// Currencies restricts the rates included in events; empty includes all
+	Currencies []string `gorm:"serializer:json" json:"currencies"`
+	// ThresholdPercent is the move, in percent, that triggers a rate.moved event
+	ThresholdPercent decimal.Decimal `gorm:"type:numeric(10,4);not null;default:0" json:"threshold_percent"`
+	Active           bool            `gorm:"not null" json:"active"`
+	CreatedBy        string          `gorm:"size:100" json:"created_by"`
+	CreatedAt        time.Time       `json:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+}
+
+// Subscribes reports whether the subscription receives events of the type
+func (s *WebhookSubscription) Subscribes(eventType string) bool {
+	for _, event := range s.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Watches reports whether the subscription's events include the currency
+func (s *WebhookSubscription) Watches(code string) bool {
+	if len(s.Currencies) == 0 {
+		return true
+	}
+	for _, currency := range s.Currencies {
+		if currency == code {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookSubscriptionSettings are the caller-controlled fields of a subscription. An
+// empty Secret keeps the current secret, or generates one for a new subscription.
+type WebhookSubscriptionSettings struct {
+	URL              string
+	Secret           string
+	Events           []string
+	Currencies       []string
+	ThresholdPercent decimal.Decimal
+	Active           *bool
+}
+
+// WebhookDelivery represents the webhook_deliveries table: one event sent, or to be
+// sent, to a subscription. Payload is the exact body that is signed and posted.
+type WebhookDelivery struct {
+	ID             uint                 `gorm:"primaryKey" json:"id"`
+	SubscriptionID uint                 `gorm:"not null;index" json:"subscription_id"`
+	Subscription   *WebhookSubscription `gorm:"foreignKey:SubscriptionID" json:"-"`
+	EventID        string               `gorm:"size:40;not null;index" json:"event_id"` // Shared by every delivery and replay of the event
+	EventType      string               `gorm:"size:50;not null" json:"event_type"`
+	Payload        string               `gorm:"type:text;not null" json:"payload"`
+	Status         string               `gorm:"size:20;not null;index" json:"status"`
+	Attempts       int                  `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt  time.Time            `gorm:"not null;index" json:"next_attempt_at"`
+	LastStatusCode int                  `json:"last_status_code,omitempty"`
+	LastError      string               `gorm:"size:500" json:"last_error,omitempty"`
+	ReplayOfID     *uint                `json:"replay_of_id,omitempty"` // The delivery this one replays
+	CreatedAt      time.Time            `json:"created_at"`
+	DeliveredAt    *time.Time           `json:"delivered_at,omitempty"`
+}
+
+// WebhookEvent is the body posted to a subscription's URL
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
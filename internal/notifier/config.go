@@ -0,0 +1,45 @@
+// internal/notifier/config.go
+
+package notifier
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+// NewAccountNotifierFromConfig builds the account notifier for the configured driver:
+// smtp, file or log
+func NewAccountNotifierFromConfig() (AccountNotifier, error) {
+	var notifier Notifier
+	switch driver := viper.GetString("notifications.driver"); driver {
+	case "smtp":
+		host := viper.GetString("notifications.smtp.host")
+		from := viper.GetString("notifications.smtp.from")
+		if host == "" || from == "" {
+			return nil, fmt.Errorf("notifications.smtp.host and notifications.smtp.from are required for the smtp driver")
+		}
+		port := viper.GetInt("notifications.smtp.port")
+		if port == 0 {
+			port = 587
+		}
+		notifier = NewSMTPNotifier(host, port,
+			viper.GetString("notifications.smtp.username"), viper.GetString("notifications.smtp.password"), from)
+	case "file":
+		path := viper.GetString("notifications.file.path")
+		if path == "" {
+			return nil, fmt.Errorf("notifications.file.path is required for the file driver")
+		}
+		notifier = NewFileNotifier(path)
+	case "", "log":
+		notifier = NewLogNotifier()
+	default:
+		return nil, fmt.Errorf("unknown notifications driver %q", driver)
+	}
+
+	appName := viper.GetString("notifications.app_name")
+	if appName == "" {
+		appName = "Exchange Rate Service"
+	}
+	return NewAccountNotifier(notifier, appName, viper.GetString("notifications.reset_url")), nil
+}
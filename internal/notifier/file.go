@@ -0,0 +1,62 @@
+// internal/notifier/file.go
+
+package notifier
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+type fileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileNotifier creates a notifier that appends messages to a local file instead of
+// sending them, for development and tests
+func NewFileNotifier(path string) Notifier {
+	return &fileNotifier{path: path}
+}
+
+// Send appends the message to the file
+func (n *fileNotifier) Send(message Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	file, err := os.OpenFile(n.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open notification file %s: %v", n.path, err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(format(message)); err != nil {
+		return fmt.Errorf("failed to write notification: %v", err)
+	}
+	return nil
+}
+
+type logNotifier struct{}
+
+// NewLogNotifier creates a notifier that writes messages to the application log
+// instead of sending them, for development
+func NewLogNotifier() Notifier {
+	return logNotifier{}
+}
+
+// Send logs the message
+func (logNotifier) Send(message Message) error {
+	log.Printf("Notification:\n%s", format(message))
+	return nil
+}
+
+// format renders a message the way it would appear in a mailbox
+func format(message Message) string {
+	if message.SentAt.IsZero() {
+		message.SentAt = time.Now()
+	}
+	return fmt.Sprintf("Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n",
+		message.SentAt.Format(time.RFC1123Z), message.To, message.Subject, message.Body)
+}
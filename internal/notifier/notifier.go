@@ -0,0 +1,18 @@
+// internal/notifier/notifier.go
+
+package notifier
+
+import "time"
+
+// Message is a plain-text notification addressed to one recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+	SentAt  time.Time
+}
+
+// Notifier delivers messages to users
+type Notifier interface {
+	Send(message Message) error
+}
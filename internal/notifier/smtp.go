@@ -0,0 +1,54 @@
+// internal/notifier/smtp.go
+
+package notifier
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type smtpNotifier struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPNotifier creates a notifier that sends email through an SMTP server. PLAIN
+// authentication is used when a username is given; net/smtp only sends it over TLS or
+// to localhost.
+func NewSMTPNotifier(host string, port int, username, password, from string) Notifier {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &smtpNotifier{
+		addr: net.JoinHostPort(host, strconv.Itoa(port)),
+		auth: auth,
+		from: from,
+	}
+}
+
+// Send delivers the message as a plain-text email
+func (n *smtpNotifier) Send(message Message) error {
+	if message.SentAt.IsZero() {
+		message.SentAt = time.Now()
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", n.from)
+	fmt.Fprintf(&body, "To: %s\r\n", message.To)
+	fmt.Fprintf(&body, "Subject: %s\r\n", message.Subject)
+	fmt.Fprintf(&body, "Date: %s\r\n", message.SentAt.Format(time.RFC1123Z))
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	body.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+
+	if err := smtp.SendMail(n.addr, n.auth, n.from, []string{message.To}, []byte(body.String())); err != nil {
+		return fmt.Errorf("failed to send email to %s: %v", message.To, err)
+	}
+	return nil
+}
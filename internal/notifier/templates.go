@@ -0,0 +1,126 @@
+// internal/notifier/templates.go
+
+package notifier
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+)
+
+// AccountNotifier sends the templated account emails
+type AccountNotifier interface {
+	PasswordReset(user *models.User, token string, expiresAt time.Time) error
+	Registered(user *models.User) error
+	SecurityAlert(user *models.User, event string) error
+}
+
+// messageTemplate is the subject and body of one kind of message
+type messageTemplate struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+var (
+	passwordResetTemplate = messageTemplate{
+		subject: template.Must(template.New("password_reset_subject").Parse("Reset your {{.AppName}} password")),
+		body: template.Must(template.New("password_reset").Parse(`Hello {{.User.FirstName}},
+
+We received a request to reset the password of your {{.AppName}} account ({{.User.Username}}).
+
+Use the link below to choose a new password. It expires at {{.ExpiresAt.Format "2006-01-02 15:04 MST"}}.
+
+{{.Link}}
+
+If you did not ask for a password reset you can ignore this email; your password has not been changed.
+`)),
+	}
+
+	registeredTemplate = messageTemplate{
+		subject: template.Must(template.New("registered_subject").Parse("Welcome to {{.AppName}}")),
+		body: template.Must(template.New("registered").Parse(`Hello {{.User.FirstName}},
+
+Your {{.AppName}} account has been created with the username {{.User.Username}}.
+{{if .User.MDA}}
+You have joined {{.User.MDA}}.
+{{end}}
+New accounts can view published rates. Ask an administrator if you need further access.
+`)),
+	}
+
+	securityAlertTemplate = messageTemplate{
+		subject: template.Must(template.New("security_alert_subject").Parse("Security alert for your {{.AppName}} account")),
+		body: template.Must(template.New("security_alert").Parse(`Hello {{.User.FirstName}},
+
+The following change was made to your {{.AppName}} account ({{.User.Username}}) at {{.Time.Format "2006-01-02 15:04 MST"}}:
+
+    {{.Event}}
+
+If this was not you, reset your password immediately and contact an administrator.
+`)),
+	}
+)
+
+// templateData is what message templates can refer to
+type templateData struct {
+	AppName   string
+	User      *models.User
+	Link      string
+	ExpiresAt time.Time
+	Event     string
+	Time      time.Time
+}
+
+type accountNotifier struct {
+	notifier Notifier
+	appName  string
+	resetURL string
+}
+
+// NewAccountNotifier creates an AccountNotifier. resetURL is the page users open to
+// reset their password; its %s placeholder is replaced with the reset token.
+func NewAccountNotifier(notifier Notifier, appName, resetURL string) AccountNotifier {
+	return &accountNotifier{notifier: notifier, appName: appName, resetURL: resetURL}
+}
+
+// PasswordReset sends the link for completing a password reset
+func (n *accountNotifier) PasswordReset(user *models.User, token string, expiresAt time.Time) error {
+	return n.send(user, passwordResetTemplate, templateData{
+		Link:      strings.Replace(n.resetURL, "%s", token, 1),
+		ExpiresAt: expiresAt,
+	})
+}
+
+// Registered confirms a new registration
+func (n *accountNotifier) Registered(user *models.User) error {
+	return n.send(user, registeredTemplate, templateData{})
+}
+
+// SecurityAlert tells the user about a sensitive change to their account
+func (n *accountNotifier) SecurityAlert(user *models.User, event string) error {
+	return n.send(user, securityAlertTemplate, templateData{Event: event, Time: time.Now()})
+}
+
+// send renders the template for the user and delivers it
+func (n *accountNotifier) send(user *models.User, tmpl messageTemplate, data templateData) error {
+	data.AppName = n.appName
+	data.User = user
+
+	var subjectText, bodyText strings.Builder
+	if err := tmpl.subject.Execute(&subjectText, data); err != nil {
+		return fmt.Errorf("failed to render subject: %v", err)
+	}
+	if err := tmpl.body.Execute(&bodyText, data); err != nil {
+		return fmt.Errorf("failed to render %s message: %v", tmpl.body.Name(), err)
+	}
+
+	return n.notifier.Send(Message{
+		To:      user.Email,
+		Subject: subjectText.String(),
+		Body:    bodyText.String(),
+		SentAt:  time.Now(),
+	})
+}
@@ -0,0 +1,260 @@
+// internal/providers/cbn.go
+
+package providers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// CBNName is the registry name of the Central Bank of Nigeria provider
+const CBNName = "cbn"
+
+// cbnBaseCurrency is the currency CBN quotes all of its rates against
+const cbnBaseCurrency = "NGN"
+
+// cbnCurrencyCodes maps the currency names used in CBN publications to ISO 4217 codes
+var cbnCurrencyCodes = map[string]string{
+	"US DOLLAR":          "USD",
+	"POUNDS STERLING":    "GBP",
+	"EURO":               "EUR",
+	"SWISS FRANC":        "CHF",
+	"YEN":                "JPY",
+	"CFA":                "XOF",
+	"WAUA":               "XUA",
+	"YUAN/RENMINBI":      "CNY",
+	"DANISH KRONA":       "DKK",
+	"RIYAL":              "SAR",
+	"SOUTH AFRICAN RAND": "ZAR",
+}
+
+type cbnProvider struct {
+	apiURL string
+	client *http.Client
+}
+
+// NewCBNProvider creates a provider for the CBN official exchange rate publication.
+// The publication may be served either as JSON or as CSV.
+func NewCBNProvider(apiURL string, client *http.Client) RateProvider {
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	return &cbnProvider{apiURL: apiURL, client: client}
+}
+
+// Name returns the provider name
+func (p *cbnProvider) Name() string {
+	return CBNName
+}
+
+// cbnRecord is a single row of the CBN publication
+type cbnRecord struct {
+	Currency    string      `json:"currency"`
+	RateDate    string      `json:"ratedate"`
+	BuyingRate  flexDecimal `json:"buyingrate"`
+	CentralRate flexDecimal `json:"centralrate"`
+	SellingRate flexDecimal `json:"sellingrate"`
+}
+
+// FetchRates fetches the CBN rates published on, or most recently before, the given date
+func (p *cbnProvider) FetchRates(date time.Time) (*models.ExchangeRateData, error) {
+	body, err := getBody(p.client, p.apiURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// CBN publishes the same table as JSON and as CSV
+	var records []cbnRecord
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		records, err = parseCBNJSON(trimmed)
+	} else {
+		records, err = parseCBNCSV(trimmed)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return cbnRecordsToData(records, date)
+}
+
+// parseCBNJSON accepts either a bare array of records or an object wrapping them in "data"
+func parseCBNJSON(body []byte) ([]cbnRecord, error) {
+	var records []cbnRecord
+	if err := json.Unmarshal(body, &records); err == nil {
+		return records, nil
+	}
+
+	var wrapped struct {
+		Data []cbnRecord `json:"data"`
+	}
+	if err := json.Unmarshal(body, &wrapped); err != nil {
+		return nil, fmt.Errorf("failed to decode CBN response: %v", err)
+	}
+	return wrapped.Data, nil
+}
+
+// parseCBNCSV parses the CSV export, locating columns by their header names
+func parseCBNCSV(body []byte) ([]cbnRecord, error) {
+	reader := csv.NewReader(bytes.NewReader(body))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode CBN CSV: %v", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("CBN CSV is empty")
+	}
+
+	// Normalise headers such as "Rate Date" and "Central Rate" to "ratedate" and "centralrate"
+	columns := make(map[string]int)
+	for i, header := range rows[0] {
+		key := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(header), " ", ""))
+		columns[key] = i
+	}
+	for _, required := range []string{"currency", "ratedate", "centralrate"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CBN CSV is missing the %q column", required)
+		}
+	}
+
+	field := func(row []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return row[i]
+	}
+
+	records := make([]cbnRecord, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		record := cbnRecord{
+			Currency: field(row, "currency"),
+			RateDate: field(row, "ratedate"),
+		}
+		for name, target := range map[string]*flexDecimal{
+			"buyingrate":  &record.BuyingRate,
+			"centralrate": &record.CentralRate,
+			"sellingrate": &record.SellingRate,
+		} {
+			if err := target.UnmarshalJSON([]byte(field(row, name))); err != nil {
+				return nil, err
+			}
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// cbnRecordsToData selects the latest rate date not after the requested date and
+// converts its rates from NGN per unit into units per NGN, rounded to the scale rates
+// are stored with. The central rate becomes
+// the mid rate and the buying and selling rates keep their CBN labels.
+func cbnRecordsToData(records []cbnRecord, date time.Time) (*models.ExchangeRateData, error) {
+	cutoff := date.Format("2006-01-02")
+	var selected time.Time
+	byDate := make(map[time.Time][]cbnRecord)
+
+	for _, record := range records {
+		rateDate, err := parseCBNDate(record.RateDate)
+		if err != nil {
+			return nil, err
+		}
+		if rateDate.Format("2006-01-02") > cutoff {
+			continue
+		}
+		byDate[rateDate] = append(byDate[rateDate], record)
+		if rateDate.After(selected) {
+			selected = rateDate
+		}
+	}
+
+	if selected.IsZero() {
+		return nil, fmt.Errorf("no CBN rates published on or before %s", cutoff)
+	}
+
+	data := &models.ExchangeRateData{
+		Timestamp: selected.Unix(),
+		Base:      cbnBaseCurrency,
+		Source:    CBNName,
+		Rates:     map[string]decimal.Decimal{cbnBaseCurrency: one},
+		Quotes:    map[string]models.Quote{cbnBaseCurrency: {Buy: one, Sell: one, Mid: one}},
+	}
+	for _, record := range byDate[selected] {
+		code, ok := cbnCurrencyCode(record.Currency)
+		if !ok || !record.CentralRate.IsPositive() {
+			continue
+		}
+		central := one.DivRound(record.CentralRate.Decimal, models.RateScale)
+		data.Rates[code] = central
+
+		// Missing buying or selling rates default to the central rate
+		quote := models.Quote{Buy: central, Sell: central, Mid: central}
+		if record.BuyingRate.IsPositive() {
+			quote.Buy = one.DivRound(record.BuyingRate.Decimal, models.RateScale)
+		}
+		if record.SellingRate.IsPositive() {
+			quote.Sell = one.DivRound(record.SellingRate.Decimal, models.RateScale)
+		}
+		data.Quotes[code] = quote
+	}
+
+	return data, nil
+}
+
+// cbnCurrencyCode resolves a CBN currency name, or an ISO code, to an ISO code
+func cbnCurrencyCode(name string) (string, bool) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if code, ok := cbnCurrencyCodes[name]; ok {
+		return code, true
+	}
+	if len(name) == 3 {
+		return name, true
+	}
+	return "", false
+}
+
+// parseCBNDate parses the date formats seen in CBN publications
+func parseCBNDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{"2006-01-02", "2006-01-02T15:04:05", "1/2/2006"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised CBN rate date %q", value)
+}
+
+// one is the decimal constant used to invert CBN quotes
+var one = decimal.NewFromInt(1)
+
+// flexDecimal decodes a JSON number that may also be encoded as a string with
+// thousands separators, treating empty values as zero
+type flexDecimal struct {
+	decimal.Decimal
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (f *flexDecimal) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(strings.TrimSpace(string(b)), `"`)
+	if s == "" || s == "null" {
+		f.Decimal = decimal.Zero
+		return nil
+	}
+	v, err := decimal.NewFromString(strings.ReplaceAll(s, ",", ""))
+	if err != nil {
+		return fmt.Errorf("invalid rate %q: %v", s, err)
+	}
+	f.Decimal = v
+	return nil
+}
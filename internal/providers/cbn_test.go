@@ -0,0 +1,62 @@
+package providers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+)
+
+// TestCBNRatesConvertToTheKobo converts amounts at CBN central rates the way conversions
+// do, from the inverted rates as stored, and expects exactly the published NGN amounts
+func TestCBNRatesConvertToTheKobo(t *testing.T) {
+	tests := []struct {
+		central string
+		amount  string
+	}{
+		{"1534.21", "1000000"},
+		{"1459.8745", "1000000"},
+		{"1459.8745", "987654321.99"},
+		{"0.2983", "250000000"},
+		{"1999.9999", "0.01"},
+	}
+
+	for _, tt := range tests {
+		central := decimal.RequireFromString(tt.central)
+		records := []cbnRecord{{
+			Currency:    "US DOLLAR",
+			RateDate:    "2024-03-01",
+			CentralRate: flexDecimal{central},
+		}}
+		data, err := cbnRecordsToData(records, mustDate(t, "2024-03-01"))
+		if err != nil {
+			t.Fatalf("cbnRecordsToData: %v", err)
+		}
+
+		// Rates are read back from the database rounded to the stored scale
+		usd := data.Rates["USD"].Round(models.RateScale)
+		ngn := data.Rates["NGN"].Round(models.RateScale)
+		amount := decimal.RequireFromString(tt.amount)
+
+		toNGN := amount.Mul(ngn.Div(usd)).Round(2)
+		if want := amount.Mul(central).Round(2); !toNGN.Equal(want) {
+			t.Errorf("%s USD at %s = %s NGN, want %s", tt.amount, tt.central, toNGN, want)
+		}
+
+		toUSD := amount.Mul(central).Mul(usd.Div(ngn)).Round(2)
+		if want := amount.Round(2); !toUSD.Equal(want) {
+			t.Errorf("%s NGN at %s = %s USD, want %s", amount.Mul(central), tt.central, toUSD, want)
+		}
+	}
+}
+
+func mustDate(t *testing.T, value string) time.Time {
+	t.Helper()
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return date
+}
@@ -0,0 +1,71 @@
+// internal/providers/config.go
+
+package providers
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+// NewRegistryFromConfig builds a Registry from the rate_providers section of the configuration.
+// Only the providers listed under rate_providers.enabled are constructed.
+func NewRegistryFromConfig() (*Registry, error) {
+	defaultName := viper.GetString("rate_providers.default")
+	if defaultName == "" {
+		defaultName = OpenExchangeRatesName
+	}
+
+	enabled := viper.GetStringSlice("rate_providers.enabled")
+	if len(enabled) == 0 {
+		enabled = []string{defaultName}
+	}
+
+	registry := NewRegistry(defaultName)
+	for _, name := range enabled {
+		provider, err := newProviderFromConfig(name)
+		if err != nil {
+			return nil, err
+		}
+		registry.Register(provider)
+	}
+
+	if _, err := registry.Default(); err != nil {
+		return nil, fmt.Errorf("default rate provider %q is not enabled", defaultName)
+	}
+
+	return registry, nil
+}
+
+// newProviderFromConfig constructs a single named provider from its configuration keys
+func newProviderFromConfig(name string) (RateProvider, error) {
+	switch name {
+	case OpenExchangeRatesName:
+		apiURL := viper.GetString("exchange_rate_api_url")
+		appID := viper.GetString("exchange_rate_app_id")
+		if apiURL == "" || appID == "" {
+			return nil, fmt.Errorf("missing required configuration: exchange_rate_api_url and exchange_rate_app_id")
+		}
+		return NewOpenExchangeRatesProvider(apiURL, appID, nil), nil
+	case CBNName:
+		apiURL := viper.GetString("rate_providers.cbn.url")
+		if apiURL == "" {
+			return nil, fmt.Errorf("missing required configuration: rate_providers.cbn.url")
+		}
+		return NewCBNProvider(apiURL, nil), nil
+	case ECBName:
+		apiURL := viper.GetString("rate_providers.ecb.url")
+		if apiURL == "" {
+			return nil, fmt.Errorf("missing required configuration: rate_providers.ecb.url")
+		}
+		return NewECBProvider(apiURL, nil), nil
+	case FileName:
+		path := viper.GetString("rate_providers.file.path")
+		if path == "" {
+			return nil, fmt.Errorf("missing required configuration: rate_providers.file.path")
+		}
+		return NewFileProvider(path), nil
+	default:
+		return nil, fmt.Errorf("unknown rate provider %q", name)
+	}
+}
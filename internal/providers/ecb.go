@@ -0,0 +1,98 @@
+// internal/providers/ecb.go
+
+package providers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// ECBName is the registry name of the European Central Bank provider
+const ECBName = "ecb"
+
+// ecbBaseCurrency is the currency ECB reference rates are quoted against
+const ecbBaseCurrency = "EUR"
+
+type ecbProvider struct {
+	apiURL string
+	client *http.Client
+}
+
+// NewECBProvider creates a provider for the ECB euro foreign exchange reference rates XML feed.
+// Both the daily and the historical feeds are supported.
+func NewECBProvider(apiURL string, client *http.Client) RateProvider {
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	return &ecbProvider{apiURL: apiURL, client: client}
+}
+
+// Name returns the provider name
+func (p *ecbProvider) Name() string {
+	return ECBName
+}
+
+// ecbEnvelope mirrors the gesmes:Envelope document published by the ECB
+type ecbEnvelope struct {
+	Days []struct {
+		Time  string `xml:"time,attr"`
+		Rates []struct {
+			Currency string `xml:"currency,attr"`
+			Rate     string `xml:"rate,attr"`
+		} `xml:"Cube"`
+	} `xml:"Cube>Cube"`
+}
+
+// FetchRates fetches the ECB reference rates published on, or most recently before, the given date
+func (p *ecbProvider) FetchRates(date time.Time) (*models.ExchangeRateData, error) {
+	body, err := getBody(p.client, p.apiURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var envelope ecbEnvelope
+	if err := xml.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("failed to decode ECB response: %v", err)
+	}
+
+	cutoff := date.Format("2006-01-02")
+	selected := -1
+	for i, day := range envelope.Days {
+		if day.Time > cutoff {
+			continue
+		}
+		if selected == -1 || day.Time > envelope.Days[selected].Time {
+			selected = i
+		}
+	}
+	if selected == -1 {
+		return nil, fmt.Errorf("no ECB rates published on or before %s", cutoff)
+	}
+
+	day := envelope.Days[selected]
+	dayTime, err := time.Parse("2006-01-02", day.Time)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ECB rate date %q: %v", day.Time, err)
+	}
+
+	data := &models.ExchangeRateData{
+		Timestamp: dayTime.Unix(),
+		Base:      ecbBaseCurrency,
+		Source:    ECBName,
+		Rates:     map[string]decimal.Decimal{ecbBaseCurrency: decimal.NewFromInt(1)},
+	}
+	for _, rate := range day.Rates {
+		value, err := decimal.NewFromString(rate.Rate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ECB rate for %s: %v", rate.Currency, err)
+		}
+		data.Rates[rate.Currency] = value
+	}
+
+	return data, nil
+}
@@ -0,0 +1,53 @@
+// internal/providers/file.go
+
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+)
+
+// FileName is the registry name of the local file provider
+const FileName = "file"
+
+type fileProvider struct {
+	path string
+}
+
+// NewFileProvider creates a provider that reads rates from local JSON files in the
+// Open Exchange Rates format. If path contains a %s placeholder it is replaced with
+// the requested date (YYYY-MM-DD), allowing one file per day.
+func NewFileProvider(path string) RateProvider {
+	return &fileProvider{path: path}
+}
+
+// Name returns the provider name
+func (p *fileProvider) Name() string {
+	return FileName
+}
+
+// FetchRates reads the rates for the given date from disk
+func (p *fileProvider) FetchRates(date time.Time) (*models.ExchangeRateData, error) {
+	path := strings.Replace(p.path, "%s", date.Format("2006-01-02"), 1)
+
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rate file %s: %v", path, err)
+	}
+
+	var data models.ExchangeRateData
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("failed to decode rate file %s: %v", path, err)
+	}
+
+	if data.Source == "" {
+		data.Source = FileName
+	}
+
+	return &data, nil
+}
@@ -0,0 +1,64 @@
+// internal/providers/open_exchange_rates.go
+
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+)
+
+// OpenExchangeRatesName is the registry name of the Open Exchange Rates provider
+const OpenExchangeRatesName = "openexchangerates"
+
+type openExchangeRatesProvider struct {
+	apiURL string
+	appID  string
+	client *http.Client
+}
+
+// NewOpenExchangeRatesProvider creates a provider for the Open Exchange Rates historical API.
+// apiURL must contain a single %s placeholder for the date (YYYY-MM-DD).
+func NewOpenExchangeRatesProvider(apiURL, appID string, client *http.Client) RateProvider {
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	return &openExchangeRatesProvider{apiURL: apiURL, appID: appID, client: client}
+}
+
+// Name returns the provider name
+func (p *openExchangeRatesProvider) Name() string {
+	return OpenExchangeRatesName
+}
+
+// FetchRates fetches the rates published for the given date
+func (p *openExchangeRatesProvider) FetchRates(date time.Time) (*models.ExchangeRateData, error) {
+	endpoint, err := url.Parse(strings.Replace(p.apiURL, "%s", date.Format("2006-01-02"), 1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Open Exchange Rates URL: %v", err)
+	}
+	query := endpoint.Query()
+	query.Set("app_id", p.appID)
+	endpoint.RawQuery = query.Encode()
+
+	body, err := getBody(p.client, endpoint.String())
+	if err != nil {
+		return nil, err
+	}
+
+	var data models.ExchangeRateData
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("failed to decode Open Exchange Rates response: %v", err)
+	}
+
+	if data.Source == "" {
+		data.Source = OpenExchangeRatesName
+	}
+
+	return &data, nil
+}
@@ -0,0 +1,82 @@
+// internal/providers/provider.go
+
+package providers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+)
+
+// RateProvider defines a source of exchange rate data
+type RateProvider interface {
+	// Name returns the identifier the provider is registered under
+	Name() string
+	// FetchRates retrieves the rates published for the given date
+	FetchRates(date time.Time) (*models.ExchangeRateData, error)
+}
+
+// Registry holds the configured rate providers keyed by name
+type Registry struct {
+	providers   map[string]RateProvider
+	defaultName string
+}
+
+// NewRegistry creates an empty Registry with the given default provider name
+func NewRegistry(defaultName string) *Registry {
+	return &Registry{
+		providers:   make(map[string]RateProvider),
+		defaultName: defaultName,
+	}
+}
+
+// Register adds a provider to the registry, replacing any provider with the same name
+func (r *Registry) Register(provider RateProvider) {
+	r.providers[provider.Name()] = provider
+}
+
+// Get returns the provider registered under the given name
+func (r *Registry) Get(name string) (RateProvider, error) {
+	provider, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("rate provider %q is not configured", name)
+	}
+	return provider, nil
+}
+
+// Default returns the provider used when none is specified
+func (r *Registry) Default() (RateProvider, error) {
+	return r.Get(r.defaultName)
+}
+
+// Names returns the names of all registered providers in alphabetical order
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// defaultHTTPClient is shared by the HTTP based providers
+var defaultHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// getBody performs a GET request and returns the response body
+func getBody(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch data: status code %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(resp.Body)
+}
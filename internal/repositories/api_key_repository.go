@@ -0,0 +1,73 @@
+// package repositories
+
+package repositories
+
+import (
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"gorm.io/gorm"
+)
+
+// APIKeyRepository interface defines the methods for API key database operations
+type APIKeyRepository interface {
+	CreateAPIKey(key *models.APIKey) error
+	UpdateAPIKey(key *models.APIKey) error
+	DeleteAPIKey(id uint) error
+	FindAPIKeyByID(id uint) (*models.APIKey, error)
+	FindAPIKeyByPrefix(prefix string) (*models.APIKey, error)
+	ListAPIKeys(userID uint) ([]models.APIKey, error)
+	TouchAPIKey(id uint, usedAt time.Time, ipAddress string) error
+}
+
+type apiKeyRepository struct {
+	db *gorm.DB
+}
+
+// NewAPIKeyRepository creates a new instance of APIKeyRepository
+func NewAPIKeyRepository(db *gorm.DB) APIKeyRepository {
+	return &apiKeyRepository{db}
+}
+
+// CreateAPIKey inserts a new API key
+func (r *apiKeyRepository) CreateAPIKey(key *models.APIKey) error {
+	return r.db.Create(key).Error
+}
+
+// UpdateAPIKey saves an API key
+func (r *apiKeyRepository) UpdateAPIKey(key *models.APIKey) error {
+	return r.db.Save(key).Error
+}
+
+// DeleteAPIKey deletes an API key by its ID
+func (r *apiKeyRepository) DeleteAPIKey(id uint) error {
+	return r.db.Delete(&models.APIKey{}, id).Error
+}
+
+// FindAPIKeyByID retrieves an API key by its ID
+func (r *apiKeyRepository) FindAPIKeyByID(id uint) (*models.APIKey, error) {
+	var key models.APIKey
+	err := r.db.First(&key, id).Error
+	return &key, err
+}
+
+// FindAPIKeyByPrefix retrieves an API key by its prefix
+func (r *apiKeyRepository) FindAPIKeyByPrefix(prefix string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := r.db.Where("prefix = ?", prefix).First(&key).Error
+	return &key, err
+}
+
+// ListAPIKeys retrieves a user's API keys, newest first
+func (r *apiKeyRepository) ListAPIKeys(userID uint) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+// TouchAPIKey records when and from where a key was last used, without touching the
+// other columns
+func (r *apiKeyRepository) TouchAPIKey(id uint, usedAt time.Time, ipAddress string) error {
+	return r.db.Model(&models.APIKey{}).Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{"last_used_at": usedAt, "last_used_ip": ipAddress}).Error
+}
@@ -0,0 +1,100 @@
+// package repositories
+
+package repositories
+
+import (
+	"errors"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"gorm.io/gorm"
+)
+
+// auditChainLockKey identifies the PostgreSQL advisory lock serialising appends to the
+// audit chain across every process sharing the database
+const auditChainLockKey = 0x61756474 // "audt"
+
+// AuditRepository interface defines the methods for the append-only audit log
+type AuditRepository interface {
+	AppendEvent(event *models.AuditEvent) error
+	ListEvents(filter models.AuditFilter) ([]models.AuditEvent, int64, error)
+	ListEventsAfter(filter models.AuditFilter, id uint, limit int) ([]models.AuditEvent, error)
+}
+
+type auditRepository struct {
+	db *gorm.DB
+}
+
+// NewAuditRepository creates a new instance of AuditRepository
+func NewAuditRepository(db *gorm.DB) AuditRepository {
+	return &auditRepository{db}
+}
+
+// AppendEvent links the event to the last one in the chain, hashes it and inserts it.
+// Appends are serialised so that two events can never claim the same predecessor.
+func (r *auditRepository) AppendEvent(event *models.AuditEvent) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditChainLockKey).Error; err != nil {
+			return err
+		}
+
+		var last models.AuditEvent
+		err := tx.Select("hash").Order("id DESC").First(&last).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		event.PrevHash = last.Hash
+		event.Hash = event.ComputeHash()
+		return tx.Create(event).Error
+	})
+}
+
+// filtered applies the filter's conditions, but not its paging, to a query on audit_events
+func (r *auditRepository) filtered(filter models.AuditFilter) *gorm.DB {
+	query := r.db.Model(&models.AuditEvent{})
+	if filter.MdaID != nil {
+		query = query.Where("mda_id = ?", *filter.MdaID)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if filter.Target != "" {
+		query = query.Where("target = ?", filter.Target)
+	}
+	if filter.From != nil {
+		query = query.Where("occurred_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("occurred_at < ?", *filter.To)
+	}
+	return query
+}
+
+// ListEvents retrieves the events matching the filter, newest first, along with the
+// total number of matches
+func (r *auditRepository) ListEvents(filter models.AuditFilter) ([]models.AuditEvent, int64, error) {
+	var total int64
+	if err := r.filtered(filter).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	query := r.filtered(filter)
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	var events []models.AuditEvent
+	err := query.Order("id DESC").Offset(filter.Offset).Find(&events).Error
+	return events, total, err
+}
+
+// ListEventsAfter retrieves up to limit events matching the filter with an ID above id,
+// in chain order. The filter's paging is ignored; callers page by passing the last ID seen.
+func (r *auditRepository) ListEventsAfter(filter models.AuditFilter, id uint, limit int) ([]models.AuditEvent, error) {
+	var events []models.AuditEvent
+	err := r.filtered(filter).Where("id > ?", id).Order("id ASC").Limit(limit).Find(&events).Error
+	return events, err
+}
@@ -0,0 +1,49 @@
+// package repositories
+
+package repositories
+
+import (
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"gorm.io/gorm"
+)
+
+// BackfillRepository interface defines the methods for backfill job operations
+type BackfillRepository interface {
+	CreateJob(job *models.BackfillJob) error
+	UpdateJob(job *models.BackfillJob) error
+	GetJobByID(id uint) (*models.BackfillJob, error)
+	ListJobs(limit, offset int) ([]models.BackfillJob, error)
+}
+
+type backfillRepository struct {
+	db *gorm.DB
+}
+
+// NewBackfillRepository creates a new instance of BackfillRepository
+func NewBackfillRepository(db *gorm.DB) BackfillRepository {
+	return &backfillRepository{db}
+}
+
+// CreateJob inserts a new backfill job
+func (r *backfillRepository) CreateJob(job *models.BackfillJob) error {
+	return r.db.Create(job).Error
+}
+
+// UpdateJob saves the progress of a backfill job
+func (r *backfillRepository) UpdateJob(job *models.BackfillJob) error {
+	return r.db.Save(job).Error
+}
+
+// GetJobByID retrieves a backfill job by its ID
+func (r *backfillRepository) GetJobByID(id uint) (*models.BackfillJob, error) {
+	var job models.BackfillJob
+	err := r.db.First(&job, id).Error
+	return &job, err
+}
+
+// ListJobs retrieves backfill jobs, newest first
+func (r *backfillRepository) ListJobs(limit, offset int) ([]models.BackfillJob, error) {
+	var jobs []models.BackfillJob
+	err := r.db.Order("id DESC").Limit(limit).Offset(offset).Find(&jobs).Error
+	return jobs, err
+}
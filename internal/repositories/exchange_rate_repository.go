@@ -4,32 +4,60 @@ package repositories
 
 import (
 	"fmt"
-	"log"
 	"time"
 
 	"github.com/abduls21985/exchange-rate-service/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // ExchangeRateRepository interface defines the methods for exchange rate operations
 type ExchangeRateRepository interface {
+	ForTenant(mdaID string) ExchangeRateRepository
 	GetCurrencyByCode(code string) (*models.Currency, error)
 	CreateCurrency(code string, name string) (*models.Currency, error)
-	InsertOrUpdateExchangeRate(rate *models.ExchangeRate) error
-	GetExchangeRates(currencyCode string, timestamp int64) ([]models.ExchangeRate, error)
+	GetRateSourceByCode(code string) (*models.RateSource, error)
+	CreateRateSource(code string, name string, mdaID string) (*models.RateSource, error)
+	GetAllRateSources() ([]models.RateSource, error)
+	GetOrCreateCurrencies(codes []string) (map[string]uint, error)
+	SaveSnapshots(snapshots []*models.RateSnapshot) error
+	ListSnapshots(source string, limit, offset int) ([]models.RateSnapshot, error)
+	ListSnapshotsAfter(afterID uint, limit int) ([]models.RateSnapshot, error)
+	GetSnapshotDates(source string, start, end time.Time) (map[string]bool, error)
+	GetSnapshotByID(id uint) (*models.RateSnapshot, error)
+	GetPreviousSnapshot(snapshot *models.RateSnapshot) (*models.RateSnapshot, error)
+	HasNewerSnapshot(snapshot *models.RateSnapshot) (bool, error)
+	GetExchangeRates(currencyCode string, timestamp int64, source string) ([]models.ExchangeRate, error)
 	GetAllCurrencies() ([]models.Currency, error)
-	GetHistoricalExchangeRates(currencyCode string, startDate, endDate int64) ([]models.ExchangeRate, error)
-	GetExchangeRateByCurrency(currencyCode string) (models.ExchangeRate, error)
+	GetRateSeries(currencyCodes []string, source string, start, end time.Time) ([]models.ExchangeRate, error)
+	GetExchangeRateByCurrency(currencyCode string, source string) (models.ExchangeRate, error)
+	GetExchangeRateBefore(currencyCode string, source string, before time.Time) (models.ExchangeRate, error)
+	GetExchangeRateOnOrAfter(currencyCode string, source string, from time.Time) (models.ExchangeRate, error)
+	GetRatesPublishedWith(rate models.ExchangeRate) ([]models.ExchangeRate, error)
 	CountExchangeRates() (int, error)
 }
 
 type exchangeRateRepository struct {
-	db *gorm.DB
+	db    *gorm.DB
+	mdaID string // Tenant whose custom sources are visible in addition to the global ones
 }
 
-// NewExchangeRateRepository creates a new instance of ExchangeRateRepository
+// NewExchangeRateRepository creates a new instance of ExchangeRateRepository that reads
+// from global rate sources only
 func NewExchangeRateRepository(db *gorm.DB) ExchangeRateRepository {
-	return &exchangeRateRepository{db}
+	return &exchangeRateRepository{db: db}
+}
+
+// ForTenant returns a repository whose reads also see the sources owned by the MDA
+func (r *exchangeRateRepository) ForTenant(mdaID string) ExchangeRateRepository {
+	return &exchangeRateRepository{db: r.db, mdaID: mdaID}
+}
+
+// visibleSources restricts a query to rows from global sources and the tenant's own.
+// column is the source ID column of the queried table.
+func (r *exchangeRateRepository) visibleSources(query *gorm.DB, column string) *gorm.DB {
+	return query.Where(column+" IN (?)",
+		r.db.Model(&models.RateSource{}).Select("id").Where("mda_id = '' OR mda_id = ?", r.mdaID))
 }
 
 // GetCurrencyByCode retrieves a currency by its code
@@ -46,31 +74,269 @@ func (r *exchangeRateRepository) CreateCurrency(code string, name string) (*mode
 	return currency, err
 }
 
-// InsertOrUpdateExchangeRate inserts a new exchange rate or updates the existing one
-func (r *exchangeRateRepository) InsertOrUpdateExchangeRate(rate *models.ExchangeRate) error {
-	// GORM's `Save` method will update if the record already exists
-	return r.db.Save(rate).Error
+// GetRateSourceByCode retrieves a rate source by its code
+func (r *exchangeRateRepository) GetRateSourceByCode(code string) (*models.RateSource, error) {
+	var source models.RateSource
+	err := r.db.Where("code = ?", code).First(&source).Error
+	return &source, err
+}
+
+// CreateRateSource adds a new rate source to the database, owned by the MDA if one is given
+func (r *exchangeRateRepository) CreateRateSource(code string, name string, mdaID string) (*models.RateSource, error) {
+	source := &models.RateSource{Code: code, Name: name, MdaID: mdaID}
+	err := r.db.Create(source).Error
+	return source, err
+}
+
+// GetAllRateSources retrieves the global rate sources and the tenant's own
+func (r *exchangeRateRepository) GetAllRateSources() ([]models.RateSource, error) {
+	var sources []models.RateSource
+	err := r.visibleSources(r.db, "id").Order("code ASC").Find(&sources).Error
+	return sources, err
+}
+
+// filterBySource restricts a query on exchange_rates to the rate source with the given code
+func filterBySource(query *gorm.DB, source string) *gorm.DB {
+	if source == "" {
+		return query
+	}
+	return query.Joins("JOIN rate_sources ON exchange_rates.source_id = rate_sources.id").
+		Where("rate_sources.code = ?", source)
+}
+
+// inCompleteSnapshots restricts a query on exchange_rates to rates that belong to a snapshot.
+// Snapshots are written in a single transaction, so their rates are always complete.
+func inCompleteSnapshots(query *gorm.DB) *gorm.DB {
+	return query.Joins("JOIN rate_snapshots ON exchange_rates.snapshot_id = rate_snapshots.id")
+}
+
+// rateUpsertBatchSize keeps each bulk insert well below PostgreSQL's parameter limit
+const rateUpsertBatchSize = 1000
+
+// SaveSnapshots stores snapshots and all of their rates in one transaction. A snapshot
+// of an already stored publication (same source and provider timestamp) is updated in
+// place and its rates are upserted, so re-ingesting never creates duplicates. The
+// statements issued do not depend on the number of rates or snapshots beyond batching.
+func (r *exchangeRateRepository) SaveSnapshots(snapshots []*models.RateSnapshot) error {
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Note which publications are already stored; only those can have stale rates
+		publications := make([][]interface{}, len(snapshots))
+		for i, snapshot := range snapshots {
+			publications[i] = []interface{}{snapshot.SourceID, snapshot.ProviderTimestamp}
+		}
+		var existing []models.RateSnapshot
+		if err := tx.Where("(source_id, provider_timestamp) IN ?", publications).Find(&existing).Error; err != nil {
+			return fmt.Errorf("failed to look up existing snapshots: %v", err)
+		}
+		replaced := make(map[uint]bool, len(existing))
+		for _, snapshot := range existing {
+			replaced[snapshot.ID] = true
+		}
+
+		// Upsert the snapshot rows; PostgreSQL returns the ID of inserted and updated rows alike.
+		// A re-ingest without attribution keeps the user and reason of a manual submission.
+		err := tx.Omit(clause.Associations).Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "source_id"}, {Name: "provider_timestamp"}},
+			DoUpdates: append(clause.AssignmentColumns([]string{
+				"base_currency_id", "fetched_at", "checksum", "rate_count",
+			}), clause.Set{
+				{Column: clause.Column{Name: "posted_by_id"}, Value: gorm.Expr("COALESCE(excluded.posted_by_id, rate_snapshots.posted_by_id)")},
+				{Column: clause.Column{Name: "posted_by"}, Value: gorm.Expr("COALESCE(NULLIF(excluded.posted_by, ''), rate_snapshots.posted_by)")},
+				{Column: clause.Column{Name: "reason"}, Value: gorm.Expr("COALESCE(NULLIF(excluded.reason, ''), rate_snapshots.reason)")},
+			}...),
+		}).CreateInBatches(snapshots, rateUpsertBatchSize).Error
+		if err != nil {
+			return fmt.Errorf("failed to upsert snapshots: %v", err)
+		}
+
+		rates := make([]models.ExchangeRate, 0, len(snapshots)*len(snapshots[0].Rates))
+		for _, snapshot := range snapshots {
+			for i := range snapshot.Rates {
+				snapshot.Rates[i].SnapshotID = snapshot.ID
+			}
+			rates = append(rates, snapshot.Rates...)
+		}
+		if len(rates) == 0 {
+			return nil
+		}
+
+		err = tx.Omit(clause.Associations).Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "currency_id"}, {Name: "timestamp"}, {Name: "source_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"rate", "buy_rate", "sell_rate", "mid_rate", "base_currency_id", "snapshot_id",
+			}),
+		}).CreateInBatches(rates, rateUpsertBatchSize).Error
+		if err != nil {
+			return fmt.Errorf("failed to upsert exchange rates: %v", err)
+		}
+
+		// Drop currencies a re-published snapshot no longer quotes, i.e. any of its
+		// rows that were not among the ones just upserted
+		for _, snapshot := range snapshots {
+			if !replaced[snapshot.ID] {
+				continue
+			}
+			ids := make([]uint, len(snapshot.Rates))
+			for i, rate := range snapshot.Rates {
+				ids[i] = rate.ID
+			}
+			query := tx.Where("snapshot_id = ?", snapshot.ID)
+			if len(ids) > 0 {
+				query = query.Where("id NOT IN ?", ids)
+			}
+			if err := query.Delete(&models.ExchangeRate{}).Error; err != nil {
+				return fmt.Errorf("failed to remove superseded rates: %v", err)
+			}
+		}
+
+		return nil
+	})
 }
 
-// GetExchangeRates retrieves exchange rates based on currency code and timestamp
-func (r *exchangeRateRepository) GetExchangeRates(currencyCode string, timestamp int64) ([]models.ExchangeRate, error) {
+// GetOrCreateCurrencies resolves currency codes to IDs, creating any that do not exist.
+// It issues a fixed number of statements regardless of how many codes are given.
+func (r *exchangeRateRepository) GetOrCreateCurrencies(codes []string) (map[string]uint, error) {
+	ids := make(map[string]uint, len(codes))
+	if len(codes) == 0 {
+		return ids, nil
+	}
+
+	currencies := make([]models.Currency, len(codes))
+	for i, code := range codes {
+		currencies[i] = models.Currency{Code: code}
+	}
+	err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "code"}},
+		DoNothing: true,
+	}).CreateInBatches(currencies, rateUpsertBatchSize).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to create currencies: %v", err)
+	}
+
+	var existing []models.Currency
+	if err := r.db.Where("code IN ?", codes).Find(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to look up currencies: %v", err)
+	}
+	for _, currency := range existing {
+		ids[currency.Code] = currency.ID
+	}
+	return ids, nil
+}
+
+// ListSnapshots retrieves snapshots, newest publication first, optionally for a single source
+func (r *exchangeRateRepository) ListSnapshots(source string, limit, offset int) ([]models.RateSnapshot, error) {
+	var snapshots []models.RateSnapshot
+
+	query := r.visibleSources(r.db.Preload("Source").Preload("BaseCurrency"), "rate_snapshots.source_id")
+	if source != "" {
+		query = query.Joins("JOIN rate_sources ON rate_snapshots.source_id = rate_sources.id").
+			Where("rate_sources.code = ?", source)
+	}
+
+	err := query.Order("rate_snapshots.provider_timestamp DESC, rate_snapshots.id DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&snapshots).Error
+	return snapshots, err
+}
+
+// ListSnapshotsAfter retrieves the snapshots stored after the one with afterID, oldest
+// first, together with their rates
+func (r *exchangeRateRepository) ListSnapshotsAfter(afterID uint, limit int) ([]models.RateSnapshot, error) {
+	var snapshots []models.RateSnapshot
+	query := r.visibleSources(r.db.Preload("Source").Preload("BaseCurrency").Preload("Rates.Currency"), "source_id")
+	err := query.Where("id > ?", afterID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&snapshots).Error
+	return snapshots, err
+}
+
+// GetSnapshotDates returns the days (YYYY-MM-DD, UTC) between start and end inclusive
+// on which the source has a snapshot
+func (r *exchangeRateRepository) GetSnapshotDates(source string, start, end time.Time) (map[string]bool, error) {
+	var timestamps []time.Time
+	err := r.db.Model(&models.RateSnapshot{}).
+		Joins("JOIN rate_sources ON rate_snapshots.source_id = rate_sources.id").
+		Where("rate_sources.code = ? AND rate_snapshots.provider_timestamp >= ? AND rate_snapshots.provider_timestamp < ?",
+			source, start.UTC(), end.UTC().AddDate(0, 0, 1)).
+		Pluck("rate_snapshots.provider_timestamp", &timestamps).Error
+	if err != nil {
+		return nil, err
+	}
+
+	dates := make(map[string]bool, len(timestamps))
+	for _, timestamp := range timestamps {
+		dates[timestamp.UTC().Format("2006-01-02")] = true
+	}
+	return dates, nil
+}
+
+// GetSnapshotByID retrieves a snapshot together with its rates
+func (r *exchangeRateRepository) GetSnapshotByID(id uint) (*models.RateSnapshot, error) {
+	var snapshot models.RateSnapshot
+	query := r.visibleSources(r.db.Preload("Source").Preload("BaseCurrency").Preload("Rates.Currency"), "source_id")
+	err := query.First(&snapshot, id).Error
+	return &snapshot, err
+}
+
+// GetPreviousSnapshot retrieves the snapshot of the same source published just before
+// the given one, together with its rates
+func (r *exchangeRateRepository) GetPreviousSnapshot(snapshot *models.RateSnapshot) (*models.RateSnapshot, error) {
+	var previous models.RateSnapshot
+	err := r.db.Preload("Source").Preload("BaseCurrency").Preload("Rates.Currency").
+		Where("source_id = ? AND provider_timestamp < ?", snapshot.SourceID, snapshot.ProviderTimestamp).
+		Order("provider_timestamp DESC").
+		First(&previous).Error
+	return &previous, err
+}
+
+// HasNewerSnapshot reports whether the snapshot's source has one published after it
+func (r *exchangeRateRepository) HasNewerSnapshot(snapshot *models.RateSnapshot) (bool, error) {
+	var exists bool
+	err := r.db.Raw("SELECT EXISTS (SELECT 1 FROM rate_snapshots WHERE source_id = ? AND provider_timestamp > ?)",
+		snapshot.SourceID, snapshot.ProviderTimestamp).Scan(&exists).Error
+	return exists, err
+}
+
+// GetExchangeRates retrieves the rates of a single snapshot: the one published at the
+// timestamp, or the most recent one, optionally restricted to a currency and source
+func (r *exchangeRateRepository) GetExchangeRates(currencyCode string, timestamp int64, source string) ([]models.ExchangeRate, error) {
 	var rates []models.ExchangeRate
 
+	// Find the snapshot to read from
+	snapshotQuery := r.visibleSources(r.db.Model(&models.RateSnapshot{}), "rate_snapshots.source_id")
+	if source != "" {
+		snapshotQuery = snapshotQuery.Joins("JOIN rate_sources ON rate_snapshots.source_id = rate_sources.id").
+			Where("rate_sources.code = ?", source)
+	}
+	if timestamp != 0 {
+		snapshotQuery = snapshotQuery.Where("rate_snapshots.provider_timestamp = ?", time.Unix(timestamp, 0).UTC())
+	}
+	var snapshot models.RateSnapshot
+	err := snapshotQuery.Order("rate_snapshots.provider_timestamp DESC, rate_snapshots.id DESC").
+		Limit(1).
+		Find(&snapshot).Error
+	if err != nil || snapshot.ID == 0 {
+		return rates, err
+	}
+
 	// Start the query
 	query := r.db.Joins("JOIN currencies AS c1 ON exchange_rates.currency_id = c1.id").
-		Joins("JOIN currencies AS c2 ON exchange_rates.base_currency_id = c2.id").
-		Preload("Currency").Preload("BaseCurrency")
+		Where("exchange_rates.snapshot_id = ?", snapshot.ID).
+		Preload("Currency").Preload("BaseCurrency").Preload("Source")
 
 	// Apply filters if provided
 	if currencyCode != "" {
 		query = query.Where("c1.code = ?", currencyCode)
 	}
-	if timestamp != 0 {
-		query = query.Where("exchange_rates.timestamp = ?", timestamp)
-	}
 
 	// Execute the query
-	err := query.Find(&rates).Error
+	err = query.Find(&rates).Error
 	return rates, err
 }
 
@@ -81,54 +347,85 @@ func (r *exchangeRateRepository) GetAllCurrencies() ([]models.Currency, error) {
 	return currencies, err
 }
 
-// internal/repositories/exchange_rate_repository.go
-
-func (r *exchangeRateRepository) GetHistoricalExchangeRates(currencyCode string, startDate, endDate int64) ([]models.ExchangeRate, error) {
+// GetRateSeries retrieves the rates of the currencies, or of every currency when none are
+// given, stamped from start up to, but not including, end, oldest first, with their
+// currency, base currency and source
+func (r *exchangeRateRepository) GetRateSeries(currencyCodes []string, source string, start, end time.Time) ([]models.ExchangeRate, error) {
 	var rates []models.ExchangeRate
 
-	// Convert Unix timestamps to time.Time
-	start := time.Unix(startDate, 0).UTC()
-	end := time.Unix(endDate, 0).UTC()
-
-	// Build the query
 	query := r.db.Joins("JOIN currencies ON exchange_rates.currency_id = currencies.id").
-		Where("exchange_rates.timestamp BETWEEN ? AND ?", start, end)
-
-	if currencyCode != "" {
-		query = query.Where("currencies.code = ?", currencyCode)
-	}
-
-	// Execute the query
-	err := query.Find(&rates).Error
-
-	// Log the number of records found
-	if err == nil {
-		log.Printf("Found %d exchange rate records for currency %s between %v and %v", len(rates), currencyCode, start, end)
+		Where("exchange_rates.timestamp >= ? AND exchange_rates.timestamp < ?", start.UTC(), end.UTC())
+	if len(currencyCodes) > 0 {
+		query = query.Where("currencies.code IN ?", currencyCodes)
 	}
+	query = inCompleteSnapshots(filterBySource(r.visibleSources(query, "exchange_rates.source_id"), source)).
+		Preload("Currency").Preload("BaseCurrency").Preload("Source")
 
+	err := query.Order("exchange_rates.timestamp ASC, exchange_rates.snapshot_id ASC").Find(&rates).Error
 	return rates, err
 }
 
 // internal/repositories/exchange_rate_repository.go
 
-func (r *exchangeRateRepository) GetExchangeRateByCurrency(currencyCode string) (models.ExchangeRate, error) {
+func (r *exchangeRateRepository) GetExchangeRateByCurrency(currencyCode string, source string) (models.ExchangeRate, error) {
+	var rate models.ExchangeRate
+
+	// Fetch the latest exchange rate for the given currency, optionally from a single source
+	query := r.db.Joins("JOIN currencies ON exchange_rates.currency_id = currencies.id").
+		Where("currencies.code = ?", currencyCode)
+	query = inCompleteSnapshots(filterBySource(r.visibleSources(query, "exchange_rates.source_id"), source)).Preload("Source")
+
+	err := query.Order("exchange_rates.timestamp DESC").
+		Limit(1).
+		Find(&rate).Error
+
+	return rate, err
+}
+
+// GetExchangeRateBefore retrieves the most recent rate for the currency stamped strictly before the given time
+func (r *exchangeRateRepository) GetExchangeRateBefore(currencyCode string, source string, before time.Time) (models.ExchangeRate, error) {
 	var rate models.ExchangeRate
 
-	// Fetch the latest exchange rate for the given currency
-	err := r.db.Joins("JOIN currencies ON exchange_rates.currency_id = currencies.id").
-		Where("currencies.code = ?", currencyCode).
-		Order("exchange_rates.timestamp DESC").
+	query := r.db.Joins("JOIN currencies ON exchange_rates.currency_id = currencies.id").
+		Where("currencies.code = ? AND exchange_rates.timestamp < ?", currencyCode, before.UTC())
+	query = inCompleteSnapshots(filterBySource(r.visibleSources(query, "exchange_rates.source_id"), source)).Preload("Source")
+
+	err := query.Order("exchange_rates.timestamp DESC").
 		Limit(1).
 		Find(&rate).Error
 
 	return rate, err
 }
 
+// GetExchangeRateOnOrAfter retrieves the earliest rate for the currency stamped at or after the given time
+func (r *exchangeRateRepository) GetExchangeRateOnOrAfter(currencyCode string, source string, from time.Time) (models.ExchangeRate, error) {
+	var rate models.ExchangeRate
+
+	query := r.db.Joins("JOIN currencies ON exchange_rates.currency_id = currencies.id").
+		Where("currencies.code = ? AND exchange_rates.timestamp >= ?", currencyCode, from.UTC())
+	query = inCompleteSnapshots(filterBySource(r.visibleSources(query, "exchange_rates.source_id"), source)).Preload("Source")
+
+	err := query.Order("exchange_rates.timestamp ASC").
+		Limit(1).
+		Find(&rate).Error
+
+	return rate, err
+}
+
+// GetRatesPublishedWith retrieves every rate from the same snapshot as the given rate
+func (r *exchangeRateRepository) GetRatesPublishedWith(rate models.ExchangeRate) ([]models.ExchangeRate, error) {
+	var rates []models.ExchangeRate
+	err := r.db.Where("snapshot_id = ?", rate.SnapshotID).
+		Preload("Currency").Preload("BaseCurrency").Preload("Source").
+		Find(&rates).Error
+	return rates, err
+}
+
 // internal/repositories/exchange_rate_repository.go
 
 func (r *exchangeRateRepository) CountExchangeRates() (int, error) {
 	var count int64
-	if err := r.db.Model(&models.ExchangeRate{}).Count(&count).Error; err != nil {
+	if err := r.visibleSources(r.db.Model(&models.ExchangeRate{}), "exchange_rates.source_id").Count(&count).Error; err != nil {
 		return 0, fmt.Errorf("failed to count exchange rates: %v", err)
 	}
 	return int(count), nil
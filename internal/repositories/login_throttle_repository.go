@@ -0,0 +1,73 @@
+// package repositories
+
+package repositories
+
+import (
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoginThrottleRepository interface defines the methods for failed login tracking
+type LoginThrottleRepository interface {
+	FindThrottle(kind, value string) (*models.LoginThrottle, error)
+	RecordFailure(kind, value string, now, forgetBefore time.Time) (*models.LoginThrottle, error)
+	Lock(kind, value string, until time.Time) error
+	DeleteThrottle(kind, value string) error
+	ListLocked(now time.Time) ([]models.LoginThrottle, error)
+}
+
+type loginThrottleRepository struct {
+	db *gorm.DB
+}
+
+// NewLoginThrottleRepository creates a new instance of LoginThrottleRepository
+func NewLoginThrottleRepository(db *gorm.DB) LoginThrottleRepository {
+	return &loginThrottleRepository{db}
+}
+
+// FindThrottle retrieves the failed login record for a username or IP
+func (r *loginThrottleRepository) FindThrottle(kind, value string) (*models.LoginThrottle, error) {
+	var throttle models.LoginThrottle
+	err := r.db.Where("kind = ? AND value = ?", kind, value).First(&throttle).Error
+	return &throttle, err
+}
+
+// RecordFailure counts a failed login in a single statement, so that concurrent
+// attempts are all counted. Failures last recorded before forgetBefore are discarded
+// and counting starts again from one.
+func (r *loginThrottleRepository) RecordFailure(kind, value string, now, forgetBefore time.Time) (*models.LoginThrottle, error) {
+	throttle := models.LoginThrottle{Kind: kind, Value: value, Failures: 1, LastFailureAt: now}
+	err := r.db.Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "kind"}, {Name: "value"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"failures": gorm.Expr(
+					"CASE WHEN login_throttles.last_failure_at < ? THEN 1 ELSE login_throttles.failures + 1 END", forgetBefore),
+				"last_failure_at": now,
+			}),
+		},
+		clause.Returning{},
+	).Create(&throttle).Error
+	return &throttle, err
+}
+
+// Lock locks out logins for a username or IP until the given time
+func (r *loginThrottleRepository) Lock(kind, value string, until time.Time) error {
+	return r.db.Model(&models.LoginThrottle{}).Where("kind = ? AND value = ?", kind, value).
+		Update("locked_until", until).Error
+}
+
+// DeleteThrottle forgets the failed logins of a username or IP, lifting any lockout
+func (r *loginThrottleRepository) DeleteThrottle(kind, value string) error {
+	return r.db.Where("kind = ? AND value = ?", kind, value).Delete(&models.LoginThrottle{}).Error
+}
+
+// ListLocked retrieves the usernames and IPs currently locked out, latest lockout end first
+func (r *loginThrottleRepository) ListLocked(now time.Time) ([]models.LoginThrottle, error) {
+	var throttles []models.LoginThrottle
+	err := r.db.Where("locked_until > ?", now).Order("locked_until DESC").Find(&throttles).Error
+	return throttles, err
+}
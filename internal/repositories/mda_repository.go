@@ -0,0 +1,49 @@
+// package repositories
+
+package repositories
+
+import (
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"gorm.io/gorm"
+)
+
+// MDARepository interface defines the methods for tenant operations
+type MDARepository interface {
+	CreateMDA(mda *models.MDA) error
+	UpdateMDA(mda *models.MDA) error
+	FindMDAByCode(code string) (*models.MDA, error)
+	ListMDAs() ([]models.MDA, error)
+}
+
+type mdaRepository struct {
+	db *gorm.DB
+}
+
+// NewMDARepository creates a new instance of MDARepository
+func NewMDARepository(db *gorm.DB) MDARepository {
+	return &mdaRepository{db}
+}
+
+// CreateMDA inserts a new MDA
+func (r *mdaRepository) CreateMDA(mda *models.MDA) error {
+	return r.db.Create(mda).Error
+}
+
+// UpdateMDA saves an MDA's settings
+func (r *mdaRepository) UpdateMDA(mda *models.MDA) error {
+	return r.db.Save(mda).Error
+}
+
+// FindMDAByCode retrieves an MDA by its code, ignoring case
+func (r *mdaRepository) FindMDAByCode(code string) (*models.MDA, error) {
+	var mda models.MDA
+	err := r.db.Where("UPPER(code) = UPPER(?)", code).First(&mda).Error
+	return &mda, err
+}
+
+// ListMDAs retrieves all MDAs ordered by code
+func (r *mdaRepository) ListMDAs() ([]models.MDA, error) {
+	var mdas []models.MDA
+	err := r.db.Order("code ASC").Find(&mdas).Error
+	return mdas, err
+}
@@ -0,0 +1,133 @@
+// package repositories
+
+package repositories
+
+import (
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MFARepository interface defines the methods for second factor operations
+type MFARepository interface {
+	AcceptStep(userID uint, step int64) (bool, error)
+	ReplaceRecoveryCodes(userID uint, hashes []string) error
+	UseRecoveryCode(userID uint, hash string, now time.Time) (bool, error)
+	CountRecoveryCodes(userID uint) (int64, error)
+	DeleteRecoveryCodes(userID uint) error
+	CreateChallenge(challenge *models.MFAChallenge) error
+	FindChallengeByTokenHash(hash string) (*models.MFAChallenge, error)
+	CountChallengeAttempt(id uint) error
+	DeleteChallenge(id uint) (bool, error)
+	DeleteExpiredChallenges(now time.Time) error
+	ListPolicies() ([]models.MFAPolicy, error)
+	FindPolicy(role models.Role) (*models.MFAPolicy, error)
+	SavePolicy(policy *models.MFAPolicy) error
+}
+
+type mfaRepository struct {
+	db *gorm.DB
+}
+
+// NewMFARepository creates a new instance of MFARepository
+func NewMFARepository(db *gorm.DB) MFARepository {
+	return &mfaRepository{db}
+}
+
+// AcceptStep records the TOTP time step of an accepted code. It reports false if the
+// step, or a later one, was already used, so that each code is accepted only once even
+// by concurrent requests.
+func (r *mfaRepository) AcceptStep(userID uint, step int64) (bool, error) {
+	result := r.db.Model(&models.User{}).Where("id = ? AND mfa_last_step < ?", userID, step).
+		UpdateColumn("mfa_last_step", step)
+	return result.RowsAffected == 1, result.Error
+}
+
+// ReplaceRecoveryCodes discards the user's recovery codes and stores new ones
+func (r *mfaRepository) ReplaceRecoveryCodes(userID uint, hashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]models.MFARecoveryCode, 0, len(hashes))
+		for _, hash := range hashes {
+			codes = append(codes, models.MFARecoveryCode{UserID: userID, CodeHash: hash})
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// UseRecoveryCode marks an unused recovery code of the user as used, reporting false if
+// there is no such code
+func (r *mfaRepository) UseRecoveryCode(userID uint, hash string, now time.Time) (bool, error) {
+	result := r.db.Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", now)
+	return result.RowsAffected == 1, result.Error
+}
+
+// CountRecoveryCodes counts the user's unused recovery codes
+func (r *mfaRepository) CountRecoveryCodes(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.MFARecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+// DeleteRecoveryCodes removes all of the user's recovery codes
+func (r *mfaRepository) DeleteRecoveryCodes(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error
+}
+
+// CreateChallenge inserts a new login challenge
+func (r *mfaRepository) CreateChallenge(challenge *models.MFAChallenge) error {
+	return r.db.Create(challenge).Error
+}
+
+// FindChallengeByTokenHash retrieves the challenge whose token has the hash
+func (r *mfaRepository) FindChallengeByTokenHash(hash string) (*models.MFAChallenge, error) {
+	var challenge models.MFAChallenge
+	err := r.db.Where("token_hash = ?", hash).First(&challenge).Error
+	return &challenge, err
+}
+
+// CountChallengeAttempt counts a wrong code entered for the challenge
+func (r *mfaRepository) CountChallengeAttempt(id uint) error {
+	return r.db.Model(&models.MFAChallenge{}).Where("id = ?", id).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1")).Error
+}
+
+// DeleteChallenge removes a challenge, reporting false if it was already gone so that
+// only one request can complete it
+func (r *mfaRepository) DeleteChallenge(id uint) (bool, error) {
+	result := r.db.Delete(&models.MFAChallenge{}, id)
+	return result.RowsAffected == 1, result.Error
+}
+
+// DeleteExpiredChallenges removes challenges that can no longer be completed
+func (r *mfaRepository) DeleteExpiredChallenges(now time.Time) error {
+	return r.db.Where("expires_at <= ?", now).Delete(&models.MFAChallenge{}).Error
+}
+
+// ListPolicies retrieves the stored per-role policies
+func (r *mfaRepository) ListPolicies() ([]models.MFAPolicy, error) {
+	var policies []models.MFAPolicy
+	err := r.db.Order("role").Find(&policies).Error
+	return policies, err
+}
+
+// FindPolicy retrieves the stored policy of a role
+func (r *mfaRepository) FindPolicy(role models.Role) (*models.MFAPolicy, error) {
+	var policy models.MFAPolicy
+	err := r.db.Where("role = ?", role).First(&policy).Error
+	return &policy, err
+}
+
+// SavePolicy inserts or replaces the policy of a role
+func (r *mfaRepository) SavePolicy(policy *models.MFAPolicy) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "role"}},
+		DoUpdates: clause.AssignmentColumns([]string{"required", "updated_at"}),
+	}).Create(policy).Error
+}
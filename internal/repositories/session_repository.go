@@ -0,0 +1,144 @@
+// package repositories
+
+package repositories
+
+import (
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SessionRepository interface defines the methods for session and token revocation operations
+type SessionRepository interface {
+	CreateSession(session *models.Session) error
+	UpdateSession(session *models.Session) error
+	RotateRefreshToken(session *models.Session, presentedHash string, replaced *models.RevokedToken) (bool, error)
+	FindSessionByID(id uint) (*models.Session, error)
+	FindSessionByRefreshTokenHash(hash string) (*models.Session, error)
+	ListActiveSessions(userID uint, now time.Time) ([]models.Session, error)
+	RevokeSessions(sessions []models.Session, now time.Time) error
+	RevokeToken(token models.RevokedToken) error
+	IsTokenRevoked(jti string) (bool, error)
+	DeleteExpiredRevokedTokens(now time.Time) error
+}
+
+type sessionRepository struct {
+	db *gorm.DB
+}
+
+// NewSessionRepository creates a new instance of SessionRepository
+func NewSessionRepository(db *gorm.DB) SessionRepository {
+	return &sessionRepository{db}
+}
+
+// CreateSession inserts a new session
+func (r *sessionRepository) CreateSession(session *models.Session) error {
+	return r.db.Create(session).Error
+}
+
+// UpdateSession saves a session
+func (r *sessionRepository) UpdateSession(session *models.Session) error {
+	return r.db.Save(session).Error
+}
+
+// RotateRefreshToken saves a session whose refresh token was replaced, but only while
+// the session's stored refresh token still has the presented hash, and revokes the
+// replaced access token, if any, in the same transaction. It reports false when another
+// request rotated or revoked the session first.
+func (r *sessionRepository) RotateRefreshToken(session *models.Session, presentedHash string, replaced *models.RevokedToken) (bool, error) {
+	rotated := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Session{}).
+			Where("id = ? AND refresh_token_hash = ? AND revoked_at IS NULL", session.ID, presentedHash).
+			Updates(map[string]interface{}{
+				"refresh_token_hash":          session.RefreshTokenHash,
+				"previous_refresh_token_hash": session.PreviousRefreshTokenHash,
+				"access_token_id":             session.AccessTokenID,
+				"access_expires_at":           session.AccessExpiresAt,
+				"user_agent":                  session.UserAgent,
+				"ip_address":                  session.IPAddress,
+				"last_used_at":                session.LastUsedAt,
+			})
+		if result.Error != nil || result.RowsAffected != 1 {
+			return result.Error
+		}
+		rotated = true
+		if replaced == nil {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(replaced).Error
+	})
+	return rotated && err == nil, err
+}
+
+// FindSessionByID retrieves a session by its ID
+func (r *sessionRepository) FindSessionByID(id uint) (*models.Session, error) {
+	var session models.Session
+	err := r.db.First(&session, id).Error
+	return &session, err
+}
+
+// FindSessionByRefreshTokenHash retrieves the session whose current or previous refresh
+// token has the hash
+func (r *sessionRepository) FindSessionByRefreshTokenHash(hash string) (*models.Session, error) {
+	var session models.Session
+	err := r.db.Where("refresh_token_hash = ? OR previous_refresh_token_hash = ?", hash, hash).
+		First(&session).Error
+	return &session, err
+}
+
+// ListActiveSessions retrieves a user's sessions that are neither revoked nor expired,
+// most recently used first
+func (r *sessionRepository) ListActiveSessions(userID uint, now time.Time) ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// RevokeSessions marks the sessions revoked and adds their unexpired access tokens to
+// the revocation list, in one transaction
+func (r *sessionRepository) RevokeSessions(sessions []models.Session, now time.Time) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(sessions))
+	tokens := make([]models.RevokedToken, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+		if session.AccessTokenID != "" && session.AccessExpiresAt.After(now) {
+			tokens = append(tokens, models.RevokedToken{JTI: session.AccessTokenID, ExpiresAt: session.AccessExpiresAt})
+		}
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Session{}).Where("id IN ?", ids).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		if len(tokens) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tokens).Error
+	})
+}
+
+// RevokeToken adds a single access token to the revocation list
+func (r *sessionRepository) RevokeToken(token models.RevokedToken) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&token).Error
+}
+
+// IsTokenRevoked reports whether the access token with the jti has been revoked
+func (r *sessionRepository) IsTokenRevoked(jti string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	return count > 0, err
+}
+
+// DeleteExpiredRevokedTokens removes revocation entries for tokens that have expired anyway
+func (r *sessionRepository) DeleteExpiredRevokedTokens(now time.Time) error {
+	return r.db.Where("expires_at < ?", now).Delete(&models.RevokedToken{}).Error
+}
@@ -11,9 +11,12 @@ import (
 type UserRepository interface {
 	CreateUser(user *models.User) error
 	FindUserByUsername(username string) (*models.User, error)
+	FindUserByID(id uint) (*models.User, error)
 	UpdateUser(user *models.User) error
 	FindUserByEmail(email string) (*models.User, error)
 	FindUserByResetToken(token string) (*models.User, error)
+	CountUsersByMDA(mdaID string) (int64, error)
+	ListUsers(filter models.UserFilter) ([]models.User, int64, error)
 }
 
 type userRepository struct {
@@ -37,6 +40,13 @@ func (r *userRepository) FindUserByUsername(username string) (*models.User, erro
 	return &user, err
 }
 
+// FindUserByID retrieves a user by their ID
+func (r *userRepository) FindUserByID(id uint) (*models.User, error) {
+	var user models.User
+	err := r.db.First(&user, id).Error
+	return &user, err
+}
+
 // UpdateUser updates user details in the database
 func (r *userRepository) UpdateUser(user *models.User) error {
 	return r.db.Save(user).Error
@@ -55,3 +65,39 @@ func (r *userRepository) FindUserByResetToken(token string) (*models.User, error
 	err := r.db.Where("reset_token = ?", token).First(&user).Error
 	return &user, err
 }
+
+// CountUsersByMDA counts the users belonging to an MDA
+func (r *userRepository) CountUsersByMDA(mdaID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.User{}).Where("mda_id = ?", mdaID).Count(&count).Error
+	return count, err
+}
+
+// ListUsers retrieves a page of users matching the filter, ordered by username, together
+// with the total number of matches
+func (r *userRepository) ListUsers(filter models.UserFilter) ([]models.User, int64, error) {
+	query := r.db.Model(&models.User{})
+	if filter.MdaID != "" {
+		query = query.Where("mda_id = ?", filter.MdaID)
+	}
+	if filter.Search != "" {
+		pattern := "%" + filter.Search + "%"
+		query = query.Where("username ILIKE ? OR email ILIKE ? OR first_name ILIKE ? OR last_name ILIKE ?",
+			pattern, pattern, pattern, pattern)
+	}
+	if filter.Role != "" {
+		query = query.Where("role = ?", filter.Role)
+	}
+	if filter.Active != nil {
+		query = query.Where("active = ?", *filter.Active)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []models.User
+	err := query.Order("username ASC").Limit(filter.Limit).Offset(filter.Offset).Find(&users).Error
+	return users, total, err
+}
@@ -0,0 +1,136 @@
+// package repositories
+
+package repositories
+
+import (
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// WebhookRepository interface defines the methods for webhook subscriptions and their deliveries
+type WebhookRepository interface {
+	CreateSubscription(subscription *models.WebhookSubscription) error
+	UpdateSubscription(subscription *models.WebhookSubscription) error
+	DeleteSubscription(id uint) error
+	FindSubscriptionByID(id uint) (*models.WebhookSubscription, error)
+	ListSubscriptions(mdaID string) ([]models.WebhookSubscription, error)
+	ListActiveSubscriptions() ([]models.WebhookSubscription, error)
+	CreateDeliveries(deliveries []*models.WebhookDelivery) error
+	UpdateDelivery(delivery *models.WebhookDelivery) error
+	FindDeliveryByID(id uint) (*models.WebhookDelivery, error)
+	ListDeliveries(subscriptionID uint, status string, limit, offset int) ([]models.WebhookDelivery, error)
+	ClaimDueDeliveries(now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error)
+}
+
+type webhookRepository struct {
+	db *gorm.DB
+}
+
+// NewWebhookRepository creates a new instance of WebhookRepository
+func NewWebhookRepository(db *gorm.DB) WebhookRepository {
+	return &webhookRepository{db}
+}
+
+// CreateSubscription inserts a new subscription
+func (r *webhookRepository) CreateSubscription(subscription *models.WebhookSubscription) error {
+	return r.db.Create(subscription).Error
+}
+
+// UpdateSubscription saves a subscription
+func (r *webhookRepository) UpdateSubscription(subscription *models.WebhookSubscription) error {
+	return r.db.Save(subscription).Error
+}
+
+// DeleteSubscription deletes a subscription together with its delivery log
+func (r *webhookRepository) DeleteSubscription(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("subscription_id = ?", id).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.WebhookSubscription{}, id).Error
+	})
+}
+
+// FindSubscriptionByID retrieves a subscription by its ID
+func (r *webhookRepository) FindSubscriptionByID(id uint) (*models.WebhookSubscription, error) {
+	var subscription models.WebhookSubscription
+	err := r.db.First(&subscription, id).Error
+	return &subscription, err
+}
+
+// ListSubscriptions retrieves the subscriptions of an MDA, or the platform's for "", newest first
+func (r *webhookRepository) ListSubscriptions(mdaID string) ([]models.WebhookSubscription, error) {
+	var subscriptions []models.WebhookSubscription
+	err := r.db.Where("mda_id = ?", mdaID).Order("created_at DESC").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+// ListActiveSubscriptions retrieves every active subscription of every MDA
+func (r *webhookRepository) ListActiveSubscriptions() ([]models.WebhookSubscription, error) {
+	var subscriptions []models.WebhookSubscription
+	err := r.db.Where("active = ?", true).Order("id").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+// CreateDeliveries inserts deliveries waiting to be sent
+func (r *webhookRepository) CreateDeliveries(deliveries []*models.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return r.db.Omit(clause.Associations).Create(deliveries).Error
+}
+
+// UpdateDelivery saves the outcome of a delivery attempt
+func (r *webhookRepository) UpdateDelivery(delivery *models.WebhookDelivery) error {
+	return r.db.Omit(clause.Associations).Save(delivery).Error
+}
+
+// FindDeliveryByID retrieves a delivery by its ID
+func (r *webhookRepository) FindDeliveryByID(id uint) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := r.db.First(&delivery, id).Error
+	return &delivery, err
+}
+
+// ListDeliveries retrieves a subscription's deliveries, newest first, optionally with a
+// single status
+func (r *webhookRepository) ListDeliveries(subscriptionID uint, status string, limit, offset int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	query := r.db.Where("subscription_id = ?", subscriptionID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&deliveries).Error
+	return deliveries, err
+}
+
+// ClaimDueDeliveries retrieves pending deliveries of active subscriptions whose next
+// attempt is due, with their subscriptions, and postpones them by lease so that other
+// processes sharing the database do not send them at the same time
+func (r *webhookRepository) ClaimDueDeliveries(now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Preload("Subscription").
+			Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, now).
+			Where("subscription_id IN (?)", tx.Model(&models.WebhookSubscription{}).Select("id").Where("active = ?", true)).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&deliveries).Error
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+
+		ids := make([]uint, len(deliveries))
+		for i := range deliveries {
+			ids[i] = deliveries[i].ID
+			deliveries[i].NextAttemptAt = now.Add(lease)
+		}
+		return tx.Model(&models.WebhookDelivery{}).Where("id IN ?", ids).
+			UpdateColumn("next_attempt_at", now.Add(lease)).Error
+	})
+	return deliveries, err
+}
@@ -0,0 +1,85 @@
+// internal/routes/permissions.go
+
+package routes
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/pkg/middleware"
+)
+
+// Permission names an action guarded by the permissions matrix
+type Permission string
+
+const (
+	ManageAccount   Permission = "account:manage"   // Viewing and editing one's own account
+	ManageAPIKeys   Permission = "api-keys:manage"  // Creating and revoking one's own API keys
+	ReadRates       Permission = "rates:read"       // Latest rates, snapshots, currencies and conversions
+	AnalyzeRates    Permission = "rates:analyze"    // Historical queries and aggregates
+	PublishRates    Permission = "rates:publish"    // Posting rates and triggering provider ingestion
+	ManageBackfills Permission = "backfills:manage" // Starting and resuming historical backfills
+	ManageUsers     Permission = "users:manage"     // Listing, activating and changing roles of users in the admin's MDA
+	ManageTenants   Permission = "tenants:manage"   // Creating MDAs, changing their settings and members
+	ManageWebhooks  Permission = "webhooks:manage"  // Subscribing the admin's MDA to rate events and replaying deliveries
+	ManageLockouts  Permission = "lockouts:manage"  // Monitoring login lockouts and unlocking client IPs
+	ManageMFA       Permission = "mfa:manage"       // Choosing the roles that must use two-factor authentication
+	MonitorService  Permission = "service:monitor"  // Reading operational statistics such as cache hit rates
+	ReadAuditLog    Permission = "audit:read"       // Querying and exporting the audit log of the auditor's MDA
+	VerifyAuditLog  Permission = "audit:verify"     // Checking the hash chain of the whole audit log
+)
+
+// permissions is the matrix of roles allowed to perform each action
+var permissions = map[Permission][]models.Role{
+	ManageAccount:   {models.RoleViewer, models.RoleAnalyst, models.RoleAuditor, models.RoleRatePublisher, models.RoleAdmin},
+	ManageAPIKeys:   {models.RoleViewer, models.RoleAnalyst, models.RoleAuditor, models.RoleRatePublisher, models.RoleAdmin},
+	ReadRates:       {models.RoleViewer, models.RoleAnalyst, models.RoleAuditor, models.RoleRatePublisher, models.RoleAdmin},
+	AnalyzeRates:    {models.RoleAnalyst, models.RoleAuditor, models.RoleRatePublisher, models.RoleAdmin},
+	PublishRates:    {models.RoleRatePublisher, models.RoleAdmin},
+	ManageBackfills: {models.RoleAdmin},
+	ManageUsers:     {models.RoleAdmin},
+	ManageTenants:   {models.RoleAdmin},
+	ManageWebhooks:  {models.RoleAdmin},
+	ManageLockouts:  {models.RoleAdmin},
+	ManageMFA:       {models.RoleAdmin},
+	MonitorService:  {models.RoleAdmin},
+	ReadAuditLog:    {models.RoleAuditor, models.RoleAdmin},
+	VerifyAuditLog:  {models.RoleAuditor, models.RoleAdmin},
+}
+
+// platformPermissions are only granted to users who do not belong to an MDA
+var platformPermissions = map[Permission]bool{
+	ManageBackfills: true, // Backfills write to the global rate sources
+	ManageTenants:   true,
+	ManageLockouts:  true, // IPs and unknown usernames belong to no MDA
+	ManageMFA:       true, // Policies apply to every MDA
+	MonitorService:  true,
+	VerifyAuditLog:  true, // The chain spans every tenant's events
+}
+
+// Authorize returns middleware that only admits the roles granted the permission, API
+// keys holding the permission as a scope, and for platform permissions only users
+// outside any MDA
+func Authorize(permission Permission) mux.MiddlewareFunc {
+	roles := make([]string, 0, len(permissions[permission]))
+	for _, role := range permissions[permission] {
+		roles = append(roles, string(role))
+	}
+	requireRole := middleware.RequireRole(roles...)
+	requireScope := middleware.RequireScope(string(permission))
+	if !platformPermissions[permission] {
+		return func(next http.Handler) http.Handler {
+			return requireRole(requireScope(next))
+		}
+	}
+	return func(next http.Handler) http.Handler {
+		return requireRole(requireScope(middleware.RequirePlatform(next)))
+	}
+}
+
+// handle registers a handler on the router guarded by the permission
+func handle(router *mux.Router, path string, permission Permission, handler http.HandlerFunc) *mux.Route {
+	return router.Handle(path, Authorize(permission)(handler))
+}
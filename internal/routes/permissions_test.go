@@ -0,0 +1,262 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/services"
+	"github.com/abduls21985/exchange-rate-service/pkg/middleware"
+)
+
+// publicRoutes need no credentials
+var publicRoutes = map[string]bool{
+	"POST /api/register":                true,
+	"POST /api/login":                   true,
+	"POST /api/login/mfa":               true,
+	"POST /api/login/mfa/enroll":        true,
+	"POST /api/token/refresh":           true,
+	"POST /api/password-reset/initiate": true,
+	"POST /api/password-reset/complete": true,
+	"GET /api/health":                   true,
+}
+
+// routePermissions is the permission every authenticated route must be guarded by
+var routePermissions = map[string]Permission{
+	"GET /api/me":                                  ManageAccount,
+	"PUT /api/me":                                  ManageAccount,
+	"PUT /api/me/password":                         ManageAccount,
+	"GET /api/me/sessions":                         ManageAccount,
+	"DELETE /api/me/sessions/{id:[0-9]+}":          ManageAccount,
+	"GET /api/me/mfa":                              ManageAccount,
+	"DELETE /api/me/mfa":                           ManageAccount,
+	"POST /api/me/mfa/enroll":                      ManageAccount,
+	"POST /api/me/mfa/confirm":                     ManageAccount,
+	"POST /api/me/mfa/recovery-codes":              ManageAccount,
+	"POST /api/logout":                             ManageAccount,
+	"POST /api/logout/all":                         ManageAccount,
+	"POST /api/api-keys":                           ManageAPIKeys,
+	"GET /api/api-keys":                            ManageAPIKeys,
+	"GET /api/api-keys/{id:[0-9]+}":                ManageAPIKeys,
+	"PUT /api/api-keys/{id:[0-9]+}":                ManageAPIKeys,
+	"DELETE /api/api-keys/{id:[0-9]+}":             ManageAPIKeys,
+	"GET /api/fetch-cbn-exchange-rates":            ReadRates,
+	"POST /api/exchange-rates":                     PublishRates,
+	"GET /api/currencies":                          ReadRates,
+	"GET /api/rate-sources":                        ReadRates,
+	"GET /api/snapshots":                           ReadRates,
+	"GET /api/snapshots/{id:[0-9]+}":               ReadRates,
+	"GET /api/exchange-rates/stream":               ReadRates,
+	"ANY /api/exchange-rates/historical":           AnalyzeRates,
+	"GET /api/exchange-rates/analytics/ohlc":       AnalyzeRates,
+	"GET /api/exchange-rates/analytics/summary":    AnalyzeRates,
+	"GET /api/exchange-rates/analytics/volatility": AnalyzeRates,
+	"POST /api/exchange-rates/convert":             ReadRates,
+	"GET /api/exchange-rates/base-convert":         ReadRates,
+	"GET /api/exchange-rates/count":                AnalyzeRates,
+	"POST /api/convert-rates":                      ReadRates,
+	"GET /api/mda":                                 ReadRates,
+	"POST /api/webhooks":                           ManageWebhooks,
+	"GET /api/webhooks":                            ManageWebhooks,
+	"GET /api/webhooks/{id:[0-9]+}":                ManageWebhooks,
+	"PUT /api/webhooks/{id:[0-9]+}":                ManageWebhooks,
+	"DELETE /api/webhooks/{id:[0-9]+}":             ManageWebhooks,
+	"GET /api/webhooks/{id:[0-9]+}/deliveries":     ManageWebhooks,
+	"POST /api/webhooks/{id:[0-9]+}/deliveries/{deliveryID:[0-9]+}/replay": ManageWebhooks,
+	"GET /api/audit-events":                        ReadAuditLog,
+	"GET /api/audit-events/export":                 ReadAuditLog,
+	"GET /api/audit-events/verify":                 VerifyAuditLog,
+	"GET /api/admin/users":                         ManageUsers,
+	"GET /api/admin/users/{username}":              ManageUsers,
+	"POST /api/admin/users/{username}/deactivate":  ManageUsers,
+	"POST /api/admin/users/{username}/reactivate":  ManageUsers,
+	"POST /api/admin/users/{username}/logout":      ManageUsers,
+	"POST /api/admin/users/{username}/unlock":      ManageUsers,
+	"DELETE /api/admin/users/{username}/mfa":       ManageUsers,
+	"PUT /api/admin/users/{username}/role":         ManageUsers,
+	"PUT /api/admin/users/{username}/mda":          ManageTenants,
+	"POST /api/admin/mdas":                         ManageTenants,
+	"GET /api/admin/mdas":                          ManageTenants,
+	"GET /api/admin/mdas/{code}":                   ManageTenants,
+	"PUT /api/admin/mdas/{code}":                   ManageTenants,
+	"GET /api/admin/mfa-policies":                  ManageMFA,
+	"PUT /api/admin/mfa-policies/{role}":           ManageMFA,
+	"GET /api/admin/rate-cache":                    MonitorService,
+	"GET /api/admin/lockouts":                      ManageLockouts,
+	"DELETE /api/admin/lockouts/ips/{ip}":          ManageLockouts,
+	"POST /api/admin/backfills":                    ManageBackfills,
+	"GET /api/admin/backfills":                     ManageBackfills,
+	"GET /api/admin/backfills/{id:[0-9]+}":         ManageBackfills,
+	"POST /api/admin/backfills/{id:[0-9]+}/resume": ManageBackfills,
+}
+
+// grants is the permissions matrix as it should be, restated so that an accidental
+// change to permissions.go fails the tests
+var grants = map[Permission][]models.Role{
+	ManageAccount:   {models.RoleViewer, models.RoleAnalyst, models.RoleAuditor, models.RoleRatePublisher, models.RoleAdmin},
+	ManageAPIKeys:   {models.RoleViewer, models.RoleAnalyst, models.RoleAuditor, models.RoleRatePublisher, models.RoleAdmin},
+	ReadRates:       {models.RoleViewer, models.RoleAnalyst, models.RoleAuditor, models.RoleRatePublisher, models.RoleAdmin},
+	AnalyzeRates:    {models.RoleAnalyst, models.RoleAuditor, models.RoleRatePublisher, models.RoleAdmin},
+	PublishRates:    {models.RoleRatePublisher, models.RoleAdmin},
+	ManageBackfills: {models.RoleAdmin},
+	ManageUsers:     {models.RoleAdmin},
+	ManageTenants:   {models.RoleAdmin},
+	ManageWebhooks:  {models.RoleAdmin},
+	ManageLockouts:  {models.RoleAdmin},
+	ManageMFA:       {models.RoleAdmin},
+	MonitorService:  {models.RoleAdmin},
+	ReadAuditLog:    {models.RoleAuditor, models.RoleAdmin},
+	VerifyAuditLog:  {models.RoleAuditor, models.RoleAdmin},
+}
+
+// platformOnly are the permissions users of an MDA never get, whatever their role
+var platformOnly = map[Permission]bool{
+	ManageBackfills: true,
+	ManageTenants:   true,
+	ManageLockouts:  true,
+	ManageMFA:       true,
+	MonitorService:  true,
+	VerifyAuditLog:  true,
+}
+
+var allRoles = []models.Role{models.RoleViewer, models.RoleAnalyst, models.RoleAuditor, models.RoleRatePublisher, models.RoleAdmin}
+
+// admits reports whether the handler lets the principal through its guards, which
+// refuse with 403 and one of their own messages. The services behind the routes are
+// nil, so a handler that is reached usually panics; that counts as admitted.
+func admits(handler http.Handler, method string, principal *middleware.Principal) (admitted bool) {
+	defer func() {
+		if recover() != nil {
+			admitted = true
+		}
+	}()
+	request := httptest.NewRequest(method, "/", nil)
+	request = request.WithContext(middleware.WithPrincipal(request.Context(), principal))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	refusal := strings.TrimSpace(recorder.Body.String())
+	return recorder.Code != http.StatusForbidden ||
+		(refusal != "Insufficient permissions" && refusal != "API key is not allowed to perform this action")
+}
+
+// testPrincipal is a user signed in with the role, in the MDA when mdaID is set
+func testPrincipal(role models.Role, mdaID string) *middleware.Principal {
+	return &middleware.Principal{Kind: middleware.PrincipalUser, UserID: 1, Username: "ada", Role: string(role), MdaID: mdaID, SessionID: 1}
+}
+
+// granted reports whether the matrix lets a user with the role, in an MDA or not, act
+func granted(permission Permission, role models.Role, inMDA bool) bool {
+	if inMDA && platformOnly[permission] {
+		return false
+	}
+	for _, allowed := range grants[permission] {
+		if allowed == role {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPermissionsMatrix(t *testing.T) {
+	if len(permissions) != len(grants) {
+		t.Errorf("the matrix has %d permissions, the test knows %d", len(permissions), len(grants))
+	}
+	for permission := range permissions {
+		if _, ok := grants[permission]; !ok {
+			t.Errorf("permission %s is missing from the test's matrix", permission)
+		}
+	}
+	for permission := range platformPermissions {
+		if !platformOnly[permission] {
+			t.Errorf("%s is unexpectedly limited to platform users", permission)
+		}
+	}
+
+	ok := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	for permission := range grants {
+		guarded := Authorize(permission)(ok)
+		for _, role := range allRoles {
+			for _, mdaID := range []string{"", "NUPRC"} {
+				user := testPrincipal(role, mdaID)
+				if got, want := admits(guarded, http.MethodGet, user), granted(permission, role, mdaID != ""); got != want {
+					t.Errorf("%s as %s in MDA %q: admitted %v, want %v", permission, role, mdaID, got, want)
+				}
+
+				// API keys act as their owner, but only within the scopes of the key
+				key := testPrincipal(role, mdaID)
+				key.Kind, key.APIKeyID, key.Scopes = middleware.PrincipalAPIKey, 1, []string{string(ReadRates)}
+				if got, want := admits(guarded, http.MethodGet, key), permission == ReadRates && granted(permission, role, mdaID != ""); got != want {
+					t.Errorf("%s with a rates:read key of %s in MDA %q: admitted %v, want %v", permission, role, mdaID, got, want)
+				}
+			}
+		}
+		if admits(guarded, http.MethodGet, testPrincipal("superuser", "")) {
+			t.Errorf("%s admitted an unknown role", permission)
+		}
+	}
+}
+
+func TestEveryRouteIsGuarded(t *testing.T) {
+	router := mux.NewRouter()
+	InitializeRoutes(router, nil, nil, nil, nil, nil, nil, nil, services.MFAOptions{})
+
+	seen := make(map[string]bool)
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil || route.GetHandler() == nil {
+			return nil // The /api subrouter itself
+		}
+		methods, _ := route.GetMethods()
+		if len(methods) == 0 {
+			methods = []string{"ANY"}
+		}
+
+		for _, method := range methods {
+			name := method + " " + template
+			seen[name] = true
+			if publicRoutes[name] {
+				if len(ancestors) > 0 {
+					t.Errorf("public route %s is behind authentication", name)
+				}
+				continue
+			}
+
+			permission, ok := routePermissions[name]
+			if !ok {
+				t.Errorf("route %s is not in the permissions table", name)
+				continue
+			}
+			if len(ancestors) == 0 {
+				t.Errorf("route %s is registered outside the authenticated API", name)
+			}
+			requestMethod := strings.Replace(method, "ANY", http.MethodGet, 1)
+			for _, role := range allRoles {
+				for _, mdaID := range []string{"", "NUPRC"} {
+					user := testPrincipal(role, mdaID)
+					if got, want := admits(route.GetHandler(), requestMethod, user), granted(permission, role, mdaID != ""); got != want {
+						t.Errorf("%s as %s in MDA %q: admitted %v, want %v (%s)", name, role, mdaID, got, want, permission)
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+
+	for name := range routePermissions {
+		if !seen[name] {
+			t.Errorf("route %s is no longer registered", name)
+		}
+	}
+	for name := range publicRoutes {
+		if !seen[name] {
+			t.Errorf("public route %s is no longer registered", name)
+		}
+	}
+}
@@ -7,45 +7,144 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/abduls21985/exchange-rate-service/internal/controllers"
+	"github.com/abduls21985/exchange-rate-service/internal/notifier"
 	"github.com/abduls21985/exchange-rate-service/internal/repositories"
 	"github.com/abduls21985/exchange-rate-service/internal/services"
 	"github.com/abduls21985/exchange-rate-service/pkg/middleware"
 )
 
-// InitializeRoutes sets up all the routes for the application
-func InitializeRoutes(router *mux.Router, db *gorm.DB) {
+// InitializeRoutes sets up all the routes for the application and returns the
+// authenticated API subrouter. Every protected endpoint is guarded by a permission from
+// the matrix in permissions.go. The services and notifier passed in are shared with the
+// ingestion jobs and commands started in main.
+func InitializeRoutes(router *mux.Router, db *gorm.DB, exchangeRateService services.ExchangeRateService, backfillService services.BackfillService, auditService services.AuditService, rateStream services.RateStreamService, webhookService services.WebhookService, accountNotifier notifier.AccountNotifier, mfaOptions services.MFAOptions) *mux.Router {
 	// Initialize repositories
-	exchangeRateRepo := repositories.NewExchangeRateRepository(db)
 	userRepo := repositories.NewUserRepository(db)
+	mdaRepo := repositories.NewMDARepository(db)
+	sessionRepo := repositories.NewSessionRepository(db)
+	apiKeyRepo := repositories.NewAPIKeyRepository(db)
+	loginThrottleRepo := repositories.NewLoginThrottleRepository(db)
+	mfaRepo := repositories.NewMFARepository(db)
 
 	// Initialize services
-	exchangeRateService := services.NewExchangeRateService(exchangeRateRepo)
-	userService := services.NewUserService(userRepo)
-	authService := services.NewAuthService(userService)
+	mdaService := services.NewMDAService(mdaRepo)
+	userService := services.NewUserService(userRepo, mdaRepo, accountNotifier)
+	loginThrottleService := services.NewLoginThrottleService(loginThrottleRepo, auditService, services.LoginThrottleOptionsFromConfig())
+	mfaService := services.NewMFAService(mfaRepo, userRepo, mfaOptions)
+	authService := services.NewAuthService(userService, sessionRepo, loginThrottleService, mfaService, services.AuthOptionsFromConfig())
+	apiKeyService := services.NewAPIKeyService(apiKeyRepo, userService)
 
 	// Initialize controllers
-	exchangeRateController := controllers.NewExchangeRateController(exchangeRateService)
-	userController := controllers.NewUserController(userService)
-	authController := controllers.NewAuthController(authService)
+	exchangeRateController := controllers.NewExchangeRateController(exchangeRateService, mdaService, auditService)
+	mdaController := controllers.NewMDAController(mdaService, auditService)
+	userController := controllers.NewUserController(userService, authService, auditService)
+	authController := controllers.NewAuthController(authService, mfaService, auditService)
+	backfillController := controllers.NewBackfillController(backfillService, auditService)
+	apiKeyController := controllers.NewAPIKeyController(apiKeyService, auditService)
+	auditController := controllers.NewAuditController(auditService)
+	lockoutController := controllers.NewLockoutController(loginThrottleService, userService, auditService)
+	mfaController := controllers.NewMFAController(mfaService, userService, auditService)
+	rateStreamController := controllers.NewRateStreamController(rateStream, mdaService)
+	webhookController := controllers.NewWebhookController(webhookService, auditService)
 
 	// User Management Routes
 	router.HandleFunc("/api/register", userController.RegisterUser).Methods("POST")
 	router.HandleFunc("/api/login", authController.AuthenticateUser).Methods("POST")
+	router.HandleFunc("/api/login/mfa", authController.CompleteMFALogin).Methods("POST")
+	router.HandleFunc("/api/login/mfa/enroll", authController.EnrollMFALogin).Methods("POST")
+	router.HandleFunc("/api/token/refresh", authController.RefreshToken).Methods("POST")
+	router.HandleFunc("/api/password-reset/initiate", userController.InitiatePasswordReset).Methods("POST")
+	router.HandleFunc("/api/password-reset/complete", userController.ResetPassword).Methods("POST")
 
 	// API subrouter for protected routes
 	apiRouter := router.PathPrefix("/api").Subrouter()
-	apiRouter.Use(middleware.AuthMiddleware)
+	apiRouter.Use(
+		middleware.AuthMiddleware(authService.IsTokenRevoked, apiKeyService.AuthenticateAPIKey),
+		middleware.RequireActiveUser(userService.IsActive),
+		middleware.TenantQuota(mdaService.ConsumeRequest),
+	)
+
+	// Account Routes
+	handle(apiRouter, "/me", ManageAccount, userController.GetMe).Methods("GET")
+	handle(apiRouter, "/me", ManageAccount, userController.UpdateMe).Methods("PUT")
+	handle(apiRouter, "/me/password", ManageAccount, userController.ChangePassword).Methods("PUT")
+	handle(apiRouter, "/me/sessions", ManageAccount, authController.ListSessions).Methods("GET")
+	handle(apiRouter, "/me/sessions/{id:[0-9]+}", ManageAccount, authController.RevokeSession).Methods("DELETE")
+	handle(apiRouter, "/me/mfa", ManageAccount, mfaController.GetStatus).Methods("GET")
+	handle(apiRouter, "/me/mfa", ManageAccount, mfaController.Disable).Methods("DELETE")
+	handle(apiRouter, "/me/mfa/enroll", ManageAccount, mfaController.BeginEnrollment).Methods("POST")
+	handle(apiRouter, "/me/mfa/confirm", ManageAccount, mfaController.ConfirmEnrollment).Methods("POST")
+	handle(apiRouter, "/me/mfa/recovery-codes", ManageAccount, mfaController.RegenerateRecoveryCodes).Methods("POST")
+	handle(apiRouter, "/logout", ManageAccount, authController.Logout).Methods("POST")
+	handle(apiRouter, "/logout/all", ManageAccount, authController.LogoutAll).Methods("POST")
+
+	// API Key Routes
+	handle(apiRouter, "/api-keys", ManageAPIKeys, apiKeyController.CreateAPIKey).Methods("POST")
+	handle(apiRouter, "/api-keys", ManageAPIKeys, apiKeyController.ListAPIKeys).Methods("GET")
+	handle(apiRouter, "/api-keys/{id:[0-9]+}", ManageAPIKeys, apiKeyController.GetAPIKey).Methods("GET")
+	handle(apiRouter, "/api-keys/{id:[0-9]+}", ManageAPIKeys, apiKeyController.UpdateAPIKey).Methods("PUT")
+	handle(apiRouter, "/api-keys/{id:[0-9]+}", ManageAPIKeys, apiKeyController.DeleteAPIKey).Methods("DELETE")
 
 	// Exchange Rate Routes
-	apiRouter.HandleFunc("/fetch-cbn-exchange-rates", exchangeRateController.GetExchangeRates).Methods("GET")
-	apiRouter.HandleFunc("/exchange-rates", exchangeRateController.PostExchangeRates).Methods("POST")
-	apiRouter.HandleFunc("/currencies", exchangeRateController.GetCurrencies).Methods("GET")
-	apiRouter.HandleFunc("/exchange-rates/historical", exchangeRateController.GetHistoricalExchangeRates)
-	apiRouter.HandleFunc("/exchange-rates/convert", exchangeRateController.ConvertCurrency).Methods("POST")
-	apiRouter.HandleFunc("/exchange-rates/base-convert", exchangeRateController.ConvertRatesToBaseCurrency).Methods("GET")
-	apiRouter.HandleFunc("/exchange-rates/count", exchangeRateController.GetExchangeRateCount).Methods("GET")
-	apiRouter.HandleFunc("/convert-rates", exchangeRateController.ConvertMultipleRatesToBaseCurrency).Methods("POST")
+	handle(apiRouter, "/fetch-cbn-exchange-rates", ReadRates, exchangeRateController.GetExchangeRates).Methods("GET")
+	handle(apiRouter, "/exchange-rates", PublishRates, exchangeRateController.PostExchangeRates).Methods("POST")
+	handle(apiRouter, "/currencies", ReadRates, exchangeRateController.GetCurrencies).Methods("GET")
+	handle(apiRouter, "/rate-sources", ReadRates, exchangeRateController.GetRateSources).Methods("GET")
+	handle(apiRouter, "/snapshots", ReadRates, exchangeRateController.ListSnapshots).Methods("GET")
+	handle(apiRouter, "/snapshots/{id:[0-9]+}", ReadRates, exchangeRateController.GetSnapshot).Methods("GET")
+	handle(apiRouter, "/exchange-rates/stream", ReadRates, rateStreamController.StreamRates).Methods("GET")
+	handle(apiRouter, "/exchange-rates/historical", AnalyzeRates, exchangeRateController.GetHistoricalExchangeRates)
+	handle(apiRouter, "/exchange-rates/analytics/ohlc", AnalyzeRates, exchangeRateController.GetRateOHLC).Methods("GET")
+	handle(apiRouter, "/exchange-rates/analytics/summary", AnalyzeRates, exchangeRateController.GetRateSummary).Methods("GET")
+	handle(apiRouter, "/exchange-rates/analytics/volatility", AnalyzeRates, exchangeRateController.GetRateVolatility).Methods("GET")
+	handle(apiRouter, "/exchange-rates/convert", ReadRates, exchangeRateController.ConvertCurrency).Methods("POST")
+	handle(apiRouter, "/exchange-rates/base-convert", ReadRates, exchangeRateController.ConvertRatesToBaseCurrency).Methods("GET")
+	handle(apiRouter, "/exchange-rates/count", AnalyzeRates, exchangeRateController.GetExchangeRateCount).Methods("GET")
+	handle(apiRouter, "/convert-rates", ReadRates, exchangeRateController.ConvertMultipleRatesToBaseCurrency).Methods("POST")
+
+	// Tenant Routes
+	handle(apiRouter, "/mda", ReadRates, mdaController.GetOwnMDA).Methods("GET")
+
+	// Webhook Routes
+	handle(apiRouter, "/webhooks", ManageWebhooks, webhookController.CreateWebhook).Methods("POST")
+	handle(apiRouter, "/webhooks", ManageWebhooks, webhookController.ListWebhooks).Methods("GET")
+	handle(apiRouter, "/webhooks/{id:[0-9]+}", ManageWebhooks, webhookController.GetWebhook).Methods("GET")
+	handle(apiRouter, "/webhooks/{id:[0-9]+}", ManageWebhooks, webhookController.UpdateWebhook).Methods("PUT")
+	handle(apiRouter, "/webhooks/{id:[0-9]+}", ManageWebhooks, webhookController.DeleteWebhook).Methods("DELETE")
+	handle(apiRouter, "/webhooks/{id:[0-9]+}/deliveries", ManageWebhooks, webhookController.ListDeliveries).Methods("GET")
+	handle(apiRouter, "/webhooks/{id:[0-9]+}/deliveries/{deliveryID:[0-9]+}/replay", ManageWebhooks, webhookController.ReplayDelivery).Methods("POST")
+
+	// Audit Routes
+	handle(apiRouter, "/audit-events", ReadAuditLog, auditController.ListEvents).Methods("GET")
+	handle(apiRouter, "/audit-events/export", ReadAuditLog, auditController.ExportEvents).Methods("GET")
+	handle(apiRouter, "/audit-events/verify", VerifyAuditLog, auditController.VerifyChain).Methods("GET")
+
+	// Admin Routes
+	handle(apiRouter, "/admin/users", ManageUsers, userController.ListUsers).Methods("GET")
+	handle(apiRouter, "/admin/users/{username}", ManageUsers, userController.GetUser).Methods("GET")
+	handle(apiRouter, "/admin/users/{username}/deactivate", ManageUsers, userController.DeactivateUser).Methods("POST")
+	handle(apiRouter, "/admin/users/{username}/reactivate", ManageUsers, userController.ReactivateUser).Methods("POST")
+	handle(apiRouter, "/admin/users/{username}/logout", ManageUsers, userController.LogoutUser).Methods("POST")
+	handle(apiRouter, "/admin/users/{username}/unlock", ManageUsers, lockoutController.UnlockUser).Methods("POST")
+	handle(apiRouter, "/admin/users/{username}/mfa", ManageUsers, mfaController.ResetUser).Methods("DELETE")
+	handle(apiRouter, "/admin/users/{username}/role", ManageUsers, userController.ChangeRole).Methods("PUT")
+	handle(apiRouter, "/admin/users/{username}/mda", ManageTenants, userController.AssignMDA).Methods("PUT")
+	handle(apiRouter, "/admin/mdas", ManageTenants, mdaController.CreateMDA).Methods("POST")
+	handle(apiRouter, "/admin/mdas", ManageTenants, mdaController.ListMDAs).Methods("GET")
+	handle(apiRouter, "/admin/mdas/{code}", ManageTenants, mdaController.GetMDA).Methods("GET")
+	handle(apiRouter, "/admin/mdas/{code}", ManageTenants, mdaController.UpdateMDA).Methods("PUT")
+	handle(apiRouter, "/admin/mfa-policies", ManageMFA, mfaController.ListPolicies).Methods("GET")
+	handle(apiRouter, "/admin/mfa-policies/{role}", ManageMFA, mfaController.SetPolicy).Methods("PUT")
+	handle(apiRouter, "/admin/rate-cache", MonitorService, exchangeRateController.GetCacheStats).Methods("GET")
+	handle(apiRouter, "/admin/lockouts", ManageLockouts, lockoutController.ListLockouts).Methods("GET")
+	handle(apiRouter, "/admin/lockouts/ips/{ip}", ManageLockouts, lockoutController.UnlockIP).Methods("DELETE")
+	handle(apiRouter, "/admin/backfills", ManageBackfills, backfillController.CreateBackfill).Methods("POST")
+	handle(apiRouter, "/admin/backfills", ManageBackfills, backfillController.ListBackfills).Methods("GET")
+	handle(apiRouter, "/admin/backfills/{id:[0-9]+}", ManageBackfills, backfillController.GetBackfill).Methods("GET")
+	handle(apiRouter, "/admin/backfills/{id:[0-9]+}/resume", ManageBackfills, backfillController.ResumeBackfill).Methods("POST")
 
 	// Health Check Route (public)
 	router.HandleFunc("/api/health", exchangeRateController.HealthCheck).Methods("GET")
+
+	return apiRouter
 }
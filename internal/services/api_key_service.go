@@ -0,0 +1,253 @@
+// internal/services/api_key_service.go
+
+package services
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/repositories"
+	"github.com/abduls21985/exchange-rate-service/internal/utils"
+	"github.com/abduls21985/exchange-rate-service/pkg/middleware"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrAPIKeyNotFound is returned when a key does not exist or belongs to another user
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	// ErrInvalidAPIKeySettings is returned when the name, scopes, IP allowlist or expiry of a key are invalid
+	ErrInvalidAPIKeySettings = errors.New("invalid API key settings")
+)
+
+const (
+	// apiKeyPrefix starts every key so that leaked keys are easy to recognise
+	apiKeyPrefix = "erk_"
+	// apiKeyPrefixLength is the length of the stored prefix: apiKeyPrefix and 8 hex characters
+	apiKeyPrefixLength = len(apiKeyPrefix) + 8
+	// apiKeyTouchInterval limits how often the last-used time of a key is written
+	apiKeyTouchInterval = time.Minute
+)
+
+// APIKeyService interface defines API key management and authentication
+type APIKeyService interface {
+	CreateAPIKey(username string, settings models.APIKeySettings) (*models.APIKey, string, error)
+	ListAPIKeys(username string) ([]models.APIKey, error)
+	GetAPIKey(username string, id uint) (*models.APIKey, error)
+	UpdateAPIKey(username string, id uint, settings models.APIKeySettings) (*models.APIKey, error)
+	DeleteAPIKey(username string, id uint) error
+	AuthenticateAPIKey(key, ipAddress string) (*middleware.Principal, error)
+}
+
+type apiKeyService struct {
+	repo  repositories.APIKeyRepository
+	users UserService
+}
+
+// NewAPIKeyService creates a new instance of APIKeyService
+func NewAPIKeyService(repo repositories.APIKeyRepository, users UserService) APIKeyService {
+	return &apiKeyService{repo, users}
+}
+
+// CreateAPIKey creates a key for the user and returns it together with the key itself,
+// which is not stored and cannot be retrieved again
+func (s *apiKeyService) CreateAPIKey(username string, settings models.APIKeySettings) (*models.APIKey, string, error) {
+	user, err := s.users.GetUserByUsername(username)
+	if err != nil {
+		return nil, "", ErrUserNotFound
+	}
+
+	key := &models.APIKey{UserID: user.ID}
+	if err := applyAPIKeySettings(key, settings); err != nil {
+		return nil, "", err
+	}
+
+	id, err := utils.NewToken(4)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := utils.NewToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	key.Prefix = apiKeyPrefix + id
+	plain := key.Prefix + "_" + secret
+	key.KeyHash = utils.HashToken(plain)
+
+	if err := s.repo.CreateAPIKey(key); err != nil {
+		return nil, "", fmt.Errorf("failed to create API key: %v", err)
+	}
+	return key, plain, nil
+}
+
+// ListAPIKeys returns the user's keys, newest first
+func (s *apiKeyService) ListAPIKeys(username string) ([]models.APIKey, error) {
+	user, err := s.users.GetUserByUsername(username)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	keys, err := s.repo.ListAPIKeys(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %v", err)
+	}
+	return keys, nil
+}
+
+// GetAPIKey returns one of the user's keys
+func (s *apiKeyService) GetAPIKey(username string, id uint) (*models.APIKey, error) {
+	user, err := s.users.GetUserByUsername(username)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	key, err := s.repo.FindAPIKeyByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && key.UserID != user.ID) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up API key: %v", err)
+	}
+	return key, nil
+}
+
+// UpdateAPIKey replaces the name, scopes, IP allowlist and expiry of one of the user's keys
+func (s *apiKeyService) UpdateAPIKey(username string, id uint, settings models.APIKeySettings) (*models.APIKey, error) {
+	key, err := s.GetAPIKey(username, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyAPIKeySettings(key, settings); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdateAPIKey(key); err != nil {
+		return nil, fmt.Errorf("failed to update API key: %v", err)
+	}
+	return key, nil
+}
+
+// DeleteAPIKey deletes one of the user's keys; requests using it are rejected at once
+func (s *apiKeyService) DeleteAPIKey(username string, id uint) error {
+	key, err := s.GetAPIKey(username, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteAPIKey(key.ID); err != nil {
+		return fmt.Errorf("failed to delete API key: %v", err)
+	}
+	return nil
+}
+
+// AuthenticateAPIKey resolves a key used from ipAddress to the principal of its owner,
+// limited to the key's scopes. It returns a nil principal when the key is unknown,
+// expired, not allowed from the address or owned by a deactivated user.
+func (s *apiKeyService) AuthenticateAPIKey(plain, ipAddress string) (*middleware.Principal, error) {
+	if len(plain) <= apiKeyPrefixLength || !strings.HasPrefix(plain, apiKeyPrefix) || plain[apiKeyPrefixLength] != '_' {
+		return nil, nil
+	}
+
+	key, err := s.repo.FindAPIKeyByPrefix(plain[:apiKeyPrefixLength])
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up API key: %v", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(utils.HashToken(plain)), []byte(key.KeyHash)) != 1 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	if key.Expired(now) || !key.AllowsIP(ipAddress) {
+		return nil, nil
+	}
+
+	owner, err := s.users.GetUserByID(key.UserID)
+	if err != nil || !owner.Active {
+		return nil, nil
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		if err := s.repo.TouchAPIKey(key.ID, now, ipAddress); err != nil {
+			log.Printf("Failed to record use of API key %s: %v", key.Prefix, err)
+		}
+	}
+
+	return &middleware.Principal{
+		Kind:     middleware.PrincipalAPIKey,
+		UserID:   owner.ID,
+		Username: owner.Username,
+		Role:     string(owner.Role),
+		MdaID:    owner.MdaID,
+		APIKeyID: key.ID,
+		Scopes:   key.Scopes,
+	}, nil
+}
+
+// applyAPIKeySettings validates the settings and copies them onto the key
+func applyAPIKeySettings(key *models.APIKey, settings models.APIKeySettings) error {
+	name := strings.TrimSpace(settings.Name)
+	if name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidAPIKeySettings)
+	}
+
+	scopes, err := normalizeScopes(settings.Scopes)
+	if err != nil {
+		return err
+	}
+
+	allowedIPs := make([]string, 0, len(settings.AllowedIPs))
+	for _, entry := range settings.AllowedIPs {
+		entry = strings.TrimSpace(entry)
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			return fmt.Errorf("%w: %q is not an IP address or CIDR range", ErrInvalidAPIKeySettings, entry)
+		}
+		allowedIPs = append(allowedIPs, entry)
+	}
+
+	if settings.ExpiresAt != nil && !settings.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("%w: expiry must be in the future", ErrInvalidAPIKeySettings)
+	}
+
+	key.Name = name
+	key.Scopes = scopes
+	key.AllowedIPs = allowedIPs
+	key.ExpiresAt = settings.ExpiresAt
+	return nil
+}
+
+// normalizeScopes checks that every scope can be granted to a key and removes duplicates
+func normalizeScopes(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidAPIKeySettings)
+	}
+
+	valid := make(map[string]bool, len(models.APIKeyScopes))
+	for _, scope := range models.APIKeyScopes {
+		valid[scope] = true
+	}
+
+	seen := make(map[string]bool, len(requested))
+	scopes := make([]string, 0, len(requested))
+	for _, scope := range requested {
+		scope = strings.TrimSpace(scope)
+		if !valid[scope] {
+			return nil, fmt.Errorf("%w: unknown scope %q (valid scopes: %s)", ErrInvalidAPIKeySettings, scope, strings.Join(models.APIKeyScopes, ", "))
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
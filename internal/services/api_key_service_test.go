@@ -0,0 +1,158 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/repositories"
+	"github.com/abduls21985/exchange-rate-service/pkg/middleware"
+)
+
+type fakeAPIKeyRepo struct {
+	repositories.APIKeyRepository
+	keys    map[string]*models.APIKey // By prefix
+	touches int
+}
+
+func (r *fakeAPIKeyRepo) CreateAPIKey(key *models.APIKey) error {
+	key.ID = uint(len(r.keys) + 1)
+	stored := *key
+	r.keys[key.Prefix] = &stored
+	return nil
+}
+
+func (r *fakeAPIKeyRepo) FindAPIKeyByPrefix(prefix string) (*models.APIKey, error) {
+	key, ok := r.keys[prefix]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	found := *key
+	return &found, nil
+}
+
+func (r *fakeAPIKeyRepo) TouchAPIKey(id uint, usedAt time.Time, ipAddress string) error {
+	r.touches++
+	for _, key := range r.keys {
+		if key.ID == id {
+			key.LastUsedAt, key.LastUsedIP = &usedAt, ipAddress
+		}
+	}
+	return nil
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name       string
+		key        func(plain string) string // The key presented, from the one issued
+		allowedIPs []string
+		expiresAt  *time.Time
+		inactive   bool
+		ipAddress  string
+		valid      bool
+	}{
+		{name: "issued key", valid: true},
+		{name: "from an allowed address", allowedIPs: []string{"10.1.0.0/16", "192.0.2.7"}, ipAddress: "10.1.4.2", valid: true},
+		{name: "from an allowed IPv6 range", allowedIPs: []string{"2001:db8::/32"}, ipAddress: "2001:db8::9", valid: true},
+		{name: "from another address", allowedIPs: []string{"10.1.0.0/16", "192.0.2.7"}, ipAddress: "192.0.2.8"},
+		{name: "from an unparseable address", allowedIPs: []string{"10.1.0.0/16"}, ipAddress: "unknown"},
+		{name: "expired", expiresAt: &past},
+		{name: "owner deactivated", inactive: true},
+		{name: "wrong secret", key: func(plain string) string { return plain[:len(plain)-1] + "x" }},
+		{name: "secret missing", key: func(plain string) string { return plain[:apiKeyPrefixLength+1] }},
+		{name: "unknown prefix", key: func(plain string) string { return "erk_00000000" + plain[apiKeyPrefixLength:] }},
+		{name: "other prefix", key: func(plain string) string { return "sk_" + plain[len(apiKeyPrefix):] }},
+		{name: "no separator", key: func(plain string) string { return strings.Replace(plain, "_", "-", 2) }},
+		{name: "empty", key: func(string) string { return "" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeAPIKeyRepo{keys: map[string]*models.APIKey{}}
+			owner := &models.User{ID: 1, Username: "ada", Role: models.RoleRatePublisher, MdaID: "NUPRC", Active: true}
+			service := NewAPIKeyService(repo, &fakeUsers{user: owner})
+
+			key, plain, err := service.CreateAPIKey("ada", models.APIKeySettings{
+				Name: "ingestion", Scopes: []string{"rates:read", "rates:publish"}, AllowedIPs: tt.allowedIPs,
+			})
+			if err != nil {
+				t.Fatalf("CreateAPIKey: %v", err)
+			}
+			if key.KeyHash == plain || strings.Contains(key.KeyHash, plain[apiKeyPrefixLength+1:]) || !strings.HasPrefix(plain, key.Prefix+"_") {
+				t.Fatalf("key %s stored as %+v", plain, key)
+			}
+			repo.keys[key.Prefix].ExpiresAt = tt.expiresAt
+			owner.Active = !tt.inactive
+
+			presented := plain
+			if tt.key != nil {
+				presented = tt.key(plain)
+			}
+			ipAddress := tt.ipAddress
+			if ipAddress == "" {
+				ipAddress = "198.51.100.4"
+			}
+
+			principal, err := service.AuthenticateAPIKey(presented, ipAddress)
+			if err != nil {
+				t.Fatalf("AuthenticateAPIKey: %v", err)
+			}
+			if !tt.valid {
+				if principal != nil {
+					t.Errorf("authenticated as %+v, want the key refused", principal)
+				}
+				if repo.touches != 0 {
+					t.Error("a refused key was recorded as used")
+				}
+				return
+			}
+
+			if principal == nil {
+				t.Fatal("key refused")
+			}
+			if principal.Kind != middleware.PrincipalAPIKey || principal.Username != "ada" || principal.Role != string(models.RoleRatePublisher) ||
+				principal.MdaID != "NUPRC" || principal.APIKeyID != key.ID || principal.SessionID != 0 {
+				t.Errorf("principal = %+v", principal)
+			}
+			for scope, want := range map[string]bool{"rates:read": true, "rates:publish": true, "rates:analyze": false, "users:manage": false} {
+				if principal.HasScope(scope) != want {
+					t.Errorf("HasScope(%s) = %v, want %v", scope, !want, want)
+				}
+			}
+			if stored := repo.keys[key.Prefix]; stored.LastUsedAt == nil || stored.LastUsedIP != ipAddress {
+				t.Errorf("use of the key was not recorded: %v from %q", stored.LastUsedAt, stored.LastUsedIP)
+			}
+
+			// Uses within a minute are not written again
+			if _, err := service.AuthenticateAPIKey(presented, ipAddress); err != nil || repo.touches != 1 {
+				t.Errorf("second use: %v, %d writes of the last use", err, repo.touches)
+			}
+		})
+	}
+}
+
+func TestCreateAPIKeyValidatesSettings(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name     string
+		settings models.APIKeySettings
+	}{
+		{"no name", models.APIKeySettings{Scopes: []string{"rates:read"}}},
+		{"no scopes", models.APIKeySettings{Name: "ci"}},
+		{"a role's permission as scope", models.APIKeySettings{Name: "ci", Scopes: []string{"users:manage"}}},
+		{"malformed address", models.APIKeySettings{Name: "ci", Scopes: []string{"rates:read"}, AllowedIPs: []string{"10.0.0.0/33"}}},
+		{"expiry in the past", models.APIKeySettings{Name: "ci", Scopes: []string{"rates:read"}, ExpiresAt: &past}},
+	}
+
+	for _, tt := range tests {
+		repo := &fakeAPIKeyRepo{keys: map[string]*models.APIKey{}}
+		service := NewAPIKeyService(repo, &fakeUsers{user: &models.User{ID: 1, Username: "ada", Active: true}})
+		if _, _, err := service.CreateAPIKey("ada", tt.settings); err == nil || len(repo.keys) != 0 {
+			t.Errorf("%s: err = %v with %d keys stored, want ErrInvalidAPIKeySettings", tt.name, err, len(repo.keys))
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// internal/services/audit_service.go
+
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/repositories"
+	"github.com/shopspring/decimal"
+	"github.com/spf13/viper"
+)
+
+// auditBatchSize is the number of events read at a time while exporting or verifying
+const auditBatchSize = 1000
+
+// AuditOptions configures which events are audited
+type AuditOptions struct {
+	// ConversionThreshold is the amount, in the source currency, from which conversions
+	// are audited; zero disables conversion auditing
+	ConversionThreshold decimal.Decimal
+}
+
+// AuditOptionsFromConfig reads AuditOptions from the application configuration
+func AuditOptionsFromConfig() (AuditOptions, error) {
+	var options AuditOptions
+	if value := viper.GetString("audit.conversion_threshold"); value != "" {
+		threshold, err := decimal.NewFromString(value)
+		if err != nil {
+			return options, fmt.Errorf("invalid audit.conversion_threshold %q: %v", value, err)
+		}
+		options.ConversionThreshold = threshold
+	}
+	return options, nil
+}
+
+// AuditService interface defines recording, querying and verifying the audit log
+type AuditService interface {
+	Record(entry models.AuditEntry) error
+	RecordLogged(entry models.AuditEntry)
+	IsLargeConversion(amount decimal.Decimal) bool
+	ListEvents(filter models.AuditFilter) ([]models.AuditEvent, int64, error)
+	ExportEvents(filter models.AuditFilter, write func(event *models.AuditEvent) error) error
+	Verify() (*models.AuditVerification, error)
+}
+
+type auditService struct {
+	repo    repositories.AuditRepository
+	options AuditOptions
+}
+
+// NewAuditService creates a new instance of AuditService
+func NewAuditService(repo repositories.AuditRepository, options AuditOptions) AuditService {
+	return &auditService{repo, options}
+}
+
+// Record appends an event to the audit log
+func (s *auditService) Record(entry models.AuditEntry) error {
+	event := &models.AuditEvent{
+		// PostgreSQL keeps microseconds; the hash must be computed over what is stored
+		OccurredAt: time.Now().UTC().Truncate(time.Microsecond),
+		Type:       entry.Type,
+		Actor:      entry.Actor,
+		MdaID:      entry.MdaID,
+		Target:     entry.Target,
+		IPAddress:  entry.IPAddress,
+	}
+	if entry.ActorID != 0 {
+		actorID := entry.ActorID
+		event.ActorID = &actorID
+	}
+	if len(entry.Details) > 0 {
+		details, err := json.Marshal(entry.Details)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit details: %v", err)
+		}
+		event.Details = models.AuditDetails(details)
+	}
+
+	if err := s.repo.AppendEvent(event); err != nil {
+		return fmt.Errorf("failed to record audit event %s: %v", entry.Type, err)
+	}
+	return nil
+}
+
+// RecordLogged records an event for an action that has already taken place, logging
+// rather than returning a failure since the action cannot be undone
+func (s *auditService) RecordLogged(entry models.AuditEntry) {
+	if err := s.Record(entry); err != nil {
+		log.Printf("AUDIT FAILURE: %v (entry: %+v)", err, entry)
+	}
+}
+
+// IsLargeConversion reports whether a conversion of the amount must be audited
+func (s *auditService) IsLargeConversion(amount decimal.Decimal) bool {
+	return s.options.ConversionThreshold.IsPositive() && amount.GreaterThanOrEqual(s.options.ConversionThreshold)
+}
+
+// ListEvents returns the events matching the filter, newest first, and the total number of matches
+func (s *auditService) ListEvents(filter models.AuditFilter) ([]models.AuditEvent, int64, error) {
+	events, total, err := s.repo.ListEvents(filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit events: %v", err)
+	}
+	return events, total, nil
+}
+
+// ExportEvents passes every event matching the filter to write, oldest first, reading
+// them in batches so that exports of any size use constant memory
+func (s *auditService) ExportEvents(filter models.AuditFilter, write func(event *models.AuditEvent) error) error {
+	var lastID uint
+	for {
+		events, err := s.repo.ListEventsAfter(filter, lastID, auditBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to read audit events: %v", err)
+		}
+
+		for i := range events {
+			if err := write(&events[i]); err != nil {
+				return err
+			}
+			lastID = events[i].ID
+		}
+
+		if len(events) < auditBatchSize {
+			return nil
+		}
+	}
+}
+
+// Verify walks the whole chain and reports the first event whose link to its
+// predecessor or whose own hash does not match
+func (s *auditService) Verify() (*models.AuditVerification, error) {
+	result := &models.AuditVerification{Valid: true}
+	prevHash := ""
+	var lastID uint
+
+	for {
+		events, err := s.repo.ListEventsAfter(models.AuditFilter{}, lastID, auditBatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit events: %v", err)
+		}
+
+		for i := range events {
+			event := &events[i]
+			switch {
+			case event.PrevHash != prevHash:
+				result.Problem = "link to the previous event does not match; an event was removed or altered"
+			case event.ComputeHash() != event.Hash:
+				result.Problem = "contents do not match the recorded hash"
+			}
+			if result.Problem != "" {
+				result.Valid = false
+				result.FirstInvalidID = event.ID
+				return result, nil
+			}
+
+			result.Checked++
+			prevHash = event.Hash
+			lastID = event.ID
+		}
+
+		if len(events) < auditBatchSize {
+			return result, nil
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/repositories"
+)
+
+// fakeAuditRepo keeps the chain in memory, linking events the way the database does
+type fakeAuditRepo struct {
+	repositories.AuditRepository
+	events []models.AuditEvent
+}
+
+func (r *fakeAuditRepo) AppendEvent(event *models.AuditEvent) error {
+	if n := len(r.events); n > 0 {
+		event.PrevHash = r.events[n-1].Hash
+	}
+	event.ID = uint(len(r.events) + 1)
+	event.Hash = event.ComputeHash()
+	r.events = append(r.events, *event)
+	return nil
+}
+
+func (r *fakeAuditRepo) ListEventsAfter(_ models.AuditFilter, id uint, limit int) ([]models.AuditEvent, error) {
+	events := make([]models.AuditEvent, 0, limit)
+	for _, event := range r.events {
+		if event.ID > id && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name      string
+		tamper    func(events []models.AuditEvent) []models.AuditEvent
+		invalidID uint
+	}{
+		{
+			name:   "untouched",
+			tamper: func(events []models.AuditEvent) []models.AuditEvent { return events },
+		},
+		{
+			name: "altered details",
+			tamper: func(events []models.AuditEvent) []models.AuditEvent {
+				events[1].Details = `{"role":"admin"}`
+				return events
+			},
+			invalidID: 2,
+		},
+		{
+			name: "altered actor",
+			tamper: func(events []models.AuditEvent) []models.AuditEvent {
+				events[2].Actor = "someone-else"
+				return events
+			},
+			invalidID: 3,
+		},
+		{
+			name: "altered and rehashed",
+			tamper: func(events []models.AuditEvent) []models.AuditEvent {
+				events[1].Target = "user:99"
+				events[1].Hash = events[1].ComputeHash()
+				return events
+			},
+			invalidID: 3,
+		},
+		{
+			name: "removed event",
+			tamper: func(events []models.AuditEvent) []models.AuditEvent {
+				return append(events[:1], events[2:]...)
+			},
+			invalidID: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeAuditRepo{}
+			service := NewAuditService(repo, AuditOptions{})
+			for _, entry := range []models.AuditEntry{
+				{Type: models.AuditLoginSucceeded, Actor: "ada", ActorID: 1},
+				{Type: models.AuditRoleChanged, Actor: "ada", ActorID: 1, Target: "user:2", Details: map[string]interface{}{"role": "viewer"}},
+				{Type: models.AuditRatesIngested, Actor: models.AuditSystemActor, Target: "cbn"},
+				{Type: models.AuditMDACreated, Actor: "ada", ActorID: 1, Target: "mda:FMF"},
+			} {
+				if err := service.Record(entry); err != nil {
+					t.Fatalf("Record: %v", err)
+				}
+			}
+
+			repo.events = tt.tamper(repo.events)
+			result, err := service.Verify()
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if tt.invalidID == 0 {
+				if !result.Valid || result.Checked != 4 {
+					t.Errorf("got %+v, want a valid chain of 4 events", result)
+				}
+				return
+			}
+			if result.Valid || result.FirstInvalidID != tt.invalidID {
+				t.Errorf("got %+v, want the chain broken at event %d", result, tt.invalidID)
+			}
+		})
+	}
+}
@@ -1,59 +1,429 @@
 package services
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"time"
 
 	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/repositories"
+	"github.com/abduls21985/exchange-rate-service/internal/utils"
+	"github.com/abduls21985/exchange-rate-service/pkg/middleware"
 	"github.com/dgrijalva/jwt-go"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
 )
 
-// AuthService interface defines authentication-related operations
+var (
+	// ErrInvalidRefreshToken is returned when a refresh token is unknown, expired, revoked
+	// or has already been used
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrSessionNotFound is returned when a session does not exist or belongs to another user
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrNotSessionPrincipal is returned when logging out a request not authenticated by
+	// an access token
+	ErrNotSessionPrincipal = errors.New("request is not authenticated by a session")
+)
+
+// AuthOptions configures the lifetime of issued tokens
+type AuthOptions struct {
+	// AccessTokenTTL is how long an access token is accepted
+	AccessTokenTTL time.Duration
+	// RefreshTokenTTL is how long a session can be refreshed after login
+	RefreshTokenTTL time.Duration
+}
+
+// AuthOptionsFromConfig reads AuthOptions from the application configuration
+func AuthOptionsFromConfig() AuthOptions {
+	options := AuthOptions{
+		AccessTokenTTL:  viper.GetDuration("auth.access_token_ttl"),
+		RefreshTokenTTL: viper.GetDuration("auth.refresh_token_ttl"),
+	}
+	if options.AccessTokenTTL <= 0 {
+		options.AccessTokenTTL = 15 * time.Minute
+	}
+	if options.RefreshTokenTTL <= 0 {
+		options.RefreshTokenTTL = 30 * 24 * time.Hour
+	}
+	return options
+}
+
+// MFALogin is the outcome of the second step of a login
+type MFALogin struct {
+	User         *models.User
+	Tokens       *models.TokenPair
+	Verification *MFAVerification
+}
+
+// AuthService interface defines authentication-related operations. A login creates a
+// session that issues short-lived access tokens and a refresh token; every refresh
+// replaces the refresh token, and logging out revokes the session's access token.
+// Users with a second factor get an MFA challenge instead, and their session only
+// starts once it is completed.
 type AuthService interface {
-	AuthenticateUser(username, password string) (*models.User, error)
-	GenerateJWT(username string) (string, error)
+	AuthenticateUser(username, password, ipAddress string) (*models.User, error)
+	BeginLogin(user *models.User, userAgent, ipAddress string) (*models.TokenPair, *models.MFAChallengeResponse, error)
+	CompleteMFALogin(mfaToken, code, userAgent, ipAddress string) (*MFALogin, error)
+	RefreshTokens(refreshToken, userAgent, ipAddress string) (*models.TokenPair, error)
+	Logout(principal *middleware.Principal) error
+	LogoutAll(username string) (int, error)
+	LogoutOtherSessions(username string, keepSessionID uint) (int, error)
+	ListSessions(username string) ([]models.Session, error)
+	RevokeSession(username string, sessionID uint) error
+	IsTokenRevoked(jti string) (bool, error)
 }
 
 type authService struct {
-	userRepo UserService
+	userRepo    UserService
+	sessionRepo repositories.SessionRepository
+	throttle    LoginThrottleService
+	mfa         MFAService
+	options     AuthOptions
 }
 
 // NewAuthService creates a new instance of AuthService
-func NewAuthService(userRepo UserService) AuthService {
-	return &authService{userRepo}
+func NewAuthService(userRepo UserService, sessionRepo repositories.SessionRepository, throttle LoginThrottleService, mfa MFAService, options AuthOptions) AuthService {
+	return &authService{userRepo, sessionRepo, throttle, mfa, options}
+}
+
+// AuthenticateUser verifies the username and password for login from the IP. Attempts
+// are refused with a *LoginThrottledError while the username or IP is delayed or
+// locked out after earlier failures.
+func (s *authService) AuthenticateUser(username, password, ipAddress string) (*models.User, error) {
+	if err := s.throttle.Check(username, ipAddress); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.AuthenticateUser(username, password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		if err := s.throttle.RecordFailure(username, ipAddress); err != nil {
+			log.Printf("Failed to record failed login: %v", err)
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Failures are only forgotten once the second factor, if any, is also passed
+	challenge, err := s.mfa.ChallengeNeeded(user)
+	if err != nil {
+		return nil, err
+	}
+	if !challenge {
+		s.resetFailures(user.Username)
+	}
+	return user, nil
 }
 
-// AuthenticateUser verifies the username and password for login
-func (s *authService) AuthenticateUser(username, password string) (*models.User, error) {
+// BeginLogin starts a session for a user whose password has been checked, or returns
+// an MFA challenge if the user has or needs a second factor
+func (s *authService) BeginLogin(user *models.User, userAgent, ipAddress string) (*models.TokenPair, *models.MFAChallengeResponse, error) {
+	challenge, err := s.mfa.ChallengeNeeded(user)
+	if err != nil {
+		return nil, nil, err
+	}
+	if challenge {
+		response, err := s.mfa.CreateChallenge(user, userAgent, ipAddress)
+		return nil, response, err
+	}
+
+	pair, err := s.issueTokens(user, false, userAgent, ipAddress)
+	return pair, nil, err
+}
+
+// CompleteMFALogin checks the second factor of a login and starts its session. Wrong
+// codes count as failed logins for the user and IP.
+func (s *authService) CompleteMFALogin(mfaToken, code, userAgent, ipAddress string) (*MFALogin, error) {
+	user, verification, err := s.mfa.CompleteChallenge(mfaToken, code)
+	if errors.Is(err, ErrInvalidMFACode) {
+		if err := s.throttle.RecordFailure(user.Username, ipAddress); err != nil {
+			log.Printf("Failed to record failed login: %v", err)
+		}
+		return &MFALogin{User: user}, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.resetFailures(user.Username)
+
+	pair, err := s.issueTokens(user, true, userAgent, ipAddress)
+	if err != nil {
+		return nil, err
+	}
+	return &MFALogin{User: user, Tokens: pair, Verification: verification}, nil
+}
+
+// issueTokens starts a new session for an authenticated user
+func (s *authService) issueTokens(user *models.User, mfaVerified bool, userAgent, ipAddress string) (*models.TokenPair, error) {
+	now := time.Now()
+	session := &models.Session{
+		UserID:      user.ID,
+		MFAVerified: mfaVerified,
+		UserAgent:   truncate(userAgent, 255),
+		IPAddress:   ipAddress,
+		CreatedAt:   now,
+		LastUsedAt:  now,
+		ExpiresAt:   now.Add(s.options.RefreshTokenTTL),
+	}
+
+	refreshToken, err := utils.NewToken(32)
+	if err != nil {
+		return nil, err
+	}
+	session.RefreshTokenHash = utils.HashToken(refreshToken)
+
+	// The session is saved first so that its ID can be put in the access token
+	if err := s.sessionRepo.CreateSession(session); err != nil {
+		return nil, fmt.Errorf("failed to create session: %v", err)
+	}
+
+	accessToken, err := s.signAccessToken(user, session, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sessionRepo.UpdateSession(session); err != nil {
+		return nil, fmt.Errorf("failed to update session: %v", err)
+	}
+
+	return s.tokenPair(session, accessToken, refreshToken), nil
+}
+
+// RefreshTokens exchanges a refresh token for a new access token and refresh token.
+// A refresh token can only be used once: presenting a replaced token again means it
+// was copied, so the whole session is revoked.
+func (s *authService) RefreshTokens(refreshToken, userAgent, ipAddress string) (*models.TokenPair, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	hash := utils.HashToken(refreshToken)
+	session, err := s.sessionRepo.FindSessionByRefreshTokenHash(hash)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up session: %v", err)
+	}
+
+	now := time.Now()
+	if !session.Active(now) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if session.RefreshTokenHash != hash {
+		log.Printf("Refresh token reuse detected for session %d; revoking session", session.ID)
+		if err := s.sessionRepo.RevokeSessions([]models.Session{*session}, now); err != nil {
+			return nil, fmt.Errorf("failed to revoke session: %v", err)
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// Reload the user so that role, tenant and status changes apply from this refresh on
+	user, err := s.userRepo.GetUserByID(session.UserID)
+	if err != nil || !user.Active {
+		if err := s.sessionRepo.RevokeSessions([]models.Session{*session}, now); err != nil {
+			return nil, fmt.Errorf("failed to revoke session: %v", err)
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// A session started without a second factor ends once the user is required to have one
+	if !session.MFAVerified {
+		required, err := s.mfa.IsRequired(user)
+		if err != nil {
+			return nil, err
+		}
+		if required {
+			if err := s.sessionRepo.RevokeSessions([]models.Session{*session}, now); err != nil {
+				return nil, fmt.Errorf("failed to revoke session: %v", err)
+			}
+			return nil, ErrInvalidRefreshToken
+		}
+	}
+
+	newRefreshToken, err := utils.NewToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	// The access token issued with the replaced refresh token is revoked along with it, so
+	// that revoking the session later reaches every token it issued
+	var replaced *models.RevokedToken
+	if session.AccessTokenID != "" && session.AccessExpiresAt.After(now) {
+		replaced = &models.RevokedToken{JTI: session.AccessTokenID, ExpiresAt: session.AccessExpiresAt}
+	}
+
+	accessToken, err := s.signAccessToken(user, session, now)
+	if err != nil {
+		return nil, err
+	}
+
+	session.PreviousRefreshTokenHash = session.RefreshTokenHash
+	session.RefreshTokenHash = utils.HashToken(newRefreshToken)
+	session.UserAgent = truncate(userAgent, 255)
+	session.IPAddress = ipAddress
+	session.LastUsedAt = now
+
+	// Two requests presenting the same token both get this far; only the first one to
+	// replace it wins, and the other is treated as reuse
+	rotated, err := s.sessionRepo.RotateRefreshToken(session, hash, replaced)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update session: %v", err)
+	}
+	if !rotated {
+		log.Printf("Refresh token reuse detected for session %d; revoking session", session.ID)
+		// Reload the session so the access token issued to the winning request is revoked too
+		current, err := s.sessionRepo.FindSessionByID(session.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up session: %v", err)
+		}
+		if err := s.sessionRepo.RevokeSessions([]models.Session{*current}, now); err != nil {
+			return nil, fmt.Errorf("failed to revoke session: %v", err)
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return s.tokenPair(session, accessToken, newRefreshToken), nil
+}
+
+// Logout revokes the session that issued the principal's access token, and the token
+// itself. API keys have no session and are revoked by deleting them.
+func (s *authService) Logout(principal *middleware.Principal) error {
+	if principal.Kind != middleware.PrincipalUser {
+		return ErrNotSessionPrincipal
+	}
+
+	now := time.Now()
+
+	if err := s.sessionRepo.RevokeToken(models.RevokedToken{JTI: principal.TokenID, ExpiresAt: principal.TokenExpiresAt}); err != nil {
+		return fmt.Errorf("failed to revoke token: %v", err)
+	}
+
+	if principal.SessionID != 0 {
+		session, err := s.sessionRepo.FindSessionByID(principal.SessionID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("failed to look up session: %v", err)
+		}
+		if err == nil && session.RevokedAt == nil {
+			if err := s.sessionRepo.RevokeSessions([]models.Session{*session}, now); err != nil {
+				return fmt.Errorf("failed to revoke session: %v", err)
+			}
+		}
+	}
+
+	s.purgeRevokedTokens(now)
+	return nil
+}
+
+// LogoutAll revokes every active session of the user and returns how many there were
+func (s *authService) LogoutAll(username string) (int, error) {
+	return s.LogoutOtherSessions(username, 0)
+}
+
+// LogoutOtherSessions revokes every active session of the user except the one with the
+// ID, such as the session that just changed the password, and returns how many it revoked
+func (s *authService) LogoutOtherSessions(username string, keepSessionID uint) (int, error) {
 	user, err := s.userRepo.GetUserByUsername(username)
 	if err != nil {
-		return nil, fmt.Errorf("user not found: %v", err)
+		return 0, ErrUserNotFound
+	}
+
+	now := time.Now()
+	active, err := s.sessionRepo.ListActiveSessions(user.ID, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list sessions: %v", err)
+	}
+	sessions := make([]models.Session, 0, len(active))
+	for _, session := range active {
+		if session.ID != keepSessionID {
+			sessions = append(sessions, session)
+		}
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return nil, fmt.Errorf("invalid password")
+	if err := s.sessionRepo.RevokeSessions(sessions, now); err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %v", err)
 	}
 
-	return user, nil
+	s.purgeRevokedTokens(now)
+	return len(sessions), nil
+}
+
+// ListSessions returns the user's active sessions, most recently used first
+func (s *authService) ListSessions(username string) ([]models.Session, error) {
+	user, err := s.userRepo.GetUserByUsername(username)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	sessions, err := s.sessionRepo.ListActiveSessions(user.ID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %v", err)
+	}
+	return sessions, nil
+}
+
+// RevokeSession revokes one of the user's own sessions
+func (s *authService) RevokeSession(username string, sessionID uint) error {
+	user, err := s.userRepo.GetUserByUsername(username)
+	if err != nil {
+		return ErrUserNotFound
+	}
+
+	session, err := s.sessionRepo.FindSessionByID(sessionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && session.UserID != user.ID) {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up session: %v", err)
+	}
+
+	now := time.Now()
+	if !session.Active(now) {
+		return ErrSessionNotFound
+	}
+
+	if err := s.sessionRepo.RevokeSessions([]models.Session{*session}, now); err != nil {
+		return fmt.Errorf("failed to revoke session: %v", err)
+	}
+	return nil
 }
 
-// GenerateJWT generates a JWT token for the authenticated user
-func (s *authService) GenerateJWT(username string) (string, error) {
+// IsTokenRevoked reports whether the access token with the jti is on the revocation list
+func (s *authService) IsTokenRevoked(jti string) (bool, error) {
+	return s.sessionRepo.IsTokenRevoked(jti)
+}
+
+// signAccessToken signs a new access token for the session and records its jti on the
+// session, so that revoking the session also revokes the token
+func (s *authService) signAccessToken(user *models.User, session *models.Session, now time.Time) (string, error) {
 	// Get the secret key from environment variables
 	secretKey := os.Getenv("JWT_SECRET")
 	if secretKey == "" {
 		return "", fmt.Errorf("JWT secret key not configured")
 	}
 
-	// Define the token expiration time
-	expirationTime := time.Now().Add(24 * time.Hour)
+	jti, err := utils.NewToken(16)
+	if err != nil {
+		return "", err
+	}
+	expirationTime := now.Add(s.options.AccessTokenTTL)
 
 	// Create JWT claims
-	claims := &jwt.StandardClaims{
-		Subject:   username,
-		ExpiresAt: expirationTime.Unix(),
+	claims := &middleware.Claims{
+		UserID:    user.ID,
+		Role:      string(user.Role),
+		MdaID:     user.MdaID,
+		SessionID: session.ID,
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			Subject:   user.Username,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: expirationTime.Unix(),
+		},
 	}
 
 	// Create the token
@@ -65,5 +435,42 @@ func (s *authService) GenerateJWT(username string) (string, error) {
 		return "", fmt.Errorf("failed to sign JWT: %v", err)
 	}
 
+	session.AccessTokenID = jti
+	session.AccessExpiresAt = expirationTime
 	return tokenString, nil
 }
+
+// tokenPair builds the response for a freshly issued access and refresh token
+func (s *authService) tokenPair(session *models.Session, accessToken, refreshToken string) *models.TokenPair {
+	return &models.TokenPair{
+		AccessToken:      accessToken,
+		AccessExpiresAt:  session.AccessExpiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: session.ExpiresAt,
+		SessionID:        session.ID,
+	}
+}
+
+// purgeRevokedTokens drops revocation entries of tokens that have expired anyway. It is
+// best effort: a failure only leaves some stale rows behind.
+func (s *authService) purgeRevokedTokens(now time.Time) {
+	if err := s.sessionRepo.DeleteExpiredRevokedTokens(now); err != nil {
+		log.Printf("Failed to purge expired revoked tokens: %v", err)
+	}
+}
+
+// resetFailures forgets the failed logins of a user who has logged in. It is best
+// effort: a failure only leaves the user subject to delays a little longer.
+func (s *authService) resetFailures(username string) {
+	if err := s.throttle.RecordSuccess(username); err != nil {
+		log.Printf("Failed to reset failed logins of %s: %v", username, err)
+	}
+}
+
+// truncate shortens s to at most n bytes
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
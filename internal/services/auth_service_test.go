@@ -0,0 +1,211 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/repositories"
+	"github.com/abduls21985/exchange-rate-service/internal/utils"
+)
+
+type fakeSessionRepo struct {
+	repositories.SessionRepository
+	sessions map[uint]*models.Session
+	revoked  map[string]bool // jti of revoked access tokens
+	// beforeRotate runs once, just before the next rotation is applied
+	beforeRotate func()
+}
+
+func newFakeSessionRepo(sessions ...models.Session) *fakeSessionRepo {
+	repo := &fakeSessionRepo{sessions: map[uint]*models.Session{}, revoked: map[string]bool{}}
+	for i := range sessions {
+		repo.sessions[sessions[i].ID] = &sessions[i]
+	}
+	return repo
+}
+
+func (r *fakeSessionRepo) FindSessionByRefreshTokenHash(hash string) (*models.Session, error) {
+	for _, session := range r.sessions {
+		if session.RefreshTokenHash == hash || session.PreviousRefreshTokenHash == hash {
+			found := *session
+			return &found, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeSessionRepo) FindSessionByID(id uint) (*models.Session, error) {
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	found := *session
+	return &found, nil
+}
+
+func (r *fakeSessionRepo) RotateRefreshToken(session *models.Session, presentedHash string, replaced *models.RevokedToken) (bool, error) {
+	if hook := r.beforeRotate; hook != nil {
+		r.beforeRotate = nil
+		hook()
+	}
+	stored := r.sessions[session.ID]
+	if stored.RefreshTokenHash != presentedHash || stored.RevokedAt != nil {
+		return false, nil
+	}
+	*stored = *session
+	if replaced != nil {
+		r.revoked[replaced.JTI] = true
+	}
+	return true, nil
+}
+
+func (r *fakeSessionRepo) ListActiveSessions(userID uint, now time.Time) ([]models.Session, error) {
+	sessions := make([]models.Session, 0)
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.Active(now) {
+			sessions = append(sessions, *session)
+		}
+	}
+	return sessions, nil
+}
+
+func (r *fakeSessionRepo) RevokeSessions(sessions []models.Session, now time.Time) error {
+	for _, session := range sessions {
+		r.sessions[session.ID].RevokedAt = &now
+		if session.AccessTokenID != "" {
+			r.revoked[session.AccessTokenID] = true
+		}
+	}
+	return nil
+}
+
+func (r *fakeSessionRepo) IsTokenRevoked(jti string) (bool, error) {
+	return r.revoked[jti], nil
+}
+
+func (r *fakeSessionRepo) DeleteExpiredRevokedTokens(time.Time) error {
+	return nil
+}
+
+type fakeUsers struct {
+	UserService
+	user *models.User
+}
+
+func (u *fakeUsers) GetUserByID(uint) (*models.User, error) {
+	return u.user, nil
+}
+
+func (u *fakeUsers) GetUserByUsername(string) (*models.User, error) {
+	return u.user, nil
+}
+
+// newTestAuthService returns an auth service for the user "ada" and her sessions
+func newTestAuthService(t *testing.T, sessions ...models.Session) (AuthService, *fakeSessionRepo) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	repo := newFakeSessionRepo(sessions...)
+	users := &fakeUsers{user: &models.User{ID: 1, Username: "ada", Active: true}}
+	return NewAuthService(users, repo, nil, nil, AuthOptions{AccessTokenTTL: time.Minute, RefreshTokenTTL: time.Hour}), repo
+}
+
+// testSession is an active session of ada's whose refresh token is the given one
+func testSession(id uint, refreshToken, accessTokenID string) models.Session {
+	return models.Session{
+		ID:               id,
+		UserID:           1,
+		RefreshTokenHash: utils.HashToken(refreshToken),
+		AccessTokenID:    accessTokenID,
+		AccessExpiresAt:  time.Now().Add(time.Minute),
+		MFAVerified:      true,
+		ExpiresAt:        time.Now().Add(time.Hour),
+	}
+}
+
+func TestRefreshTokensRejectsConcurrentReuse(t *testing.T) {
+	refreshToken := "original-refresh-token"
+	service, repo := newTestAuthService(t, testSession(7, refreshToken, "first-access-token"))
+
+	// A second request with the same token rotates it while the first is in flight
+	var winner *models.TokenPair
+	repo.beforeRotate = func() {
+		pair, err := service.RefreshTokens(refreshToken, "agent", "10.0.0.2")
+		if err != nil {
+			t.Fatalf("concurrent refresh: %v", err)
+		}
+		winner = pair
+	}
+
+	_, err := service.RefreshTokens(refreshToken, "agent", "10.0.0.1")
+	if !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("err = %v, want ErrInvalidRefreshToken", err)
+	}
+	if winner == nil {
+		t.Fatal("concurrent refresh did not run")
+	}
+	session := repo.sessions[7]
+	if session.RevokedAt == nil {
+		t.Error("session was not revoked after the token was reused")
+	}
+	if session.RefreshTokenHash != utils.HashToken(winner.RefreshToken) || !repo.revoked[session.AccessTokenID] {
+		t.Error("access token issued to the winning request was not revoked")
+	}
+
+	// The token issued to the winning request is dead with the session
+	if _, err := service.RefreshTokens(winner.RefreshToken, "agent", "10.0.0.2"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refresh after revocation: err = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestRefreshTokensRevokesReplacedAccessToken(t *testing.T) {
+	service, repo := newTestAuthService(t, testSession(7, "original-refresh-token", "first-access-token"))
+
+	pair, err := service.RefreshTokens("original-refresh-token", "agent", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("RefreshTokens: %v", err)
+	}
+	if !repo.revoked["first-access-token"] {
+		t.Error("access token issued before the refresh is still accepted")
+	}
+
+	// Logging out everywhere later reaches the access token of the latest refresh
+	if _, err := service.LogoutAll("ada"); err != nil {
+		t.Fatalf("LogoutAll: %v", err)
+	}
+	if latest := repo.sessions[7].AccessTokenID; latest == "first-access-token" || !repo.revoked[latest] {
+		t.Errorf("latest access token %q was not revoked", latest)
+	}
+	if _, err := service.RefreshTokens(pair.RefreshToken, "agent", "10.0.0.1"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refresh after logout: err = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestLogoutOtherSessionsKeepsCurrent(t *testing.T) {
+	service, repo := newTestAuthService(t,
+		testSession(1, "laptop", "laptop-access"),
+		testSession(2, "phone", "phone-access"),
+		testSession(3, "stolen", "stolen-access"),
+	)
+
+	revoked, err := service.LogoutOtherSessions("ada", 1)
+	if err != nil {
+		t.Fatalf("LogoutOtherSessions: %v", err)
+	}
+	if revoked != 2 {
+		t.Errorf("revoked %d sessions, want 2", revoked)
+	}
+	if repo.sessions[1].RevokedAt != nil || repo.revoked["laptop-access"] {
+		t.Error("the current session was revoked")
+	}
+	for _, id := range []uint{2, 3} {
+		if repo.sessions[id].RevokedAt == nil || !repo.revoked[repo.sessions[id].AccessTokenID] {
+			t.Errorf("session %d was not revoked", id)
+		}
+	}
+	if _, err := service.RefreshTokens("stolen", "agent", "10.0.0.9"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refresh with another session's token: err = %v, want ErrInvalidRefreshToken", err)
+	}
+}
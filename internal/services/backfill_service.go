@@ -0,0 +1,323 @@
+// internal/services/backfill_service.go
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/providers"
+	"github.com/abduls21985/exchange-rate-service/internal/repositories"
+	"github.com/spf13/viper"
+)
+
+// ErrBackfillRunning is returned when a job is already being run by this process
+var ErrBackfillRunning = errors.New("backfill job is already running")
+
+const dateLayout = "2006-01-02"
+
+// BackfillOptions configures how backfill jobs call providers and store rates
+type BackfillOptions struct {
+	// RequestInterval is the minimum time between two provider requests
+	RequestInterval time.Duration
+	// BatchDays is the number of fetched days stored, and progress saved, at a time
+	BatchDays int
+}
+
+// BackfillOptionsFromConfig reads BackfillOptions from the application configuration
+func BackfillOptionsFromConfig() BackfillOptions {
+	options := BackfillOptions{
+		RequestInterval: viper.GetDuration("backfill.request_interval"),
+		BatchDays:       viper.GetInt("backfill.batch_days"),
+	}
+	if options.BatchDays <= 0 {
+		options.BatchDays = 30
+	}
+	return options
+}
+
+// BackfillService interface defines the methods for loading historical rates
+type BackfillService interface {
+	CreateBackfill(provider string, start, end time.Time) (*models.BackfillJob, error)
+	RunBackfill(id uint) (*models.BackfillJob, error)
+	StartBackfill(id uint) (*models.BackfillJob, error)
+	GetBackfill(id uint) (*models.BackfillJob, error)
+	ListBackfills(limit, offset int) ([]models.BackfillJob, error)
+}
+
+type backfillService struct {
+	repo                repositories.BackfillRepository
+	exchangeRateService ExchangeRateService
+	providers           *providers.Registry
+	options             BackfillOptions
+
+	mu      sync.Mutex
+	running map[uint]bool
+}
+
+// NewBackfillService creates a new instance of BackfillService
+func NewBackfillService(repo repositories.BackfillRepository, exchangeRateService ExchangeRateService, registry *providers.Registry, options BackfillOptions) BackfillService {
+	return &backfillService{
+		repo:                repo,
+		exchangeRateService: exchangeRateService,
+		providers:           registry,
+		options:             options,
+		running:             make(map[uint]bool),
+	}
+}
+
+// CreateBackfill validates the request and records a pending job covering start to end inclusive
+func (s *backfillService) CreateBackfill(provider string, start, end time.Time) (*models.BackfillJob, error) {
+	if provider == "" {
+		defaultProvider, err := s.providers.Default()
+		if err != nil {
+			return nil, err
+		}
+		provider = defaultProvider.Name()
+	}
+	if _, err := s.providers.Get(provider); err != nil {
+		return nil, err
+	}
+
+	start, end = truncateDay(start), truncateDay(end)
+	if end.Before(start) {
+		return nil, fmt.Errorf("end date %s is before start date %s", end.Format(dateLayout), start.Format(dateLayout))
+	}
+	if end.After(truncateDay(time.Now())) {
+		return nil, fmt.Errorf("end date %s is in the future", end.Format(dateLayout))
+	}
+
+	job := &models.BackfillJob{
+		Provider:  provider,
+		StartDate: start,
+		EndDate:   end,
+		NextDate:  start,
+		Status:    models.BackfillPending,
+		TotalDays: int(end.Sub(start).Hours()/24) + 1,
+	}
+	if err := s.repo.CreateJob(job); err != nil {
+		return nil, fmt.Errorf("failed to create backfill job: %v", err)
+	}
+	return job, nil
+}
+
+// RunBackfill walks the job's remaining days through its provider, skipping days that
+// already have a snapshot. Progress is saved after every batch so that a failed or
+// interrupted job can be run again and continue from where it stopped.
+func (s *backfillService) RunBackfill(id uint) (*models.BackfillJob, error) {
+	if !s.acquire(id) {
+		return nil, ErrBackfillRunning
+	}
+	defer s.release(id)
+
+	job, err := s.repo.GetJobByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return job, s.run(job)
+}
+
+// StartBackfill runs the job in the background and returns it immediately. Progress
+// can be followed with GetBackfill.
+func (s *backfillService) StartBackfill(id uint) (*models.BackfillJob, error) {
+	if !s.acquire(id) {
+		return nil, ErrBackfillRunning
+	}
+
+	job, err := s.repo.GetJobByID(id)
+	if err != nil {
+		s.release(id)
+		return nil, err
+	}
+	if job.Status == models.BackfillCompleted {
+		s.release(id)
+		return job, nil
+	}
+
+	snapshot := *job
+	go func() {
+		defer s.release(id)
+		if err := s.run(job); err != nil {
+			log.Printf("Backfill %d failed: %v", id, err)
+		}
+	}()
+	return &snapshot, nil
+}
+
+// run retries the days that failed in earlier runs, then processes the job from its
+// resume cursor to its end date. Days that cannot be fetched are kept in the job's retry
+// list, and a job that ends with any is reported as partially failed.
+func (s *backfillService) run(job *models.BackfillJob) error {
+	if job.Status == models.BackfillCompleted {
+		return nil
+	}
+
+	provider, err := s.providers.Get(job.Provider)
+	if err != nil {
+		return s.fail(job, err)
+	}
+
+	// Failed days may lie anywhere before the cursor, so look up snapshots for the whole range
+	from := job.NextDate
+	if len(job.FailedDates) > 0 {
+		from = job.StartDate
+	}
+	existing, err := s.exchangeRateService.GetSnapshotDates(provider.Name(), from, job.EndDate)
+	if err != nil {
+		return s.fail(job, fmt.Errorf("failed to look up existing snapshots: %v", err))
+	}
+
+	job.Status = models.BackfillRunning
+	job.LastError = ""
+	if err := s.repo.UpdateJob(job); err != nil {
+		return err
+	}
+
+	var (
+		batch       []models.ExchangeRateData
+		pending     int // Days processed since progress was last saved
+		lastRequest time.Time
+	)
+
+	// fetch loads one day's rates into the batch, reporting false if the provider failed
+	fetch := func(day time.Time) bool {
+		if wait := s.options.RequestInterval - time.Since(lastRequest); wait > 0 {
+			time.Sleep(wait)
+		}
+		lastRequest = time.Now()
+
+		data, err := provider.FetchRates(day)
+		if err != nil {
+			log.Printf("Backfill %d: failed to fetch %s rates for %s: %v", job.ID, provider.Name(), day.Format(dateLayout), err)
+			job.LastError = fmt.Sprintf("%s: %v", day.Format(dateLayout), err)
+			return false
+		}
+		batch = append(batch, *data)
+		return true
+	}
+
+	retries := job.FailedDates
+	job.FailedDates = nil
+	for _, date := range retries {
+		day, err := time.Parse(dateLayout, date)
+		switch {
+		case err != nil:
+			log.Printf("Backfill %d: dropping invalid failed date %q", job.ID, date)
+			job.FailedDays--
+		case existing[date]:
+			job.FailedDays--
+			job.SkippedDays++
+		case fetch(day):
+			job.FailedDays--
+			job.FetchedDays++
+		default:
+			job.FailedDates = append(job.FailedDates, date)
+		}
+	}
+	if len(retries) > 0 {
+		if err := s.flush(job, batch, job.NextDate); err != nil {
+			return s.fail(job, err)
+		}
+		batch = nil
+	}
+
+	for day := job.NextDate; !day.After(job.EndDate); day = day.AddDate(0, 0, 1) {
+		switch {
+		case existing[day.Format(dateLayout)]:
+			job.SkippedDays++
+		case fetch(day):
+			job.FetchedDays++
+		default:
+			job.FailedDays++
+			job.FailedDates = append(job.FailedDates, day.Format(dateLayout))
+		}
+
+		pending++
+		if pending >= s.options.BatchDays {
+			if err := s.flush(job, batch, day.AddDate(0, 0, 1)); err != nil {
+				return s.fail(job, err)
+			}
+			batch, pending = nil, 0
+		}
+	}
+
+	if err := s.flush(job, batch, job.EndDate.AddDate(0, 0, 1)); err != nil {
+		return s.fail(job, err)
+	}
+
+	job.Status = models.BackfillCompleted
+	if len(job.FailedDates) > 0 {
+		job.Status = models.BackfillPartial
+	}
+	if err := s.repo.UpdateJob(job); err != nil {
+		return err
+	}
+	log.Printf("Backfill %d %s: %d fetched, %d skipped, %d failed", job.ID, job.Status, job.FetchedDays, job.SkippedDays, job.FailedDays)
+	return nil
+}
+
+// GetBackfill returns a backfill job with its progress
+func (s *backfillService) GetBackfill(id uint) (*models.BackfillJob, error) {
+	return s.repo.GetJobByID(id)
+}
+
+// ListBackfills returns backfill jobs, newest first
+func (s *backfillService) ListBackfills(limit, offset int) ([]models.BackfillJob, error) {
+	return s.repo.ListJobs(limit, offset)
+}
+
+// flush stores the fetched days and advances the job's resume cursor to next
+func (s *backfillService) flush(job *models.BackfillJob, batch []models.ExchangeRateData, next time.Time) error {
+	if len(batch) > 0 {
+		if _, err := s.exchangeRateService.AddExchangeRatesBatch(batch); err != nil {
+			return fmt.Errorf("failed to store rates: %v", err)
+		}
+	}
+
+	job.NextDate = next
+	if err := s.repo.UpdateJob(job); err != nil {
+		return fmt.Errorf("failed to save backfill progress: %v", err)
+	}
+
+	log.Printf("Backfill %d: %d/%d days processed (%d fetched, %d skipped, %d failed)",
+		job.ID, job.ProcessedDays(), job.TotalDays, job.FetchedDays, job.SkippedDays, job.FailedDays)
+	return nil
+}
+
+// fail records the error on the job so that it can be inspected and resumed
+func (s *backfillService) fail(job *models.BackfillJob, err error) error {
+	job.Status = models.BackfillFailed
+	job.LastError = err.Error()
+	if saveErr := s.repo.UpdateJob(job); saveErr != nil {
+		log.Printf("Backfill %d: failed to save status: %v", job.ID, saveErr)
+	}
+	return err
+}
+
+// acquire marks the job as running in this process, reporting false if it already is
+func (s *backfillService) acquire(id uint) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[id] {
+		return false
+	}
+	s.running[id] = true
+	return true
+}
+
+// release clears the running mark set by acquire
+func (s *backfillService) release(id uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, id)
+}
+
+// truncateDay returns midnight UTC of the given time's date
+func truncateDay(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/providers"
+	"github.com/abduls21985/exchange-rate-service/internal/repositories"
+)
+
+type fakeBackfillRepo struct {
+	repositories.BackfillRepository
+	job models.BackfillJob
+}
+
+func (r *fakeBackfillRepo) UpdateJob(job *models.BackfillJob) error {
+	r.job = *job
+	r.job.FailedDates = append([]string(nil), job.FailedDates...)
+	return nil
+}
+
+func (r *fakeBackfillRepo) GetJobByID(uint) (*models.BackfillJob, error) {
+	job := r.job
+	return &job, nil
+}
+
+// flakyProvider fails on the dates listed in down
+type flakyProvider struct {
+	down    map[string]bool
+	fetched []string
+}
+
+func (p *flakyProvider) Name() string { return "flaky" }
+
+func (p *flakyProvider) FetchRates(date time.Time) (*models.ExchangeRateData, error) {
+	day := date.Format(dateLayout)
+	if p.down[day] {
+		return nil, errors.New("provider unavailable")
+	}
+	p.fetched = append(p.fetched, day)
+	return &models.ExchangeRateData{
+		Timestamp: date.Unix(),
+		Base:      "USD",
+		Source:    "flaky",
+		Rates:     map[string]decimal.Decimal{"NGN": decimal.NewFromInt(1500)},
+	}, nil
+}
+
+type backfillRates struct {
+	ExchangeRateService
+	stored []string
+}
+
+func (r *backfillRates) GetSnapshotDates(string, time.Time, time.Time) (map[string]bool, error) {
+	return map[string]bool{}, nil
+}
+
+func (r *backfillRates) AddExchangeRatesBatch(batch []models.ExchangeRateData) ([]*models.RateSnapshot, error) {
+	for _, data := range batch {
+		r.stored = append(r.stored, time.Unix(data.Timestamp, 0).UTC().Format(dateLayout))
+	}
+	return nil, nil
+}
+
+func TestBackfillRetriesFailedDays(t *testing.T) {
+	provider := &flakyProvider{down: map[string]bool{"2024-03-02": true, "2024-03-04": true}}
+	registry := providers.NewRegistry(provider.Name())
+	registry.Register(provider)
+
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+	repo := &fakeBackfillRepo{job: models.BackfillJob{
+		ID: 1, Provider: provider.Name(), StartDate: start, EndDate: end, NextDate: start,
+		Status: models.BackfillPending, TotalDays: 5,
+	}}
+	rates := &backfillRates{}
+	service := NewBackfillService(repo, rates, registry, BackfillOptions{BatchDays: 2})
+
+	job, err := service.RunBackfill(1)
+	if err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	if job.Status != models.BackfillPartial {
+		t.Errorf("status = %s, want %s", job.Status, models.BackfillPartial)
+	}
+	if job.FetchedDays != 3 || job.FailedDays != 2 || len(job.FailedDates) != 2 {
+		t.Errorf("fetched %d, failed %d %v; want 3 fetched and 2 failed", job.FetchedDays, job.FailedDays, job.FailedDates)
+	}
+	if !job.NextDate.Equal(end.AddDate(0, 0, 1)) {
+		t.Errorf("next date = %s, want the day after the end date", job.NextDate)
+	}
+
+	// Only the failed days are fetched again once the provider recovers
+	provider.down["2024-03-02"] = false
+	provider.fetched = nil
+	job, err = service.RunBackfill(1)
+	if err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	if len(provider.fetched) != 1 || provider.fetched[0] != "2024-03-02" {
+		t.Errorf("second run fetched %v, want [2024-03-02]", provider.fetched)
+	}
+	if job.Status != models.BackfillPartial || job.FailedDays != 1 || job.FailedDates[0] != "2024-03-04" {
+		t.Errorf("after retry: status %s, failed %d %v", job.Status, job.FailedDays, job.FailedDates)
+	}
+
+	provider.down["2024-03-04"] = false
+	job, err = service.RunBackfill(1)
+	if err != nil {
+		t.Fatalf("third run: %v", err)
+	}
+	if job.Status != models.BackfillCompleted || job.FailedDays != 0 || job.FetchedDays != 5 {
+		t.Errorf("after recovery: status %s, fetched %d, failed %d", job.Status, job.FetchedDays, job.FailedDays)
+	}
+	if len(rates.stored) != 5 {
+		t.Errorf("stored %v, want all 5 days", rates.stored)
+	}
+}
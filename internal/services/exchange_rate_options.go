@@ -0,0 +1,66 @@
+// internal/services/exchange_rate_options.go
+
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// ExchangeRateOptions configures how the ExchangeRateService selects and rounds rates
+type ExchangeRateOptions struct {
+	// PreferredSources are tried in order when a caller does not ask for a specific source
+	PreferredSources []string
+	// Rounding is applied to converted amounts
+	Rounding RoundingMode
+	// MinorUnits overrides the number of decimal places per currency code
+	MinorUnits map[string]int32
+	// Fallback is the default policy for dated conversions without a rate on the date
+	Fallback models.FallbackPolicy
+	// MaxFallbackDays limits how far from the requested date a fallback rate may be; 0 means no limit
+	MaxFallbackDays int
+	// PivotCurrencies are tried in order as intermediates when no single publication quotes both currencies
+	PivotCurrencies []string
+	// StaleAfter flags conversion legs older than this relative to the conversion date; 0 disables the check
+	StaleAfter time.Duration
+}
+
+// ExchangeRateOptionsFromConfig reads ExchangeRateOptions from the application configuration
+func ExchangeRateOptionsFromConfig() (ExchangeRateOptions, error) {
+	rounding, err := ParseRoundingMode(viper.GetString("conversion.rounding"))
+	if err != nil {
+		return ExchangeRateOptions{}, err
+	}
+
+	fallback, err := models.ParseFallbackPolicy(viper.GetString("conversion.fallback_policy"))
+	if err != nil {
+		return ExchangeRateOptions{}, err
+	}
+	if fallback == "" {
+		fallback = models.FallbackPrevious
+	}
+
+	minorUnits := make(map[string]int32)
+	for code, places := range viper.GetStringMap("conversion.minor_units") {
+		value, err := cast.ToInt32E(places)
+		if err != nil || value < 0 {
+			return ExchangeRateOptions{}, fmt.Errorf("invalid minor units for %s: %v", code, places)
+		}
+		minorUnits[strings.ToUpper(code)] = value
+	}
+
+	return ExchangeRateOptions{
+		PreferredSources: viper.GetStringSlice("rate_providers.preferred_sources"),
+		Rounding:         rounding,
+		MinorUnits:       minorUnits,
+		Fallback:         fallback,
+		MaxFallbackDays:  viper.GetInt("conversion.max_fallback_days"),
+		PivotCurrencies:  viper.GetStringSlice("conversion.pivot_currencies"),
+		StaleAfter:       viper.GetDuration("conversion.stale_after"),
+	}, nil
+}
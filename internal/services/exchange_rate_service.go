@@ -5,118 +5,774 @@ package services
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/abduls21985/exchange-rate-service/internal/cache"
 	"github.com/abduls21985/exchange-rate-service/internal/repositories"
 
 	"github.com/abduls21985/exchange-rate-service/internal/models"
 )
 
+var (
+	// ErrRateNotFound is returned when no stored rate satisfies a conversion request
+	ErrRateNotFound = errors.New("no exchange rate available")
+	// ErrBaseCurrencyRequired is returned when rebasing without a base currency or tenant default
+	ErrBaseCurrencyRequired = errors.New("base currency is required")
+	// ErrCurrencyNotAllowed is returned when a tenant uses a currency outside its allowed list
+	ErrCurrencyNotAllowed = errors.New("currency not allowed for this MDA")
+)
+
 type ExchangeRateService interface {
-	AddExchangeRates(data models.ExchangeRateData) error
-	FetchExchangeRates(currencyCode string, timestamp int64) ([]models.ExchangeRate, error)
+	ForTenant(mda *models.MDA) ExchangeRateService
+	ResolveBaseCurrency(code string) (string, error)
+	AddExchangeRates(data models.ExchangeRateData) (*models.RateSnapshot, error)
+	AddExchangeRatesBatch(batch []models.ExchangeRateData) ([]*models.RateSnapshot, error)
+	ListSnapshots(source string, limit, offset int) ([]models.RateSnapshot, error)
+	ListSnapshotsAfter(afterID uint, limit int) ([]models.RateSnapshot, error)
+	GetSnapshotDates(source string, start, end time.Time) (map[string]bool, error)
+	GetSnapshot(id uint) (*models.RateSnapshot, error)
+	GetPreviousSnapshot(snapshot *models.RateSnapshot) (*models.RateSnapshot, error)
+	HasNewerSnapshot(snapshot *models.RateSnapshot) (bool, error)
+	FetchExchangeRates(currencyCode string, timestamp int64, source string) ([]models.ExchangeRate, error)
 	GetAllCurrencies() ([]models.Currency, error)
+	GetRateSources() ([]models.RateSource, error)
 	CountExchangeRates() (int, error)
-	GetHistoricalExchangeRates(currencyCode string, startDate, endDate int64) ([]models.ExchangeRate, error)
-	ConvertCurrency(fromCurrency, toCurrency string, amount float64) (float64, error)
+	GetTimeSeries(query TimeSeriesQuery) (*TimeSeries, error)
+	GetPairSeries(base, quote, source string, side models.RateSide, startDate, endDate time.Time) (*PairSeries, error)
+	ConvertCurrency(request models.ConversionRequest) (*models.Conversion, error)
 	ConvertToBaseCurrency(rates []models.ExchangeRate, baseCurrency string) ([]models.ExchangeRate, error)
 	ConvertRatesToBaseCurrency(baseCurrencyCode string, rates []models.ExchangeRate) ([]models.ExchangeRate, error)
+	CacheStats() cache.Stats
+	AddSnapshotListener(listener SnapshotListener)
+	AddFailureListener(listener IngestionFailureListener)
+	ReportIngestionFailure(source string, err error)
 }
 
 type exchangeRateService struct {
-	repo repositories.ExchangeRateRepository
+	repo      repositories.ExchangeRateRepository
+	options   ExchangeRateOptions
+	audit     AuditService
+	tenant    *models.MDA // nil outside of a tenant
+	ids       *idCache
+	cache     cache.Cache // Latest rates and publications, shared by every tenant view
+	listeners *ingestionListeners
+}
+
+// SnapshotListener is called with the snapshots of each ingestion once they are stored.
+// It runs on the ingesting goroutine, so it must return quickly.
+type SnapshotListener func(snapshots []*models.RateSnapshot)
+
+// IngestionFailure describes rates of a source that could not be fetched or stored
+type IngestionFailure struct {
+	Source   string
+	MdaID    string // The tenant whose custom source failed; empty for global sources
+	Err      error
+	FailedAt time.Time
+}
+
+// IngestionFailureListener is called when an ingestion fails. Like SnapshotListener it
+// runs on the ingesting goroutine.
+type IngestionFailureListener func(failure IngestionFailure)
+
+// ingestionListeners holds the listeners shared by the global and every tenant-scoped service
+type ingestionListeners struct {
+	mu     sync.RWMutex
+	stored []SnapshotListener
+	failed []IngestionFailureListener
+}
+
+// idCache holds currency and source IDs, which never change once created, for
+// ingestion. It is shared by the global and every tenant-scoped service.
+type idCache struct {
+	mu         sync.RWMutex
+	currencies map[string]uint
+	sources    map[string]models.RateSource
 }
 
-func NewExchangeRateService(repo repositories.ExchangeRateRepository) ExchangeRateService {
-	return &exchangeRateService{repo: repo}
+// NewExchangeRateService creates a new ExchangeRateService. When a caller does not ask
+// for a specific source, rates are looked up in the preferred sources order before
+// falling back to whichever source has the most recent rate. Lookups of the latest
+// rates go through rateCache, which is invalidated whenever rates are stored.
+func NewExchangeRateService(repo repositories.ExchangeRateRepository, options ExchangeRateOptions, audit AuditService, rateCache cache.Cache) ExchangeRateService {
+	return &exchangeRateService{
+		repo:    repo,
+		options: options,
+		audit:   audit,
+		cache:   rateCache,
+		ids: &idCache{
+			currencies: make(map[string]uint),
+			sources:    make(map[string]models.RateSource),
+		},
+		listeners: &ingestionListeners{},
+	}
 }
 
-func (s *exchangeRateService) AddExchangeRates(data models.ExchangeRateData) error {
-	// Get or create base currency
-	baseCurrency, err := s.repo.GetCurrencyByCode(data.Base)
+// ForTenant returns a view of the service for an MDA's users. It reads the MDA's own
+// rate sources alongside the global ones, tries its preferred source first, restricts
+// currencies to its allowed list and stores published rates in MDA-owned sources.
+// A nil MDA returns the global view.
+func (s *exchangeRateService) ForTenant(mda *models.MDA) ExchangeRateService {
+	mdaID := ""
+	if mda != nil {
+		mdaID = mda.Code
+	}
+	return &exchangeRateService{
+		repo:      s.repo.ForTenant(mdaID),
+		options:   s.options,
+		audit:     s.audit,
+		tenant:    mda,
+		ids:       s.ids,
+		cache:     s.cache,
+		listeners: s.listeners,
+	}
+}
+
+// candidateSources returns the sources to try in order. An explicitly requested source
+// is used on its own; otherwise the tenant's and then the configured preferred sources
+// are tried before any source ("").
+func (s *exchangeRateService) candidateSources(source string) []string {
+	if source != "" {
+		return []string{source}
+	}
+	var candidates []string
+	if s.tenant != nil && s.tenant.PreferredSource != "" {
+		candidates = append(candidates, s.tenant.PreferredSource)
+	}
+	candidates = append(candidates, s.options.PreferredSources...)
+	return append(candidates, "")
+}
+
+// checkCurrencies returns ErrCurrencyNotAllowed if the tenant may not use any of the codes
+func (s *exchangeRateService) checkCurrencies(codes ...string) error {
+	for _, code := range codes {
+		if !s.tenant.AllowsCurrency(code) {
+			return fmt.Errorf("%w: %s", ErrCurrencyNotAllowed, code)
+		}
+	}
+	return nil
+}
+
+// allowedRates drops the rates of currencies the tenant may not use
+func (s *exchangeRateService) allowedRates(rates []models.ExchangeRate) []models.ExchangeRate {
+	if s.tenant == nil || len(s.tenant.AllowedCurrencies) == 0 {
+		return rates
+	}
+	allowed := make([]models.ExchangeRate, 0, len(rates))
+	for _, rate := range rates {
+		if s.tenant.AllowsCurrency(rate.Currency.Code) {
+			allowed = append(allowed, rate)
+		}
+	}
+	return allowed
+}
+
+// ResolveBaseCurrency returns the requested base currency, defaulting to the tenant's
+func (s *exchangeRateService) ResolveBaseCurrency(code string) (string, error) {
+	if code == "" && s.tenant != nil {
+		code = s.tenant.DefaultBaseCurrency
+	}
+	if code == "" {
+		return "", ErrBaseCurrencyRequired
+	}
+	return code, s.checkCurrencies(code)
+}
+
+// AddExchangeRates stores one provider payload as a snapshot, writing all of its rates atomically
+func (s *exchangeRateService) AddExchangeRates(data models.ExchangeRateData) (*models.RateSnapshot, error) {
+	snapshots, err := s.AddExchangeRatesBatch([]models.ExchangeRateData{data})
 	if err != nil {
-		// If not found, create it
-		baseCurrency, err = s.repo.CreateCurrency(data.Base, "")
-		if err != nil {
-			return fmt.Errorf("failed to create base currency: %v", err)
+		return nil, err
+	}
+	return snapshots[0], nil
+}
+
+// AddExchangeRatesBatch stores several provider payloads, one snapshot each, in a single
+// transaction using bulk upserts. Currency and source IDs are resolved through an
+// in-memory cache so that only previously unseen codes reach the database.
+func (s *exchangeRateService) AddExchangeRatesBatch(batch []models.ExchangeRateData) ([]*models.RateSnapshot, error) {
+	// Collect every currency code used by the batch
+	codes := make([]string, 0)
+	for i, data := range batch {
+		if data.Source == "" {
+			return nil, errors.New("rate source is required")
+		}
+		// A tenant's rates are custom overrides and never touch the global sources
+		if s.tenant != nil && !strings.HasPrefix(data.Source, s.tenant.SourceCode("")) {
+			batch[i].Source = s.tenant.SourceCode(data.Source)
+		}
+		if data.Base == "" {
+			return nil, errors.New("base currency is required")
+		}
+		codes = append(codes, data.Base)
+		for code := range data.Rates {
+			codes = append(codes, code)
 		}
 	}
 
-	timestamp := time.Unix(data.Timestamp, 0).UTC()
+	currencyIDs, err := s.currencyIDs(codes)
+	if err != nil {
+		return nil, s.failBatch(batch, err)
+	}
 
-	for code, rate := range data.Rates {
-		// Get or create currency
-		currency, err := s.repo.GetCurrencyByCode(code)
+	fetchedAt := time.Now().UTC()
+	snapshots := make([]*models.RateSnapshot, 0, len(batch))
+	positions := make(map[string]int, len(batch)) // publication key -> index in snapshots
+	for _, data := range batch {
+		source, err := s.rateSource(data.Source)
 		if err != nil {
-			// If not found, create it
-			currency, err = s.repo.CreateCurrency(code, "")
-			if err != nil {
-				return fmt.Errorf("failed to create currency %s: %v", code, err)
+			return nil, s.failBatch(batch, err)
+		}
+
+		timestamp := time.Unix(data.Timestamp, 0).UTC()
+		baseCurrencyID := currencyIDs[data.Base]
+
+		rates := make([]models.ExchangeRate, 0, len(data.Rates))
+		for code, rate := range data.Rates {
+			// Use the provider's buy/sell/mid quote when it supplies one
+			quote, ok := data.Quotes[code]
+			if !ok {
+				quote = models.Quote{Buy: rate, Sell: rate, Mid: rate}
 			}
+
+			rates = append(rates, models.ExchangeRate{
+				CurrencyID:     currencyIDs[code],
+				Currency:       models.Currency{ID: currencyIDs[code], Code: code},
+				Rate:           rate,
+				BuyRate:        quote.Buy,
+				SellRate:       quote.Sell,
+				MidRate:        quote.Mid,
+				Timestamp:      timestamp,
+				BaseCurrencyID: baseCurrencyID,
+				SourceID:       source.ID,
+			})
 		}
 
-		exchangeRate := models.ExchangeRate{
-			CurrencyID:     currency.ID,
-			Rate:           rate,
-			Timestamp:      timestamp,
-			BaseCurrencyID: baseCurrency.ID,
+		snapshot := &models.RateSnapshot{
+			SourceID:          source.ID,
+			Source:            source,
+			BaseCurrencyID:    baseCurrencyID,
+			BaseCurrency:      models.Currency{ID: baseCurrencyID, Code: data.Base},
+			ProviderTimestamp: timestamp,
+			FetchedAt:         fetchedAt,
+			Checksum:          data.Checksum(),
+			RateCount:         len(rates),
+			PostedBy:          data.PostedBy,
+			Reason:            data.Reason,
+			Rates:             rates,
+		}
+		if data.PostedByID != 0 {
+			postedByID := data.PostedByID
+			snapshot.PostedByID = &postedByID
 		}
 
-		if err := s.repo.InsertOrUpdateExchangeRate(&exchangeRate); err != nil {
-			return fmt.Errorf("failed to insert/update exchange rate for %s: %v", code, err)
+		// A publication repeated within the batch keeps only its last payload
+		key := fmt.Sprintf("%d|%d", source.ID, data.Timestamp)
+		if i, ok := positions[key]; ok {
+			snapshots[i] = snapshot
+			continue
 		}
+		positions[key] = len(snapshots)
+		snapshots = append(snapshots, snapshot)
 	}
 
-	return nil
+	if err := s.repo.SaveSnapshots(snapshots); err != nil {
+		return nil, s.failBatch(batch, fmt.Errorf("failed to save snapshots: %v", err))
+	}
+	s.invalidateRates()
+
+	for _, snapshot := range snapshots {
+		s.auditSnapshot(snapshot)
+	}
+	s.notifyListeners(snapshots)
+
+	return snapshots, nil
+}
+
+// AddSnapshotListener registers a listener for snapshots stored through this service or
+// any of its tenant views
+func (s *exchangeRateService) AddSnapshotListener(listener SnapshotListener) {
+	s.listeners.mu.Lock()
+	s.listeners.stored = append(s.listeners.stored, listener)
+	s.listeners.mu.Unlock()
+}
+
+// AddFailureListener registers a listener for ingestions that fail in this service or
+// any of its tenant views, or are reported through ReportIngestionFailure
+func (s *exchangeRateService) AddFailureListener(listener IngestionFailureListener) {
+	s.listeners.mu.Lock()
+	s.listeners.failed = append(s.listeners.failed, listener)
+	s.listeners.mu.Unlock()
+}
+
+// ReportIngestionFailure tells the failure listeners that rates of the source could not
+// be fetched. Failures to store rates are reported by AddExchangeRatesBatch itself.
+func (s *exchangeRateService) ReportIngestionFailure(source string, err error) {
+	failure := IngestionFailure{Source: source, Err: err, FailedAt: time.Now().UTC()}
+	if s.tenant != nil {
+		failure.MdaID = s.tenant.Code
+	}
+
+	s.listeners.mu.RLock()
+	defer s.listeners.mu.RUnlock()
+	for _, listener := range s.listeners.failed {
+		listener(failure)
+	}
+}
+
+// failBatch reports the failure to store each source of the batch and returns err
+func (s *exchangeRateService) failBatch(batch []models.ExchangeRateData, err error) error {
+	reported := make(map[string]bool, len(batch))
+	for _, data := range batch {
+		if !reported[data.Source] {
+			reported[data.Source] = true
+			s.ReportIngestionFailure(data.Source, err)
+		}
+	}
+	return err
+}
+
+// notifyListeners passes newly stored snapshots to every registered listener
+func (s *exchangeRateService) notifyListeners(snapshots []*models.RateSnapshot) {
+	s.listeners.mu.RLock()
+	defer s.listeners.mu.RUnlock()
+	for _, listener := range s.listeners.stored {
+		listener(snapshots)
+	}
+}
+
+// auditSnapshot records the ingestion of a stored snapshot, attributing manually
+// submitted rates to the user who posted them
+func (s *exchangeRateService) auditSnapshot(snapshot *models.RateSnapshot) {
+	entry := models.AuditEntry{
+		Type:   models.AuditRatesIngested,
+		Actor:  models.AuditSystemActor,
+		Target: snapshot.Source.Code,
+		Details: map[string]interface{}{
+			"snapshot_id":        snapshot.ID,
+			"base":               snapshot.BaseCurrency.Code,
+			"provider_timestamp": snapshot.ProviderTimestamp,
+			"rate_count":         snapshot.RateCount,
+			"checksum":           snapshot.Checksum,
+		},
+	}
+	if snapshot.PostedBy != "" {
+		entry.Type = models.AuditRatesPosted
+		entry.Actor = snapshot.PostedBy
+		entry.Details["reason"] = snapshot.Reason
+	}
+	if snapshot.PostedByID != nil {
+		entry.ActorID = *snapshot.PostedByID
+	}
+	if s.tenant != nil {
+		entry.MdaID = s.tenant.Code
+	}
+
+	s.audit.RecordLogged(entry)
+}
+
+// currencyIDs resolves currency codes to IDs, consulting the cache before the database
+func (s *exchangeRateService) currencyIDs(codes []string) (map[string]uint, error) {
+	ids := make(map[string]uint, len(codes))
+	var missing []string
+
+	s.ids.mu.RLock()
+	for _, code := range codes {
+		if id, ok := s.ids.currencies[code]; ok {
+			ids[code] = id
+		} else if _, seen := ids[code]; !seen {
+			ids[code] = 0
+			missing = append(missing, code)
+		}
+	}
+	s.ids.mu.RUnlock()
+
+	if len(missing) == 0 {
+		return ids, nil
+	}
+
+	created, err := s.repo.GetOrCreateCurrencies(missing)
+	if err != nil {
+		return nil, err
+	}
+
+	s.ids.mu.Lock()
+	defer s.ids.mu.Unlock()
+	for _, code := range missing {
+		id, ok := created[code]
+		if !ok {
+			return nil, fmt.Errorf("failed to resolve currency %s", code)
+		}
+		ids[code] = id
+		s.ids.currencies[code] = id
+	}
+	return ids, nil
+}
+
+// rateSource resolves a rate source code, consulting the cache before the database.
+// Sources first seen through a tenant are owned by that tenant.
+func (s *exchangeRateService) rateSource(code string) (models.RateSource, error) {
+	s.ids.mu.RLock()
+	source, ok := s.ids.sources[code]
+	s.ids.mu.RUnlock()
+	if ok {
+		return source, nil
+	}
+
+	found, err := s.repo.GetRateSourceByCode(code)
+	if err != nil {
+		mdaID := ""
+		if s.tenant != nil {
+			mdaID = s.tenant.Code
+		}
+		found, err = s.repo.CreateRateSource(code, "", mdaID)
+		if err != nil {
+			return models.RateSource{}, fmt.Errorf("failed to create rate source %s: %v", code, err)
+		}
+	}
+
+	s.ids.mu.Lock()
+	s.ids.sources[code] = *found
+	s.ids.mu.Unlock()
+	return *found, nil
+}
+
+// ListSnapshots returns ingested snapshots, newest first
+func (s *exchangeRateService) ListSnapshots(source string, limit, offset int) ([]models.RateSnapshot, error) {
+	return s.repo.ListSnapshots(source, limit, offset)
+}
+
+// ListSnapshotsAfter returns the snapshots stored after the one with afterID, oldest first, with their rates
+func (s *exchangeRateService) ListSnapshotsAfter(afterID uint, limit int) ([]models.RateSnapshot, error) {
+	return s.repo.ListSnapshotsAfter(afterID, limit)
+}
+
+// GetSnapshotDates returns the days between start and end on which the source has a snapshot
+func (s *exchangeRateService) GetSnapshotDates(source string, start, end time.Time) (map[string]bool, error) {
+	return s.repo.GetSnapshotDates(source, start, end)
+}
+
+// GetSnapshot returns a snapshot with its rates
+func (s *exchangeRateService) GetSnapshot(id uint) (*models.RateSnapshot, error) {
+	return s.repo.GetSnapshotByID(id)
 }
 
-func (s *exchangeRateService) FetchExchangeRates(currencyCode string, timestamp int64) ([]models.ExchangeRate, error) {
-	return s.repo.GetExchangeRates(currencyCode, timestamp)
+// GetPreviousSnapshot returns the publication of the snapshot's source preceding it, with its rates
+func (s *exchangeRateService) GetPreviousSnapshot(snapshot *models.RateSnapshot) (*models.RateSnapshot, error) {
+	return s.repo.GetPreviousSnapshot(snapshot)
+}
+
+// HasNewerSnapshot reports whether the snapshot's source has a later publication, as is
+// the case for the rates of past dates loaded by a backfill
+func (s *exchangeRateService) HasNewerSnapshot(snapshot *models.RateSnapshot) (bool, error) {
+	return s.repo.HasNewerSnapshot(snapshot)
+}
+
+func (s *exchangeRateService) FetchExchangeRates(currencyCode string, timestamp int64, source string) ([]models.ExchangeRate, error) {
+	if currencyCode != "" {
+		if err := s.checkCurrencies(currencyCode); err != nil {
+			return nil, err
+		}
+	}
+
+	// Return the rates of the first candidate source that has any
+	for _, candidate := range s.candidateSources(source) {
+		rates, err := s.repo.GetExchangeRates(currencyCode, timestamp, candidate)
+		if err != nil {
+			return nil, err
+		}
+		if len(rates) > 0 {
+			return s.allowedRates(rates), nil
+		}
+	}
+	return []models.ExchangeRate{}, nil
 }
 
 func (s *exchangeRateService) GetAllCurrencies() ([]models.Currency, error) {
-	return s.repo.GetAllCurrencies()
+	currencies, err := s.repo.GetAllCurrencies()
+	if err != nil || s.tenant == nil || len(s.tenant.AllowedCurrencies) == 0 {
+		return currencies, err
+	}
+
+	allowed := make([]models.Currency, 0, len(currencies))
+	for _, currency := range currencies {
+		if s.tenant.AllowsCurrency(currency.Code) {
+			allowed = append(allowed, currency)
+		}
+	}
+	return allowed, nil
 }
 
-// internal/services/exchange_rate_service.go
+// GetTimeSeries returns the rates published within the query's range by the first
+// candidate source with any, rebased and sampled as requested. Without a base the
+// tenant's default is used, or else the base of the latest snapshot.
+func (s *exchangeRateService) GetTimeSeries(query TimeSeriesQuery) (*TimeSeries, error) {
+	if query.Base == "" && s.tenant != nil {
+		query.Base = s.tenant.DefaultBaseCurrency
+	}
+	if err := s.checkCurrencies(query.Currencies...); err != nil {
+		return nil, err
+	}
+	if query.Base != "" {
+		if err := s.checkCurrencies(query.Base); err != nil {
+			return nil, err
+		}
+	}
+	if !query.End.After(query.Start) {
+		return nil, fmt.Errorf("%w: end date is before start date", ErrInvalidDateRange)
+	}
+	if query.End.Sub(query.Start) > maxSeriesDays*24*time.Hour {
+		return nil, fmt.Errorf("%w: a range cannot span more than %d days", ErrInvalidDateRange, maxSeriesDays)
+	}
+
+	// The base is loaded along with the requested currencies so that rates can be rebased onto it
+	codes := query.Currencies
+	if len(codes) > 0 && query.Base != "" {
+		codes = append([]string{query.Base}, codes...)
+	}
+	wanted := func(code string) bool {
+		return s.tenant.AllowsCurrency(code) && (len(query.Currencies) == 0 || containsString(query.Currencies, code))
+	}
 
-func (s *exchangeRateService) GetHistoricalExchangeRates(currencyCode string, startDate, endDate int64) ([]models.ExchangeRate, error) {
-	return s.repo.GetHistoricalExchangeRates(currencyCode, startDate, endDate)
+	for _, candidate := range s.candidateSources(query.Source) {
+		rates, err := s.repo.GetRateSeries(codes, candidate, query.Start, query.End)
+		if err != nil {
+			return nil, err
+		}
+		snapshots, source := groupSeriesRates(rates, query.Side)
+		if len(snapshots) == 0 {
+			continue
+		}
+
+		if query.Base == "" {
+			query.Base = snapshots[len(snapshots)-1].base
+		}
+		series := &TimeSeries{
+			Base:     query.Base,
+			Source:   source,
+			Interval: query.Interval,
+			Sampling: query.Sampling,
+			Rates:    buildTimeSeries(snapshots, query, wanted),
+		}
+		if len(series.Rates) > 0 {
+			return series, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no rates between %s and %s", ErrRateNotFound,
+		query.Start.UTC().Format(time.RFC3339), query.End.UTC().Format(time.RFC3339))
+}
+
+// GetPairSeries returns the rate of quote per unit of base in every snapshot published
+// from startDate to endDate inclusive, using the first candidate source with any. An
+// empty base defaults to the tenant's base currency.
+func (s *exchangeRateService) GetPairSeries(base, quote, source string, side models.RateSide, startDate, endDate time.Time) (*PairSeries, error) {
+	base, err := s.ResolveBaseCurrency(base)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkCurrencies(quote); err != nil {
+		return nil, err
+	}
+	if endDate.Before(startDate) {
+		return nil, fmt.Errorf("%w: end date is before start date", ErrInvalidDateRange)
+	}
+	if endDate.Sub(startDate) > maxSeriesDays*24*time.Hour {
+		return nil, fmt.Errorf("%w: a range cannot span more than %d days", ErrInvalidDateRange, maxSeriesDays)
+	}
+
+	series := &PairSeries{Base: base, Quote: quote, Side: side, StartDate: startDate, EndDate: endDate}
+	for _, candidate := range s.candidateSources(source) {
+		rates, err := s.repo.GetRateSeries([]string{base, quote}, candidate, startDate, endDate.AddDate(0, 0, 1))
+		if err != nil {
+			return nil, err
+		}
+		snapshots, source := groupSeriesRates(rates, side)
+		if series.Points, series.Source = pairPoints(snapshots, base, quote), source; len(series.Points) > 0 {
+			return series, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no %s/%s rates between %s and %s", ErrRateNotFound, base, quote,
+		startDate.Format(dateLayout), endDate.Format(dateLayout))
+}
+
+func (s *exchangeRateService) GetRateSources() ([]models.RateSource, error) {
+	return s.repo.GetAllRateSources()
 }
 
 // internal/services/exchange_rate_service.go
 
-func (s *exchangeRateService) ConvertCurrency(fromCurrency, toCurrency string, amount float64) (float64, error) {
-	// Get exchange rate for the source currency
-	fromRate, err := s.repo.GetExchangeRateByCurrency(fromCurrency)
+func (s *exchangeRateService) ConvertCurrency(request models.ConversionRequest) (*models.Conversion, error) {
+	if err := s.checkCurrencies(request.FromCurrency, request.ToCurrency); err != nil {
+		return nil, err
+	}
+
+	policy := request.Fallback
+	if policy == "" {
+		policy = s.options.Fallback
+	}
+
+	// Try each candidate source in turn. Legs resolved from different publications are
+	// aligned by triangulate, which also reports the path that was taken.
+	for _, candidate := range s.candidateSources(request.Source) {
+		// Get exchange rate for the source currency
+		fromRate, err := s.resolveRate(request.FromCurrency, candidate, request.At, policy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch exchange rate for %s: %v", request.FromCurrency, err)
+		}
+
+		// Get exchange rate for the target currency
+		toRate, err := s.resolveRate(request.ToCurrency, candidate, request.At, policy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch exchange rate for %s: %v", request.ToCurrency, err)
+		}
+
+		if fromRate.ID == 0 || toRate.ID == 0 {
+			continue
+		}
+
+		// Load the publications each leg was resolved in so both legs can be aligned
+		fromTable, toTable, err := s.rateTablesFor(fromRate, toRate)
+		if err != nil {
+			return nil, err
+		}
+
+		side := request.Side
+		conversionRoute, err := triangulate(request.FromCurrency, request.ToCurrency, fromTable, toTable, side, s.options.PivotCurrencies)
+		if errors.Is(err, ErrRateNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		reference := time.Now().UTC()
+		if request.At != nil {
+			reference = *request.At
+		}
+
+		// Perform the conversion with the product of the leg rates, rounding only the result
+		rate := conversionRoute.rate()
+		conversion := &models.Conversion{
+			FromCurrency:      request.FromCurrency,
+			ToCurrency:        request.ToCurrency,
+			OriginalAmount:    request.Amount,
+			ConvertedAmount:   s.options.Rounding.Round(request.Amount.Mul(rate), minorUnits(request.ToCurrency, s.options.MinorUnits)),
+			Rate:              rate,
+			Side:              side,
+			Source:            conversionRoute.legs[0].Source,
+			RequestedAt:       request.At,
+			FromRateTimestamp: conversionRoute.legs[0].Timestamp,
+			ToRateTimestamp:   conversionRoute.legs[len(conversionRoute.legs)-1].Timestamp,
+			Path:              conversionRoute.path(),
+			Legs:              conversionRoute.legs,
+			Warnings:          routeWarnings(conversionRoute, reference, s.options.StaleAfter),
+		}
+		if request.At != nil {
+			conversion.Fallback = policy
+		}
+		return conversion, nil
+	}
+
+	if request.At != nil {
+		return nil, fmt.Errorf("%w: cannot convert %s to %s on %s", ErrRateNotFound, request.FromCurrency, request.ToCurrency, request.At.Format("2006-01-02"))
+	}
+	return nil, fmt.Errorf("%w: cannot convert %s to %s", ErrRateNotFound, request.FromCurrency, request.ToCurrency)
+}
+
+// rateTablesFor loads the full publications the two rates belong to, sharing the
+// table when both rates come from the same publication
+func (s *exchangeRateService) rateTablesFor(fromRate, toRate models.ExchangeRate) (*rateTable, *rateTable, error) {
+	fromRates, err := s.publishedRates(fromRate.SnapshotID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load rates published with %s: %v", fromRate.Timestamp, err)
+	}
+	fromTable := newRateTable(fromRates)
+
+	if fromRate.SourceID == toRate.SourceID && fromRate.BaseCurrencyID == toRate.BaseCurrencyID && fromRate.Timestamp.Equal(toRate.Timestamp) {
+		return fromTable, fromTable, nil
+	}
+
+	toRates, err := s.publishedRates(toRate.SnapshotID)
 	if err != nil {
-		return 0, fmt.Errorf("failed to fetch exchange rate for %s: %v", fromCurrency, err)
+		return nil, nil, fmt.Errorf("failed to load rates published with %s: %v", toRate.Timestamp, err)
+	}
+	return fromTable, newRateTable(toRates), nil
+}
+
+// resolveRate returns the rate for the currency effective at the given time, or the
+// latest rate when at is nil. A rate with ID 0 means none satisfied the policy.
+func (s *exchangeRateService) resolveRate(code, source string, at *time.Time, policy models.FallbackPolicy) (models.ExchangeRate, error) {
+	if at == nil {
+		return s.latestRate(code, source)
 	}
 
-	// Get exchange rate for the target currency
-	toRate, err := s.repo.GetExchangeRateByCurrency(toCurrency)
+	// A rate is effective on a date if it was published at any point during that UTC day
+	dayStart := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+	dayEnd := dayStart.AddDate(0, 0, 1)
+
+	previous, err := s.repo.GetExchangeRateBefore(code, source, dayEnd)
 	if err != nil {
-		return 0, fmt.Errorf("failed to fetch exchange rate for %s: %v", toCurrency, err)
+		return models.ExchangeRate{}, err
+	}
+	if previous.ID != 0 && !previous.Timestamp.Before(dayStart) {
+		return previous, nil
+	}
+
+	var chosen models.ExchangeRate
+	switch policy {
+	case models.FallbackStrict:
+		return models.ExchangeRate{}, nil
+	case models.FallbackNearest:
+		next, err := s.repo.GetExchangeRateOnOrAfter(code, source, dayEnd)
+		if err != nil {
+			return models.ExchangeRate{}, err
+		}
+		chosen = previous
+		if next.ID != 0 && (previous.ID == 0 || next.Timestamp.Sub(dayEnd) < dayStart.Sub(previous.Timestamp)) {
+			chosen = next
+		}
+	default:
+		chosen = previous
+	}
+
+	// Do not fall back further than the configured window
+	if chosen.ID != 0 && s.options.MaxFallbackDays > 0 {
+		window := time.Duration(s.options.MaxFallbackDays) * 24 * time.Hour
+		if chosen.Timestamp.Before(dayStart.Add(-window)) || !chosen.Timestamp.Before(dayEnd.Add(window)) {
+			return models.ExchangeRate{}, nil
+		}
 	}
 
-	// Perform the conversion
-	convertedAmount := (amount / fromRate.Rate) * toRate.Rate
-	return convertedAmount, nil
+	return chosen, nil
 }
 
 // internal/services/exchange_rate_service.go
 
 func (s *exchangeRateService) ConvertToBaseCurrency(rates []models.ExchangeRate, baseCurrency string) ([]models.ExchangeRate, error) {
-	// Get the exchange rate for the specified base currency
-	baseRate, err := s.repo.GetExchangeRateByCurrency(baseCurrency)
+	baseCurrency, err := s.ResolveBaseCurrency(baseCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the exchange rate for the specified base currency from the same source as the rates
+	source := ""
+	if len(rates) > 0 {
+		source = rates[0].Source.Code
+	}
+	baseRate, err := s.latestRate(baseCurrency, source)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch base currency rate for %s: %v", baseCurrency, err)
 	}
 
+	if baseRate.Rate.IsZero() {
+		return nil, errors.New("base currency rate cannot be zero")
+	}
+
 	// Convert each rate in the list to the new base currency
 	for i := range rates {
 		if rates[i].CurrencyID != baseRate.CurrencyID {
-			rates[i].Rate /= baseRate.Rate
+			rates[i].Rate = rates[i].Rate.Div(baseRate.Rate)
 		}
 	}
 
@@ -135,20 +791,30 @@ func (s *exchangeRateService) CountExchangeRates() (int, error) {
 }
 
 func (s *exchangeRateService) ConvertRatesToBaseCurrency(baseCurrencyCode string, rates []models.ExchangeRate) ([]models.ExchangeRate, error) {
+	baseCurrencyCode, err := s.ResolveBaseCurrency(baseCurrencyCode)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get the rate for the specified base currency
-	baseRate, err := s.repo.GetExchangeRateByCurrency(baseCurrencyCode)
+	baseRate, err := s.latestRate(baseCurrencyCode, "")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get base currency rate: %v", err)
 	}
 
-	if baseRate.Rate == 0 {
+	if baseRate.Rate.IsZero() {
 		return nil, errors.New("base currency rate cannot be zero")
 	}
 
 	// Convert each rate relative to the base rate
 	for i := range rates {
-		rates[i].Rate = rates[i].Rate / baseRate.Rate
+		rates[i].Rate = rates[i].Rate.Div(baseRate.Rate)
 	}
 
 	return rates, nil
 }
+
+// CacheStats reports the hits and misses of the latest-rate cache
+func (s *exchangeRateService) CacheStats() cache.Stats {
+	return s.cache.Stats()
+}
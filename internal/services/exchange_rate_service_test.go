@@ -0,0 +1,77 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/repositories"
+)
+
+// datedRatesRepo holds the USD rates of one source published at the given times, oldest first
+type datedRatesRepo struct {
+	repositories.ExchangeRateRepository
+	published []time.Time
+}
+
+func (r *datedRatesRepo) GetExchangeRateBefore(code, source string, before time.Time) (models.ExchangeRate, error) {
+	var found models.ExchangeRate
+	for i, at := range r.published {
+		if at.Before(before) {
+			found = models.ExchangeRate{ID: uint(i + 1), Timestamp: at}
+		}
+	}
+	return found, nil
+}
+
+func (r *datedRatesRepo) GetExchangeRateOnOrAfter(code, source string, from time.Time) (models.ExchangeRate, error) {
+	for i, at := range r.published {
+		if !at.Before(from) {
+			return models.ExchangeRate{ID: uint(i + 1), Timestamp: at}, nil
+		}
+	}
+	return models.ExchangeRate{}, nil
+}
+
+func TestResolveRateFallback(t *testing.T) {
+	date := func(day, hour int) time.Time {
+		return time.Date(2024, 3, day, hour, 0, 0, 0, time.UTC)
+	}
+	// Rates were published on the 1st, 4th and 10th of March
+	repo := &datedRatesRepo{published: []time.Time{date(1, 10), date(4, 8), date(10, 12)}}
+
+	tests := []struct {
+		name    string
+		at      time.Time
+		policy  models.FallbackPolicy
+		maxDays int
+		want    time.Time // Zero when no rate satisfies the policy
+	}{
+		{"published on the date", date(1, 23), models.FallbackStrict, 0, date(1, 10)},
+		{"published later on the date", date(4, 0), models.FallbackPrevious, 0, date(4, 8)},
+		{"strict without a rate on the date", date(2, 12), models.FallbackStrict, 0, time.Time{}},
+		{"previous", date(3, 12), models.FallbackPrevious, 0, date(1, 10)},
+		{"previous within the window", date(2, 12), models.FallbackPrevious, 1, date(1, 10)},
+		{"previous outside the window", date(3, 12), models.FallbackPrevious, 1, time.Time{}},
+		{"previous before the first publication", time.Date(2024, 2, 28, 12, 0, 0, 0, time.UTC), models.FallbackPrevious, 0, time.Time{}},
+		{"nearest is earlier", date(2, 12), models.FallbackNearest, 0, date(1, 10)},
+		{"nearest is later", date(3, 12), models.FallbackNearest, 0, date(4, 8)},
+		{"nearest before the first publication", time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC), models.FallbackNearest, 1, date(1, 10)},
+		{"nearest outside the window", date(8, 12), models.FallbackNearest, 1, time.Time{}},
+		{"previous after the last publication", date(20, 12), models.FallbackPrevious, 0, date(10, 12)},
+		{"previous long after the last publication", date(20, 12), models.FallbackPrevious, 7, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewExchangeRateService(repo, ExchangeRateOptions{MaxFallbackDays: tt.maxDays}, nil, nil).(*exchangeRateService)
+			rate, err := service.resolveRate("USD", "cbn", &tt.at, tt.policy)
+			if err != nil {
+				t.Fatalf("resolveRate: %v", err)
+			}
+			if (rate.ID == 0) != tt.want.IsZero() || !rate.Timestamp.Equal(tt.want) {
+				t.Errorf("resolved the rate of %s (id %d), want %s", rate.Timestamp, rate.ID, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+// internal/services/login_throttle_service.go
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/repositories"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// LoginThrottledError is returned when a login is refused before its password is
+// checked, because of recent failures for the username or the client IP
+type LoginThrottledError struct {
+	// RetryAfter is how long until another attempt will be considered
+	RetryAfter time.Duration
+	// Locked distinguishes a lockout from the delay between attempts
+	Locked bool
+}
+
+// Error implements the error interface
+func (e *LoginThrottledError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("login locked out; retry after %s", e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("too many failed logins; retry after %s", e.RetryAfter.Round(time.Second))
+}
+
+// LoginThrottleOptions configures the delays and lockouts applied after failed logins
+type LoginThrottleOptions struct {
+	// FreeAttempts is the number of failures allowed before attempts are delayed
+	FreeAttempts int
+	// BaseDelay is the delay after the first failure beyond FreeAttempts; it doubles
+	// with every further failure
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts
+	MaxDelay time.Duration
+	// LockoutThreshold is the number of failures for one username that locks it out
+	LockoutThreshold int
+	// IPLockoutThreshold is the number of failures from one IP that locks it out; it is
+	// higher since many users may share an address
+	IPLockoutThreshold int
+	// LockoutDuration is how long a lockout lasts unless an admin lifts it
+	LockoutDuration time.Duration
+	// ResetAfter is how long after the last failure the count starts again
+	ResetAfter time.Duration
+}
+
+// LoginThrottleOptionsFromConfig reads LoginThrottleOptions from the application configuration
+func LoginThrottleOptionsFromConfig() LoginThrottleOptions {
+	options := LoginThrottleOptions{
+		FreeAttempts:       viper.GetInt("auth.login.free_attempts"),
+		BaseDelay:          viper.GetDuration("auth.login.base_delay"),
+		MaxDelay:           viper.GetDuration("auth.login.max_delay"),
+		LockoutThreshold:   viper.GetInt("auth.login.lockout_threshold"),
+		IPLockoutThreshold: viper.GetInt("auth.login.ip_lockout_threshold"),
+		LockoutDuration:    viper.GetDuration("auth.login.lockout_duration"),
+		ResetAfter:         viper.GetDuration("auth.login.reset_after"),
+	}
+	if options.FreeAttempts <= 0 {
+		options.FreeAttempts = 3
+	}
+	if options.BaseDelay <= 0 {
+		options.BaseDelay = time.Second
+	}
+	if options.MaxDelay <= 0 {
+		options.MaxDelay = time.Minute
+	}
+	if options.LockoutThreshold <= 0 {
+		options.LockoutThreshold = 10
+	}
+	if options.IPLockoutThreshold <= 0 {
+		options.IPLockoutThreshold = 100
+	}
+	if options.LockoutDuration <= 0 {
+		options.LockoutDuration = 15 * time.Minute
+	}
+	if options.ResetAfter <= 0 {
+		options.ResetAfter = time.Hour
+	}
+	return options
+}
+
+// LoginThrottleService interface defines failed login tracking. Failures are counted
+// per username, whether or not the user exists, and per client IP; each failure beyond
+// the free attempts doubles the wait before the next attempt, and enough failures lock
+// the username or IP out for a while.
+type LoginThrottleService interface {
+	Check(username, ipAddress string) error
+	RecordFailure(username, ipAddress string) error
+	RecordSuccess(username string) error
+	Unlock(kind, value string) error
+	ListLockouts() ([]models.LoginThrottle, error)
+}
+
+type loginThrottleService struct {
+	repo    repositories.LoginThrottleRepository
+	audit   AuditService
+	options LoginThrottleOptions
+	now     func() time.Time // Replaced in tests to run the throttle on a fixed clock
+}
+
+// NewLoginThrottleService creates a new instance of LoginThrottleService
+func NewLoginThrottleService(repo repositories.LoginThrottleRepository, audit AuditService, options LoginThrottleOptions) LoginThrottleService {
+	return &loginThrottleService{repo, audit, options, time.Now}
+}
+
+// Check returns a *LoginThrottledError if a login for the username from the IP must
+// not be attempted yet
+func (s *loginThrottleService) Check(username, ipAddress string) error {
+	now := s.now()
+	for _, key := range throttleKeys(username, ipAddress) {
+		throttle, err := s.repo.FindThrottle(key.kind, key.value)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to look up failed logins: %v", err)
+		}
+
+		if throttle.Locked(now) {
+			return &LoginThrottledError{RetryAfter: throttle.LockedUntil.Sub(now), Locked: true}
+		}
+		since := now.Sub(throttle.LastFailureAt)
+		if since >= s.options.ResetAfter {
+			continue
+		}
+		if wait := s.delay(throttle.Failures) - since; wait > 0 {
+			return &LoginThrottledError{RetryAfter: wait}
+		}
+	}
+	return nil
+}
+
+// RecordFailure counts a failed login against the username and the IP, locking out
+// either once it reaches its threshold
+func (s *loginThrottleService) RecordFailure(username, ipAddress string) error {
+	now := s.now()
+	for _, key := range throttleKeys(username, ipAddress) {
+		throttle, err := s.repo.RecordFailure(key.kind, key.value, now, now.Add(-s.options.ResetAfter))
+		if err != nil {
+			return fmt.Errorf("failed to record failed login: %v", err)
+		}
+
+		threshold := s.options.LockoutThreshold
+		if key.kind == models.ThrottleIP {
+			threshold = s.options.IPLockoutThreshold
+		}
+		if throttle.Failures < threshold || throttle.Locked(now) {
+			continue
+		}
+
+		until := now.Add(s.options.LockoutDuration)
+		if err := s.repo.Lock(key.kind, key.value, until); err != nil {
+			return fmt.Errorf("failed to lock out %s %s: %v", key.kind, key.value, err)
+		}
+		log.Printf("SECURITY: logins for %s %q locked out until %s after %d failed attempts",
+			key.kind, key.value, until.Format(time.RFC3339), throttle.Failures)
+		s.audit.RecordLogged(models.AuditEntry{
+			Type:      models.AuditLoginLocked,
+			Actor:     models.AuditSystemActor,
+			Target:    key.value,
+			IPAddress: ipAddress,
+			Details: map[string]interface{}{
+				"kind":         key.kind,
+				"failures":     throttle.Failures,
+				"locked_until": until,
+			},
+		})
+	}
+	return nil
+}
+
+// RecordSuccess forgets the failures of a username after a successful login. Failures
+// from the IP are kept, so that one valid account cannot be used to keep guessing others.
+func (s *loginThrottleService) RecordSuccess(username string) error {
+	if err := s.repo.DeleteThrottle(models.ThrottleUsername, normalizeThrottleUsername(username)); err != nil {
+		return fmt.Errorf("failed to reset failed logins: %v", err)
+	}
+	return nil
+}
+
+// Unlock lifts the lockout of a username or IP and forgets its failures
+func (s *loginThrottleService) Unlock(kind, value string) error {
+	if kind == models.ThrottleUsername {
+		value = normalizeThrottleUsername(value)
+	}
+	if err := s.repo.DeleteThrottle(kind, value); err != nil {
+		return fmt.Errorf("failed to unlock %s %s: %v", kind, value, err)
+	}
+	return nil
+}
+
+// ListLockouts returns the usernames and IPs currently locked out
+func (s *loginThrottleService) ListLockouts() ([]models.LoginThrottle, error) {
+	throttles, err := s.repo.ListLocked(s.now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list lockouts: %v", err)
+	}
+	return throttles, nil
+}
+
+// delay returns the wait required after the given number of consecutive failures
+func (s *loginThrottleService) delay(failures int) time.Duration {
+	if failures <= s.options.FreeAttempts {
+		return 0
+	}
+	delay := s.options.BaseDelay
+	for i := s.options.FreeAttempts + 1; i < failures && delay < s.options.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > s.options.MaxDelay {
+		delay = s.options.MaxDelay
+	}
+	return delay
+}
+
+// throttleKey identifies one set of failed logins
+type throttleKey struct {
+	kind  string
+	value string
+}
+
+// throttleKeys returns the keys a login attempt is counted under
+func throttleKeys(username, ipAddress string) []throttleKey {
+	var keys []throttleKey
+	if username = normalizeThrottleUsername(username); username != "" {
+		keys = append(keys, throttleKey{models.ThrottleUsername, username})
+	}
+	if ipAddress != "" {
+		keys = append(keys, throttleKey{models.ThrottleIP, ipAddress})
+	}
+	return keys
+}
+
+// normalizeThrottleUsername folds variants of a username onto one key
+func normalizeThrottleUsername(username string) string {
+	return truncate(strings.ToLower(strings.TrimSpace(username)), 150)
+}
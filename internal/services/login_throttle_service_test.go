@@ -0,0 +1,207 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/repositories"
+)
+
+// fakeThrottleRepo counts failures the way the single-statement upsert does
+type fakeThrottleRepo struct {
+	repositories.LoginThrottleRepository
+	throttles map[throttleKey]*models.LoginThrottle
+}
+
+func (r *fakeThrottleRepo) FindThrottle(kind, value string) (*models.LoginThrottle, error) {
+	throttle, ok := r.throttles[throttleKey{kind, value}]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	found := *throttle
+	return &found, nil
+}
+
+func (r *fakeThrottleRepo) RecordFailure(kind, value string, now, forgetBefore time.Time) (*models.LoginThrottle, error) {
+	throttle, ok := r.throttles[throttleKey{kind, value}]
+	if !ok {
+		throttle = &models.LoginThrottle{Kind: kind, Value: value}
+		r.throttles[throttleKey{kind, value}] = throttle
+	}
+	if throttle.LastFailureAt.Before(forgetBefore) {
+		throttle.Failures = 0
+	}
+	throttle.Failures++
+	throttle.LastFailureAt = now
+	found := *throttle
+	return &found, nil
+}
+
+func (r *fakeThrottleRepo) Lock(kind, value string, until time.Time) error {
+	r.throttles[throttleKey{kind, value}].LockedUntil = &until
+	return nil
+}
+
+func (r *fakeThrottleRepo) DeleteThrottle(kind, value string) error {
+	delete(r.throttles, throttleKey{kind, value})
+	return nil
+}
+
+func (r *fakeThrottleRepo) ListLocked(now time.Time) ([]models.LoginThrottle, error) {
+	var locked []models.LoginThrottle
+	for _, throttle := range r.throttles {
+		if throttle.Locked(now) {
+			locked = append(locked, *throttle)
+		}
+	}
+	return locked, nil
+}
+
+var testThrottleOptions = LoginThrottleOptions{
+	FreeAttempts:       3,
+	BaseDelay:          time.Second,
+	MaxDelay:           8 * time.Second,
+	LockoutThreshold:   6,
+	IPLockoutThreshold: 10,
+	LockoutDuration:    15 * time.Minute,
+	ResetAfter:         time.Hour,
+}
+
+// newTestThrottle returns a throttle whose clock is moved by advancing *clock
+func newTestThrottle() (*loginThrottleService, *fakeThrottleRepo, *fakeAuditRepo, *time.Time) {
+	repo := &fakeThrottleRepo{throttles: map[throttleKey]*models.LoginThrottle{}}
+	auditRepo := &fakeAuditRepo{}
+	service := NewLoginThrottleService(repo, NewAuditService(auditRepo, AuditOptions{}), testThrottleOptions).(*loginThrottleService)
+	clock := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return clock }
+	return service, repo, auditRepo, &clock
+}
+
+// throttled describes the result of Check: "" when the login may be attempted
+func throttled(err error) string {
+	var throttledErr *LoginThrottledError
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &throttledErr) && throttledErr.Locked:
+		return "locked " + throttledErr.RetryAfter.String()
+	case errors.As(err, &throttledErr):
+		return "wait " + throttledErr.RetryAfter.String()
+	default:
+		return err.Error()
+	}
+}
+
+func TestLoginThrottleDelay(t *testing.T) {
+	service, _, _, _ := newTestThrottle()
+	want := []time.Duration{0, 0, 0, 0, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second, 8 * time.Second}
+	for failures, delay := range want {
+		if got := service.delay(failures); got != delay {
+			t.Errorf("delay(%d) = %s, want %s", failures, got, delay)
+		}
+	}
+}
+
+func TestLoginThrottleDelaysThenLocksOutUsername(t *testing.T) {
+	service, _, auditRepo, clock := newTestThrottle()
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		fail    bool
+		want    string
+	}{
+		{"first failure", 0, true, ""},
+		{"second failure", 0, true, ""},
+		{"last free failure", 0, true, ""},
+		{"first delayed failure", 0, true, "wait 1s"},
+		{"during the delay", 500 * time.Millisecond, false, "wait 500ms"},
+		{"after the delay", 500 * time.Millisecond, false, ""},
+		{"delay doubles", 0, true, "wait 2s"},
+		{"lockout threshold", 2 * time.Second, true, "locked 15m0s"},
+		{"during the lockout", 10 * time.Minute, false, "locked 5m0s"},
+		{"lockout over", 5 * time.Minute, false, ""},
+		{"next failure locks again", 0, true, "locked 15m0s"},
+		{"failures forgotten", time.Hour + time.Second, false, ""},
+		{"counting starts again", 0, true, ""},
+	}
+
+	for _, step := range steps {
+		*clock = clock.Add(step.advance)
+		if step.fail {
+			if err := service.RecordFailure(" Ada ", ""); err != nil {
+				t.Fatalf("%s: RecordFailure: %v", step.name, err)
+			}
+		}
+		if got := throttled(service.Check("ada", "")); got != step.want {
+			t.Errorf("%s: Check = %q, want %q", step.name, got, step.want)
+		}
+	}
+
+	if len(auditRepo.events) != 2 {
+		t.Fatalf("%d audit events, want the two lockouts", len(auditRepo.events))
+	}
+	for _, event := range auditRepo.events {
+		if event.Type != models.AuditLoginLocked || event.Target != "ada" {
+			t.Errorf("audit event %s of %s, want a lockout of ada", event.Type, event.Target)
+		}
+	}
+}
+
+func TestLoginThrottleLocksOutIP(t *testing.T) {
+	service, _, _, clock := newTestThrottle()
+
+	// Guessing at many accounts from one address locks the address out
+	for i := 0; i < testThrottleOptions.IPLockoutThreshold; i++ {
+		if err := service.RecordFailure(fmt.Sprintf("user%d", i), "203.0.113.9"); err != nil {
+			t.Fatalf("RecordFailure: %v", err)
+		}
+	}
+	if got := throttled(service.Check("grace", "203.0.113.9")); got != "locked 15m0s" {
+		t.Errorf("other user from the address: Check = %q, want locked", got)
+	}
+	if got := throttled(service.Check("user0", "198.51.100.1")); got != "" {
+		t.Errorf("a guessed user from elsewhere: Check = %q, want allowed", got)
+	}
+
+	// A successful login does not clear the address, only the username
+	if err := service.RecordSuccess("user0"); err != nil {
+		t.Fatalf("RecordSuccess: %v", err)
+	}
+	*clock = clock.Add(time.Minute)
+	if got := throttled(service.Check("user0", "203.0.113.9")); got != "locked 14m0s" {
+		t.Errorf("after a success: Check = %q, want the address still locked", got)
+	}
+}
+
+func TestLoginThrottleUnlock(t *testing.T) {
+	service, repo, _, _ := newTestThrottle()
+
+	for i := 0; i < testThrottleOptions.LockoutThreshold; i++ {
+		if err := service.RecordFailure("Ada", "203.0.113.9"); err != nil {
+			t.Fatalf("RecordFailure: %v", err)
+		}
+	}
+	lockouts, err := service.ListLockouts()
+	if err != nil || len(lockouts) != 1 || lockouts[0].Value != "ada" {
+		t.Fatalf("ListLockouts = %+v, %v; want ada", lockouts, err)
+	}
+
+	if err := service.Unlock(models.ThrottleUsername, "ADA"); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if got := throttled(service.Check("ada", "")); got != "" {
+		t.Errorf("after unlocking: Check = %q, want allowed", got)
+	}
+	if _, ok := repo.throttles[throttleKey{models.ThrottleIP, "203.0.113.9"}]; !ok {
+		t.Error("unlocking the username forgot the failures from the address")
+	}
+	if lockouts, _ := service.ListLockouts(); len(lockouts) != 0 {
+		t.Errorf("lockouts after unlocking: %+v", lockouts)
+	}
+}
@@ -0,0 +1,156 @@
+// internal/services/mda_service.go
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/repositories"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrMDANotFound is returned when no MDA has the requested code
+	ErrMDANotFound = errors.New("MDA not found")
+	// ErrMDAExists is returned when creating an MDA whose code, in any case, is taken
+	ErrMDAExists = errors.New("MDA code already in use")
+	// ErrMDAUserLimit is returned when an MDA already has as many users as it may
+	ErrMDAUserLimit = errors.New("MDA has reached its user limit")
+	// ErrQuotaExceeded is returned when an MDA has used up its daily request quota
+	ErrQuotaExceeded = errors.New("daily request quota exceeded")
+)
+
+// mdaCodePattern is the format of MDA codes once upper-cased
+var mdaCodePattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9_-]*$`)
+
+// MDAService interface defines tenant management and quota operations
+type MDAService interface {
+	CreateMDA(mda *models.MDA) (*models.MDA, error)
+	UpdateMDA(code string, settings *models.MDA) (*models.MDA, error)
+	GetMDA(code string) (*models.MDA, error)
+	ListMDAs() ([]models.MDA, error)
+	ConsumeRequest(code string) error
+}
+
+type mdaService struct {
+	repo repositories.MDARepository
+
+	// Request counters for the current UTC day, kept in memory per process
+	usageMu  sync.Mutex
+	usageDay string
+	usage    map[string]int
+}
+
+// NewMDAService creates a new instance of MDAService
+func NewMDAService(repo repositories.MDARepository) MDAService {
+	return &mdaService{repo: repo, usage: make(map[string]int)}
+}
+
+// CreateMDA validates and stores a new MDA
+func (s *mdaService) CreateMDA(mda *models.MDA) (*models.MDA, error) {
+	// Codes are kept in upper case so that no two MDAs share a rate source (see MDA.SourceCode)
+	mda.Code = strings.ToUpper(strings.TrimSpace(mda.Code))
+	if mda.Code == "" || mda.Name == "" {
+		return nil, errors.New("MDA code and name are required")
+	}
+	if !mdaCodePattern.MatchString(mda.Code) {
+		return nil, errors.New("MDA code may only contain letters, digits, '-' and '_'")
+	}
+	if _, err := s.repo.FindMDAByCode(mda.Code); err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrMDAExists, mda.Code)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to look up MDA: %v", err)
+	}
+	normalizeMDASettings(mda)
+
+	if err := s.repo.CreateMDA(mda); err != nil {
+		return nil, fmt.Errorf("failed to create MDA: %v", err)
+	}
+	return mda, nil
+}
+
+// UpdateMDA replaces the name and settings of an existing MDA; the code cannot change
+func (s *mdaService) UpdateMDA(code string, settings *models.MDA) (*models.MDA, error) {
+	mda, err := s.GetMDA(code)
+	if err != nil {
+		return nil, err
+	}
+
+	if settings.Name != "" {
+		mda.Name = settings.Name
+	}
+	mda.AllowedCurrencies = settings.AllowedCurrencies
+	mda.PreferredSource = settings.PreferredSource
+	mda.DefaultBaseCurrency = settings.DefaultBaseCurrency
+	mda.MaxUsers = settings.MaxUsers
+	mda.DailyRequestQuota = settings.DailyRequestQuota
+	normalizeMDASettings(mda)
+
+	if err := s.repo.UpdateMDA(mda); err != nil {
+		return nil, fmt.Errorf("failed to update MDA: %v", err)
+	}
+	return mda, nil
+}
+
+// GetMDA retrieves an MDA by its code
+func (s *mdaService) GetMDA(code string) (*models.MDA, error) {
+	mda, err := s.repo.FindMDAByCode(code)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrMDANotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up MDA: %v", err)
+	}
+	return mda, nil
+}
+
+// ListMDAs retrieves every MDA
+func (s *mdaService) ListMDAs() ([]models.MDA, error) {
+	return s.repo.ListMDAs()
+}
+
+// ConsumeRequest counts one API request against the MDA's daily quota, returning
+// ErrQuotaExceeded once the quota is used up. Users without a registered MDA are not
+// limited here; requests needing the MDA reject them when they load it.
+func (s *mdaService) ConsumeRequest(code string) error {
+	if code == "" {
+		return nil
+	}
+	mda, err := s.GetMDA(code)
+	if errors.Is(err, ErrMDANotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if mda.DailyRequestQuota <= 0 {
+		return nil
+	}
+
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+
+	if today := time.Now().UTC().Format("2006-01-02"); today != s.usageDay {
+		s.usageDay = today
+		s.usage = make(map[string]int)
+	}
+	if s.usage[code] >= mda.DailyRequestQuota {
+		return ErrQuotaExceeded
+	}
+	s.usage[code]++
+	return nil
+}
+
+// normalizeMDASettings upper-cases currency codes so they match stored currencies
+func normalizeMDASettings(mda *models.MDA) {
+	for i, code := range mda.AllowedCurrencies {
+		mda.AllowedCurrencies[i] = strings.ToUpper(strings.TrimSpace(code))
+	}
+	mda.DefaultBaseCurrency = strings.ToUpper(mda.DefaultBaseCurrency)
+}
@@ -0,0 +1,523 @@
+// internal/services/mfa_service.go
+
+package services
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/repositories"
+	"github.com/abduls21985/exchange-rate-service/internal/utils"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidMFACode is returned when a TOTP or recovery code is wrong, expired or
+	// has already been used
+	ErrInvalidMFACode = errors.New("invalid authentication code")
+	// ErrInvalidMFAChallenge is returned when a login challenge token is unknown, expired
+	// or has had too many wrong codes
+	ErrInvalidMFAChallenge = errors.New("invalid or expired MFA token")
+	// ErrMFAAlreadyEnabled is returned when enrolling a user who already has a second factor
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrMFANotEnabled is returned when an operation needs a confirmed second factor
+	ErrMFANotEnabled = errors.New("two-factor authentication is not enabled")
+	// ErrMFANotEnrolling is returned when confirming an enrollment that was not started
+	ErrMFANotEnrolling = errors.New("no two-factor enrollment is pending")
+	// ErrMFARequired is returned when disabling a second factor the user's role requires
+	ErrMFARequired = errors.New("two-factor authentication is required for this account")
+)
+
+const (
+	// totpPeriod is the lifetime in seconds of one TOTP code
+	totpPeriod = 30
+	// totpSkew is the number of periods either side of now whose codes are accepted, to
+	// allow for clock drift
+	totpSkew = 1
+)
+
+// totpOptions are the parameters understood by common authenticator apps
+var totpOptions = totp.ValidateOpts{Period: totpPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1}
+
+// MFAOptions configures two-factor authentication
+type MFAOptions struct {
+	// Issuer is the name authenticator apps show for the account
+	Issuer string
+	// RequiredRoles are the roles that need a second factor unless an admin has set a
+	// policy for the role
+	RequiredRoles []models.Role
+	// ChallengeTTL is how long the second step of a login may take
+	ChallengeTTL time.Duration
+	// MaxChallengeAttempts is the number of wrong codes after which a challenge is void
+	MaxChallengeAttempts int
+	// RecoveryCodeCount is the number of recovery codes issued at a time
+	RecoveryCodeCount int
+}
+
+// MFAOptionsFromConfig reads MFAOptions from the application configuration
+func MFAOptionsFromConfig() (MFAOptions, error) {
+	options := MFAOptions{
+		Issuer:               viper.GetString("auth.mfa.issuer"),
+		ChallengeTTL:         viper.GetDuration("auth.mfa.challenge_ttl"),
+		MaxChallengeAttempts: viper.GetInt("auth.mfa.max_challenge_attempts"),
+		RecoveryCodeCount:    viper.GetInt("auth.mfa.recovery_codes"),
+	}
+	for _, value := range viper.GetStringSlice("auth.mfa.required_roles") {
+		role, err := models.ParseRole(value)
+		if err != nil {
+			return options, fmt.Errorf("invalid auth.mfa.required_roles: %v", err)
+		}
+		options.RequiredRoles = append(options.RequiredRoles, role)
+	}
+	if !viper.IsSet("auth.mfa.required_roles") {
+		options.RequiredRoles = []models.Role{models.RoleRatePublisher, models.RoleAdmin}
+	}
+	if options.Issuer == "" {
+		options.Issuer = viper.GetString("notifications.app_name")
+	}
+	if options.Issuer == "" {
+		options.Issuer = "Exchange Rate Service"
+	}
+	if options.ChallengeTTL <= 0 {
+		options.ChallengeTTL = 5 * time.Minute
+	}
+	if options.MaxChallengeAttempts <= 0 {
+		options.MaxChallengeAttempts = 5
+	}
+	if options.RecoveryCodeCount <= 0 {
+		options.RecoveryCodeCount = 10
+	}
+	return options, nil
+}
+
+// MFAVerification describes how a login challenge was completed
+type MFAVerification struct {
+	// RecoveryCodeUsed is set when a recovery code stood in for a TOTP code
+	RecoveryCodeUsed bool
+	// RecoveryCodes are issued when the challenge also confirmed an enrollment
+	RecoveryCodes []string
+}
+
+// MFAService interface defines TOTP two-factor authentication. Users enroll an
+// authenticator app and confirm it with a code, which also issues one-time recovery
+// codes. Owners and users whose role requires it must complete a challenge after their
+// password to log in.
+type MFAService interface {
+	Status(user *models.User) (*models.MFAStatus, error)
+	IsRequired(user *models.User) (bool, error)
+	ChallengeNeeded(user *models.User) (bool, error)
+	BeginEnrollment(user *models.User) (*models.MFAEnrollment, error)
+	ConfirmEnrollment(user *models.User, code string) ([]string, error)
+	RegenerateRecoveryCodes(user *models.User, code string) ([]string, error)
+	Disable(user *models.User, code string) error
+	Reset(user *models.User) error
+	CreateChallenge(user *models.User, userAgent, ipAddress string) (*models.MFAChallengeResponse, error)
+	EnrollWithChallenge(token string) (*models.MFAEnrollment, error)
+	CompleteChallenge(token, code string) (*models.User, *MFAVerification, error)
+	ListPolicies() ([]models.MFAPolicy, error)
+	SetPolicy(role models.Role, required bool) (*models.MFAPolicy, error)
+}
+
+type mfaService struct {
+	repo     repositories.MFARepository
+	userRepo repositories.UserRepository
+	options  MFAOptions
+	now      func() time.Time // Replaced in tests to check codes at a fixed time
+}
+
+// NewMFAService creates a new instance of MFAService
+func NewMFAService(repo repositories.MFARepository, userRepo repositories.UserRepository, options MFAOptions) MFAService {
+	return &mfaService{repo, userRepo, options, time.Now}
+}
+
+// Status summarises the user's second factor
+func (s *mfaService) Status(user *models.User) (*models.MFAStatus, error) {
+	required, err := s.IsRequired(user)
+	if err != nil {
+		return nil, err
+	}
+	remaining, err := s.repo.CountRecoveryCodes(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count recovery codes: %v", err)
+	}
+	return &models.MFAStatus{
+		Enabled:                user.MFAEnabled,
+		Required:               required,
+		EnabledAt:              user.MFAEnabledAt,
+		Enrolling:              user.MFAPendingSecret != "",
+		RecoveryCodesRemaining: remaining,
+	}, nil
+}
+
+// IsRequired reports whether the user must log in with a second factor: owners always
+// must, other users when their role's policy says so
+func (s *mfaService) IsRequired(user *models.User) (bool, error) {
+	if user.IsOwner {
+		return true, nil
+	}
+	return s.roleRequired(user.Role)
+}
+
+// ChallengeNeeded reports whether a login by the user needs a second step, because
+// they have enrolled or are required to
+func (s *mfaService) ChallengeNeeded(user *models.User) (bool, error) {
+	if user.MFAEnabled {
+		return true, nil
+	}
+	return s.IsRequired(user)
+}
+
+// BeginEnrollment generates a new TOTP secret for the user, to be confirmed with a code
+// from their authenticator app. Starting again replaces an unconfirmed secret.
+func (s *mfaService) BeginEnrollment(user *models.User) (*models.MFAEnrollment, error) {
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      s.options.Issuer,
+		AccountName: user.Username,
+		Period:      totpPeriod,
+		Digits:      totpOptions.Digits,
+		Algorithm:   totpOptions.Algorithm,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate TOTP secret: %v", err)
+	}
+
+	user.MFAPendingSecret = key.Secret()
+	user.UpdatedAt = s.now()
+	if err := s.userRepo.UpdateUser(user); err != nil {
+		return nil, fmt.Errorf("failed to save TOTP secret: %v", err)
+	}
+
+	return &models.MFAEnrollment{Secret: key.Secret(), URI: key.URL()}, nil
+}
+
+// ConfirmEnrollment enables the pending TOTP secret once the user proves their app
+// produces its codes, and returns a fresh set of recovery codes
+func (s *mfaService) ConfirmEnrollment(user *models.User, code string) ([]string, error) {
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.MFAPendingSecret == "" {
+		return nil, ErrMFANotEnrolling
+	}
+
+	if err := s.verifyTOTP(user, user.MFAPendingSecret, code); err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	user.MFAEnabled = true
+	user.MFASecret = user.MFAPendingSecret
+	user.MFAPendingSecret = ""
+	user.MFAEnabledAt = &now
+	user.UpdatedAt = now
+	if err := s.userRepo.UpdateUser(user); err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %v", err)
+	}
+
+	return s.issueRecoveryCodes(user)
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking a code
+func (s *mfaService) RegenerateRecoveryCodes(user *models.User, code string) ([]string, error) {
+	if !user.MFAEnabled {
+		return nil, ErrMFANotEnabled
+	}
+	if _, err := s.verify(user, code); err != nil {
+		return nil, err
+	}
+	return s.issueRecoveryCodes(user)
+}
+
+// Disable removes the user's second factor after checking a code. Users who are
+// required to use one cannot remove it; an admin can reset it instead.
+func (s *mfaService) Disable(user *models.User, code string) error {
+	if !user.MFAEnabled {
+		return ErrMFANotEnabled
+	}
+	required, err := s.IsRequired(user)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrMFARequired
+	}
+	if _, err := s.verify(user, code); err != nil {
+		return err
+	}
+	return s.Reset(user)
+}
+
+// Reset removes the user's second factor and recovery codes without a code, for users
+// who have lost their device. Users who are required to use one must enroll again at
+// their next login.
+func (s *mfaService) Reset(user *models.User) error {
+	user.MFAEnabled = false
+	user.MFASecret = ""
+	user.MFAPendingSecret = ""
+	user.MFAEnabledAt = nil
+	user.UpdatedAt = s.now()
+	if err := s.userRepo.UpdateUser(user); err != nil {
+		return fmt.Errorf("failed to disable two-factor authentication: %v", err)
+	}
+	if err := s.repo.DeleteRecoveryCodes(user.ID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %v", err)
+	}
+	return nil
+}
+
+// CreateChallenge starts the second step of a login whose password has been checked
+func (s *mfaService) CreateChallenge(user *models.User, userAgent, ipAddress string) (*models.MFAChallengeResponse, error) {
+	token, err := utils.NewToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	challenge := &models.MFAChallenge{
+		TokenHash: utils.HashToken(token),
+		UserID:    user.ID,
+		UserAgent: truncate(userAgent, 255),
+		IPAddress: ipAddress,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.options.ChallengeTTL),
+	}
+	if err := s.repo.CreateChallenge(challenge); err != nil {
+		return nil, fmt.Errorf("failed to create MFA challenge: %v", err)
+	}
+
+	// Best effort: a failure only leaves some stale rows behind
+	if err := s.repo.DeleteExpiredChallenges(now); err != nil {
+		log.Printf("Failed to purge expired MFA challenges: %v", err)
+	}
+
+	return &models.MFAChallengeResponse{
+		MFAToken:           token,
+		ExpiresAt:          challenge.ExpiresAt,
+		EnrollmentRequired: !user.MFAEnabled,
+	}, nil
+}
+
+// EnrollWithChallenge begins enrollment for a user whose login is waiting on a second
+// factor they do not have yet; the challenge is then completed by confirming it
+func (s *mfaService) EnrollWithChallenge(token string) (*models.MFAEnrollment, error) {
+	_, user, err := s.findChallenge(token)
+	if err != nil {
+		return nil, err
+	}
+	return s.BeginEnrollment(user)
+}
+
+// CompleteChallenge checks a TOTP or recovery code against a login challenge, or
+// confirms a pending enrollment with a TOTP code, and consumes the challenge. A wrong
+// code also returns the user, so that the failure can be attributed.
+func (s *mfaService) CompleteChallenge(token, code string) (*models.User, *MFAVerification, error) {
+	challenge, user, err := s.findChallenge(token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	verification := &MFAVerification{}
+	if user.MFAEnabled {
+		verification.RecoveryCodeUsed, err = s.verify(user, code)
+	} else {
+		verification.RecoveryCodes, err = s.ConfirmEnrollment(user, code)
+	}
+	if errors.Is(err, ErrInvalidMFACode) {
+		if err := s.repo.CountChallengeAttempt(challenge.ID); err != nil {
+			log.Printf("Failed to count MFA attempt: %v", err)
+		}
+		return user, nil, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	deleted, err := s.repo.DeleteChallenge(challenge.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to consume MFA challenge: %v", err)
+	}
+	if !deleted {
+		return nil, nil, ErrInvalidMFAChallenge
+	}
+	return user, verification, nil
+}
+
+// ListPolicies returns the MFA policy of every role, including configured defaults
+func (s *mfaService) ListPolicies() ([]models.MFAPolicy, error) {
+	stored, err := s.repo.ListPolicies()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list MFA policies: %v", err)
+	}
+	byRole := make(map[models.Role]models.MFAPolicy, len(stored))
+	for _, policy := range stored {
+		byRole[policy.Role] = policy
+	}
+
+	policies := make([]models.MFAPolicy, 0, len(models.Roles))
+	for _, role := range models.Roles {
+		policy, ok := byRole[role]
+		if !ok {
+			policy = models.MFAPolicy{Role: role, Required: s.defaultRequired(role)}
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// SetPolicy sets whether users with the role must use a second factor
+func (s *mfaService) SetPolicy(role models.Role, required bool) (*models.MFAPolicy, error) {
+	policy := &models.MFAPolicy{Role: role, Required: required, UpdatedAt: s.now()}
+	if err := s.repo.SavePolicy(policy); err != nil {
+		return nil, fmt.Errorf("failed to save MFA policy: %v", err)
+	}
+	return policy, nil
+}
+
+// findChallenge looks up an unexpired challenge and its user
+func (s *mfaService) findChallenge(token string) (*models.MFAChallenge, *models.User, error) {
+	if token == "" {
+		return nil, nil, ErrInvalidMFAChallenge
+	}
+
+	challenge, err := s.repo.FindChallengeByTokenHash(utils.HashToken(token))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrInvalidMFAChallenge
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to look up MFA challenge: %v", err)
+	}
+	if !s.now().Before(challenge.ExpiresAt) || challenge.Attempts >= s.options.MaxChallengeAttempts {
+		return nil, nil, ErrInvalidMFAChallenge
+	}
+
+	user, err := s.userRepo.FindUserByID(challenge.UserID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrInvalidMFAChallenge
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to look up user: %v", err)
+	}
+	if !user.Active {
+		return nil, nil, ErrUserInactive
+	}
+	return challenge, user, nil
+}
+
+// verify checks a TOTP code, or failing that a recovery code, against the user's
+// confirmed secret and reports whether a recovery code was used
+func (s *mfaService) verify(user *models.User, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if isTOTPCode(code) {
+		return false, s.verifyTOTP(user, user.MFASecret, code)
+	}
+
+	used, err := s.repo.UseRecoveryCode(user.ID, utils.HashToken(normalizeRecoveryCode(code)), s.now())
+	if err != nil {
+		return false, fmt.Errorf("failed to check recovery code: %v", err)
+	}
+	if !used {
+		return false, ErrInvalidMFACode
+	}
+	return true, nil
+}
+
+// verifyTOTP checks a TOTP code for the secret. A code is accepted once: its time step
+// must be later than the last one the user presented.
+func (s *mfaService) verifyTOTP(user *models.User, secret, code string) error {
+	code = strings.TrimSpace(code)
+	now := s.now().Unix()
+	for offset := -totpSkew; offset <= totpSkew; offset++ {
+		step := now/totpPeriod + int64(offset)
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(step*totpPeriod, 0), totpOptions)
+		if err != nil {
+			return fmt.Errorf("failed to generate TOTP code: %v", err)
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) != 1 {
+			continue
+		}
+
+		accepted, err := s.repo.AcceptStep(user.ID, step)
+		if err != nil {
+			return fmt.Errorf("failed to record TOTP code: %v", err)
+		}
+		if !accepted {
+			return ErrInvalidMFACode
+		}
+		user.MFALastStep = step
+		return nil
+	}
+	return ErrInvalidMFACode
+}
+
+// issueRecoveryCodes replaces the user's recovery codes and returns the new ones, which
+// cannot be shown again
+func (s *mfaService) issueRecoveryCodes(user *models.User) ([]string, error) {
+	codes := make([]string, 0, s.options.RecoveryCodeCount)
+	hashes := make([]string, 0, s.options.RecoveryCodeCount)
+	for i := 0; i < s.options.RecoveryCodeCount; i++ {
+		raw, err := utils.NewToken(5)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, utils.HashToken(raw))
+	}
+
+	if err := s.repo.ReplaceRecoveryCodes(user.ID, hashes); err != nil {
+		return nil, fmt.Errorf("failed to save recovery codes: %v", err)
+	}
+	return codes, nil
+}
+
+// roleRequired looks up the policy of the role, falling back to the configured default
+func (s *mfaService) roleRequired(role models.Role) (bool, error) {
+	policy, err := s.repo.FindPolicy(role)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return s.defaultRequired(role), nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to look up MFA policy: %v", err)
+	}
+	return policy.Required, nil
+}
+
+// defaultRequired reports whether the role needs a second factor when no policy is stored
+func (s *mfaService) defaultRequired(role models.Role) bool {
+	for _, required := range s.options.RequiredRoles {
+		if required == role {
+			return true
+		}
+	}
+	return false
+}
+
+// isTOTPCode reports whether the code has the shape of a TOTP code rather than a
+// recovery code
+func isTOTPCode(code string) bool {
+	if len(code) != int(totpOptions.Digits) {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeRecoveryCode strips the separator and case users may type a recovery code with
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
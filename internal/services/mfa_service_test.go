@@ -0,0 +1,290 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+	"gorm.io/gorm"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/repositories"
+)
+
+const testTOTPSecret = "JBSWY3DPEHPK3PXP"
+
+// testClock is the fixed time the MFA tests check codes at, in the middle of a step
+var testClock = time.Unix(1700000010, 0)
+
+type fakeMFARepo struct {
+	repositories.MFARepository
+	lastStep   map[uint]int64
+	recovery   map[string]bool
+	challenges map[string]*models.MFAChallenge
+}
+
+func newFakeMFARepo() *fakeMFARepo {
+	return &fakeMFARepo{
+		lastStep:   map[uint]int64{},
+		recovery:   map[string]bool{},
+		challenges: map[string]*models.MFAChallenge{},
+	}
+}
+
+func (r *fakeMFARepo) AcceptStep(userID uint, step int64) (bool, error) {
+	if r.lastStep[userID] >= step {
+		return false, nil
+	}
+	r.lastStep[userID] = step
+	return true, nil
+}
+
+func (r *fakeMFARepo) ReplaceRecoveryCodes(_ uint, hashes []string) error {
+	r.recovery = map[string]bool{}
+	for _, hash := range hashes {
+		r.recovery[hash] = true
+	}
+	return nil
+}
+
+func (r *fakeMFARepo) UseRecoveryCode(_ uint, hash string, _ time.Time) (bool, error) {
+	if !r.recovery[hash] {
+		return false, nil
+	}
+	delete(r.recovery, hash)
+	return true, nil
+}
+
+func (r *fakeMFARepo) CreateChallenge(challenge *models.MFAChallenge) error {
+	challenge.ID = uint(len(r.challenges) + 1)
+	r.challenges[challenge.TokenHash] = challenge
+	return nil
+}
+
+func (r *fakeMFARepo) FindChallengeByTokenHash(hash string) (*models.MFAChallenge, error) {
+	challenge, ok := r.challenges[hash]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	found := *challenge
+	return &found, nil
+}
+
+func (r *fakeMFARepo) CountChallengeAttempt(id uint) error {
+	for _, challenge := range r.challenges {
+		if challenge.ID == id {
+			challenge.Attempts++
+		}
+	}
+	return nil
+}
+
+func (r *fakeMFARepo) DeleteChallenge(id uint) (bool, error) {
+	for hash, challenge := range r.challenges {
+		if challenge.ID == id {
+			delete(r.challenges, hash)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *fakeMFARepo) DeleteExpiredChallenges(time.Time) error {
+	return nil
+}
+
+type fakeMFAUsers struct {
+	repositories.UserRepository
+	user *models.User
+}
+
+func (u *fakeMFAUsers) FindUserByID(uint) (*models.User, error) {
+	return u.user, nil
+}
+
+func newTestMFAService(t *testing.T) (*mfaService, *fakeMFARepo, *models.User) {
+	t.Helper()
+	user := &models.User{ID: 1, Username: "ada", Active: true, MFAEnabled: true, MFASecret: testTOTPSecret}
+	repo := newFakeMFARepo()
+	service := NewMFAService(repo, &fakeMFAUsers{user: user}, MFAOptions{
+		ChallengeTTL:         5 * time.Minute,
+		MaxChallengeAttempts: 3,
+		RecoveryCodeCount:    4,
+	}).(*mfaService)
+	service.now = func() time.Time { return testClock }
+	return service, repo, user
+}
+
+// codeAt returns the TOTP code of the test secret at the time
+func codeAt(t *testing.T, at time.Time) string {
+	t.Helper()
+	code, err := totp.GenerateCodeCustom(testTOTPSecret, at, totpOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestVerifyTOTPAcceptsOneStepOfSkew(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset time.Duration
+		valid  bool
+	}{
+		{"two steps behind", -2 * totpPeriod * time.Second, false},
+		{"one step behind", -totpPeriod * time.Second, true},
+		{"current step", 0, true},
+		{"one step ahead", totpPeriod * time.Second, true},
+		{"two steps ahead", 2 * totpPeriod * time.Second, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, _, user := newTestMFAService(t)
+			_, err := service.verify(user, codeAt(t, testClock.Add(tt.offset)))
+			if tt.valid && err != nil {
+				t.Errorf("err = %v, want the code accepted", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidMFACode) {
+				t.Errorf("err = %v, want ErrInvalidMFACode", err)
+			}
+		})
+	}
+}
+
+func TestVerifyTOTPRejectsReplayedSteps(t *testing.T) {
+	step := time.Duration(totpPeriod) * time.Second
+	tests := []struct {
+		name   string
+		first  time.Duration // Offset of the code accepted first
+		second time.Duration // Offset of the code presented next
+		valid  bool
+	}{
+		{"same code again", 0, 0, false},
+		{"earlier code within skew", 0, -step, false},
+		{"later code within skew", 0, step, true},
+		{"code of the step before the one used", step, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, repo, user := newTestMFAService(t)
+			if _, err := service.verify(user, codeAt(t, testClock.Add(tt.first))); err != nil {
+				t.Fatalf("first code: %v", err)
+			}
+			accepted := repo.lastStep[user.ID]
+
+			_, err := service.verify(user, codeAt(t, testClock.Add(tt.second)))
+			if tt.valid && err != nil {
+				t.Errorf("err = %v, want the code accepted", err)
+			}
+			if !tt.valid {
+				if !errors.Is(err, ErrInvalidMFACode) {
+					t.Errorf("err = %v, want ErrInvalidMFACode", err)
+				}
+				if repo.lastStep[user.ID] != accepted {
+					t.Errorf("last step moved from %d to %d on a rejected code", accepted, repo.lastStep[user.ID])
+				}
+			}
+		})
+	}
+}
+
+func TestRecoveryCodesAreUsedOnce(t *testing.T) {
+	service, repo, user := newTestMFAService(t)
+	codes, err := service.issueRecoveryCodes(user)
+	if err != nil {
+		t.Fatalf("issueRecoveryCodes: %v", err)
+	}
+	if len(codes) != 4 || len(repo.recovery) != 4 {
+		t.Fatalf("issued %d codes, stored %d; want 4", len(codes), len(repo.recovery))
+	}
+
+	tests := []struct {
+		name  string
+		code  string
+		valid bool
+	}{
+		{"as issued", codes[0], true},
+		{"already used", codes[0], false},
+		{"upper case without separator", strings.ToUpper(strings.ReplaceAll(codes[1], "-", "")), true},
+		{"surrounded by spaces", "  " + codes[2] + " ", true},
+		{"unknown", "zzzzz-zzzzz", false},
+	}
+	for _, tt := range tests {
+		used, err := service.verify(user, tt.code)
+		if tt.valid && (err != nil || !used) {
+			t.Errorf("%s: used %v, err %v; want the recovery code accepted", tt.name, used, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidMFACode) {
+			t.Errorf("%s: err = %v, want ErrInvalidMFACode", tt.name, err)
+		}
+	}
+	if len(repo.recovery) != 1 {
+		t.Errorf("%d recovery codes left, want 1", len(repo.recovery))
+	}
+}
+
+func TestCompleteChallengeLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		wrongCodes  int
+		elapsed     time.Duration
+		wantErr     error
+		recoveryUse bool
+	}{
+		{name: "correct code", wrongCodes: 0},
+		{name: "correct after wrong codes", wrongCodes: 2},
+		{name: "too many wrong codes", wrongCodes: 3, wantErr: ErrInvalidMFAChallenge},
+		{name: "expired", elapsed: 5 * time.Minute, wantErr: ErrInvalidMFAChallenge},
+		{name: "recovery code", recoveryUse: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, repo, user := newTestMFAService(t)
+			challenge, err := service.CreateChallenge(user, "agent", "10.0.0.1")
+			if err != nil {
+				t.Fatalf("CreateChallenge: %v", err)
+			}
+
+			for i := 0; i < tt.wrongCodes; i++ {
+				if _, _, err := service.CompleteChallenge(challenge.MFAToken, "000000"); !errors.Is(err, ErrInvalidMFACode) {
+					t.Fatalf("wrong code %d: err = %v, want ErrInvalidMFACode", i+1, err)
+				}
+			}
+
+			service.now = func() time.Time { return testClock.Add(tt.elapsed) }
+			code := codeAt(t, testClock)
+			if tt.recoveryUse {
+				codes, err := service.issueRecoveryCodes(user)
+				if err != nil {
+					t.Fatal(err)
+				}
+				code = codes[0]
+			}
+
+			_, verification, err := service.CompleteChallenge(challenge.MFAToken, code)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CompleteChallenge: %v", err)
+			}
+			if verification.RecoveryCodeUsed != tt.recoveryUse {
+				t.Errorf("recovery code used = %v, want %v", verification.RecoveryCodeUsed, tt.recoveryUse)
+			}
+			if len(repo.challenges) != 0 {
+				t.Error("completed challenge was not consumed")
+			}
+			if _, _, err := service.CompleteChallenge(challenge.MFAToken, code); !errors.Is(err, ErrInvalidMFAChallenge) {
+				t.Errorf("second completion: err = %v, want ErrInvalidMFAChallenge", err)
+			}
+		})
+	}
+}
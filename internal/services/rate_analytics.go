@@ -0,0 +1,263 @@
+// internal/services/rate_analytics.go
+
+package services
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+)
+
+// ErrInvalidDateRange is returned when a series is requested for a range that ends
+// before it starts or spans more than maxSeriesDays
+var ErrInvalidDateRange = errors.New("invalid date range")
+
+const (
+	// maxSeriesDays bounds the range of a single series request
+	maxSeriesDays = 3660
+	// analyticsPlaces is the number of decimal places of computed rates
+	analyticsPlaces = 12
+	// percentPlaces is the number of decimal places of percentages
+	percentPlaces = 4
+)
+
+// PairSeries is the rate of a currency pair in every snapshot of one source published
+// between two dates, oldest first
+type PairSeries struct {
+	Base      string
+	Quote     string
+	Source    string
+	Side      models.RateSide
+	StartDate time.Time // First day of the range
+	EndDate   time.Time // Last day of the range, inclusive
+	Points    []models.RatePoint
+}
+
+// seriesSnapshot holds the rates of one snapshot of a series, keyed by currency code.
+// The snapshot's own base currency, which has no rate row, is included at one unit.
+type seriesSnapshot struct {
+	id        uint
+	timestamp time.Time
+	base      string
+	rates     map[string]decimal.Decimal
+}
+
+// groupSeriesRates groups rates ordered by timestamp and snapshot into snapshots. When
+// the rates come from several sources only those of the most recently published one are
+// kept, so that a series never mixes providers; its code is returned.
+func groupSeriesRates(rates []models.ExchangeRate, side models.RateSide) ([]seriesSnapshot, string) {
+	if len(rates) == 0 {
+		return nil, ""
+	}
+	sourceID := rates[len(rates)-1].SourceID
+	source := rates[len(rates)-1].Source.Code
+
+	snapshots := make([]seriesSnapshot, 0)
+	for _, rate := range rates {
+		if rate.SourceID != sourceID {
+			continue
+		}
+		if n := len(snapshots); n == 0 || snapshots[n-1].id != rate.SnapshotID {
+			snapshots = append(snapshots, seriesSnapshot{
+				id:        rate.SnapshotID,
+				timestamp: rate.Timestamp,
+				base:      rate.BaseCurrency.Code,
+				rates:     map[string]decimal.Decimal{rate.BaseCurrency.Code: decimal.NewFromInt(1)},
+			})
+		}
+		snapshots[len(snapshots)-1].rates[rate.Currency.Code] = rate.RateFor(side)
+	}
+	return snapshots, source
+}
+
+// pairPoints computes the pair rate in each snapshot quoting both currencies
+func pairPoints(snapshots []seriesSnapshot, base, quote string) []models.RatePoint {
+	points := make([]models.RatePoint, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		baseRate, ok := snapshot.rates[base]
+		quoteRate, found := snapshot.rates[quote]
+		if !ok || !found || baseRate.IsZero() {
+			continue
+		}
+		points = append(points, models.RatePoint{
+			SnapshotID: snapshot.id,
+			Timestamp:  snapshot.timestamp,
+			Rate:       quoteRate.Div(baseRate).Round(analyticsPlaces),
+		})
+	}
+	return points
+}
+
+// Candles groups the series into periods of the interval, oldest first. Periods without
+// any published rate are left out.
+func (s *PairSeries) Candles(interval models.RateInterval) []models.Candle {
+	candles := make([]models.Candle, 0)
+	sums := make([]decimal.Decimal, 0)
+	for _, point := range s.Points {
+		start := interval.PeriodStart(point.Timestamp)
+		if n := len(candles); n == 0 || candles[n-1].Period != start.Format(dateLayout) {
+			candles = append(candles, models.Candle{
+				Period:    start.Format(dateLayout),
+				PeriodEnd: interval.PeriodEnd(start).AddDate(0, 0, -1).Format(dateLayout),
+				Open:      point.Rate,
+				High:      point.Rate,
+				Low:       point.Rate,
+			})
+			sums = append(sums, decimal.Zero)
+		}
+
+		n := len(candles) - 1
+		candle := &candles[n]
+		if point.Rate.GreaterThan(candle.High) {
+			candle.High = point.Rate
+		}
+		if point.Rate.LessThan(candle.Low) {
+			candle.Low = point.Rate
+		}
+		candle.Close = point.Rate
+		candle.Observations++
+		sums[n] = sums[n].Add(point.Rate)
+	}
+
+	for i := range candles {
+		candles[i].Average = sums[i].Div(decimal.NewFromInt(int64(candles[i].Observations))).Round(analyticsPlaces)
+	}
+	return candles
+}
+
+// Summary computes the change, averages, extremes and volatility of a series with at
+// least one point. The time-weighted average weighs each rate by how long it stood
+// before the next one, the last standing until the end of the range or now, whichever
+// comes first.
+func (s *PairSeries) Summary() models.RateSummary {
+	first, last := s.Points[0], s.Points[len(s.Points)-1]
+	summary := models.RateSummary{
+		Base:         s.Base,
+		Quote:        s.Quote,
+		Source:       s.Source,
+		Side:         s.Side,
+		StartDate:    s.StartDate.Format(dateLayout),
+		EndDate:      s.EndDate.Format(dateLayout),
+		Observations: len(s.Points),
+		Open:         first.Rate,
+		Close:        last.Rate,
+		Change:       last.Rate.Sub(first.Rate),
+		Min:          rateExtreme(first),
+		Max:          rateExtreme(first),
+	}
+	if !first.Rate.IsZero() {
+		summary.ChangePercent = summary.Change.Div(first.Rate).Mul(decimal.NewFromInt(100)).Round(percentPlaces)
+	}
+
+	end := s.EndDate.AddDate(0, 0, 1)
+	if now := time.Now().UTC(); now.Before(end) {
+		end = now
+	}
+
+	var sum, weighted decimal.Decimal
+	for i, point := range s.Points {
+		sum = sum.Add(point.Rate)
+		if point.Rate.LessThan(summary.Min.Rate) {
+			summary.Min = rateExtreme(point)
+		}
+		if point.Rate.GreaterThan(summary.Max.Rate) {
+			summary.Max = rateExtreme(point)
+		}
+
+		until := end
+		if i+1 < len(s.Points) {
+			until = s.Points[i+1].Timestamp
+		}
+		if until.After(point.Timestamp) {
+			weighted = weighted.Add(point.Rate.Mul(decimal.NewFromInt(int64(until.Sub(point.Timestamp) / time.Second))))
+		}
+	}
+	summary.Average = sum.Div(decimal.NewFromInt(int64(len(s.Points)))).Round(analyticsPlaces)
+
+	summary.TimeWeightedAverage = last.Rate
+	if seconds := int64(end.Sub(first.Timestamp) / time.Second); seconds > 0 {
+		summary.TimeWeightedAverage = weighted.Div(decimal.NewFromInt(seconds)).Round(analyticsPlaces)
+	}
+
+	if volatility, ok := logReturnDeviation(s.dailyCloses()); ok {
+		summary.Volatility = &volatility
+	}
+	return summary
+}
+
+// RollingVolatility computes, for each day with a rate, the volatility of the daily
+// closing rates over the window of returns ending on that day. Days are only reported
+// once window returns are available.
+func (s *PairSeries) RollingVolatility(window int) []models.VolatilityPoint {
+	closes := s.dailyCloses()
+	points := make([]models.VolatilityPoint, 0)
+	for end := window; end < len(closes); end++ {
+		volatility, ok := logReturnDeviation(closes[end-window : end+1])
+		if !ok {
+			continue
+		}
+		points = append(points, models.VolatilityPoint{
+			Date:       closes[end].Timestamp.UTC().Format(dateLayout),
+			Close:      closes[end].Rate,
+			Volatility: volatility,
+		})
+	}
+	return points
+}
+
+// dailyCloses returns the last point of each day with a rate
+func (s *PairSeries) dailyCloses() []models.RatePoint {
+	closes := make([]models.RatePoint, 0)
+	for _, point := range s.Points {
+		day := point.Timestamp.UTC().Format(dateLayout)
+		if n := len(closes); n > 0 && closes[n-1].Timestamp.UTC().Format(dateLayout) == day {
+			closes[n-1] = point
+			continue
+		}
+		closes = append(closes, point)
+	}
+	return closes
+}
+
+// logReturnDeviation returns the sample standard deviation, in percent, of the log
+// returns between consecutive points. It needs at least two returns.
+func logReturnDeviation(points []models.RatePoint) (decimal.Decimal, bool) {
+	returns := make([]float64, 0, len(points))
+	for i := 1; i < len(points); i++ {
+		previous, current := points[i-1].Rate.InexactFloat64(), points[i].Rate.InexactFloat64()
+		if previous <= 0 || current <= 0 {
+			continue
+		}
+		returns = append(returns, math.Log(current/previous))
+	}
+	if len(returns) < 2 {
+		return decimal.Zero, false
+	}
+
+	var mean float64
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+
+	var variance float64
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	variance /= float64(len(returns) - 1)
+
+	return decimal.NewFromFloat(math.Sqrt(variance) * 100).Round(percentPlaces), true
+}
+
+// rateExtreme describes the point as the minimum or maximum of a series
+func rateExtreme(point models.RatePoint) models.RateExtreme {
+	return models.RateExtreme{
+		Rate:      point.Rate,
+		Date:      point.Timestamp.UTC().Format(dateLayout),
+		Timestamp: point.Timestamp,
+	}
+}
@@ -0,0 +1,92 @@
+// internal/services/rate_cache.go
+
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+)
+
+// latestRate returns the latest rate of the currency from the source ("" for any
+// visible source), read from the publication it belongs to. A rate with ID 0 means
+// there is none. Both the lookup and the publication go through the rate cache, so
+// repeated conversions against the latest rates do not reach the database until the
+// next ingestion invalidates the cache.
+func (s *exchangeRateService) latestRate(code, source string) (models.ExchangeRate, error) {
+	snapshotID, err := s.latestSnapshotID(code, source)
+	if err != nil || snapshotID == 0 {
+		return models.ExchangeRate{}, err
+	}
+
+	rates, err := s.publishedRates(snapshotID)
+	if err != nil {
+		return models.ExchangeRate{}, err
+	}
+	for _, rate := range rates {
+		if rate.Currency.Code == code {
+			return rate, nil
+		}
+	}
+	return models.ExchangeRate{}, nil
+}
+
+// latestSnapshotID returns the snapshot holding the latest rate of the currency from
+// the source, or 0 if there is none. The answer depends on the sources the tenant can
+// see, so it is cached per tenant.
+func (s *exchangeRateService) latestSnapshotID(code, source string) (uint, error) {
+	scope := ""
+	if s.tenant != nil {
+		scope = s.tenant.Code
+	}
+	key := fmt.Sprintf("latest:%s:%s:%s", scope, source, code)
+
+	value, err := s.cache.GetOrLoad(key, func() ([]byte, error) {
+		rate, err := s.repo.GetExchangeRateByCurrency(code, source)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strconv.FormatUint(uint64(rate.SnapshotID), 10)), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := strconv.ParseUint(string(value), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cached snapshot ID %q: %v", value, err)
+	}
+	return uint(id), nil
+}
+
+// publishedRates returns every rate of a snapshot, through the rate cache
+func (s *exchangeRateService) publishedRates(snapshotID uint) ([]models.ExchangeRate, error) {
+	value, err := s.cache.GetOrLoad(fmt.Sprintf("snapshot:%d", snapshotID), func() ([]byte, error) {
+		rates, err := s.repo.GetRatesPublishedWith(models.ExchangeRate{SnapshotID: snapshotID})
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(rates)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var rates []models.ExchangeRate
+	if err := json.Unmarshal(value, &rates); err != nil {
+		return nil, fmt.Errorf("invalid cached rates of snapshot %d: %v", snapshotID, err)
+	}
+	return rates, nil
+}
+
+// invalidateRates drops cached rates after new ones are stored. A failure is logged
+// rather than returned, since the rates are already committed; cached entries then
+// expire on their own.
+func (s *exchangeRateService) invalidateRates() {
+	if err := s.cache.Invalidate(); err != nil {
+		log.Printf("Failed to invalidate the rate cache: %v", err)
+	}
+}
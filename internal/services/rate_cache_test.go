@@ -0,0 +1,105 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/shopspring/decimal"
+
+	"github.com/abduls21985/exchange-rate-service/internal/cache"
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/repositories"
+)
+
+// cachedRatesRepo serves the latest NGN rate from the last snapshot saved, counting the
+// lookups that reach it
+type cachedRatesRepo struct {
+	repositories.ExchangeRateRepository
+	snapshotID uint
+	rates      map[uint]decimal.Decimal // NGN rate of each snapshot
+	loads      int
+}
+
+func (r *cachedRatesRepo) GetExchangeRateByCurrency(string, string) (models.ExchangeRate, error) {
+	r.loads++
+	return models.ExchangeRate{SnapshotID: r.snapshotID}, nil
+}
+
+func (r *cachedRatesRepo) GetRatesPublishedWith(rate models.ExchangeRate) ([]models.ExchangeRate, error) {
+	r.loads++
+	return []models.ExchangeRate{{
+		SnapshotID: rate.SnapshotID,
+		Currency:   models.Currency{Code: "NGN"},
+		Rate:       r.rates[rate.SnapshotID],
+	}}, nil
+}
+
+func (r *cachedRatesRepo) GetOrCreateCurrencies(codes []string) (map[string]uint, error) {
+	ids := make(map[string]uint, len(codes))
+	for i, code := range codes {
+		ids[code] = uint(i + 1)
+	}
+	return ids, nil
+}
+
+func (r *cachedRatesRepo) GetRateSourceByCode(code string) (*models.RateSource, error) {
+	return &models.RateSource{ID: 1, Code: code}, nil
+}
+
+func (r *cachedRatesRepo) SaveSnapshots(snapshots []*models.RateSnapshot) error {
+	for _, snapshot := range snapshots {
+		r.snapshotID++
+		snapshot.ID = r.snapshotID
+		r.rates[snapshot.ID] = snapshot.Rates[0].Rate
+	}
+	return nil
+}
+
+func TestIngestionInvalidatesEveryReplica(t *testing.T) {
+	server := miniredis.RunT(t)
+	repo := &cachedRatesRepo{snapshotID: 1, rates: map[uint]decimal.Decimal{1: decimal.NewFromInt(1500)}}
+	audit := NewAuditService(&fakeAuditRepo{}, AuditOptions{})
+
+	// Two replicas share the database and the Redis server, but nothing in memory
+	replicas := make([]*exchangeRateService, 2)
+	for i := range replicas {
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		t.Cleanup(func() { client.Close() })
+		rateCache := cache.NewRedis(client, "rates", time.Minute)
+		replicas[i] = NewExchangeRateService(repo, ExchangeRateOptions{}, audit, rateCache).(*exchangeRateService)
+	}
+
+	for _, replica := range replicas {
+		rate, err := replica.latestRate("NGN", "")
+		if err != nil || !rate.Rate.Equal(decimal.NewFromInt(1500)) {
+			t.Fatalf("latest rate = %s, %v; want 1500", rate.Rate, err)
+		}
+	}
+	if repo.loads != 2 {
+		t.Errorf("%d database lookups, want 2 shared by both replicas", repo.loads)
+	}
+
+	_, err := replicas[0].AddExchangeRates(models.ExchangeRateData{
+		Timestamp: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC).Unix(),
+		Base:      "USD",
+		Source:    "cbn",
+		Rates:     map[string]decimal.Decimal{"NGN": decimal.NewFromInt(1520)},
+	})
+	if err != nil {
+		t.Fatalf("AddExchangeRates: %v", err)
+	}
+	if generation, _ := server.Get("rates:generation"); generation != "1" {
+		t.Errorf("generation = %q after ingestion, want 1", generation)
+	}
+
+	// The replica that did not ingest reads the new rate rather than its cached one
+	rate, err := replicas[1].latestRate("NGN", "")
+	if err != nil || !rate.Rate.Equal(decimal.NewFromInt(1520)) {
+		t.Errorf("latest rate on the other replica = %s, %v; want 1520", rate.Rate, err)
+	}
+	if repo.loads != 4 {
+		t.Errorf("%d database lookups, want 4", repo.loads)
+	}
+}
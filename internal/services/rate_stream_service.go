@@ -0,0 +1,378 @@
+// internal/services/rate_stream_service.go
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/shopspring/decimal"
+	"github.com/spf13/viper"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/utils"
+)
+
+// ErrStreamOverflow ends the subscription of a client that fell too far behind the
+// stream. The client is expected to reconnect and resume from the last snapshot it saw.
+var ErrStreamOverflow = errors.New("subscriber fell behind the rate stream")
+
+// replayBatchSize is the number of missed snapshots loaded at a time when a subscriber resumes
+const replayBatchSize = 50
+
+// RateStreamOptions configures the rate stream
+type RateStreamOptions struct {
+	Heartbeat   time.Duration // Interval of keep-alive messages on idle connections
+	BufferSize  int           // Snapshots queued for a subscriber before it is dropped
+	MaxDuration time.Duration // Connections are closed after this long so credentials are checked again
+	// Redis relays published snapshots to the subscribers of every replica; without it
+	// subscribers only hear of snapshots stored by their own process
+	Redis   redis.UniversalClient
+	Channel string // Redis channel the snapshots are relayed on
+}
+
+// RateStreamOptionsFromConfig reads the rate stream settings from configuration
+func RateStreamOptionsFromConfig() RateStreamOptions {
+	options := RateStreamOptions{
+		Heartbeat:   viper.GetDuration("stream.heartbeat"),
+		BufferSize:  viper.GetInt("stream.buffer_size"),
+		MaxDuration: viper.GetDuration("stream.max_duration"),
+	}
+	if options.Heartbeat <= 0 {
+		options.Heartbeat = 30 * time.Second
+	}
+	if options.BufferSize <= 0 {
+		options.BufferSize = 64
+	}
+	if options.MaxDuration <= 0 {
+		options.MaxDuration = 15 * time.Minute
+	}
+	if addr := viper.GetString("stream.redis.addr"); addr != "" {
+		options.Redis = redis.NewClient(&redis.Options{
+			Addr:     addr,
+			Password: viper.GetString("stream.redis.password"),
+			DB:       viper.GetInt("stream.redis.db"),
+		})
+	}
+	options.Channel = viper.GetString("stream.redis.channel")
+	if options.Channel == "" {
+		options.Channel = "exchange-rates:stream"
+	}
+	return options
+}
+
+// RateStreamFilter selects and reshapes the snapshots sent to a subscriber
+type RateStreamFilter struct {
+	Tenant     *models.MDA // The subscriber's MDA, limiting the sources and currencies it sees
+	Source     string      // Only snapshots of this source, when set
+	Currencies []string    // Only these currencies, when set
+	Base       string      // Rebase the rates onto this currency; defaults to the tenant's base
+}
+
+// RateUpdate is a message of the rate stream: the rates of one stored snapshot
+type RateUpdate struct {
+	SnapshotID uint                       `json:"snapshot_id"`
+	Source     string                     `json:"source"`
+	Base       string                     `json:"base"`
+	Timestamp  int64                      `json:"timestamp"`
+	FetchedAt  time.Time                  `json:"fetched_at"`
+	Rates      map[string]decimal.Decimal `json:"rates"`
+}
+
+// RateSubscription delivers rate updates to one client. Updates is closed when the
+// subscription's context ends or the subscription fails, after which Err reports why.
+type RateSubscription struct {
+	Updates <-chan RateUpdate
+	err     error
+}
+
+// Err returns ErrStreamOverflow or the replay error that ended the subscription, or nil
+// if its context ended. It must only be called once Updates is closed.
+func (sub *RateSubscription) Err() error {
+	return sub.err
+}
+
+type RateStreamService interface {
+	Publish(snapshots []*models.RateSnapshot)
+	Subscribe(ctx context.Context, filter RateStreamFilter, lastSnapshotID uint) (*RateSubscription, error)
+	Options() RateStreamOptions
+	Run(ctx context.Context)
+}
+
+type rateStreamService struct {
+	rates   ExchangeRateService
+	options RateStreamOptions
+	origin  string // Identifies the process in relayed messages, so it skips its own
+
+	mu          sync.RWMutex
+	subscribers map[*rateSubscriber]bool
+}
+
+// rateSubscriber is the queue of snapshots published to one subscription
+type rateSubscriber struct {
+	live     chan *models.RateSnapshot
+	dropped  chan struct{}
+	dropOnce sync.Once
+}
+
+// drop signals the subscription that it missed snapshots
+func (sub *rateSubscriber) drop() {
+	sub.dropOnce.Do(func() { close(sub.dropped) })
+}
+
+// relayedSnapshots is the message relaying published snapshots to other replicas
+type relayedSnapshots struct {
+	Origin    string                 `json:"origin"`
+	Snapshots []*models.RateSnapshot `json:"snapshots"`
+}
+
+// NewRateStreamService creates a new RateStreamService that pushes the snapshots passed
+// to Publish to its subscribers. With Redis configured, the snapshots are also relayed
+// to the subscribers of other replicas while Run is running.
+func NewRateStreamService(rates ExchangeRateService, options RateStreamOptions) RateStreamService {
+	origin, err := utils.NewToken(8)
+	if err != nil {
+		origin = fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return &rateStreamService{
+		rates:       rates,
+		options:     options,
+		origin:      origin,
+		subscribers: make(map[*rateSubscriber]bool),
+	}
+}
+
+// Publish queues stored snapshots for every subscriber without blocking, and relays
+// them to the other replicas
+func (s *rateStreamService) Publish(snapshots []*models.RateSnapshot) {
+	s.fanOut(snapshots)
+	if s.options.Redis == nil || len(snapshots) == 0 {
+		return
+	}
+
+	message, err := json.Marshal(relayedSnapshots{Origin: s.origin, Snapshots: snapshots})
+	if err != nil {
+		log.Printf("Error encoding snapshots for the rate stream: %v", err)
+		return
+	}
+	// Publish runs on the ingesting goroutine; subscribers elsewhere catch up from the
+	// database when they reconnect if the relay fails
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.options.Redis.Publish(ctx, s.options.Channel, message).Err(); err != nil {
+		log.Printf("Error relaying snapshots to the rate stream of other replicas: %v", err)
+	}
+}
+
+// Run passes the snapshots relayed by other replicas to this process's subscribers
+// until ctx ends. It returns at once when Redis is not configured.
+func (s *rateStreamService) Run(ctx context.Context) {
+	if s.options.Redis == nil {
+		return
+	}
+	pubsub := s.options.Redis.Subscribe(ctx, s.options.Channel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			var relayed relayedSnapshots
+			if err := json.Unmarshal([]byte(message.Payload), &relayed); err != nil {
+				log.Printf("Error decoding snapshots relayed to the rate stream: %v", err)
+				continue
+			}
+			if relayed.Origin != s.origin {
+				s.fanOut(relayed.Snapshots)
+			}
+		}
+	}
+}
+
+// fanOut queues snapshots for every subscriber of this process without blocking. A
+// subscriber whose queue is full is dropped.
+func (s *rateStreamService) fanOut(snapshots []*models.RateSnapshot) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for sub := range s.subscribers {
+		for _, snapshot := range snapshots {
+			select {
+			case sub.live <- snapshot:
+			default:
+				sub.drop()
+			}
+		}
+	}
+}
+
+// Subscribe starts a subscription to snapshots matching the filter until ctx ends. When
+// lastSnapshotID is set, the snapshots stored after it are sent first.
+func (s *rateStreamService) Subscribe(ctx context.Context, filter RateStreamFilter, lastSnapshotID uint) (*RateSubscription, error) {
+	if filter.Base == "" && filter.Tenant != nil {
+		filter.Base = filter.Tenant.DefaultBaseCurrency
+	}
+	codes := filter.Currencies
+	if filter.Base != "" {
+		codes = append([]string{filter.Base}, codes...)
+	}
+	for _, code := range codes {
+		if !filter.Tenant.AllowsCurrency(code) {
+			return nil, fmt.Errorf("%w: %s", ErrCurrencyNotAllowed, code)
+		}
+	}
+
+	// Queue live snapshots before replaying, so none stored in between are missed
+	sub := &rateSubscriber{
+		live:    make(chan *models.RateSnapshot, s.options.BufferSize),
+		dropped: make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.subscribers[sub] = true
+	s.mu.Unlock()
+
+	updates := make(chan RateUpdate)
+	subscription := &RateSubscription{Updates: updates}
+	go func() {
+		defer close(updates)
+		defer s.unsubscribe(sub)
+		subscription.err = s.deliver(ctx, sub, filter, lastSnapshotID, updates)
+	}()
+	return subscription, nil
+}
+
+// Options returns the settings of the stream
+func (s *rateStreamService) Options() RateStreamOptions {
+	return s.options
+}
+
+// unsubscribe stops publishing to the subscriber
+func (s *rateStreamService) unsubscribe(sub *rateSubscriber) {
+	s.mu.Lock()
+	delete(s.subscribers, sub)
+	s.mu.Unlock()
+}
+
+// deliver sends the snapshots missed since lastSnapshotID and then those published,
+// until ctx ends or the subscriber is dropped
+func (s *rateStreamService) deliver(ctx context.Context, sub *rateSubscriber, filter RateStreamFilter, lastSnapshotID uint, updates chan<- RateUpdate) error {
+	send := func(snapshot *models.RateSnapshot) bool {
+		update, ok := filter.update(snapshot)
+		if !ok {
+			return true
+		}
+		select {
+		case updates <- update:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	// Snapshots stored while replaying are both replayed and queued; skip the queued copy
+	replayed := make(map[uint]bool)
+	if lastSnapshotID > 0 {
+		rates := s.rates.ForTenant(filter.Tenant)
+		for afterID := lastSnapshotID; ; {
+			snapshots, err := rates.ListSnapshotsAfter(afterID, replayBatchSize)
+			if err != nil {
+				return fmt.Errorf("failed to replay snapshots after %d: %v", afterID, err)
+			}
+			for i := range snapshots {
+				replayed[snapshots[i].ID] = true
+				if !send(&snapshots[i]) {
+					return nil
+				}
+				afterID = snapshots[i].ID
+			}
+			if len(snapshots) < replayBatchSize {
+				break
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-sub.dropped:
+			return ErrStreamOverflow
+		case snapshot := <-sub.live:
+			if replayed[snapshot.ID] {
+				delete(replayed, snapshot.ID)
+				continue
+			}
+			if !send(snapshot) {
+				return nil
+			}
+		}
+	}
+}
+
+// update builds the message sent for the snapshot, reporting false if the subscriber
+// should not receive it: the snapshot belongs to another MDA or source, cannot be
+// expressed in the requested base, or quotes none of the requested currencies
+func (f RateStreamFilter) update(snapshot *models.RateSnapshot) (RateUpdate, bool) {
+	if snapshot.Source.MdaID != "" && (f.Tenant == nil || snapshot.Source.MdaID != f.Tenant.Code) {
+		return RateUpdate{}, false
+	}
+	if f.Source != "" && snapshot.Source.Code != f.Source {
+		return RateUpdate{}, false
+	}
+
+	rates := make(map[string]decimal.Decimal, len(snapshot.Rates))
+	for _, rate := range snapshot.Rates {
+		rates[rate.Currency.Code] = rate.Rate
+	}
+
+	// Rebase using the snapshot's own rate for the base, so every rate comes from one publication
+	base := snapshot.BaseCurrency.Code
+	if f.Base != "" && f.Base != base {
+		baseRate, ok := rates[f.Base]
+		if !ok || baseRate.IsZero() {
+			return RateUpdate{}, false
+		}
+		for code, rate := range rates {
+			rates[code] = rate.Div(baseRate)
+		}
+		base = f.Base
+	}
+
+	for code := range rates {
+		if !f.Tenant.AllowsCurrency(code) || (len(f.Currencies) > 0 && !containsString(f.Currencies, code)) {
+			delete(rates, code)
+		}
+	}
+	if len(rates) == 0 {
+		return RateUpdate{}, false
+	}
+
+	return RateUpdate{
+		SnapshotID: snapshot.ID,
+		Source:     snapshot.Source.Code,
+		Base:       base,
+		Timestamp:  snapshot.ProviderTimestamp.Unix(),
+		FetchedAt:  snapshot.FetchedAt,
+		Rates:      rates,
+	}, true
+}
+
+// containsString reports whether values includes value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
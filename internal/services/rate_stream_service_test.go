@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/shopspring/decimal"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+)
+
+// testSnapshot is a cbn publication in NGN with the rates
+func testSnapshot(id uint, rates map[string]float64) *models.RateSnapshot {
+	snapshot := &models.RateSnapshot{
+		ID:                id,
+		BaseCurrencyID:    1,
+		BaseCurrency:      models.Currency{Code: "NGN"},
+		Source:            models.RateSource{Code: "cbn"},
+		ProviderTimestamp: time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC).Add(time.Duration(id) * time.Hour),
+	}
+	for code, rate := range rates {
+		snapshot.Rates = append(snapshot.Rates, models.ExchangeRate{Currency: models.Currency{Code: code}, Rate: decimal.NewFromFloat(rate)})
+	}
+	return snapshot
+}
+
+// receive returns the next update of the subscription, failing the test after a second
+func receive(t *testing.T, subscription *RateSubscription) RateUpdate {
+	t.Helper()
+	select {
+	case update := <-subscription.Updates:
+		return update
+	case <-time.After(time.Second):
+		t.Fatal("no update received")
+		return RateUpdate{}
+	}
+}
+
+func TestPublishReachesSubscribersOfOtherReplicas(t *testing.T) {
+	server := miniredis.RunT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Two replicas of the server sharing one Redis
+	replicas := make([]RateStreamService, 2)
+	subscriptions := make([]*RateSubscription, 2)
+	for i := range replicas {
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		t.Cleanup(func() { client.Close() })
+		replicas[i] = NewRateStreamService(nil, RateStreamOptions{BufferSize: 8, Redis: client, Channel: "test:stream"})
+		go replicas[i].Run(ctx)
+
+		var err error
+		subscriptions[i], err = replicas[i].Subscribe(ctx, RateStreamFilter{}, 0)
+		if err != nil {
+			t.Fatalf("Subscribe: %v", err)
+		}
+	}
+	for deadline := time.Now().Add(time.Second); server.PubSubNumSub("test:stream")["test:stream"] < 2; {
+		if time.Now().After(deadline) {
+			t.Fatal("replicas did not subscribe to the relay channel")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	replicas[0].Publish([]*models.RateSnapshot{
+		testSnapshot(41, map[string]float64{"USD": 1530}),
+		{ID: 42, Source: models.RateSource{Code: "nuprc:manual", MdaID: "NUPRC"}, BaseCurrency: models.Currency{Code: "NGN"}},
+	})
+
+	for i, subscription := range subscriptions {
+		update := receive(t, subscription)
+		if update.SnapshotID != 41 || update.Base != "NGN" || !update.Rates["USD"].Equal(decimal.NewFromInt(1530)) {
+			t.Errorf("replica %d received %+v, want snapshot 41", i, update)
+		}
+	}
+
+	// The publishing replica skips its own relayed copy, and MDA snapshots stay private
+	replicas[1].Publish([]*models.RateSnapshot{testSnapshot(43, map[string]float64{"EUR": 1650})})
+	for i, subscription := range subscriptions {
+		if update := receive(t, subscription); update.SnapshotID != 43 {
+			t.Errorf("replica %d received snapshot %d, want 43", i, update.SnapshotID)
+		}
+	}
+}
+
+func TestRunWithoutRedisReturns(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		NewRateStreamService(nil, RateStreamOptions{BufferSize: 8}).Run(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run blocked without Redis")
+	}
+}
@@ -0,0 +1,89 @@
+// internal/services/rate_time_series.go
+
+package services
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+)
+
+// TimeSeriesQuery selects the rates of a historical time series
+type TimeSeriesQuery struct {
+	Currencies []string        // Only these currencies; every allowed currency when empty
+	Base       string          // Rebase the rates onto this currency; defaults to the latest snapshot's base
+	Source     string          // Empty to use the preferred sources
+	Side       models.RateSide // Quote leg used for every rate
+	Start      time.Time       // First instant of the range
+	End        time.Time       // End of the range, excluded
+	// Interval samples one value per day, week or month; every publication is kept when empty
+	Interval models.RateInterval
+	Sampling models.RateSampling // How a period's rates are reduced when sampling
+}
+
+// TimeSeries holds the rates of a historical time series. Rates is keyed by the start
+// date of each period (YYYY-MM-DD) when sampled, or by the publication time (RFC 3339)
+// of every snapshot otherwise, and then by currency code.
+type TimeSeries struct {
+	Base     string
+	Source   string
+	Interval models.RateInterval
+	Sampling models.RateSampling
+	Rates    map[string]map[string]decimal.Decimal
+}
+
+// buildTimeSeries rebases each snapshot onto the series' base, keeps the wanted currencies
+// and samples the result. Snapshots that do not quote the base are left out.
+func buildTimeSeries(snapshots []seriesSnapshot, query TimeSeriesQuery, wanted func(code string) bool) map[string]map[string]decimal.Decimal {
+	series := make(map[string]map[string]decimal.Decimal)
+	sums := make(map[string]map[string]decimal.Decimal)
+	counts := make(map[string]map[string]int64)
+
+	for _, snapshot := range snapshots {
+		baseRate, ok := snapshot.rates[query.Base]
+		if !ok || baseRate.IsZero() {
+			continue
+		}
+
+		key := snapshot.timestamp.UTC().Format(time.RFC3339)
+		if query.Interval != "" {
+			key = query.Interval.PeriodStart(snapshot.timestamp).Format(dateLayout)
+		}
+		if series[key] == nil {
+			series[key] = make(map[string]decimal.Decimal)
+			sums[key] = make(map[string]decimal.Decimal)
+			counts[key] = make(map[string]int64)
+		}
+
+		for code, rate := range snapshot.rates {
+			if code == query.Base || !wanted(code) {
+				continue
+			}
+			if !baseRate.Equal(decimal.NewFromInt(1)) {
+				rate = rate.Div(baseRate).Round(analyticsPlaces)
+			}
+			// Snapshots are oldest first, so the last one written is the period's close
+			series[key][code] = rate
+			sums[key][code] = sums[key][code].Add(rate)
+			counts[key][code]++
+		}
+	}
+
+	for key, rates := range series {
+		if len(rates) == 0 {
+			delete(series, key)
+		}
+	}
+
+	if query.Interval != "" && query.Sampling == models.AverageSampling {
+		for key, rates := range series {
+			for code := range rates {
+				sum := sums[key][code]
+				rates[code] = sum.Div(decimal.NewFromInt(counts[key][code])).Round(analyticsPlaces)
+			}
+		}
+	}
+	return series
+}
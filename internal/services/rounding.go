@@ -0,0 +1,59 @@
+// internal/services/rounding.go
+
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// RoundingMode selects how converted amounts are rounded to a currency's minor units
+type RoundingMode string
+
+const (
+	// RoundHalfUp rounds halves away from zero (1.005 -> 1.01)
+	RoundHalfUp RoundingMode = "half_up"
+	// RoundBankers rounds halves to the nearest even digit (1.005 -> 1.00, 1.015 -> 1.02)
+	RoundBankers RoundingMode = "bankers"
+)
+
+// ParseRoundingMode validates a rounding mode name, defaulting to half-up when empty
+func ParseRoundingMode(value string) (RoundingMode, error) {
+	switch mode := RoundingMode(strings.ToLower(value)); mode {
+	case "":
+		return RoundHalfUp, nil
+	case RoundHalfUp, RoundBankers:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid rounding mode %q: must be half_up or bankers", value)
+	}
+}
+
+// Round rounds the amount to the given number of decimal places
+func (m RoundingMode) Round(amount decimal.Decimal, places int32) decimal.Decimal {
+	if m == RoundBankers {
+		return amount.RoundBank(places)
+	}
+	return amount.Round(places)
+}
+
+// defaultMinorUnits lists ISO 4217 currencies whose minor unit is not two decimal places
+var defaultMinorUnits = map[string]int32{
+	"BHD": 3, "CLP": 0, "IQD": 3, "ISK": 0, "JOD": 3, "JPY": 0, "KRW": 0, "KWD": 3,
+	"LYD": 3, "OMR": 3, "TND": 3, "UGX": 0, "VND": 0, "XAF": 0, "XOF": 0, "XUA": 6,
+}
+
+// minorUnits returns the number of decimal places used for amounts in the currency,
+// preferring configured overrides over the ISO 4217 defaults
+func minorUnits(code string, overrides map[string]int32) int32 {
+	code = strings.ToUpper(code)
+	if places, ok := overrides[code]; ok {
+		return places
+	}
+	if places, ok := defaultMinorUnits[code]; ok {
+		return places
+	}
+	return 2
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestRoundingModes(t *testing.T) {
+	tests := []struct {
+		amount  string
+		places  int32
+		halfUp  string
+		bankers string
+	}{
+		{"1.005", 2, "1.01", "1"},
+		{"1.015", 2, "1.02", "1.02"},
+		{"1.0051", 2, "1.01", "1.01"},
+		{"-1.005", 2, "-1.01", "-1"},
+		{"2.5", 0, "3", "2"},
+		{"3.5", 0, "4", "4"},
+		{"0.0005", 3, "0.001", "0"},
+		{"1534.215", 2, "1534.22", "1534.22"},
+		{"1534.225", 2, "1534.23", "1534.22"},
+	}
+
+	for _, tt := range tests {
+		amount := decimal.RequireFromString(tt.amount)
+		if got := RoundHalfUp.Round(amount, tt.places); !got.Equal(decimal.RequireFromString(tt.halfUp)) {
+			t.Errorf("half_up %s to %d places = %s, want %s", tt.amount, tt.places, got, tt.halfUp)
+		}
+		if got := RoundBankers.Round(amount, tt.places); !got.Equal(decimal.RequireFromString(tt.bankers)) {
+			t.Errorf("bankers %s to %d places = %s, want %s", tt.amount, tt.places, got, tt.bankers)
+		}
+	}
+}
+
+func TestParseRoundingMode(t *testing.T) {
+	tests := []struct {
+		value string
+		want  RoundingMode
+		valid bool
+	}{
+		{"", RoundHalfUp, true},
+		{"half_up", RoundHalfUp, true},
+		{"BANKERS", RoundBankers, true},
+		{"half_even", "", false},
+	}
+
+	for _, tt := range tests {
+		mode, err := ParseRoundingMode(tt.value)
+		if (err == nil) != tt.valid || mode != tt.want {
+			t.Errorf("ParseRoundingMode(%q) = %q, %v; want %q", tt.value, mode, err, tt.want)
+		}
+	}
+}
+
+// TestConvertedAmountsUseMinorUnits rounds amounts to each currency's minor units
+func TestConvertedAmountsUseMinorUnits(t *testing.T) {
+	overrides := map[string]int32{"NGN": 2, "XAF": 2}
+	tests := []struct {
+		currency string
+		amount   string
+		mode     RoundingMode
+		want     string
+	}{
+		{"JPY", "15234.5", RoundHalfUp, "15235"},
+		{"JPY", "15234.5", RoundBankers, "15234"},
+		{"KWD", "0.3075", RoundHalfUp, "0.308"},
+		{"KWD", "0.3075", RoundBankers, "0.308"},
+		{"KWD", "0.3085", RoundBankers, "0.308"},
+		{"NGN", "1534210.005", RoundHalfUp, "1534210.01"},
+		{"usd", "12.345", RoundHalfUp, "12.35"},
+		{"XAF", "655.957", RoundHalfUp, "655.96"},
+		{"XUA", "1.2345675", RoundBankers, "1.234568"},
+	}
+
+	for _, tt := range tests {
+		places := minorUnits(tt.currency, overrides)
+		got := tt.mode.Round(decimal.RequireFromString(tt.amount), places)
+		if !got.Equal(decimal.RequireFromString(tt.want)) {
+			t.Errorf("%s %s rounded %s to %d places = %s, want %s", tt.amount, tt.currency, tt.mode, places, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// internal/services/triangulation.go
+
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// rateTable is one published set of rates: a single source quoting every currency
+// against the same base currency at the same instant
+type rateTable struct {
+	source    string
+	base      string
+	timestamp time.Time
+	rates     map[string]models.ExchangeRate
+}
+
+// newRateTable indexes published rates by currency code
+func newRateTable(rates []models.ExchangeRate) *rateTable {
+	table := &rateTable{rates: make(map[string]models.ExchangeRate, len(rates))}
+	for _, rate := range rates {
+		table.source = rate.Source.Code
+		table.base = rate.BaseCurrency.Code
+		table.timestamp = rate.Timestamp
+		table.rates[rate.Currency.Code] = rate
+	}
+	return table
+}
+
+// has reports whether the table quotes the currency with a usable rate for the side
+func (t *rateTable) has(code string, side models.RateSide) bool {
+	rate, ok := t.rates[code]
+	return ok && !rate.RateFor(side).IsZero()
+}
+
+// leg converts between two currencies quoted in the same table
+func (t *rateTable) leg(from, to string, side models.RateSide) models.ConversionLeg {
+	return models.ConversionLeg{
+		FromCurrency: from,
+		ToCurrency:   to,
+		Rate:         t.rates[to].RateFor(side).Div(t.rates[from].RateFor(side)),
+		Base:         t.base,
+		Source:       t.source,
+		Timestamp:    t.timestamp,
+	}
+}
+
+// route is the sequence of legs used to convert one currency into another
+type route struct {
+	legs []models.ConversionLeg
+}
+
+// rate multiplies the leg rates together
+func (r route) rate() decimal.Decimal {
+	rate := decimal.NewFromInt(1)
+	for _, leg := range r.legs {
+		rate = rate.Mul(leg.Rate)
+	}
+	return rate
+}
+
+// path lists the currencies visited, e.g. EUR, USD, NGN
+func (r route) path() []string {
+	path := []string{r.legs[0].FromCurrency}
+	for _, leg := range r.legs {
+		path = append(path, leg.ToCurrency)
+	}
+	return path
+}
+
+// triangulate finds a route from one currency to another using the tables the two
+// currencies were resolved in. A single table quoting both currencies is preferred,
+// newest first, so that both legs share one base and one publication. Otherwise the
+// conversion goes through an intermediate currency quoted in both tables, trying the
+// pivots and then each table's base currency.
+func triangulate(from, to string, fromTable, toTable *rateTable, side models.RateSide, pivots []string) (route, error) {
+	tables := []*rateTable{toTable, fromTable}
+	if fromTable.timestamp.After(toTable.timestamp) {
+		tables = []*rateTable{fromTable, toTable}
+	}
+	for _, table := range tables {
+		if table.has(from, side) && table.has(to, side) {
+			return route{legs: []models.ConversionLeg{table.leg(from, to, side)}}, nil
+		}
+	}
+
+	candidates := append(append([]string{}, pivots...), fromTable.base, toTable.base)
+	for _, pivot := range candidates {
+		if pivot == from || pivot == to {
+			continue
+		}
+		if fromTable.has(from, side) && fromTable.has(pivot, side) && toTable.has(pivot, side) && toTable.has(to, side) {
+			return route{legs: []models.ConversionLeg{
+				fromTable.leg(from, pivot, side),
+				toTable.leg(pivot, to, side),
+			}}, nil
+		}
+	}
+
+	return route{}, fmt.Errorf("%w: no common currency links %s and %s", ErrRateNotFound, from, to)
+}
+
+// routeWarnings flags legs that are stale relative to the reference time or that
+// were published at different times
+func routeWarnings(r route, reference time.Time, staleAfter time.Duration) []string {
+	var warnings []string
+
+	for _, leg := range r.legs[1:] {
+		if !leg.Timestamp.Equal(r.legs[0].Timestamp) {
+			warnings = append(warnings, fmt.Sprintf("legs use rates published at different times (%s and %s)",
+				r.legs[0].Timestamp.Format(time.RFC3339), leg.Timestamp.Format(time.RFC3339)))
+			break
+		}
+	}
+
+	if staleAfter > 0 {
+		for _, leg := range r.legs {
+			if age := reference.Sub(leg.Timestamp); age > staleAfter {
+				warnings = append(warnings, fmt.Sprintf("%s->%s rate from %s is stale (%s old)",
+					leg.FromCurrency, leg.ToCurrency, leg.Source, age.Round(time.Minute)))
+			}
+		}
+	}
+
+	return warnings
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+)
+
+// publication builds the rate table of a source quoting currencies against its base
+func publication(source, base string, at time.Time, rates map[string]string) *rateTable {
+	published := make([]models.ExchangeRate, 0, len(rates))
+	for code, rate := range rates {
+		published = append(published, models.ExchangeRate{
+			Currency:     models.Currency{Code: code},
+			Rate:         decimal.RequireFromString(rate),
+			Timestamp:    at,
+			BaseCurrency: models.Currency{Code: base},
+			Source:       models.RateSource{Code: source},
+		})
+	}
+	return newRateTable(published)
+}
+
+func TestTriangulate(t *testing.T) {
+	morning := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	afternoon := morning.Add(6 * time.Hour)
+
+	// cbn quotes against NGN; ecb quotes against EUR and publishes no NGN rate
+	cbn := publication("cbn", "NGN", morning, map[string]string{"NGN": "1", "USD": "0.000625", "GBP": "0.0005"})
+	ecb := publication("ecb", "EUR", afternoon, map[string]string{"EUR": "1", "USD": "1.08", "JPY": "162"})
+	newerCBN := publication("cbn", "NGN", afternoon, map[string]string{"NGN": "1", "USD": "0.0005", "GBP": "0.00045"})
+
+	tests := []struct {
+		name       string
+		from, to   string
+		fromTable  *rateTable
+		toTable    *rateTable
+		pivots     []string
+		wantPath   string
+		wantRate   string
+		wantSource string
+	}{
+		{
+			name: "both currencies in one publication", from: "USD", to: "NGN",
+			fromTable: cbn, toTable: cbn,
+			wantPath: "USD NGN", wantRate: "1600", wantSource: "cbn",
+		},
+		{
+			name: "newest publication quoting both", from: "USD", to: "GBP",
+			fromTable: cbn, toTable: newerCBN,
+			wantPath: "USD GBP", wantRate: "0.9", wantSource: "cbn",
+		},
+		{
+			name: "through a configured pivot", from: "NGN", to: "JPY",
+			fromTable: cbn, toTable: ecb, pivots: []string{"USD"},
+			wantPath: "NGN USD JPY", wantRate: "0.09375", wantSource: "cbn",
+		},
+		{
+			name: "skipping pivots one table lacks", from: "GBP", to: "EUR",
+			fromTable: cbn, toTable: ecb, pivots: []string{"CHF", "JPY", "USD"},
+			wantPath: "GBP USD EUR", wantRate: "1.1574074074074074", wantSource: "cbn",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := triangulate(tt.from, tt.to, tt.fromTable, tt.toTable, models.MidSide, tt.pivots)
+			if err != nil {
+				t.Fatalf("triangulate: %v", err)
+			}
+			if path := strings.Join(r.path(), " "); path != tt.wantPath {
+				t.Errorf("path = %s, want %s", path, tt.wantPath)
+			}
+			if rate := r.rate().Round(16); !rate.Equal(decimal.RequireFromString(tt.wantRate)) {
+				t.Errorf("rate = %s, want %s", rate, tt.wantRate)
+			}
+			if r.legs[0].Source != tt.wantSource {
+				t.Errorf("first leg from %s, want %s", r.legs[0].Source, tt.wantSource)
+			}
+		})
+	}
+
+	if _, err := triangulate("GBP", "JPY", cbn, ecb, models.MidSide, nil); !errors.Is(err, ErrRateNotFound) {
+		t.Errorf("without a common currency: err = %v, want ErrRateNotFound", err)
+	}
+}
+
+func TestRouteWarnings(t *testing.T) {
+	published := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	leg := func(from, to string, at time.Time) models.ConversionLeg {
+		return models.ConversionLeg{FromCurrency: from, ToCurrency: to, Source: "cbn", Timestamp: at}
+	}
+
+	tests := []struct {
+		name       string
+		legs       []models.ConversionLeg
+		reference  time.Time
+		staleAfter time.Duration
+		want       []string
+	}{
+		{
+			name:       "fresh single leg",
+			legs:       []models.ConversionLeg{leg("USD", "NGN", published)},
+			reference:  published.Add(time.Hour),
+			staleAfter: 72 * time.Hour,
+		},
+		{
+			name:       "stale leg",
+			legs:       []models.ConversionLeg{leg("USD", "NGN", published)},
+			reference:  published.Add(96 * time.Hour),
+			staleAfter: 72 * time.Hour,
+			want:       []string{"USD->NGN rate from cbn is stale (96h0m0s old)"},
+		},
+		{
+			name:      "staleness not checked",
+			legs:      []models.ConversionLeg{leg("USD", "NGN", published)},
+			reference: published.Add(960 * time.Hour),
+		},
+		{
+			name:       "legs of different publications",
+			legs:       []models.ConversionLeg{leg("NGN", "USD", published), leg("USD", "JPY", published.Add(6*time.Hour))},
+			reference:  published.Add(7 * time.Hour),
+			staleAfter: 72 * time.Hour,
+			want:       []string{"legs use rates published at different times (2024-03-01T09:00:00Z and 2024-03-01T15:00:00Z)"},
+		},
+		{
+			name:       "mismatched and stale",
+			legs:       []models.ConversionLeg{leg("NGN", "USD", published), leg("USD", "JPY", published.Add(48*time.Hour))},
+			reference:  published.Add(80 * time.Hour),
+			staleAfter: 72 * time.Hour,
+			want: []string{
+				"legs use rates published at different times (2024-03-01T09:00:00Z and 2024-03-03T09:00:00Z)",
+				"NGN->USD rate from cbn is stale (80h0m0s old)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := routeWarnings(route{legs: tt.legs}, tt.reference, tt.staleAfter)
+			if strings.Join(warnings, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("warnings = %q, want %q", warnings, tt.want)
+			}
+		})
+	}
+}
@@ -1,54 +1,114 @@
 package services
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"net/mail"
+	"strings"
 	"time"
 
 	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/notifier"
 	"github.com/abduls21985/exchange-rate-service/internal/repositories"
 	"github.com/abduls21985/exchange-rate-service/internal/utils"
 
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
+var (
+	// ErrUserNotFound is returned when no user matches the lookup
+	ErrUserNotFound = errors.New("user not found")
+	// ErrUserExists is returned when the username or email is already registered
+	ErrUserExists = errors.New("username or email already in use")
+	// ErrInvalidCredentials is returned when a login names an unknown user or gives the
+	// wrong password; the two are deliberately not told apart
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrInvalidPassword is returned when a password check fails
+	ErrInvalidPassword = errors.New("invalid password")
+	// ErrWeakPassword is returned when a new password does not meet the policy
+	ErrWeakPassword = fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	// ErrUserInactive is returned when a deactivated user tries to authenticate
+	ErrUserInactive = errors.New("user account is deactivated")
+	// ErrPasswordRequired is returned when the email address is changed without the current password
+	ErrPasswordRequired = errors.New("current password is required to change the email address")
+	// ErrInvalidEmail is returned when an email address cannot be parsed
+	ErrInvalidEmail = errors.New("invalid email address")
+	// ErrInvalidResetToken is returned when a password reset token is unknown or expired
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+)
+
+// unknownUserHash is compared against when a login names no user, so that the login
+// takes as long as one with a wrong password
+var unknownUserHash, _ = bcrypt.GenerateFromPassword([]byte("not the password of any user"), bcrypt.DefaultCost)
+
+// minPasswordLength is the shortest password accepted for new and changed passwords
+const minPasswordLength = 8
+
 // UserService interface defines user-related operations
 type UserService interface {
 	RegisterUser(user *models.User) (*models.User, error)
 	AuthenticateUser(username, password string) (*models.User, error)
 	GetUserByUsername(username string) (*models.User, error)
-	UpdateUser(user *models.User) error
+	GetUserByID(id uint) (*models.User, error)
+	IsActive(username string) (bool, error)
+	UpdateProfile(username string, profile models.UserProfile) (*models.User, error)
+	ChangePassword(username, currentPassword, newPassword string) error
+	ListUsers(actorMdaID string, filter models.UserFilter) ([]models.User, int64, error)
+	GetUser(actorMdaID, username string) (*models.User, error)
+	SetActive(actorMdaID, username string, active bool) (*models.User, error)
+	ChangeRole(actorMdaID, username string, role models.Role) (*models.User, error)
+	AssignMDA(username, mdaID string) (*models.User, error)
 	InitiatePasswordReset(email string) (*models.User, error)
-	ResetPassword(token, newPassword string) error
+	ResetPassword(token, newPassword string) (*models.User, error)
 }
 
 type userService struct {
-	repo repositories.UserRepository
+	repo     repositories.UserRepository
+	mdaRepo  repositories.MDARepository
+	notifier notifier.AccountNotifier
 }
 
 // NewUserService creates a new instance of UserService
-func NewUserService(repo repositories.UserRepository) UserService {
-	return &userService{repo}
+func NewUserService(repo repositories.UserRepository, mdaRepo repositories.MDARepository, accountNotifier notifier.AccountNotifier) UserService {
+	return &userService{repo, mdaRepo, accountNotifier}
 }
 
 // RegisterUser registers a new user
 func (s *userService) RegisterUser(user *models.User) (*models.User, error) {
+	email, err := checkEmail(user.Email)
+	if err != nil {
+		return nil, err
+	}
+	user.Email = email
+
 	// Check if the username or email already exists
 	existingUser, err := s.repo.FindUserByUsername(user.Username)
 	if err == nil && existingUser != nil {
-		return nil, fmt.Errorf("username already taken")
+		return nil, fmt.Errorf("%w: username already taken", ErrUserExists)
 	}
 
 	existingUser, err = s.repo.FindUserByEmail(user.Email)
 	if err == nil && existingUser != nil {
-		return nil, fmt.Errorf("email already in use")
+		return nil, fmt.Errorf("%w: email already in use", ErrUserExists)
 	}
 
 	// Hash the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	hashedPassword, err := hashPassword(user.Password)
 	if err != nil {
-		return nil, fmt.Errorf("failed to hash password: %v", err)
+		return nil, err
 	}
-	user.Password = string(hashedPassword)
+	user.Password = hashedPassword
+	user.Active = true
+
+	// New accounts always start with the least privileged role; only admins grant more
+	user.Role = models.RoleViewer
+
+	// An MDA is a data boundary, so self-registered users belong to none; a platform
+	// admin assigns them with AssignMDA
+	user.MdaID = ""
+	user.MDA = ""
 
 	// Set timestamps
 	user.CreatedAt = time.Now()
@@ -59,30 +119,178 @@ func (s *userService) RegisterUser(user *models.User) (*models.User, error) {
 		return nil, fmt.Errorf("failed to create user: %v", err)
 	}
 
+	if err := s.notifier.Registered(user); err != nil {
+		log.Printf("Failed to send registration confirmation to %s: %v", user.Username, err)
+	}
+
 	return user, nil
 }
 
-// AuthenticateUser authenticates a user by username and password
+// AuthenticateUser authenticates a user by username and password. A password is
+// hashed whether or not the user exists, and both failures return
+// ErrInvalidCredentials, so neither the error nor the timing reveals which usernames
+// are registered.
 func (s *userService) AuthenticateUser(username, password string) (*models.User, error) {
 	user, err := s.repo.FindUserByUsername(username)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to look up user: %v", err)
+	}
+
+	hash := unknownUserHash
+	if err == nil {
+		hash = []byte(user.Password)
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	if !user.Active {
+		return nil, ErrUserInactive
+	}
+
+	return user, nil
+}
+
+// UpdateProfile applies the fields a user may edit on their own account
+func (s *userService) UpdateProfile(username string, profile models.UserProfile) (*models.User, error) {
+	user, err := s.findUser("", username)
 	if err != nil {
-		return nil, fmt.Errorf("user not found: %v", err)
+		return nil, err
+	}
+
+	previous := *user
+	if profile.Email != "" && profile.Email != user.Email {
+		email, err := checkEmail(profile.Email)
+		if err != nil {
+			return nil, err
+		}
+		if profile.CurrentPassword == "" {
+			return nil, ErrPasswordRequired
+		}
+		if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(profile.CurrentPassword)) != nil {
+			return nil, ErrInvalidPassword
+		}
+		existingUser, err := s.repo.FindUserByEmail(email)
+		if err == nil && existingUser != nil {
+			return nil, fmt.Errorf("%w: email already in use", ErrUserExists)
+		}
+		user.Email = email
+	}
+	if profile.FirstName != "" {
+		user.FirstName = profile.FirstName
+	}
+	if profile.LastName != "" {
+		user.LastName = profile.LastName
+	}
+	if profile.PhoneNumber != "" {
+		user.PhoneNumber = profile.PhoneNumber
+	}
+	user.UpdatedAt = time.Now()
+
+	if err := s.repo.UpdateUser(user); err != nil {
+		return nil, fmt.Errorf("failed to update user: %v", err)
+	}
+
+	// Tell the old address, so a hijacked account cannot silently change it
+	if previous.Email != user.Email {
+		s.alert(&previous, fmt.Sprintf("Your email address was changed to %s", user.Email))
 	}
+	return user, nil
+}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+// ChangePassword replaces the user's password after checking the current one
+func (s *userService) ChangePassword(username, currentPassword, newPassword string) error {
+	user, err := s.findUser("", username)
 	if err != nil {
-		return nil, fmt.Errorf("invalid password")
+		return err
 	}
 
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(currentPassword)); err != nil {
+		return ErrInvalidPassword
+	}
+
+	hashedPassword, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	user.Password = hashedPassword
+	user.UpdatedAt = time.Now()
+
+	if err := s.repo.UpdateUser(user); err != nil {
+		return err
+	}
+
+	s.alert(user, "Your password was changed")
+	return nil
+}
+
+// ListUsers returns a page of users matching the filter and the total number of
+// matches. Admins belonging to an MDA only see that MDA's users.
+func (s *userService) ListUsers(actorMdaID string, filter models.UserFilter) ([]models.User, int64, error) {
+	if actorMdaID != "" {
+		filter.MdaID = actorMdaID
+	}
+	users, total, err := s.repo.ListUsers(filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list users: %v", err)
+	}
+	return users, total, nil
+}
+
+// GetUser returns a user visible to an admin in the given MDA
+func (s *userService) GetUser(actorMdaID, username string) (*models.User, error) {
+	return s.findUser(actorMdaID, username)
+}
+
+// SetActive deactivates or reactivates a user visible to an admin in the given MDA
+func (s *userService) SetActive(actorMdaID, username string, active bool) (*models.User, error) {
+	user, err := s.findUser(actorMdaID, username)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Active = active
+	user.DeactivatedAt = nil
+	if !active {
+		now := time.Now()
+		user.DeactivatedAt = &now
+	}
+	user.UpdatedAt = time.Now()
+
+	if err := s.repo.UpdateUser(user); err != nil {
+		return nil, fmt.Errorf("failed to update user: %v", err)
+	}
+
+	if active {
+		s.alert(user, "Your account was reactivated by an administrator")
+	} else {
+		s.alert(user, "Your account was deactivated by an administrator")
+	}
 	return user, nil
 }
 
-// UpdateUser updates user details
-func (s *userService) UpdateUser(user *models.User) error {
-	return s.repo.UpdateUser(user)
+// ChangeRole assigns a new role to a user. Callers are responsible for checking that
+// the acting user is an admin. An admin belonging to an MDA can only manage users of
+// that MDA; others are reported as not found.
+func (s *userService) ChangeRole(actorMdaID, username string, role models.Role) (*models.User, error) {
+	user, err := s.findUser(actorMdaID, username)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Role = role
+	user.UpdatedAt = time.Now()
+	if err := s.repo.UpdateUser(user); err != nil {
+		return nil, fmt.Errorf("failed to update role: %v", err)
+	}
+
+	s.alert(user, fmt.Sprintf("Your role was changed to %s", role))
+
+	return user, nil
 }
 
-// InitiatePasswordReset initiates a password reset
+// InitiatePasswordReset creates a reset token and sends the user a link containing it.
+// Only the token's hash is stored.
 func (s *userService) InitiatePasswordReset(email string) (*models.User, error) {
 	user, err := s.repo.FindUserByEmail(email)
 	if err != nil {
@@ -90,7 +298,11 @@ func (s *userService) InitiatePasswordReset(email string) (*models.User, error)
 	}
 
 	// Generate a reset token and expiry time
-	user.ResetToken = utils.GenerateRandomToken()
+	token, err := utils.NewToken(32)
+	if err != nil {
+		return nil, err
+	}
+	user.ResetToken = utils.HashToken(token)
 	user.ResetTokenExpiry = time.Now().Add(1 * time.Hour)
 
 	// Update the user with reset token details
@@ -98,30 +310,56 @@ func (s *userService) InitiatePasswordReset(email string) (*models.User, error)
 		return nil, fmt.Errorf("failed to update user with reset token: %v", err)
 	}
 
+	if err := s.notifier.PasswordReset(user, token, user.ResetTokenExpiry); err != nil {
+		return nil, fmt.Errorf("failed to send password reset link: %v", err)
+	}
+
 	return user, nil
 }
 
-// ResetPassword resets the user's password if the token is valid
-func (s *userService) ResetPassword(token, newPassword string) error {
-	user, err := s.repo.FindUserByResetToken(token)
+// ResetPassword resets the password of the user holding a valid token and returns the user
+func (s *userService) ResetPassword(token, newPassword string) (*models.User, error) {
+	// Users without a pending reset have an empty token, which must never match
+	if token == "" {
+		return nil, ErrInvalidResetToken
+	}
+
+	user, err := s.repo.FindUserByResetToken(utils.HashToken(token))
 	if err != nil {
-		return fmt.Errorf("invalid or expired reset token")
+		return nil, ErrInvalidResetToken
 	}
 
 	if time.Now().After(user.ResetTokenExpiry) {
-		return fmt.Errorf("reset token has expired")
+		return nil, ErrInvalidResetToken
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	hashedPassword, err := hashPassword(newPassword)
 	if err != nil {
-		return fmt.Errorf("failed to hash new password: %v", err)
+		return nil, err
 	}
 
-	user.Password = string(hashedPassword)
+	user.Password = hashedPassword
 	user.ResetToken = ""
 	user.ResetTokenExpiry = time.Time{}
 
-	return s.repo.UpdateUser(user)
+	if err := s.repo.UpdateUser(user); err != nil {
+		return nil, err
+	}
+
+	s.alert(user, "Your password was reset using a reset link")
+	return user, nil
+}
+
+// IsActive reports whether the user exists and has not been deactivated
+func (s *userService) IsActive(username string) (bool, error) {
+	user, err := s.repo.FindUserByUsername(username)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to look up user: %v", err)
+	}
+	return user.Active, nil
 }
 
 // GetUserByUsername retrieves a user by username
@@ -132,3 +370,104 @@ func (s *userService) GetUserByUsername(username string) (*models.User, error) {
 	}
 	return user, nil
 }
+
+// GetUserByID retrieves a user by ID
+func (s *userService) GetUserByID(id uint) (*models.User, error) {
+	user, err := s.repo.FindUserByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %v", err)
+	}
+	return user, nil
+}
+
+// AssignMDA moves a user to another MDA, or out of any MDA when mdaID is empty
+func (s *userService) AssignMDA(username, mdaID string) (*models.User, error) {
+	user, err := s.findUser("", username)
+	if err != nil {
+		return nil, err
+	}
+
+	user.MDA = ""
+	if mdaID != "" && mdaID != user.MdaID {
+		mda, err := s.joinableMDA(mdaID)
+		if err != nil {
+			return nil, err
+		}
+		user.MDA = mda.Name
+		mdaID = mda.Code
+	}
+	user.MdaID = mdaID
+	user.UpdatedAt = time.Now()
+
+	if err := s.repo.UpdateUser(user); err != nil {
+		return nil, fmt.Errorf("failed to update MDA: %v", err)
+	}
+	return user, nil
+}
+
+// findUser looks up a user visible to an actor in the given MDA; an empty actorMdaID sees every user
+func (s *userService) findUser(actorMdaID, username string) (*models.User, error) {
+	user, err := s.repo.FindUserByUsername(username)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up user: %v", err)
+	}
+	if actorMdaID != "" && user.MdaID != actorMdaID {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// joinableMDA returns the MDA if it exists and has not reached its user limit
+func (s *userService) joinableMDA(mdaID string) (*models.MDA, error) {
+	mda, err := s.mdaRepo.FindMDAByCode(mdaID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrMDANotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up MDA: %v", err)
+	}
+
+	if mda.MaxUsers > 0 {
+		count, err := s.repo.CountUsersByMDA(mda.Code)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count MDA users: %v", err)
+		}
+		if count >= int64(mda.MaxUsers) {
+			return nil, fmt.Errorf("%w (%s allows %d)", ErrMDAUserLimit, mda.Code, mda.MaxUsers)
+		}
+	}
+	return mda, nil
+}
+
+// checkEmail returns the bare address if it is a single valid email address
+func checkEmail(address string) (string, error) {
+	address = strings.TrimSpace(address)
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Address != address {
+		return "", ErrInvalidEmail
+	}
+	return parsed.Address, nil
+}
+
+// hashPassword checks the password policy and returns the bcrypt hash of the password
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", ErrWeakPassword
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %v", err)
+	}
+	return string(hashedPassword), nil
+}
+
+// alert sends a security alert, logging rather than failing when it cannot be delivered
+func (s *userService) alert(user *models.User, event string) {
+	if err := s.notifier.SecurityAlert(user, event); err != nil {
+		log.Printf("Failed to send security alert to %s: %v", user.Username, err)
+	}
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/repositories"
+)
+
+type fakeUserRepo struct {
+	repositories.UserRepository
+	users map[string]*models.User
+}
+
+func (r *fakeUserRepo) FindUserByUsername(username string) (*models.User, error) {
+	user, ok := r.users[username]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	found := *user
+	return &found, nil
+}
+
+func (r *fakeUserRepo) FindUserByEmail(email string) (*models.User, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			found := *user
+			return &found, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeUserRepo) CreateUser(user *models.User) error {
+	user.ID = uint(len(r.users) + 1)
+	stored := *user
+	r.users[user.Username] = &stored
+	return nil
+}
+
+func (r *fakeUserRepo) UpdateUser(user *models.User) error {
+	stored := *user
+	r.users[user.Username] = &stored
+	return nil
+}
+
+// fakeMDARepo knows one MDA with room for any number of users
+type fakeMDARepo struct {
+	repositories.MDARepository
+}
+
+func (fakeMDARepo) FindMDAByCode(code string) (*models.MDA, error) {
+	return &models.MDA{Code: "NUPRC", Name: "Upstream Petroleum Regulatory Commission"}, nil
+}
+
+// recordingNotifier records the account messages sent, by recipient address
+type recordingNotifier struct {
+	alerts map[string][]string
+}
+
+func (n *recordingNotifier) PasswordReset(*models.User, string, time.Time) error { return nil }
+func (n *recordingNotifier) Registered(*models.User) error                       { return nil }
+func (n *recordingNotifier) SecurityAlert(user *models.User, event string) error {
+	n.alerts[user.Email] = append(n.alerts[user.Email], event)
+	return nil
+}
+
+func newTestUserService() (UserService, *fakeUserRepo, *recordingNotifier) {
+	repo := &fakeUserRepo{users: map[string]*models.User{}}
+	notifications := &recordingNotifier{alerts: map[string][]string{}}
+	return NewUserService(repo, fakeMDARepo{}, notifications), repo, notifications
+}
+
+func TestRegisterUserJoinsNoMDA(t *testing.T) {
+	service, repo, _ := newTestUserService()
+
+	user, err := service.RegisterUser(&models.User{
+		Username: "intruder",
+		Email:    "intruder@example.com",
+		Password: "long enough password",
+		MdaID:    "NUPRC",
+		MDA:      "Upstream Petroleum Regulatory Commission",
+		Role:     models.RoleAdmin,
+	})
+	if err != nil {
+		t.Fatalf("RegisterUser: %v", err)
+	}
+	stored := repo.users["intruder"]
+	if user.MdaID != "" || stored.MdaID != "" || stored.MDA != "" {
+		t.Errorf("registered user joined MDA %q (%q), want none", stored.MdaID, stored.MDA)
+	}
+	if stored.Role != models.RoleViewer {
+		t.Errorf("role = %s, want %s", stored.Role, models.RoleViewer)
+	}
+
+	// Only a platform admin moves the user into a tenant
+	user, err = service.AssignMDA("intruder", "nuprc")
+	if err != nil || user.MdaID != "NUPRC" {
+		t.Errorf("AssignMDA = %q, %v; want NUPRC", user.MdaID, err)
+	}
+}
+
+func TestUpdateProfileEmailChange(t *testing.T) {
+	tests := []struct {
+		name     string
+		profile  models.UserProfile
+		wantErr  error
+		wantMail string
+	}{
+		{
+			name:     "with the current password",
+			profile:  models.UserProfile{Email: "ada@new.example.com", CurrentPassword: "correct horse battery"},
+			wantMail: "ada@new.example.com",
+		},
+		{
+			name:    "without the current password",
+			profile: models.UserProfile{Email: "attacker@example.com"},
+			wantErr: ErrPasswordRequired,
+		},
+		{
+			name:    "with a wrong password",
+			profile: models.UserProfile{Email: "attacker@example.com", CurrentPassword: "guess"},
+			wantErr: ErrInvalidPassword,
+		},
+		{
+			name:    "malformed address",
+			profile: models.UserProfile{Email: "not-an-address", CurrentPassword: "correct horse battery"},
+			wantErr: ErrInvalidEmail,
+		},
+		{
+			name:    "address with a display name",
+			profile: models.UserProfile{Email: "Ada <ada@new.example.com>", CurrentPassword: "correct horse battery"},
+			wantErr: ErrInvalidEmail,
+		},
+		{
+			name:    "address of another user",
+			profile: models.UserProfile{Email: "grace@example.com", CurrentPassword: "correct horse battery"},
+			wantErr: ErrUserExists,
+		},
+		{
+			name:     "other fields need no password",
+			profile:  models.UserProfile{FirstName: "Ada", Email: "ada@example.com"},
+			wantMail: "ada@example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, repo, notifications := newTestUserService()
+			for _, username := range []string{"ada", "grace"} {
+				if _, err := service.RegisterUser(&models.User{
+					Username: username, Email: username + "@example.com", Password: "correct horse battery",
+				}); err != nil {
+					t.Fatalf("RegisterUser: %v", err)
+				}
+			}
+
+			_, err := service.UpdateProfile("ada", tt.profile)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			want := tt.wantMail
+			if tt.wantErr != nil {
+				want = "ada@example.com"
+			}
+			if email := repo.users["ada"].Email; email != want {
+				t.Errorf("email = %s, want %s", email, want)
+			}
+			if changed := want != "ada@example.com"; changed != (len(notifications.alerts["ada@example.com"]) == 1) {
+				t.Errorf("alerts to the old address: %v", notifications.alerts["ada@example.com"])
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+// internal/services/webhook_endpoint.go
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"syscall"
+	"time"
+)
+
+var (
+	// errEndpointUnreachable wraps the transport errors of a delivery, which are logged
+	// but never shown to tenants since they describe the server's own network
+	errEndpointUnreachable = errors.New("endpoint unreachable")
+	// errBlockedAddress is returned when a webhook URL resolves to an address on the
+	// server's own networks
+	errBlockedAddress = errors.New("endpoint address is not allowed")
+)
+
+// nonPublicPrefixes are ranges outside the checks of netip.Addr that are not reachable
+// on the public internet
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "This" network
+	netip.MustParsePrefix("100.64.0.0/10"), // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // Benchmarking
+}
+
+// publicAddress reports whether webhooks may be delivered to the address: loopback,
+// private, link-local, unspecified and multicast addresses are the server's own networks
+func publicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkEndpointHost resolves the host of a webhook URL and rejects it unless every
+// address it has is public
+func (s *webhookService) checkEndpointHost(host string) error {
+	if s.options.AllowPrivateNetworks {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("%w: url host %s cannot be resolved", ErrInvalidWebhookSettings, host)
+	}
+	for _, addr := range addrs {
+		if !publicAddress(addr) {
+			return fmt.Errorf("%w: url host %s resolves to a non-public address", ErrInvalidWebhookSettings, host)
+		}
+	}
+	return nil
+}
+
+// dialControl refuses connections to non-public addresses. It runs after name
+// resolution, so a host that resolved to a public address when the subscription was
+// saved cannot be pointed at the server's own networks later.
+func dialControl(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !publicAddress(addrPort.Addr()) {
+		return errBlockedAddress
+	}
+	return nil
+}
+
+// deliveryError describes why a delivery failed in terms fit for the delivery log.
+// Transport errors are reduced to their kind.
+func deliveryError(err error) string {
+	if !errors.Is(err, errEndpointUnreachable) {
+		return err.Error()
+	}
+	var netErr net.Error
+	switch {
+	case errors.Is(err, errBlockedAddress):
+		return errBlockedAddress.Error()
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return "endpoint did not respond in time"
+	default:
+		return "could not connect to the endpoint"
+	}
+}
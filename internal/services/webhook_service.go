@@ -0,0 +1,753 @@
+// internal/services/webhook_service.go
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/repositories"
+	"github.com/abduls21985/exchange-rate-service/internal/utils"
+)
+
+var (
+	// ErrWebhookNotFound is returned when a subscription does not exist or belongs to another MDA
+	ErrWebhookNotFound = errors.New("webhook subscription not found")
+	// ErrDeliveryNotFound is returned when a delivery does not exist or belongs to another subscription
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	// ErrInvalidWebhookSettings is returned when the URL, secret, events, currencies or threshold are invalid
+	ErrInvalidWebhookSettings = errors.New("invalid webhook settings")
+)
+
+const (
+	// WebhookSignatureHeader carries the timestamp and HMAC-SHA256 signature of a delivery
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	// webhookSecretPrefix starts every generated secret
+	webhookSecretPrefix = "whsec_"
+	// minWebhookSecretLength is the shortest secret accepted from a caller
+	minWebhookSecretLength = 16
+	// maxWebhookErrorLength is the longest error kept in the delivery log
+	maxWebhookErrorLength = 500
+)
+
+// WebhookOptions configures the delivery of webhooks
+type WebhookOptions struct {
+	MaxAttempts  int           // Attempts before a delivery is marked as failed
+	BaseDelay    time.Duration // Delay before the first retry; doubles with each further attempt
+	MaxDelay     time.Duration
+	Timeout      time.Duration // Time allowed for an endpoint to answer
+	PollInterval time.Duration // How often due retries are looked for
+	BatchSize    int           // Deliveries sent concurrently
+	AllowHTTP    bool          // Accept plain http:// URLs; for development only
+	// AllowPrivateNetworks accepts endpoints on loopback, private and link-local
+	// addresses; for development only
+	AllowPrivateNetworks bool
+}
+
+// WebhookOptionsFromConfig reads the webhook settings from configuration
+func WebhookOptionsFromConfig() WebhookOptions {
+	options := WebhookOptions{
+		MaxAttempts:  viper.GetInt("webhooks.max_attempts"),
+		BaseDelay:    viper.GetDuration("webhooks.base_delay"),
+		MaxDelay:     viper.GetDuration("webhooks.max_delay"),
+		Timeout:      viper.GetDuration("webhooks.timeout"),
+		PollInterval: viper.GetDuration("webhooks.poll_interval"),
+		BatchSize:    viper.GetInt("webhooks.batch_size"),
+		AllowHTTP:    viper.GetBool("webhooks.allow_http"),
+
+		AllowPrivateNetworks: viper.GetBool("webhooks.allow_private_networks"),
+	}
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = 8
+	}
+	if options.BaseDelay <= 0 {
+		options.BaseDelay = 30 * time.Second
+	}
+	if options.MaxDelay <= 0 {
+		options.MaxDelay = 6 * time.Hour
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 10 * time.Second
+	}
+	if options.PollInterval <= 0 {
+		options.PollInterval = 5 * time.Second
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = 20
+	}
+	return options
+}
+
+// retryDelay returns the wait after the given number of failed attempts
+func (o WebhookOptions) retryDelay(attempts int) time.Duration {
+	delay := o.BaseDelay
+	for i := 1; i < attempts && delay < o.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > o.MaxDelay {
+		delay = o.MaxDelay
+	}
+	return delay
+}
+
+// WebhookService interface defines webhook subscriptions and the delivery of their events
+type WebhookService interface {
+	CreateSubscription(mdaID, createdBy string, settings models.WebhookSubscriptionSettings) (*models.WebhookSubscription, string, error)
+	ListSubscriptions(mdaID string) ([]models.WebhookSubscription, error)
+	GetSubscription(mdaID string, id uint) (*models.WebhookSubscription, error)
+	UpdateSubscription(mdaID string, id uint, settings models.WebhookSubscriptionSettings) (*models.WebhookSubscription, error)
+	DeleteSubscription(mdaID string, id uint) error
+	ListDeliveries(mdaID string, subscriptionID uint, status string, limit, offset int) ([]models.WebhookDelivery, error)
+	ReplayDelivery(mdaID string, subscriptionID, deliveryID uint) (*models.WebhookDelivery, error)
+	SnapshotsStored(snapshots []*models.RateSnapshot)
+	IngestionFailed(failure IngestionFailure)
+	Run(ctx context.Context)
+}
+
+type webhookService struct {
+	repo    repositories.WebhookRepository
+	rates   ExchangeRateService
+	mdas    MDAService
+	options WebhookOptions
+	client  *http.Client
+	wake    chan struct{} // Signals Run that new deliveries are due
+}
+
+// NewWebhookService creates a new instance of WebhookService. Events are queued in the
+// delivery log by SnapshotsStored and IngestionFailed, which are meant to be registered
+// as listeners of the exchange rate service, and sent by Run.
+func NewWebhookService(repo repositories.WebhookRepository, rates ExchangeRateService, mdas MDAService, options WebhookOptions) WebhookService {
+	dialer := &net.Dialer{Timeout: options.Timeout}
+	if !options.AllowPrivateNetworks {
+		dialer.Control = dialControl
+	}
+
+	return &webhookService{
+		repo:    repo,
+		rates:   rates,
+		mdas:    mdas,
+		options: options,
+		client: &http.Client{
+			Timeout: options.Timeout,
+			// Deliveries connect directly, so that the dialer sees the endpoint's address
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: options.Timeout,
+				MaxIdleConnsPerHost: 2,
+			},
+			// A redirect is treated as a failure rather than followed to another host
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// CreateSubscription creates a subscription for the MDA and returns it with its secret,
+// which is generated when the settings do not provide one
+func (s *webhookService) CreateSubscription(mdaID, createdBy string, settings models.WebhookSubscriptionSettings) (*models.WebhookSubscription, string, error) {
+	subscription := &models.WebhookSubscription{MdaID: mdaID, CreatedBy: createdBy, Active: true}
+	if settings.Secret == "" {
+		secret, err := utils.NewToken(24)
+		if err != nil {
+			return nil, "", err
+		}
+		settings.Secret = webhookSecretPrefix + secret
+	}
+	if err := s.applySettings(subscription, settings); err != nil {
+		return nil, "", err
+	}
+
+	if err := s.repo.CreateSubscription(subscription); err != nil {
+		return nil, "", fmt.Errorf("failed to create webhook subscription: %v", err)
+	}
+	return subscription, subscription.Secret, nil
+}
+
+// ListSubscriptions returns the MDA's subscriptions, newest first
+func (s *webhookService) ListSubscriptions(mdaID string) ([]models.WebhookSubscription, error) {
+	subscriptions, err := s.repo.ListSubscriptions(mdaID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook subscriptions: %v", err)
+	}
+	return subscriptions, nil
+}
+
+// GetSubscription returns one of the MDA's subscriptions
+func (s *webhookService) GetSubscription(mdaID string, id uint) (*models.WebhookSubscription, error) {
+	subscription, err := s.repo.FindSubscriptionByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && subscription.MdaID != mdaID) {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up webhook subscription: %v", err)
+	}
+	return subscription, nil
+}
+
+// UpdateSubscription replaces the settings of one of the MDA's subscriptions
+func (s *webhookService) UpdateSubscription(mdaID string, id uint, settings models.WebhookSubscriptionSettings) (*models.WebhookSubscription, error) {
+	subscription, err := s.GetSubscription(mdaID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.applySettings(subscription, settings); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdateSubscription(subscription); err != nil {
+		return nil, fmt.Errorf("failed to update webhook subscription: %v", err)
+	}
+	return subscription, nil
+}
+
+// DeleteSubscription deletes one of the MDA's subscriptions and its delivery log
+func (s *webhookService) DeleteSubscription(mdaID string, id uint) error {
+	subscription, err := s.GetSubscription(mdaID, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteSubscription(subscription.ID); err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %v", err)
+	}
+	return nil
+}
+
+// ListDeliveries returns the delivery log of one of the MDA's subscriptions, newest first
+func (s *webhookService) ListDeliveries(mdaID string, subscriptionID uint, status string, limit, offset int) ([]models.WebhookDelivery, error) {
+	subscription, err := s.GetSubscription(mdaID, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch status {
+	case "", models.DeliveryPending, models.DeliverySucceeded, models.DeliveryFailed:
+	default:
+		return nil, fmt.Errorf("%w: unknown delivery status %q", ErrInvalidWebhookSettings, status)
+	}
+
+	deliveries, err := s.repo.ListDeliveries(subscription.ID, status, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %v", err)
+	}
+	return deliveries, nil
+}
+
+// ReplayDelivery queues the event of a logged delivery to be sent again. The replay is
+// a new delivery with the same event ID, so that endpoints can recognise duplicates.
+func (s *webhookService) ReplayDelivery(mdaID string, subscriptionID, deliveryID uint) (*models.WebhookDelivery, error) {
+	subscription, err := s.GetSubscription(mdaID, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	original, err := s.repo.FindDeliveryByID(deliveryID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && original.SubscriptionID != subscription.ID) {
+		return nil, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up webhook delivery: %v", err)
+	}
+
+	replay := &models.WebhookDelivery{
+		SubscriptionID: subscription.ID,
+		EventID:        original.EventID,
+		EventType:      original.EventType,
+		Payload:        original.Payload,
+		Status:         models.DeliveryPending,
+		NextAttemptAt:  time.Now().UTC(),
+		ReplayOfID:     &original.ID,
+	}
+	if err := s.repo.CreateDeliveries([]*models.WebhookDelivery{replay}); err != nil {
+		return nil, fmt.Errorf("failed to queue webhook replay: %v", err)
+	}
+	s.signal()
+	return replay, nil
+}
+
+// SnapshotsStored queues snapshot.stored and rate.moved events for stored snapshots.
+// It returns at once; the events are built in the background.
+func (s *webhookService) SnapshotsStored(snapshots []*models.RateSnapshot) {
+	go func() {
+		if err := s.queueSnapshotEvents(snapshots); err != nil {
+			log.Printf("Error queueing webhooks for stored snapshots: %v", err)
+		}
+	}()
+}
+
+// IngestionFailed queues ingestion.failed events. Like SnapshotsStored it returns at once.
+func (s *webhookService) IngestionFailed(failure IngestionFailure) {
+	go func() {
+		if err := s.queueFailureEvents(failure); err != nil {
+			log.Printf("Error queueing webhooks for the failed ingestion of %s: %v", failure.Source, err)
+		}
+	}()
+}
+
+// Run sends due deliveries until ctx ends, checking for retries every poll interval and
+// for new events as soon as they are queued
+func (s *webhookService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.options.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.deliverDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// signal wakes Run without waiting for it
+func (s *webhookService) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// rateMovedEvent is the data of a rate.moved event
+type rateMovedEvent struct {
+	SnapshotID         uint            `json:"snapshot_id"`
+	PreviousSnapshotID uint            `json:"previous_snapshot_id"`
+	Source             string          `json:"source"`
+	Base               string          `json:"base"`
+	Timestamp          int64           `json:"timestamp"`
+	ThresholdPercent   decimal.Decimal `json:"threshold_percent"`
+	Changes            []rateChange    `json:"changes"`
+}
+
+// rateChange is the move of one currency in a rate.moved event
+type rateChange struct {
+	Currency      string          `json:"currency"`
+	PreviousRate  decimal.Decimal `json:"previous_rate"`
+	Rate          decimal.Decimal `json:"rate"`
+	ChangePercent decimal.Decimal `json:"change_percent"`
+}
+
+// ingestionFailedEvent is the data of an ingestion.failed event
+type ingestionFailedEvent struct {
+	Source   string    `json:"source"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// queueSnapshotEvents adds the events each active subscription should receive about
+// the snapshots to the delivery log. Snapshots of past dates, such as those loaded by a
+// backfill, are not announced.
+func (s *webhookService) queueSnapshotEvents(snapshots []*models.RateSnapshot) error {
+	subscriptions, err := s.repo.ListActiveSubscriptions()
+	if err != nil || len(subscriptions) == 0 {
+		return err
+	}
+
+	// Each MDA is loaded once per batch, so a change to its allowed currencies applies
+	// to the next publication
+	tenants := make(map[string]*models.MDA)
+
+	var deliveries []*models.WebhookDelivery
+	for _, snapshot := range snapshots {
+		newer, err := s.rates.HasNewerSnapshot(snapshot)
+		if err != nil {
+			return err
+		}
+		if newer {
+			continue
+		}
+
+		// The previous publication is loaded once, and only if someone watches for moves
+		var previous *models.RateSnapshot
+		loadedPrevious := false
+
+		for i := range subscriptions {
+			subscription := &subscriptions[i]
+			if !visibleTo(subscription, snapshot.Source) {
+				continue
+			}
+			tenant, err := s.subscriptionTenant(subscription, tenants)
+			if errors.Is(err, ErrMDANotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			if subscription.Subscribes(models.WebhookSnapshotStored) {
+				filter := RateStreamFilter{Tenant: tenant, Currencies: subscription.Currencies}
+				if update, ok := filter.update(snapshot); ok {
+					delivery, err := newDelivery(subscription, models.WebhookSnapshotStored, update)
+					if err != nil {
+						return err
+					}
+					deliveries = append(deliveries, delivery)
+				}
+			}
+
+			if subscription.Subscribes(models.WebhookRateMoved) {
+				if !loadedPrevious {
+					previous, err = s.rates.GetPreviousSnapshot(snapshot)
+					if errors.Is(err, gorm.ErrRecordNotFound) {
+						previous, err = nil, nil
+					}
+					if err != nil {
+						return err
+					}
+					loadedPrevious = true
+				}
+				if event, ok := rateMoves(subscription, tenant, previous, snapshot); ok {
+					delivery, err := newDelivery(subscription, models.WebhookRateMoved, event)
+					if err != nil {
+						return err
+					}
+					deliveries = append(deliveries, delivery)
+				}
+			}
+		}
+	}
+
+	return s.queue(deliveries)
+}
+
+// subscriptionTenant returns the MDA of the subscription, or nil for a global one,
+// loading each MDA once into tenants
+func (s *webhookService) subscriptionTenant(subscription *models.WebhookSubscription, tenants map[string]*models.MDA) (*models.MDA, error) {
+	if subscription.MdaID == "" {
+		return nil, nil
+	}
+	if tenant, ok := tenants[subscription.MdaID]; ok {
+		return tenant, nil
+	}
+	tenant, err := s.mdas.GetMDA(subscription.MdaID)
+	if errors.Is(err, ErrMDANotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up MDA %s: %v", subscription.MdaID, err)
+	}
+	tenants[subscription.MdaID] = tenant
+	return tenant, nil
+}
+
+// queueFailureEvents adds an ingestion.failed event for each subscription that can see
+// the source to the delivery log
+func (s *webhookService) queueFailureEvents(failure IngestionFailure) error {
+	subscriptions, err := s.repo.ListActiveSubscriptions()
+	if err != nil || len(subscriptions) == 0 {
+		return err
+	}
+
+	event := ingestionFailedEvent{Source: failure.Source, FailedAt: failure.FailedAt}
+	if failure.Err != nil {
+		event.Error = failure.Err.Error()
+	}
+
+	var deliveries []*models.WebhookDelivery
+	for i := range subscriptions {
+		subscription := &subscriptions[i]
+		if !subscription.Subscribes(models.WebhookIngestionFailed) || !visibleTo(subscription, models.RateSource{Code: failure.Source, MdaID: failure.MdaID}) {
+			continue
+		}
+		delivery, err := newDelivery(subscription, models.WebhookIngestionFailed, event)
+		if err != nil {
+			return err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return s.queue(deliveries)
+}
+
+// queue stores deliveries and wakes the sender
+func (s *webhookService) queue(deliveries []*models.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	if err := s.repo.CreateDeliveries(deliveries); err != nil {
+		return fmt.Errorf("failed to store webhook deliveries: %v", err)
+	}
+	s.signal()
+	return nil
+}
+
+// deliverDue sends due deliveries, a batch at a time, until none are left
+func (s *webhookService) deliverDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		// A claim outlasts an attempt, so no other process retries a delivery in flight
+		deliveries, err := s.repo.ClaimDueDeliveries(time.Now().UTC(), 2*s.options.Timeout, s.options.BatchSize)
+		if err != nil {
+			log.Printf("Error claiming webhook deliveries: %v", err)
+			return
+		}
+
+		var wg sync.WaitGroup
+		for i := range deliveries {
+			wg.Add(1)
+			go func(delivery *models.WebhookDelivery) {
+				defer wg.Done()
+				s.attempt(ctx, delivery)
+			}(&deliveries[i])
+		}
+		wg.Wait()
+
+		if len(deliveries) < s.options.BatchSize {
+			return
+		}
+	}
+}
+
+// attempt sends a delivery once and records the outcome, scheduling a retry with
+// exponential backoff or giving up after the maximum number of attempts
+func (s *webhookService) attempt(ctx context.Context, delivery *models.WebhookDelivery) {
+	statusCode, err := s.send(ctx, delivery)
+	now := time.Now().UTC()
+
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliverySucceeded
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+	case delivery.Attempts >= s.options.MaxAttempts:
+		delivery.Status = models.DeliveryFailed
+		delivery.LastError = truncate(deliveryError(err), maxWebhookErrorLength)
+		log.Printf("Webhook delivery %d to subscription %d failed after %d attempts: %v", delivery.ID, delivery.SubscriptionID, delivery.Attempts, err)
+	default:
+		delivery.NextAttemptAt = now.Add(s.options.retryDelay(delivery.Attempts))
+		delivery.LastError = truncate(deliveryError(err), maxWebhookErrorLength)
+	}
+
+	if err := s.repo.UpdateDelivery(delivery); err != nil {
+		log.Printf("Error recording webhook delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// send posts the delivery's payload, signed with the subscription's secret, and returns
+// the status code of the response along with an error unless it was a 2xx
+func (s *webhookService) send(ctx context.Context, delivery *models.WebhookDelivery) (int, error) {
+	if delivery.Subscription == nil {
+		return 0, errors.New("subscription not found")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Subscription.URL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "exchange-rate-service-webhooks")
+	req.Header.Set("X-Webhook-ID", delivery.EventID)
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(WebhookSignatureHeader, fmt.Sprintf("t=%d,v1=%s", timestamp, SignWebhook(delivery.Subscription.Secret, timestamp, delivery.Payload)))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", errEndpointUnreachable, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhook returns the hex encoded HMAC-SHA256 of "timestamp.payload" under the
+// secret. Receivers recompute it to check that a delivery is genuine, and reject old
+// timestamps to stop replays of captured deliveries.
+func SignWebhook(secret string, timestamp int64, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.%s", timestamp, payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// applySettings validates the settings and copies them onto the subscription. The
+// currencies of an MDA's subscription must be allowed for the MDA, and default to its
+// allowed list.
+func (s *webhookService) applySettings(subscription *models.WebhookSubscription, settings models.WebhookSubscriptionSettings) error {
+	endpoint, err := url.Parse(strings.TrimSpace(settings.URL))
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "https" && !(s.options.AllowHTTP && endpoint.Scheme == "http")) {
+		return fmt.Errorf("%w: url must be an absolute https URL", ErrInvalidWebhookSettings)
+	}
+	if len(endpoint.String()) > 500 {
+		return fmt.Errorf("%w: url cannot be longer than 500 characters", ErrInvalidWebhookSettings)
+	}
+	if err := s.checkEndpointHost(endpoint.Hostname()); err != nil {
+		return err
+	}
+
+	if settings.Secret != "" && (len(settings.Secret) < minWebhookSecretLength || len(settings.Secret) > 100) {
+		return fmt.Errorf("%w: secret must be between %d and 100 characters", ErrInvalidWebhookSettings, minWebhookSecretLength)
+	}
+
+	events, err := normalizeWebhookEvents(settings.Events)
+	if err != nil {
+		return err
+	}
+
+	if settings.ThresholdPercent.IsNegative() {
+		return fmt.Errorf("%w: threshold_percent cannot be negative", ErrInvalidWebhookSettings)
+	}
+	for _, event := range events {
+		if event == models.WebhookRateMoved && !settings.ThresholdPercent.IsPositive() {
+			return fmt.Errorf("%w: %s events need a threshold_percent above 0", ErrInvalidWebhookSettings, models.WebhookRateMoved)
+		}
+	}
+
+	var tenant *models.MDA
+	if subscription.MdaID != "" {
+		tenant, err = s.mdas.GetMDA(subscription.MdaID)
+		if err != nil {
+			return fmt.Errorf("failed to look up MDA %s: %v", subscription.MdaID, err)
+		}
+	}
+	currencies := make([]string, 0, len(settings.Currencies))
+	for _, code := range settings.Currencies {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if !tenant.AllowsCurrency(code) {
+			return fmt.Errorf("%w: %s", ErrCurrencyNotAllowed, code)
+		}
+		if !containsString(currencies, code) {
+			currencies = append(currencies, code)
+		}
+	}
+	if len(currencies) == 0 && tenant != nil {
+		currencies = append(currencies, tenant.AllowedCurrencies...)
+	}
+
+	subscription.URL = endpoint.String()
+	if settings.Secret != "" {
+		subscription.Secret = settings.Secret
+	}
+	subscription.Events = events
+	subscription.Currencies = currencies
+	subscription.ThresholdPercent = settings.ThresholdPercent
+	if settings.Active != nil {
+		subscription.Active = *settings.Active
+	}
+	return nil
+}
+
+// normalizeWebhookEvents checks that every event type exists and removes duplicates
+func normalizeWebhookEvents(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return nil, fmt.Errorf("%w: at least one event is required", ErrInvalidWebhookSettings)
+	}
+
+	events := make([]string, 0, len(requested))
+	for _, event := range requested {
+		event = strings.TrimSpace(event)
+		if !containsString(models.WebhookEventTypes, event) {
+			return nil, fmt.Errorf("%w: unknown event %q (valid events: %s)", ErrInvalidWebhookSettings, event, strings.Join(models.WebhookEventTypes, ", "))
+		}
+		if !containsString(events, event) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// visibleTo reports whether the subscription may hear of the source: global sources are
+// visible to every MDA, custom sources only to the MDA that owns them
+func visibleTo(subscription *models.WebhookSubscription, source models.RateSource) bool {
+	return source.MdaID == "" || source.MdaID == subscription.MdaID
+}
+
+// rateMoves compares the snapshot with the previous publication of its source and
+// returns the event listing the subscription's currencies that moved by at least its
+// threshold, reporting false if none did. Currencies the MDA may no longer use are left
+// out even if the subscription still lists them.
+func rateMoves(subscription *models.WebhookSubscription, tenant *models.MDA, previous, snapshot *models.RateSnapshot) (rateMovedEvent, bool) {
+	if previous == nil || previous.BaseCurrencyID != snapshot.BaseCurrencyID {
+		return rateMovedEvent{}, false
+	}
+
+	previousRates := make(map[string]decimal.Decimal, len(previous.Rates))
+	for _, rate := range previous.Rates {
+		previousRates[rate.Currency.Code] = rate.Rate
+	}
+
+	hundred := decimal.NewFromInt(100)
+	var changes []rateChange
+	for _, rate := range snapshot.Rates {
+		code := rate.Currency.Code
+		before, ok := previousRates[code]
+		if !ok || before.IsZero() || !subscription.Watches(code) || !tenant.AllowsCurrency(code) {
+			continue
+		}
+		change := rate.Rate.Sub(before).Div(before).Mul(hundred)
+		if change.Abs().LessThan(subscription.ThresholdPercent) {
+			continue
+		}
+		changes = append(changes, rateChange{
+			Currency:      code,
+			PreviousRate:  before,
+			Rate:          rate.Rate,
+			ChangePercent: change.Round(4),
+		})
+	}
+	if len(changes) == 0 {
+		return rateMovedEvent{}, false
+	}
+
+	return rateMovedEvent{
+		SnapshotID:         snapshot.ID,
+		PreviousSnapshotID: previous.ID,
+		Source:             snapshot.Source.Code,
+		Base:               snapshot.BaseCurrency.Code,
+		Timestamp:          snapshot.ProviderTimestamp.Unix(),
+		ThresholdPercent:   subscription.ThresholdPercent,
+		Changes:            changes,
+	}, true
+}
+
+// newDelivery builds a pending delivery of a new event to the subscription
+func newDelivery(subscription *models.WebhookSubscription, eventType string, data interface{}) (*models.WebhookDelivery, error) {
+	id, err := utils.NewToken(12)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+
+	payload, err := json.Marshal(models.WebhookEvent{ID: "evt_" + id, Type: eventType, CreatedAt: now, Data: data})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s event: %v", eventType, err)
+	}
+
+	return &models.WebhookDelivery{
+		SubscriptionID: subscription.ID,
+		EventID:        "evt_" + id,
+		EventType:      eventType,
+		Payload:        string(payload),
+		Status:         models.DeliveryPending,
+		NextAttemptAt:  now,
+	}, nil
+}
@@ -0,0 +1,395 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/repositories"
+)
+
+type fakeWebhookRepo struct {
+	repositories.WebhookRepository
+	subscriptions map[uint]*models.WebhookSubscription
+	deliveries    map[uint]*models.WebhookDelivery
+}
+
+func (r *fakeWebhookRepo) ListActiveSubscriptions() ([]models.WebhookSubscription, error) {
+	subscriptions := make([]models.WebhookSubscription, 0, len(r.subscriptions))
+	for id := uint(1); id <= uint(len(r.subscriptions)); id++ {
+		subscriptions = append(subscriptions, *r.subscriptions[id])
+	}
+	return subscriptions, nil
+}
+
+func (r *fakeWebhookRepo) FindSubscriptionByID(id uint) (*models.WebhookSubscription, error) {
+	subscription, ok := r.subscriptions[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return subscription, nil
+}
+
+func (r *fakeWebhookRepo) FindDeliveryByID(id uint) (*models.WebhookDelivery, error) {
+	delivery, ok := r.deliveries[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	found := *delivery
+	return &found, nil
+}
+
+func (r *fakeWebhookRepo) CreateDeliveries(deliveries []*models.WebhookDelivery) error {
+	for _, delivery := range deliveries {
+		delivery.ID = uint(len(r.deliveries) + 1)
+		stored := *delivery
+		r.deliveries[delivery.ID] = &stored
+	}
+	return nil
+}
+
+func (r *fakeWebhookRepo) UpdateDelivery(delivery *models.WebhookDelivery) error {
+	stored := *delivery
+	r.deliveries[delivery.ID] = &stored
+	return nil
+}
+
+func TestSignWebhook(t *testing.T) {
+	// Computed independently with: printf '1700000000.<payload>' | openssl dgst -sha256 -hmac <secret>
+	signature := SignWebhook("whsec_0123456789abcdef", 1700000000, `{"event":"snapshot.stored","id":"evt_1"}`)
+	if want := "513faf3cfd07df547b25b98145c8332caff324ab3f0839777232b6af3fc19852"; signature != want {
+		t.Errorf("signature = %s, want %s", signature, want)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	options := WebhookOptions{BaseDelay: 30 * time.Second, MaxDelay: 6 * time.Hour}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{5, 8 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, 6 * time.Hour},
+		{40, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := options.retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// webhookEndpoint answers deliveries with the status, checking their signature
+func webhookEndpoint(t *testing.T, secret string, status *int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var timestamp int64
+		var signature string
+		if _, err := fmt.Sscanf(r.Header.Get(WebhookSignatureHeader), "t=%d,v1=%s", &timestamp, &signature); err != nil {
+			t.Errorf("malformed signature header %q: %v", r.Header.Get(WebhookSignatureHeader), err)
+		}
+		if want := SignWebhook(secret, timestamp, string(body)); signature != want {
+			t.Errorf("signature = %s, want %s", signature, want)
+		}
+		if age := time.Since(time.Unix(timestamp, 0)); age < -time.Second || age > time.Minute {
+			t.Errorf("signature timestamp is %s old", age)
+		}
+		w.WriteHeader(*status)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAttemptSchedulesRetriesThenFails(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	subscription := &models.WebhookSubscription{ID: 1, Secret: "whsec_0123456789abcdef"}
+	subscription.URL = webhookEndpoint(t, subscription.Secret, &status).URL
+
+	repo := &fakeWebhookRepo{deliveries: map[uint]*models.WebhookDelivery{}}
+	options := WebhookOptions{MaxAttempts: 3, BaseDelay: 30 * time.Second, MaxDelay: time.Hour, Timeout: time.Second, AllowPrivateNetworks: true}
+	service := NewWebhookService(repo, nil, nil, options).(*webhookService)
+
+	delivery := &models.WebhookDelivery{
+		ID: 1, SubscriptionID: 1, Subscription: subscription, EventID: "evt_1",
+		EventType: "snapshot.stored", Payload: `{"id":"evt_1"}`, Status: models.DeliveryPending,
+	}
+	for attempts := 1; attempts < options.MaxAttempts; attempts++ {
+		before := time.Now().UTC()
+		service.attempt(context.Background(), delivery)
+
+		stored := repo.deliveries[1]
+		if stored.Status != models.DeliveryPending || stored.Attempts != attempts || stored.LastStatusCode != status {
+			t.Fatalf("after attempt %d: status %s, attempts %d, code %d", attempts, stored.Status, stored.Attempts, stored.LastStatusCode)
+		}
+		wait := stored.NextAttemptAt.Sub(before)
+		if want := options.retryDelay(attempts); wait < want || wait > want+time.Second {
+			t.Errorf("after attempt %d the next one is due in %s, want %s", attempts, wait, want)
+		}
+	}
+
+	service.attempt(context.Background(), delivery)
+	stored := repo.deliveries[1]
+	if stored.Status != models.DeliveryFailed || stored.Attempts != options.MaxAttempts || stored.LastError == "" {
+		t.Errorf("after the last attempt: status %s, attempts %d, error %q", stored.Status, stored.Attempts, stored.LastError)
+	}
+}
+
+func TestReplayFailedDelivery(t *testing.T) {
+	status := http.StatusOK
+	subscription := &models.WebhookSubscription{ID: 1, MdaID: "FMF", Secret: "whsec_0123456789abcdef"}
+	subscription.URL = webhookEndpoint(t, subscription.Secret, &status).URL
+
+	failed := &models.WebhookDelivery{
+		ID: 1, SubscriptionID: 1, EventID: "evt_1", EventType: "snapshot.stored",
+		Payload: `{"id":"evt_1"}`, Status: models.DeliveryFailed, Attempts: 8, LastError: "endpoint responded with 503",
+	}
+	repo := &fakeWebhookRepo{
+		subscriptions: map[uint]*models.WebhookSubscription{
+			1: subscription,
+			2: {ID: 2, MdaID: "CBN"},
+		},
+		deliveries: map[uint]*models.WebhookDelivery{1: failed},
+	}
+	service := NewWebhookService(repo, nil, nil, WebhookOptions{MaxAttempts: 3, Timeout: time.Second, AllowPrivateNetworks: true}).(*webhookService)
+
+	if _, err := service.ReplayDelivery("CBN", 1, 1); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("replay by another MDA: err = %v, want ErrWebhookNotFound", err)
+	}
+	if _, err := service.ReplayDelivery("CBN", 2, 1); !errors.Is(err, ErrDeliveryNotFound) {
+		t.Errorf("replay through another subscription: err = %v, want ErrDeliveryNotFound", err)
+	}
+
+	replay, err := service.ReplayDelivery("FMF", 1, 1)
+	if err != nil {
+		t.Fatalf("ReplayDelivery: %v", err)
+	}
+	if replay.ID == failed.ID || replay.EventID != failed.EventID || replay.Payload != failed.Payload {
+		t.Errorf("replay %+v, want a new delivery of event %s", replay, failed.EventID)
+	}
+	if replay.Status != models.DeliveryPending || replay.Attempts != 0 || replay.ReplayOfID == nil || *replay.ReplayOfID != failed.ID {
+		t.Errorf("replay %+v, want a pending delivery replaying %d", replay, failed.ID)
+	}
+	if replay.NextAttemptAt.After(time.Now().UTC()) {
+		t.Errorf("replay is due at %s, want it due now", replay.NextAttemptAt)
+	}
+
+	replay.Subscription = subscription
+	service.attempt(context.Background(), replay)
+	if stored := repo.deliveries[replay.ID]; stored.Status != models.DeliverySucceeded || stored.DeliveredAt == nil {
+		t.Errorf("replay after sending: status %s, delivered at %v", stored.Status, stored.DeliveredAt)
+	}
+	if original := repo.deliveries[failed.ID]; original.Status != models.DeliveryFailed || original.Attempts != 8 {
+		t.Errorf("original delivery changed to status %s with %d attempts", original.Status, original.Attempts)
+	}
+}
+
+func TestPublicAddress(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.10", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"100.64.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"224.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := publicAddress(netip.MustParseAddr(tt.addr)); got != tt.public {
+			t.Errorf("publicAddress(%s) = %v, want %v", tt.addr, got, tt.public)
+		}
+	}
+}
+
+func TestApplySettingsRejectsInternalEndpoints(t *testing.T) {
+	service := NewWebhookService(&fakeWebhookRepo{}, nil, nil, WebhookOptions{AllowHTTP: true}).(*webhookService)
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://93.184.216.34/hooks/rates", true},
+		{"https://localhost:8443/hooks", false},
+		{"https://127.0.0.1/hooks", false},
+		{"https://10.0.0.5/hooks", false},
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"https://[::1]:9000/hooks", false},
+		{"https://[::ffff:10.0.0.5]/hooks", false},
+		{"ftp://93.184.216.34/hooks", false},
+	}
+	for _, tt := range tests {
+		subscription := &models.WebhookSubscription{}
+		err := service.applySettings(subscription, models.WebhookSubscriptionSettings{
+			URL:    tt.url,
+			Events: []string{models.WebhookSnapshotStored},
+		})
+		if tt.valid && err != nil {
+			t.Errorf("%s: err = %v, want it accepted", tt.url, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidWebhookSettings) {
+			t.Errorf("%s: err = %v, want ErrInvalidWebhookSettings", tt.url, err)
+		}
+	}
+}
+
+func TestDeliveryToInternalAddressIsRefusedAtDialTime(t *testing.T) {
+	reached := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	defer server.Close()
+
+	// The host may have resolved to a public address when the subscription was saved
+	repo := &fakeWebhookRepo{deliveries: map[uint]*models.WebhookDelivery{}}
+	service := NewWebhookService(repo, nil, nil, WebhookOptions{MaxAttempts: 1, Timeout: time.Second}).(*webhookService)
+	delivery := &models.WebhookDelivery{
+		ID: 1, SubscriptionID: 1, EventID: "evt_1", Payload: `{}`, Status: models.DeliveryPending,
+		Subscription: &models.WebhookSubscription{ID: 1, URL: server.URL, Secret: "whsec_0123456789abcdef"},
+	}
+	service.attempt(context.Background(), delivery)
+
+	if reached {
+		t.Error("the delivery reached an endpoint on a loopback address")
+	}
+	stored := repo.deliveries[1]
+	if stored.Status != models.DeliveryFailed || stored.LastError != errBlockedAddress.Error() || stored.LastStatusCode != 0 {
+		t.Errorf("delivery: status %s, code %d, error %q", stored.Status, stored.LastStatusCode, stored.LastError)
+	}
+}
+
+func TestDeliveryErrorHidesTransportDetails(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connect: connection refused 10.0.0.7:5432")}
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("%w: %w", errEndpointUnreachable, refused), "could not connect to the endpoint"},
+		{fmt.Errorf("%w: %w", errEndpointUnreachable, context.DeadlineExceeded), "endpoint did not respond in time"},
+		{fmt.Errorf("%w: %w", errEndpointUnreachable, errBlockedAddress), "endpoint address is not allowed"},
+		{errors.New("endpoint responded with 503 Service Unavailable"), "endpoint responded with 503 Service Unavailable"},
+	}
+	for _, tt := range tests {
+		if got := deliveryError(tt.err); got != tt.want {
+			t.Errorf("deliveryError(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+// webhookRates knows one earlier publication of every snapshot's source
+type webhookRates struct {
+	ExchangeRateService
+	previous *models.RateSnapshot
+}
+
+func (r webhookRates) HasNewerSnapshot(*models.RateSnapshot) (bool, error) {
+	return false, nil
+}
+
+func (r webhookRates) GetPreviousSnapshot(*models.RateSnapshot) (*models.RateSnapshot, error) {
+	return r.previous, nil
+}
+
+// countingMDAs serves MDAs from a map, counting the lookups
+type countingMDAs struct {
+	MDAService
+	mdas    map[string]*models.MDA
+	lookups int
+}
+
+func (m *countingMDAs) GetMDA(code string) (*models.MDA, error) {
+	m.lookups++
+	mda, ok := m.mdas[code]
+	if !ok {
+		return nil, ErrMDANotFound
+	}
+	return mda, nil
+}
+
+func TestQueueSnapshotEventsAppliesMDAAllowlist(t *testing.T) {
+	// NUPRC was allowed EUR when it subscribed, and has since been limited to USD
+	events := []string{models.WebhookSnapshotStored, models.WebhookRateMoved}
+	repo := &fakeWebhookRepo{
+		subscriptions: map[uint]*models.WebhookSubscription{
+			1: {ID: 1, MdaID: "NUPRC", Active: true, Events: events, Currencies: []string{"USD", "EUR"}, ThresholdPercent: decimal.NewFromInt(1)},
+			2: {ID: 2, MdaID: "NUPRC", Active: true, Events: events, ThresholdPercent: decimal.NewFromInt(1)},
+			3: {ID: 3, Active: true, Events: events, ThresholdPercent: decimal.NewFromInt(1)},
+			4: {ID: 4, MdaID: "GONE", Active: true, Events: events, ThresholdPercent: decimal.NewFromInt(1)},
+		},
+		deliveries: map[uint]*models.WebhookDelivery{},
+	}
+	mdas := &countingMDAs{mdas: map[string]*models.MDA{"NUPRC": {Code: "NUPRC", AllowedCurrencies: []string{"USD"}}}}
+	rates := webhookRates{previous: testSnapshot(1, map[string]float64{"USD": 1500, "EUR": 1600, "GBP": 1900})}
+	service := NewWebhookService(repo, rates, mdas, WebhookOptions{}).(*webhookService)
+
+	snapshot := testSnapshot(2, map[string]float64{"USD": 1530, "EUR": 1650, "GBP": 1950})
+	if err := service.queueSnapshotEvents([]*models.RateSnapshot{snapshot}); err != nil {
+		t.Fatalf("queueSnapshotEvents: %v", err)
+	}
+	if mdas.lookups != 2 {
+		t.Errorf("looked up MDAs %d times, want once for each of NUPRC and GONE", mdas.lookups)
+	}
+
+	want := map[uint][]string{1: {"USD"}, 2: {"USD"}, 3: {"EUR", "GBP", "USD"}}
+	got := map[uint]map[string][]string{}
+	for _, delivery := range repo.deliveries {
+		var event struct {
+			Data struct {
+				Rates   map[string]decimal.Decimal `json:"rates"`
+				Changes []rateChange               `json:"changes"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(delivery.Payload), &event); err != nil {
+			t.Fatalf("payload %s: %v", delivery.Payload, err)
+		}
+		var currencies []string
+		for code := range event.Data.Rates {
+			currencies = append(currencies, code)
+		}
+		for _, change := range event.Data.Changes {
+			currencies = append(currencies, change.Currency)
+		}
+		sort.Strings(currencies)
+		if got[delivery.SubscriptionID] == nil {
+			got[delivery.SubscriptionID] = map[string][]string{}
+		}
+		got[delivery.SubscriptionID][delivery.EventType] = currencies
+	}
+
+	if _, ok := got[4]; ok {
+		t.Error("subscription of a deleted MDA received events")
+	}
+	for id, currencies := range want {
+		for _, eventType := range events {
+			if fmt.Sprint(got[id][eventType]) != fmt.Sprint(currencies) {
+				t.Errorf("subscription %d %s: currencies %v, want %v", id, eventType, got[id][eventType], currencies)
+			}
+		}
+	}
+}
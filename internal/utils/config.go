@@ -43,10 +43,10 @@ func validateConfig() error {
 		"database.password",
 		"database.dbname",
 		"database.sslmode",
-		"exchange_rate_api_url", // Add required configuration for the exchange rate API URL
-		"exchange_rate_app_id",  // Add required configuration for the exchange rate API App ID
 	}
 
+	// Provider specific keys are validated when the rate provider registry is built
+
 	// Iterate over required keys and check if they are set
 	for _, key := range requiredKeys {
 		if !viper.IsSet(key) {
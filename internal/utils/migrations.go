@@ -11,9 +11,23 @@ import (
 // RunMigrations uses GORM to auto-migrate database schemas
 func RunMigrations() error {
 	if err := DB.AutoMigrate(
+		&models.MDA{},
 		&models.User{},
 		&models.Currency{},
+		&models.RateSource{},
+		&models.RateSnapshot{},
 		&models.ExchangeRate{},
+		&models.BackfillJob{},
+		&models.Session{},
+		&models.RevokedToken{},
+		&models.APIKey{},
+		&models.AuditEvent{},
+		&models.LoginThrottle{},
+		&models.MFAPolicy{},
+		&models.MFARecoveryCode{},
+		&models.MFAChallenge{},
+		&models.WebhookSubscription{},
+		&models.WebhookDelivery{},
 	); err != nil {
 		return err
 	}
@@ -2,7 +2,9 @@ package utils
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 )
 
 // GenerateRandomToken generates a random token string
@@ -14,3 +16,21 @@ func GenerateRandomToken() string {
 	}
 	return hex.EncodeToString(bytes)
 }
+
+// NewToken returns a hex encoded token of n random bytes. Unlike GenerateRandomToken
+// it reports failures of the random source instead of returning a fixed value, so it is
+// the one to use for credentials.
+func NewToken(n int) (string, error) {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// HashToken returns the hex encoded SHA-256 hash of a token. Tokens are stored hashed
+// so that a database leak does not expose usable credentials.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
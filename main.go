@@ -1,25 +1,33 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
 	"time"
 
+	"github.com/abduls21985/exchange-rate-service/internal/cache"
 	"github.com/abduls21985/exchange-rate-service/internal/models"
+	"github.com/abduls21985/exchange-rate-service/internal/notifier"
+	"github.com/abduls21985/exchange-rate-service/internal/providers"
 	"github.com/abduls21985/exchange-rate-service/internal/repositories"
 	"github.com/abduls21985/exchange-rate-service/internal/routes"
 	"github.com/abduls21985/exchange-rate-service/internal/services"
 	"github.com/abduls21985/exchange-rate-service/internal/utils"
 	"github.com/robfig/cron/v3"
+	"github.com/shopspring/decimal"
 	"github.com/spf13/viper"
 
 	"github.com/gorilla/mux"
 )
 
 func main() {
+	// Encode rates and amounts as exact JSON numbers rather than quoted strings
+	decimal.MarshalJSONWithoutQuotes = true
+
 	// Initialize configuration
 	if err := utils.InitConfig(); err != nil {
 		log.Fatalf("Failed to initialize config: %v", err)
@@ -42,26 +50,99 @@ func main() {
 	// Initialize router
 	router := mux.NewRouter()
 
-	// Set up all routes using the routes package
-	routes.InitializeRoutes(router, utils.DB)
+	// Initialize the AuditService shared by the API, ingestion jobs and commands
+	auditOptions, err := services.AuditOptionsFromConfig()
+	if err != nil {
+		log.Fatalf("Invalid audit configuration: %v", err)
+	}
+	auditService := services.NewAuditService(repositories.NewAuditRepository(utils.DB), auditOptions)
 
-	// Initialize the ExchangeRateService
+	// Initialize the ExchangeRateService with its latest-rate cache
 	exchangeRateRepo := repositories.NewExchangeRateRepository(utils.DB)
-	exchangeRateService := services.NewExchangeRateService(exchangeRateRepo)
+	exchangeRateOptions, err := services.ExchangeRateOptionsFromConfig()
+	if err != nil {
+		log.Fatalf("Invalid conversion configuration: %v", err)
+	}
+	rateCache, err := cache.NewFromConfig()
+	if err != nil {
+		log.Fatalf("Failed to initialize rate cache: %v", err)
+	}
+	exchangeRateService := services.NewExchangeRateService(exchangeRateRepo, exchangeRateOptions, auditService, rateCache)
+
+	// Push every stored snapshot, whether from cron, manual fetches or posted rates, to stream subscribers
+	rateStream := services.NewRateStreamService(exchangeRateService, services.RateStreamOptionsFromConfig())
+	exchangeRateService.AddSnapshotListener(rateStream.Publish)
+
+	// Build the rate provider registry from configuration
+	providerRegistry, err := providers.NewRegistryFromConfig()
+	if err != nil {
+		log.Fatalf("Failed to initialize rate providers: %v", err)
+	}
+
+	// Initialize the BackfillService for loading historical rates
+	backfillRepo := repositories.NewBackfillRepository(utils.DB)
+	backfillService := services.NewBackfillService(backfillRepo, exchangeRateService, providerRegistry, services.BackfillOptionsFromConfig())
+
+	// Initialize the notifier for account emails
+	accountNotifier, err := notifier.NewAccountNotifierFromConfig()
+	if err != nil {
+		log.Fatalf("Failed to initialize notifications: %v", err)
+	}
+
+	// Read the two-factor authentication settings used by the login routes
+	mfaOptions, err := services.MFAOptionsFromConfig()
+	if err != nil {
+		log.Fatalf("Invalid MFA configuration: %v", err)
+	}
+
+	// Initialize the WebhookService; its deliveries are sent by the server
+	webhookService := services.NewWebhookService(repositories.NewWebhookRepository(utils.DB), exchangeRateService, services.NewMDAService(repositories.NewMDARepository(utils.DB)), services.WebhookOptionsFromConfig())
+
+	// Run a subcommand instead of the server when one is given
+	if len(os.Args) > 1 {
+		commandServices := commandServices{
+			backfill: backfillService,
+			audit:    auditService,
+			users:    services.NewUserService(repositories.NewUserRepository(utils.DB), repositories.NewMDARepository(utils.DB), accountNotifier),
+		}
+		if err := runCommand(os.Args[1], os.Args[2:], commandServices); err != nil {
+			log.Fatalf("%s: %v", os.Args[1], err)
+		}
+		return
+	}
+
+	// Queue webhook events for stored snapshots and failed ingestions, and send them in the background
+	exchangeRateService.AddSnapshotListener(webhookService.SnapshotsStored)
+	exchangeRateService.AddFailureListener(webhookService.IngestionFailed)
+	webhookContext, stopWebhooks := context.WithCancel(context.Background())
+	defer stopWebhooks()
+	go webhookService.Run(webhookContext)
+
+	// Relay the snapshots stored by other replicas to this one's stream subscribers
+	streamContext, stopStream := context.WithCancel(context.Background())
+	defer stopStream()
+	go rateStream.Run(streamContext)
+
+	// Set up all routes using the routes package
+	apiRouter := routes.InitializeRoutes(router, utils.DB, exchangeRateService, backfillService, auditService, rateStream, webhookService, accountNotifier, mfaOptions)
 
-	// Add a manual trigger endpoint for fetching exchange rates
-	router.HandleFunc("/api/manual-fetch", func(w http.ResponseWriter, r *http.Request) {
+	// Add a manual trigger endpoint for fetching exchange rates, restricted to rate publishers
+	apiRouter.Handle("/manual-fetch", routes.Authorize(routes.PublishRates)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Println("Manually triggering exchange rate data fetch...")
-		data, err := FetchExchangeRateData()
+
+		// Use the requested provider, falling back to the configured default
+		provider, err := providerRegistry.Default()
+		if name := r.URL.Query().Get("provider"); name != "" {
+			provider, err = providerRegistry.Get(name)
+		}
 		if err != nil {
-			log.Printf("Error fetching data: %v", err)
-			http.Error(w, "Failed to fetch exchange rates", http.StatusInternalServerError)
+			jsonResponse(w, map[string]string{"error": err.Error()}, http.StatusBadRequest)
 			return
 		}
 
-		// Call the service layer to update the exchange rates
-		if err := exchangeRateService.AddExchangeRates(*data); err != nil {
-			log.Printf("Error inserting data: %v", err)
+		data, snapshot, err := syncExchangeRates(provider, exchangeRateService)
+		if err != nil {
+			log.Printf("Error synchronising rates from %s: %v", provider.Name(), err)
 			http.Error(w, "Failed to update exchange rates", http.StatusInternalServerError)
 			return
 		}
@@ -69,27 +150,26 @@ func main() {
 		log.Println("Exchange rates updated successfully")
 		// Include both the status and the fetched data in the response
 		response := map[string]interface{}{
-			"status": "Exchange rates updated successfully",
-			"data":   data,
+			"status":      "Exchange rates updated successfully",
+			"provider":    provider.Name(),
+			"snapshot_id": snapshot.ID,
+			"data":        data,
 		}
 		jsonResponse(w, response, http.StatusOK)
-	}).Methods("GET")
+	}))).Methods("GET")
 
 	// Initialize Cron for daily data synchronization
 	c := cron.New()
 	c.AddFunc("@daily", func() {
 		log.Println("Running scheduled daily data synchronization...")
-		data, err := FetchExchangeRateData()
-		if err != nil {
-			log.Printf("Error fetching data: %v", err)
-			return
+		for _, name := range providerRegistry.Names() {
+			provider, _ := providerRegistry.Get(name)
+			if _, _, err := syncExchangeRates(provider, exchangeRateService); err != nil {
+				log.Printf("Error synchronising rates from %s: %v", name, err)
+				continue
+			}
+			log.Printf("Exchange rates from %s updated successfully", name)
 		}
-		// Call the service layer to update the exchange rates
-		if err := exchangeRateService.AddExchangeRates(*data); err != nil {
-			log.Printf("Error inserting data: %v", err)
-			return
-		}
-		log.Println("Exchange rates updated successfully")
 	})
 	c.Start()
 	defer c.Stop()
@@ -102,41 +182,22 @@ func main() {
 	}
 }
 
-// FetchExchangeRateData fetches exchange rate data from the external API
-func FetchExchangeRateData() (*models.ExchangeRateData, error) {
-	// Get the current date in the format YYYY-MM-DD
-	date := time.Now().Format("2006-01-02")
-
-	// Get the API URL and app ID from the configuration
-	apiUrl := viper.GetString("EXCHANGE_RATE_API_URL")
-	appId := viper.GetString("EXCHANGE_RATE_APP_ID")
-
-	// Construct the URL using the date, API URL, and app ID
-	url := fmt.Sprintf(apiUrl+"?app_id=%s", date, appId)
-
-	// Make the HTTP request
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch data: status code %d", resp.StatusCode)
-	}
-
-	body, err := ioutil.ReadAll(resp.Body)
+// syncExchangeRates fetches today's rates from the provider and stores them as a snapshot
+func syncExchangeRates(provider providers.RateProvider, service services.ExchangeRateService) (*models.ExchangeRateData, *models.RateSnapshot, error) {
+	data, err := provider.FetchRates(time.Now().UTC())
 	if err != nil {
-		return nil, err
+		err = fmt.Errorf("failed to fetch rates: %v", err)
+		service.ReportIngestionFailure(provider.Name(), err)
+		return nil, nil, err
 	}
 
-	var data models.ExchangeRateData
-	err = json.Unmarshal(body, &data)
+	// Call the service layer to update the exchange rates
+	snapshot, err := service.AddExchangeRates(*data)
 	if err != nil {
-		return nil, err
+		return nil, nil, fmt.Errorf("failed to store rates: %v", err)
 	}
 
-	return &data, nil
+	return data, snapshot, nil
 }
 
 // Helper function to write JSON responses
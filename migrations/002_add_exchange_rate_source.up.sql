@@ -0,0 +1,6 @@
+-- migrations/002_add_exchange_rate_source.up.sql
+
+-- Record which provider each exchange rate came from
+ALTER TABLE exchange_rates ADD COLUMN IF NOT EXISTS source VARCHAR(50);
+
+CREATE INDEX IF NOT EXISTS idx_exchange_rates_source ON exchange_rates (source);
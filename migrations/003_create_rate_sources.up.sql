@@ -0,0 +1,28 @@
+-- migrations/003_create_rate_sources.up.sql
+
+-- Table to store the providers exchange rates are ingested from
+CREATE TABLE IF NOT EXISTS rate_sources (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(50) UNIQUE NOT NULL,
+    name VARCHAR(100)
+);
+
+-- Rates stored before sources were tracked are attributed to a legacy source
+INSERT INTO rate_sources (code, name)
+SELECT DISTINCT COALESCE(source, 'legacy'), NULL FROM exchange_rates
+ON CONFLICT (code) DO NOTHING;
+
+ALTER TABLE exchange_rates ADD COLUMN IF NOT EXISTS source_id INTEGER REFERENCES rate_sources(id) ON DELETE CASCADE;
+
+UPDATE exchange_rates er
+SET source_id = rs.id
+FROM rate_sources rs
+WHERE rs.code = COALESCE(er.source, 'legacy') AND er.source_id IS NULL;
+
+ALTER TABLE exchange_rates DROP COLUMN IF EXISTS source;
+
+-- Several providers may publish a rate for the same currency at the same instant
+ALTER TABLE exchange_rates DROP CONSTRAINT IF EXISTS exchange_rates_currency_id_timestamp_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_exchange_rates_currency_timestamp_source ON exchange_rates (currency_id, timestamp, source_id);
+
+CREATE INDEX IF NOT EXISTS idx_exchange_rates_source_timestamp ON exchange_rates (source_id, timestamp);
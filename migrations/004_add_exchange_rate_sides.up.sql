@@ -0,0 +1,9 @@
+-- migrations/004_add_exchange_rate_sides.up.sql
+
+-- Buying, selling and mid rates for providers that publish a spread
+ALTER TABLE exchange_rates ADD COLUMN IF NOT EXISTS buy_rate DECIMAL(18,6);
+ALTER TABLE exchange_rates ADD COLUMN IF NOT EXISTS sell_rate DECIMAL(18,6);
+ALTER TABLE exchange_rates ADD COLUMN IF NOT EXISTS mid_rate DECIMAL(18,6);
+
+-- Existing rates only have a single value, so use it for every side
+UPDATE exchange_rates SET buy_rate = rate, sell_rate = rate, mid_rate = rate WHERE mid_rate IS NULL;
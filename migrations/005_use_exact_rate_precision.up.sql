@@ -0,0 +1,10 @@
+-- migrations/005_use_exact_rate_precision.up.sql
+
+-- Match the precision declared on the GORM models so that rates round identically
+-- whether the table was created by AutoMigrate or by these scripts. Twenty-four decimal
+-- places keep inverted quotes such as USD per NGN exact: a CBN central rate of 1534.21
+-- stored with only twelve converted 1,000,000 USD back to an amount 56 kobo short.
+ALTER TABLE exchange_rates ALTER COLUMN rate TYPE NUMERIC(40,24);
+ALTER TABLE exchange_rates ALTER COLUMN buy_rate TYPE NUMERIC(40,24);
+ALTER TABLE exchange_rates ALTER COLUMN sell_rate TYPE NUMERIC(40,24);
+ALTER TABLE exchange_rates ALTER COLUMN mid_rate TYPE NUMERIC(40,24);
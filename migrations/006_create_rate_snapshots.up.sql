@@ -0,0 +1,33 @@
+-- migrations/006_create_rate_snapshots.up.sql
+
+-- Table to store ingestion runs; every exchange rate belongs to exactly one snapshot
+CREATE TABLE IF NOT EXISTS rate_snapshots (
+    id SERIAL PRIMARY KEY,
+    source_id INTEGER NOT NULL REFERENCES rate_sources(id) ON DELETE CASCADE,
+    base_currency_id INTEGER NOT NULL REFERENCES currencies(id) ON DELETE CASCADE,
+    provider_timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
+    fetched_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    checksum VARCHAR(64),
+    rate_count INTEGER
+);
+
+-- One snapshot per publication; the name matches the index declared on the GORM model
+CREATE UNIQUE INDEX IF NOT EXISTS idx_rate_snapshots_source_timestamp ON rate_snapshots (source_id, provider_timestamp);
+
+ALTER TABLE exchange_rates ADD COLUMN IF NOT EXISTS snapshot_id INTEGER REFERENCES rate_snapshots(id) ON DELETE CASCADE;
+
+-- Group rates stored before snapshots existed into one snapshot per source and timestamp.
+-- Their checksum is left empty because the original payloads are not available.
+INSERT INTO rate_snapshots (source_id, base_currency_id, provider_timestamp, fetched_at, checksum, rate_count)
+SELECT source_id, MIN(base_currency_id), timestamp, timestamp, NULL, COUNT(*)
+FROM exchange_rates
+WHERE snapshot_id IS NULL
+GROUP BY source_id, timestamp
+ON CONFLICT (source_id, provider_timestamp) DO NOTHING;
+
+UPDATE exchange_rates er
+SET snapshot_id = rs.id
+FROM rate_snapshots rs
+WHERE er.snapshot_id IS NULL AND rs.source_id = er.source_id AND rs.provider_timestamp = er.timestamp;
+
+CREATE INDEX IF NOT EXISTS idx_exchange_rates_snapshot_id ON exchange_rates (snapshot_id);
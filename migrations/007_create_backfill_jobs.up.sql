@@ -0,0 +1,21 @@
+-- migrations/007_create_backfill_jobs.up.sql
+
+-- Table to track historical backfills so that an interrupted run can be resumed
+CREATE TABLE IF NOT EXISTS backfill_jobs (
+    id SERIAL PRIMARY KEY,
+    provider VARCHAR(50) NOT NULL,
+    start_date TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_date TIMESTAMP WITH TIME ZONE NOT NULL,
+    next_date TIMESTAMP WITH TIME ZONE NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    total_days INTEGER,
+    fetched_days INTEGER,
+    skipped_days INTEGER,
+    failed_days INTEGER,
+    failed_dates TEXT, -- JSON list of days that could not be fetched, retried on the next run
+    last_error VARCHAR(500),
+    created_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_backfill_jobs_status ON backfill_jobs (status);
@@ -0,0 +1,8 @@
+-- migrations/008_add_user_roles.up.sql
+
+-- Users registered before roles were enforced, or with an unrecognised role, become viewers
+UPDATE users SET role = 'viewer'
+WHERE role IS NULL OR role NOT IN ('viewer', 'analyst', 'rate-publisher', 'admin');
+
+ALTER TABLE users ALTER COLUMN role SET DEFAULT 'viewer';
+ALTER TABLE users ALTER COLUMN role SET NOT NULL;
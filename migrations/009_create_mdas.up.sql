@@ -0,0 +1,36 @@
+-- migrations/009_create_mdas.up.sql
+
+-- Table to store tenants (ministries, departments and agencies) and their settings
+CREATE TABLE IF NOT EXISTS mdas (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(50) NOT NULL,
+    name VARCHAR(150) NOT NULL,
+    allowed_currencies TEXT,
+    preferred_source VARCHAR(50),
+    default_base_currency VARCHAR(3),
+    max_users BIGINT,
+    daily_request_quota BIGINT,
+    created_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_mdas_code ON mdas (code);
+-- Codes are unique regardless of case, since an MDA's rate sources are named after its
+-- lower-cased code
+CREATE UNIQUE INDEX IF NOT EXISTS idx_mdas_code_upper ON mdas (UPPER(code));
+
+-- MDA codes are stored upper-cased; users may refer to one in any case
+UPDATE users SET mda_id = UPPER(TRIM(mda_id))
+WHERE mda_id IS NOT NULL AND mda_id <> UPPER(TRIM(mda_id));
+
+-- Create an MDA for every one users already refer to
+INSERT INTO mdas (code, name, created_at, updated_at)
+SELECT mda_id, COALESCE(NULLIF(MAX(mda), ''), mda_id), NOW(), NOW()
+FROM users
+WHERE mda_id IS NOT NULL AND mda_id <> ''
+GROUP BY mda_id
+ON CONFLICT (code) DO NOTHING;
+
+-- Rate sources owned by an MDA hold its custom rates; global sources have no owner
+ALTER TABLE rate_sources ADD COLUMN IF NOT EXISTS mda_id VARCHAR(50) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_rate_sources_mda_id ON rate_sources (mda_id);
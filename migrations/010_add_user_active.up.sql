@@ -0,0 +1,5 @@
+-- migrations/010_add_user_active.up.sql
+
+-- Users can be deactivated by admins instead of being deleted
+ALTER TABLE users ADD COLUMN IF NOT EXISTS active BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deactivated_at TIMESTAMP WITH TIME ZONE;
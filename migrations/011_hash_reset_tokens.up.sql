@@ -0,0 +1,5 @@
+-- migrations/011_hash_reset_tokens.up.sql
+
+-- Reset tokens are now stored as SHA-256 hashes; pending plain-text tokens are discarded
+-- and their users have to request a new reset link
+UPDATE users SET reset_token = '', reset_token_expiry = NULL WHERE reset_token IS NOT NULL AND reset_token <> '';
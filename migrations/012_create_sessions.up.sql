@@ -0,0 +1,29 @@
+-- migrations/012_create_sessions.up.sql
+
+-- Table to store login sessions and the hashes of their rotating refresh tokens
+CREATE TABLE IF NOT EXISTS sessions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    refresh_token_hash VARCHAR(64) NOT NULL,
+    previous_refresh_token_hash VARCHAR(64),
+    access_token_id VARCHAR(64),
+    access_expires_at TIMESTAMP WITH TIME ZONE,
+    user_agent VARCHAR(255),
+    ip_address VARCHAR(45),
+    created_at TIMESTAMP WITH TIME ZONE,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_refresh_token_hash ON sessions (refresh_token_hash);
+CREATE INDEX IF NOT EXISTS idx_sessions_previous_refresh_token_hash ON sessions (previous_refresh_token_hash);
+
+-- Access tokens revoked before their expiry, looked up by their jti claim
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti VARCHAR(64) PRIMARY KEY,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
@@ -0,0 +1,9 @@
+-- migrations/014_add_snapshot_attribution.up.sql
+
+-- Record who submitted a manual snapshot and why. The username is kept alongside the ID
+-- so that attribution survives the user being deleted.
+ALTER TABLE rate_snapshots ADD COLUMN IF NOT EXISTS posted_by_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE rate_snapshots ADD COLUMN IF NOT EXISTS posted_by VARCHAR(100);
+ALTER TABLE rate_snapshots ADD COLUMN IF NOT EXISTS reason VARCHAR(500);
+
+CREATE INDEX IF NOT EXISTS idx_rate_snapshots_posted_by_id ON rate_snapshots (posted_by_id);
@@ -0,0 +1,34 @@
+-- migrations/015_create_audit_events.up.sql
+
+-- Append-only, hash-chained log of rate changes, logins and admin actions
+CREATE TABLE IF NOT EXISTS audit_events (
+    id SERIAL PRIMARY KEY,
+    occurred_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    type VARCHAR(64) NOT NULL,
+    actor VARCHAR(100),
+    actor_id INTEGER,
+    mda_id VARCHAR(50) NOT NULL DEFAULT '',
+    target VARCHAR(150),
+    ip_address VARCHAR(45),
+    details TEXT,
+    prev_hash VARCHAR(64),
+    hash VARCHAR(64) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_occurred_at ON audit_events (occurred_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_type ON audit_events (type);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events (actor);
+CREATE INDEX IF NOT EXISTS idx_audit_events_mda_id ON audit_events (mda_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_audit_events_hash ON audit_events (hash);
+
+-- Reject changes to recorded events; the hash chain detects anything done around this
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
@@ -0,0 +1,13 @@
+-- migrations/016_create_login_throttles.up.sql
+
+-- Table to track failed logins per username and per client IP for throttling and lockout
+CREATE TABLE IF NOT EXISTS login_throttles (
+    kind VARCHAR(10) NOT NULL,
+    value VARCHAR(150) NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (kind, value)
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_throttles_locked_until ON login_throttles (locked_until);
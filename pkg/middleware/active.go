@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+)
+
+// RequireActiveUser rejects tokens and API keys of users that have since been
+// deactivated or deleted, so that deactivation takes effect before the token expires.
+// It must run after AuthMiddleware.
+func RequireActiveUser(isActive func(username string) (bool, error)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := PrincipalFromContext(r.Context())
+			if !ok {
+				http.Error(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+
+			active, err := isActive(principal.Username)
+			if err != nil {
+				log.Printf("Error checking status of %s: %v", principal.Username, err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if !active {
+				http.Error(w, "Account is deactivated", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -2,46 +2,104 @@ package middleware
 
 import (
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenString := r.Header.Get("Authorization")
-		if tokenString == "" {
-			http.Error(w, "Authorization header missing", http.StatusUnauthorized)
-			return
-		}
+// APIKeyHeader is the header machine clients send their API key in
+const APIKeyHeader = "X-API-Key"
 
-		if !strings.HasPrefix(tokenString, "Bearer ") {
-			http.Error(w, "Invalid Authorization format", http.StatusUnauthorized)
-			return
-		}
+// AuthMiddleware authenticates the request by a Bearer access token or an API key and
+// stores the resulting principal in the request context.
+//
+// Access tokens whose jti isRevoked reports as revoked are rejected, as are tokens
+// without a jti, which were issued before revocation existed. authenticateKey resolves
+// an API key sent from ipAddress to its principal, returning a nil principal when the
+// key is unknown, expired or not allowed from that address.
+func AuthMiddleware(isRevoked func(jti string) (bool, error), authenticateKey func(key, ipAddress string) (*Principal, error)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var principal *Principal
+			if key := r.Header.Get(APIKeyHeader); key != "" {
+				var err error
+				principal, err = authenticateKey(key, ClientIP(r))
+				if err != nil {
+					log.Printf("Error authenticating API key: %v", err)
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+					return
+				}
+				if principal == nil {
+					http.Error(w, "Invalid API key", http.StatusUnauthorized)
+					return
+				}
+			} else {
+				var status int
+				var message string
+				principal, status, message = authenticateToken(r, isRevoked)
+				if principal == nil {
+					http.Error(w, message, status)
+					return
+				}
+			}
 
-		tokenString = strings.TrimPrefix(tokenString, "Bearer ")
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
 
-		secretKey := os.Getenv("JWT_SECRET")
-		if secretKey == "" {
-			http.Error(w, "JWT secret key not configured", http.StatusInternalServerError)
-			return
-		}
+// authenticateToken validates the Bearer access token of the request. On failure it
+// returns the status and message to respond with.
+func authenticateToken(r *http.Request, isRevoked func(jti string) (bool, error)) (*Principal, int, string) {
+	tokenString := r.Header.Get("Authorization")
+	if tokenString == "" {
+		return nil, http.StatusUnauthorized, "Authorization header missing"
+	}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(secretKey), nil
-		})
+	if !strings.HasPrefix(tokenString, "Bearer ") {
+		return nil, http.StatusUnauthorized, "Invalid Authorization format"
+	}
 
-		if err != nil || !token.Valid {
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
-			return
-		}
+	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
 
-		next.ServeHTTP(w, r)
+	secretKey := os.Getenv("JWT_SECRET")
+	if secretKey == "" {
+		return nil, http.StatusInternalServerError, "JWT secret key not configured"
+	}
+
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(secretKey), nil
 	})
+
+	if err != nil || !token.Valid || claims.Id == "" {
+		return nil, http.StatusUnauthorized, "Invalid or expired token"
+	}
+
+	revoked, err := isRevoked(claims.Id)
+	if err != nil {
+		log.Printf("Error checking revocation of token %s: %v", claims.Id, err)
+		return nil, http.StatusInternalServerError, "Internal Server Error"
+	}
+	if revoked {
+		return nil, http.StatusUnauthorized, "Token has been revoked"
+	}
+
+	return &Principal{
+		Kind:           PrincipalUser,
+		UserID:         claims.UserID,
+		Username:       claims.Subject,
+		Role:           claims.Role,
+		MdaID:          claims.MdaID,
+		SessionID:      claims.SessionID,
+		TokenID:        claims.Id,
+		TokenExpiresAt: time.Unix(claims.ExpiresAt, 0),
+	}, 0, ""
 }
@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Claims are the JWT claims of an access token. Subject holds the username and UserID
+// the user's ID, MdaID the tenant the user belongs to, if any, SessionID the login
+// session that issued the token and Id (jti) the token's own identifier, used to revoke it.
+type Claims struct {
+	UserID    uint   `json:"uid,omitempty"`
+	Role      string `json:"role"`
+	MdaID     string `json:"mda_id,omitempty"`
+	SessionID uint   `json:"sid,omitempty"`
+	jwt.StandardClaims
+}
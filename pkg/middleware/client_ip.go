@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+)
+
+// ClientIP returns the IP address of the client that sent the request. Forwarding
+// headers are ignored because they can be set by the client.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
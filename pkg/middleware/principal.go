@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"context"
+	"time"
+)
+
+// PrincipalKind tells how a request was authenticated
+type PrincipalKind string
+
+const (
+	PrincipalUser   PrincipalKind = "user"    // Bearer access token from a login session
+	PrincipalAPIKey PrincipalKind = "api_key" // X-API-Key header
+)
+
+// Principal is the authenticated caller of a request, whichever credential it used. An
+// API key acts on behalf of the user who created it, limited to the key's scopes.
+type Principal struct {
+	Kind     PrincipalKind
+	UserID   uint
+	Username string
+	Role     string
+	MdaID    string
+
+	// Set for access tokens
+	SessionID      uint
+	TokenID        string
+	TokenExpiresAt time.Time
+
+	// Set for API keys
+	APIKeyID uint
+	Scopes   []string
+}
+
+// HasScope reports whether the principal may perform the action named by scope. Users
+// are only limited by their role, so the check always passes for them.
+func (p *Principal) HasScope(scope string) bool {
+	if p.Kind != PrincipalAPIKey {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey string
+
+const principalContextKey contextKey = "principal"
+
+// WithPrincipal returns a copy of ctx carrying the principal
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey, principal)
+}
+
+// PrincipalFromContext returns the principal of the authenticated request, if any
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey).(*Principal)
+	return principal, ok
+}
+
+// UserIDFromContext returns the ID of the authenticated user, or 0 when the request is
+// not authenticated
+func UserIDFromContext(ctx context.Context) uint {
+	if principal, ok := PrincipalFromContext(ctx); ok {
+		return principal.UserID
+	}
+	return 0
+}
+
+// UsernameFromContext returns the username of the authenticated user, or "" when the
+// request is not authenticated
+func UsernameFromContext(ctx context.Context) string {
+	if principal, ok := PrincipalFromContext(ctx); ok {
+		return principal.Username
+	}
+	return ""
+}
+
+// RoleFromContext returns the role of the authenticated user, or "" when the request is
+// not authenticated
+func RoleFromContext(ctx context.Context) string {
+	if principal, ok := PrincipalFromContext(ctx); ok {
+		return principal.Role
+	}
+	return ""
+}
+
+// TenantFromContext returns the MDA of the authenticated user, or "" for platform users
+// and unauthenticated requests
+func TenantFromContext(ctx context.Context) string {
+	if principal, ok := PrincipalFromContext(ctx); ok {
+		return principal.MdaID
+	}
+	return ""
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+)
+
+// TenantQuota counts each request against the caller's tenant by calling consume with
+// the tenant ID of the principal, rejecting the request when consume returns an error.
+// It must run after AuthMiddleware.
+func TenantQuota(consume func(mdaID string) error) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if principal, ok := PrincipalFromContext(r.Context()); ok {
+				if err := consume(principal.MdaID); err != nil {
+					log.Printf("Request from MDA %s rejected: %v", principal.MdaID, err)
+					http.Error(w, err.Error(), http.StatusTooManyRequests)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}